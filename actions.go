@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/radar"
+)
+
+// checkActorActions validates the per-actor action mappings of a zone against
+// the configured switches.
+func (b *Beaves) checkActorActions(z *Zone) error {
+	for actor, m := range z.Actions {
+		for action, actions := range m {
+			if action != radar.Entering.String() && action != radar.Exiting.String() {
+				return fmt.Errorf("actions of %s: unknown action %q", actor, action)
+			}
+			for _, a := range actions {
+				if a.Group != "" {
+					if _, ok := group(a.Group); !ok {
+						return fmt.Errorf("actions of %s refer to unknown group %q", actor, a.Group)
+					}
+					continue
+				}
+				if a.Pattern != "" {
+					if _, ok := b.Patterns[a.Pattern]; !ok {
+						return fmt.Errorf("actions of %s refer to unknown pattern %q", actor, a.Pattern)
+					}
+					continue
+				}
+				if _, ok := b.Switches[a.Switch]; !ok {
+					return fmt.Errorf("actions of %s refer to unknown switch %q", actor, a.Switch)
+				}
+				switch strings.ToLower(a.Command) {
+				case "on", "off", "toggle":
+				case "press":
+					if a.Switch != z.Actuator.Name() {
+						return fmt.Errorf("actions of %s: only the managed switch %q can be pressed", actor, z.Actuator.Name())
+					}
+				default:
+					return fmt.Errorf("actions of %s: unknown command %q", actor, a.Command)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// actorActions returns what the actor of an event has mapped its action to,
+// and false if it has no mapping for it.
+func actorActions(mappings map[string]config.ActorActions, event *radar.Event) ([]config.ActorAction, bool) {
+	for id, m := range mappings {
+		if strings.EqualFold(string(event.Actor.ID), id) {
+			actions, ok := m[event.Action.String()]
+			return actions, ok
+		}
+	}
+	return nil, false
+}
+
+// Perform carries out the actions the actor of an event received at since has
+// mapped its action to in a zone, as automation. It reports false if there is
+// no mapping, leaving the event to drive the zone's managed switch.
+func (b *Beaves) Perform(z *Zone, event *radar.Event, since time.Time) bool {
+	actions, ok := actorActions(z.Actions, event)
+	if !ok {
+		return false
+	}
+	cause := audit.Cause{Kind: "presence", By: event.Actor.DisplayName()}
+	for _, a := range actions {
+		if a.Group != "" {
+			// NOTE: its delays would hold up presence handling
+			go func() {
+				if err := b.AutomateGroup(a.Group, cause); err != nil {
+					log.Error(err.Error())
+				}
+			}()
+			continue
+		}
+		if a.Pattern != "" {
+			go func() {
+				if err := b.AutomatePlay(a.Pattern, cause); err != nil {
+					log.Error(err.Error())
+				}
+			}()
+			continue
+		}
+		if !b.automatic(a.Switch, cause) {
+			continue
+		}
+		var err error
+		if strings.EqualFold(a.Command, "press") {
+			// NOTE: pressed as the event would press it, with the delays
+			// and checks of its action
+			var queued bool
+			if queued, err = b.Operate(z, event.Action, event.Actor.ID, since, cause, nil); err == nil && !queued {
+				err = fmt.Errorf("switch %q was pressed too recently", a.Switch)
+			}
+		} else {
+			err = b.Command(a.Switch, a.Command, cause)
+		}
+		if err != nil {
+			log.Error(err.Error())
+		}
+	}
+	return true
+}
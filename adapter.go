@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/radar"
+)
+
+// configuredAdapters keeps the adapter of every zone's sentry for the status
+// API before the sentries are set up, so one that is missing or whose sentry
+// failed is still reported, as not present.
+func (b *Beaves) configuredAdapters() {
+	for _, s := range sentryConfigs() {
+		if slices.ContainsFunc(b.Adapters, func(a *radar.BlueZAdapter) bool { return a.ID() == s.Adapter }) {
+			continue
+		}
+		a, err := radar.NewBlueZAdapter(s.Adapter)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		b.Adapters = append(b.Adapters, a)
+	}
+}
+
+// adapter keeps a sentry's adapter for the status API in place of the
+// configured one, logging what it is and what it runs on.
+func (b *Beaves) adapter(a *radar.BlueZAdapter) {
+	if i := slices.IndexFunc(b.Adapters, func(c *radar.BlueZAdapter) bool { return c.ID() == a.ID() }); i >= 0 {
+		b.Adapters[i] = a
+	} else {
+		b.Adapters = append(b.Adapters, a)
+	}
+	info, err := a.Info()
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	log.Info(info.String())
+}
+
+// AdapterInfo reads every sentry's adapter as it is now.
+func (b *Beaves) AdapterInfo() []radar.AdapterInfo {
+	infos := []radar.AdapterInfo{}
+	for _, a := range b.Adapters {
+		info, err := a.Info()
+		if err != nil {
+			log.Error(err.Error())
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
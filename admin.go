@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+// Delta is a config change pushed by an admin device.
+type Delta struct {
+	Sequence    uint64         `json:"sequence"`    // must be higher than the last applied
+	AddKnown    []string       `json:"addKnown"`    // actors to add to actors.known
+	RemoveKnown []string       `json:"removeKnown"` // actors to remove from actors.known
+	Set         map[string]any `json:"set"`         // merged into the config; null removes a field
+}
+
+var deltaLock sync.Mutex
+
+// deltaPaths are the parts of the config an admin device may set. Anything
+// naming a command, script, file or key is left out, as the admin device
+// must not be able to make beaves run code or read files of its choosing.
+var deltaPaths = []string{
+	"actors.names",
+	"actors.priority",
+	"actors.conflict",
+	"bluetooth.advertisementName",
+	"bluetooth.adapterAlias",
+	"bluetooth.advertisementDelayMs",
+	"bluetooth.advertisementPauseMs",
+	"bluetooth.advertisementIntervalMs",
+	"bluetooth.txPowerDbm",
+	"bluetooth.occupied",
+	"bluetooth.reserved",
+	"profile",
+	"operationDelayMs",
+	"eventLoopDelayMs",
+	"arrivalDwellMs",
+	"coalesceMs",
+	"unseen",
+	"lowPower",
+}
+
+// checkPaths refuses a patch setting anything outside deltaPaths.
+func checkPaths(patch map[string]any, prefix string) error {
+	for k, v := range patch {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if slices.Contains(deltaPaths, path) {
+			continue
+		}
+		sub, ok := v.(map[string]any)
+		if !ok || !slices.ContainsFunc(deltaPaths, func(p string) bool { return strings.HasPrefix(p, path+".") }) {
+			return fmt.Errorf("%s may not be changed by the admin device", path)
+		}
+		if err := checkPaths(sub, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge applies patch to doc the way a JSON merge patch (RFC 7386) does.
+func merge(doc map[string]any, patch map[string]any) {
+	for k, v := range patch {
+		if v == nil {
+			delete(doc, k)
+			continue
+		}
+		sub, ok := v.(map[string]any)
+		if !ok {
+			doc[k] = v
+			continue
+		}
+		inner, ok := doc[k].(map[string]any)
+		if !ok {
+			inner = map[string]any{}
+		}
+		merge(inner, sub)
+		doc[k] = inner
+	}
+}
+
+func object(doc map[string]any, key string) map[string]any {
+	o, ok := doc[key].(map[string]any)
+	if !ok {
+		o = map[string]any{}
+		doc[key] = o
+	}
+	return o
+}
+
+// applyDelta validates a change against the config file and writes it,
+// keeping the previous file, then restarts beaves to load it.
+func applyDelta(message []byte) error {
+	deltaLock.Lock()
+	defer deltaLock.Unlock()
+	d := Delta{}
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+	if err := decoder.Decode(&d); err != nil {
+		return fmt.Errorf("invalid change: %w", err)
+	}
+	if err := checkPaths(d.Set, ""); err != nil {
+		return err
+	}
+	last := config.RuntimeConfig.Bluetooth.Admin.Sequence
+	if d.Sequence <= last {
+		return fmt.Errorf("change %d is not newer than %d", d.Sequence, last)
+	}
+	data, err := os.ReadFile(config.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	doc := map[string]any{}
+	decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	merge(doc, d.Set)
+	actors := object(doc, "actors")
+	known := []string{}
+	if list, ok := actors["known"].([]any); ok {
+		for _, id := range list {
+			if s, ok := id.(string); ok {
+				known = append(known, s)
+			}
+		}
+	}
+	for _, id := range d.AddKnown {
+		if !slices.ContainsFunc(known, func(k string) bool { return strings.EqualFold(k, id) }) {
+			known = append(known, id)
+		}
+	}
+	known = slices.DeleteFunc(known, func(k string) bool {
+		return slices.ContainsFunc(d.RemoveKnown, func(id string) bool { return strings.EqualFold(k, id) })
+	})
+	actors["known"] = known
+	object(object(doc, "bluetooth"), "admin")["sequence"] = d.Sequence
+	data, err = json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if _, err := decodeConfig(data); err != nil {
+		return err
+	}
+	if err := writeConfig(append(data, '\n')); err != nil {
+		return err
+	}
+	config.RuntimeConfig.Bluetooth.Admin.Sequence = d.Sequence
+	log.Info("applied config change %d from the admin device", d.Sequence)
+	go func() {
+		// NOTE: give the status a moment to reach the admin device
+		time.Sleep(time.Second)
+		if err := Restart(); err != nil {
+			log.Error(err.Error())
+		}
+	}()
+	return nil
+}
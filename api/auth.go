@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type tokenKey struct{}
+
+// tokenFrom returns the token a request was authorized with, if tokens are
+// required.
+func tokenFrom(r *http.Request) (Token, bool) {
+	token, ok := r.Context().Value(tokenKey{}).(Token)
+	return token, ok
+}
+
+// allowed reports whether a request may use scope: its token must grant it,
+// and control needs a verified client certificate when a client CA is set.
+func (s *Server) allowed(r *http.Request, scope Scope) bool {
+	if scope == Control && s.tls.ClientCA != "" && !verified(r) {
+		return false
+	}
+	token, ok := tokenFrom(r)
+	return !ok || token.Scope.Allows(scope)
+}
+
+// bearer extracts the token from the Authorization header, or from the token
+// query parameter for clients that can't set headers (e.g. browser sockets).
+func bearer(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authorize rejects requests without a valid token, and anything but reads
+// from read-only tokens or clients without a required certificate. Clients
+// are rate limited by address and by token, and addresses that keep failing
+// are locked out for a while.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr := host(r)
+		if until, locked := s.limits.Locked(addr); locked {
+			writeLimited(w, time.Until(until), "too many failed attempts")
+			return
+		}
+		if !s.limits.Allow(addr) {
+			writeLimited(w, time.Minute, "too many requests")
+			return
+		}
+		if s.tokens != nil {
+			token, ok := s.tokens.Check(bearer(r))
+			if !ok {
+				s.limits.Fail(addr)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="beaves"`)
+				writeError(w, http.StatusUnauthorized, "missing or invalid token")
+				return
+			}
+			if !s.limits.Allow("token " + token.ID) {
+				writeLimited(w, time.Minute, "too many requests")
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), tokenKey{}, token))
+		}
+		need := Control
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			need = Read
+		}
+		if !s.allowed(r, need) {
+			s.limits.Fail(addr)
+			writeError(w, http.StatusForbidden, "token or client certificate does not allow control")
+			return
+		}
+		s.limits.Succeed(addr)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limit applies the rate limits to a command arriving on an open connection.
+func (s *Server) limit(r *http.Request) bool {
+	if token, ok := tokenFrom(r); ok && !s.limits.Allow("token "+token.ID) {
+		return false
+	}
+	return s.limits.Allow(host(r))
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultRatePerMinute = 120
+	DefaultRateBurst     = 20
+	DefaultMaxFailures   = 5
+	DefaultLockoutMs     = 300000
+	DefaultBansFile      = "bans.json"
+
+	RateLimited = "RateLimited"
+	LockedOut   = "LockedOut"
+)
+
+// bucket tracks one client: a token bucket of requests and its recent
+// failed authentications.
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	limited  bool // already reported as rate limited
+	failures int
+	locked   time.Time // locked out until
+}
+
+// limiter rate limits clients, keyed by address or token, and locks out
+// addresses that keep failing to authenticate.
+type limiter struct {
+	rate        float64 // tokens per second
+	burst       float64
+	maxFailures int
+	lockout     time.Duration
+	trip        func(client, action string)
+	path        string // where lockouts are kept across restarts
+
+	buckets map[string]*bucket
+	swept   time.Time
+	lock    sync.Mutex
+}
+
+func (l *limiter) String() string {
+	return fmt.Sprintf("Limiter {rate: %.2f/s, burst: %.0f, clients: %d}", l.rate, l.burst, len(l.buckets))
+}
+
+// get must be called with the lock held.
+func (l *limiter) get(key string, now time.Time) *bucket {
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			idle := b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst
+			if idle && b.failures == 0 && now.After(b.locked) {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// Locked reports whether key is locked out, and until when.
+func (l *limiter) Locked(key string) (time.Time, bool) {
+	if l == nil {
+		return time.Time{}, false
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	b, ok := l.buckets[key]
+	if !ok || time.Now().After(b.locked) {
+		return time.Time{}, false
+	}
+	return b.locked, true
+}
+
+// Allow takes a request from key's bucket, reporting the first request
+// refused after a run of allowed ones.
+func (l *limiter) Allow(key string) bool {
+	if l == nil {
+		return true
+	}
+	now := time.Now()
+	l.lock.Lock()
+	b := l.get(key, now)
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		l.lock.Unlock()
+		return true
+	}
+	report := !b.limited
+	b.limited = true
+	l.lock.Unlock()
+	if report {
+		l.trip(key, RateLimited)
+	}
+	return false
+}
+
+// Fail counts a failed authentication from key, locking it out once it has
+// failed too often.
+func (l *limiter) Fail(key string) {
+	if l == nil || l.maxFailures <= 0 {
+		return
+	}
+	now := time.Now()
+	l.lock.Lock()
+	b := l.get(key, now)
+	b.failures++
+	locked := b.failures >= l.maxFailures
+	var bans map[string]time.Time
+	if locked {
+		b.failures = 0
+		b.locked = now.Add(l.lockout)
+		bans = l.bans(now)
+	}
+	l.lock.Unlock()
+	if locked {
+		if err := l.save(bans); err != nil {
+			log.Error(err.Error())
+		}
+		l.trip(key, LockedOut)
+	}
+}
+
+// bans must be called with the lock held. It lists the keys locked out, and
+// until when.
+func (l *limiter) bans(now time.Time) map[string]time.Time {
+	bans := map[string]time.Time{}
+	for k, b := range l.buckets {
+		if b.locked.After(now) {
+			bans[k] = b.locked
+		}
+	}
+	return bans
+}
+
+// save writes the lockouts to a temporary file and renames it over path, like
+// the state file.
+func (l *limiter) save(bans map[string]time.Time) error {
+	data, err := json.Marshal(bans)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save lockouts: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save lockouts: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save lockouts: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("failed to save lockouts: %w", err)
+	}
+	return nil
+}
+
+// restore locks out again the keys still locked out when lockouts were last
+// saved; a missing file restores none.
+func (l *limiter) restore() error {
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read lockouts %s: %w", l.path, err)
+	}
+	bans := map[string]time.Time{}
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return fmt.Errorf("failed to decode lockouts %s: %w", l.path, err)
+	}
+	now := time.Now()
+	for k, until := range bans {
+		if until.After(now) {
+			l.get(k, now).locked = until
+		}
+	}
+	return nil
+}
+
+// Succeed forgets key's failed authentications.
+func (l *limiter) Succeed(key string) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.failures = 0
+	}
+}
+
+// host is the address a request came from, without its port.
+func host(r *http.Request) string {
+	h, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return h
+}
+
+func writeLimited(w http.ResponseWriter, retry time.Duration, msg string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+	writeError(w, http.StatusTooManyRequests, msg)
+}
+
+// newLimiter returns nil, which allows everything, when rate limiting is
+// disabled with a negative rate.
+func newLimiter(c config.RateLimit, trip func(client, action string)) *limiter {
+	if c.PerMinute < 0 {
+		return nil
+	}
+	rate := c.PerMinute
+	if rate == 0 {
+		rate = DefaultRatePerMinute
+	}
+	burst := c.Burst
+	if burst <= 0 {
+		burst = DefaultRateBurst
+	}
+	failures := c.MaxFailures
+	if failures == 0 {
+		failures = DefaultMaxFailures
+	}
+	lockout := c.LockoutMs
+	if lockout <= 0 {
+		lockout = DefaultLockoutMs
+	}
+	l := &limiter{
+		rate:        float64(rate) / 60,
+		burst:       float64(burst),
+		maxFailures: failures,
+		lockout:     time.Duration(lockout) * time.Millisecond,
+		trip:        trip,
+		path:        config.StatePath("", DefaultBansFile),
+		buckets:     map[string]*bucket{},
+	}
+	if err := l.restore(); err != nil {
+		log.Error(err.Error())
+	}
+	return l
+}
@@ -0,0 +1,624 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/clock"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/history"
+	"github.com/robolivable/beaves/latency"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/profile"
+	"github.com/robolivable/beaves/radar"
+	"github.com/robolivable/beaves/report"
+	"github.com/robolivable/beaves/supervisor"
+	"github.com/robolivable/beaves/version"
+)
+
+type Server struct {
+	presence *radar.PresenceTable
+	zones    map[string]*radar.PresenceTable
+	agent    *radar.Agent
+	events   *bus.Bus
+	monitor  *controller.Monitor
+	battery  *controller.Battery
+	latency  *latency.Recorder
+	seen     func() []radar.Seen
+	adapters func() []radar.AdapterInfo
+	status   func() []supervisor.Status // of the components, when served
+	switches map[string]controller.Switch
+	profiles *profile.Manager
+	command  Commander
+
+	trace *radar.BTTrace
+
+	overrides *controller.Overrides
+	overrider Overrider
+	fallback  time.Duration // pin duration when a request gives none
+
+	history *history.Store
+	purge   Purger
+
+	groups   []config.Group
+	sequence Sequencer
+	patterns []config.Pattern
+	play     Sequencer
+
+	tokens  *Tokens // required on every request when set
+	origins []string
+	tls     config.TLS
+	limits  *limiter
+
+	mux  *http.ServeMux
+	http *http.Server
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("api: failed to encode response: %s", err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// UserHeader names the local user running a CLI command, for the audit log.
+const UserHeader = "X-Beaves-User"
+
+// VersionHeader carries the build of the running sentry on health responses.
+const VersionHeader = "X-Beaves-Version"
+
+// DegradedHeader lists the components the running sentry does without on
+// health responses.
+const DegradedHeader = "X-Beaves-Degraded"
+
+// cause attributes a request to its client and token, and to the CLI user it
+// names.
+func cause(r *http.Request, kind string) audit.Cause {
+	by := r.RemoteAddr
+	if token, ok := tokenFrom(r); ok {
+		by = token.Name + "@" + by
+	}
+	if user := r.Header.Get(UserHeader); user != "" {
+		return audit.Cause{Kind: "cli", By: user + " as " + by}
+	}
+	return audit.Cause{Kind: kind, By: by}
+}
+
+func (s *Server) handlePresence(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.presence.Snapshot())
+}
+
+func (s *Server) handleActorPresence(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.presence.Get(radar.ID(r.PathValue("actor")))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown actor")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// zone returns the presence of the requested zone, answering 404 for an
+// unknown one.
+func (s *Server) zone(w http.ResponseWriter, r *http.Request) (*radar.PresenceTable, bool) {
+	presence, ok := s.zones[r.PathValue("zone")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown zone")
+	}
+	return presence, ok
+}
+
+func (s *Server) handleZonePresence(w http.ResponseWriter, r *http.Request) {
+	if presence, ok := s.zone(w, r); ok {
+		writeJSON(w, http.StatusOK, presence.Snapshot())
+	}
+}
+
+func (s *Server) handleZoneActorPresence(w http.ResponseWriter, r *http.Request) {
+	presence, ok := s.zone(w, r)
+	if !ok {
+		return
+	}
+	p, ok := presence.Get(radar.ID(r.PathValue("actor")))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown actor")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// Zones serves the presence of each zone by name, the main one included.
+func (s *Server) Zones(zones map[string]*radar.PresenceTable) {
+	s.zones = zones
+	s.mux.HandleFunc("GET /zones/{zone}/presence", s.handleZonePresence)
+	s.mux.HandleFunc("GET /zones/{zone}/presence/{actor}", s.handleZoneActorPresence)
+}
+
+// handleFlushLog summarizes suppressed log repeats now.
+func (s *Server) handleFlushLog(w http.ResponseWriter, r *http.Request) {
+	log.Flush()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleBluetoothTrace(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.trace.Entries())
+}
+
+// BluetoothTrace serves the low level BLE trace.
+func (s *Server) BluetoothTrace(trace *radar.BTTrace) {
+	s.trace = trace
+	s.mux.HandleFunc("GET /bluetooth/trace", s.handleBluetoothTrace)
+}
+
+func (s *Server) handleBluetoothRejections(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, radar.Rejections())
+}
+
+// BluetoothRejections serves the counts of refused authenticated writes.
+func (s *Server) BluetoothRejections() {
+	s.mux.HandleFunc("GET /bluetooth/rejections", s.handleBluetoothRejections)
+}
+
+func (s *Server) handlePairing(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.agent.Pending())
+}
+
+func (s *Server) handlePairingDecision(accept bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.agent.Resolve(r.PathValue("address"), accept); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Pairing exposes the pairing agent's pending requests for confirmation.
+func (s *Server) Pairing(agent *radar.Agent) {
+	s.agent = agent
+	s.mux.HandleFunc("GET /pairing", s.handlePairing)
+	s.mux.HandleFunc("POST /pairing/{address}/confirm", s.handlePairingDecision(true))
+	s.mux.HandleFunc("POST /pairing/{address}/reject", s.handlePairingDecision(false))
+}
+
+// degraded names the components that failed to start.
+func (s *Server) degraded() []string {
+	names := []string{}
+	if s.status == nil {
+		return names
+	}
+	for _, c := range s.status() {
+		if c.State == supervisor.Degraded {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(VersionHeader, version.Get().String())
+	health := []controller.Health{}
+	if s.monitor != nil {
+		health = s.monitor.Snapshot()
+	}
+	status := http.StatusOK
+	if degraded := s.degraded(); len(degraded) > 0 {
+		w.Header().Set(DegradedHeader, strings.Join(degraded, ","))
+		status = http.StatusServiceUnavailable
+	}
+	for _, h := range health {
+		if !h.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, status, health)
+}
+
+func (s *Server) handleSwitchHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(VersionHeader, version.Get().String())
+	if s.monitor == nil {
+		writeError(w, http.StatusNotFound, "unknown switch")
+		return
+	}
+	h, ok := s.monitor.Get(r.PathValue("switch"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown switch")
+		return
+	}
+	status := http.StatusOK
+	if !h.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, h)
+}
+
+type SwitchStatus struct {
+	Name              string          `json:"name"`
+	State             string          `json:"state"`
+	Cycles            uint64          `json:"cycles"`
+	MaintenanceCycles uint64          `json:"maintenanceCycles,omitempty"`
+	Override          *controller.Pin `json:"override,omitempty"`
+}
+
+func (s *Server) handleSwitches(w http.ResponseWriter, r *http.Request) {
+	out := []SwitchStatus{}
+	for name, sw := range s.switches {
+		st := SwitchStatus{Name: name, State: sw.State().String()}
+		if c, ok := controller.Find[*controller.Counter](sw); ok {
+			st.Cycles, st.MaintenanceCycles = c.Cycles(), c.Limit()
+		}
+		if s.overrides != nil {
+			if p, ok := s.overrides.Get(name); ok {
+				st.Override = &p
+			}
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	writeJSON(w, http.StatusOK, out)
+}
+
+// Switches exposes switch states and wear.
+func (s *Server) Switches(switches map[string]controller.Switch) {
+	s.switches = switches
+	s.mux.HandleFunc("GET /switches", s.handleSwitches)
+}
+
+type ProfileStatus struct {
+	Active   *profile.Active `json:"active"`
+	Profiles []string        `json:"profiles"`
+}
+
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ProfileStatus{Active: s.profiles.Active(), Profiles: s.profiles.Names()})
+}
+
+func (s *Server) handleSetProfile(w http.ResponseWriter, r *http.Request) {
+	if err := s.profiles.Set(r.PathValue("name"), "api"); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.handleProfile(w, r)
+}
+
+// Profiles exposes the active profile and switches between them.
+func (s *Server) Profiles(profiles *profile.Manager) {
+	s.profiles = profiles
+	s.mux.HandleFunc("GET /profile", s.handleProfile)
+	s.mux.HandleFunc("PUT /profile/{name}", s.handleSetProfile)
+}
+
+// Overrider pins switches against automation and releases them.
+type Overrider interface {
+	Override(name string, state controller.State, duration time.Duration, cause audit.Cause) error
+	ClearOverride(name string, cause audit.Cause) error
+}
+
+type OverrideRequest struct {
+	State      string `json:"state"`      // "on" or "off"
+	DurationMs *int   `json:"durationMs"` // unset uses the configured duration; 0 pins until cleared
+}
+
+func (s *Server) handleOverrides(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.overrides.Snapshot())
+}
+
+func (s *Server) handleSetOverride(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("switch")
+	if _, ok := s.switches[name]; !ok {
+		writeError(w, http.StatusNotFound, "unknown switch")
+		return
+	}
+	req := OverrideRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid override: "+err.Error())
+		return
+	}
+	var state controller.State
+	switch strings.ToLower(req.State) {
+	case "on":
+		state = controller.On
+	case "off":
+		state = controller.Off
+	default:
+		writeError(w, http.StatusBadRequest, "state must be on or off")
+		return
+	}
+	duration := s.fallback
+	if req.DurationMs != nil {
+		duration = time.Duration(*req.DurationMs) * time.Millisecond
+	}
+	if err := s.overrider.Override(name, state, duration, cause(r, "api")); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	p, _ := s.overrides.Get(name)
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleClearOverride(w http.ResponseWriter, r *http.Request) {
+	if err := s.overrider.ClearOverride(r.PathValue("switch"), cause(r, "api")); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const (
+	DefaultStatsDays = 7
+	MaxStatsDays     = 90
+)
+
+// stats computes the statistics of every actor over the days requested with
+// ?days=, today included, writing the error response if it can't.
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) (map[string]*report.Actor, bool) {
+	days := DefaultStatsDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxStatsDays {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("days must be 1 to %d", MaxStatsDays))
+			return nil, false
+		}
+		days = n
+	}
+	today := clock.Local(time.Now())
+	from := time.Date(today.Year(), today.Month(), today.Day()-days+1, 0, 0, 0, 0, today.Location())
+	events, err := s.history.Read(from)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return report.Actors(events, from, days), true
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if actors, ok := s.stats(w, r); ok {
+		writeJSON(w, http.StatusOK, actors)
+	}
+}
+
+func (s *Server) handleActorStats(w http.ResponseWriter, r *http.Request) {
+	actors, ok := s.stats(w, r)
+	if !ok {
+		return
+	}
+	a, ok := actors[r.PathValue("actor")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown actor")
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+// Stats serves per-actor occupancy statistics computed from the history.
+func (s *Server) Stats(store *history.Store) {
+	s.history = store
+	s.mux.HandleFunc("GET /stats", s.handleStats)
+	s.mux.HandleFunc("GET /stats/{actor}", s.handleActorStats)
+}
+
+func (s *Server) handleLatency(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.latency.Snapshot())
+}
+
+func (s *Server) handleActorLatency(w http.ResponseWriter, r *http.Request) {
+	stages, ok := s.latency.Snapshot()[r.PathValue("actor")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown actor")
+		return
+	}
+	writeJSON(w, http.StatusOK, stages)
+}
+
+// Latency serves per-actor histograms of detection and actuation latency.
+func (s *Server) Latency(recorder *latency.Recorder) {
+	s.latency = recorder
+	s.mux.HandleFunc("GET /latency", s.handleLatency)
+	s.mux.HandleFunc("GET /latency/{actor}", s.handleActorLatency)
+}
+
+func (s *Server) handleSeen(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.seen())
+}
+
+func (s *Server) handleActorSeen(w http.ResponseWriter, r *http.Request) {
+	actor := r.PathValue("actor")
+	for _, seen := range s.seen() {
+		if strings.EqualFold(string(seen.Actor), actor) || strings.EqualFold(seen.Name, actor) {
+			writeJSON(w, http.StatusOK, seen)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "unknown actor")
+}
+
+// Seen serves when each actor was last detected, by ID or name.
+func (s *Server) Seen(seen func() []radar.Seen) {
+	s.seen = seen
+	s.mux.HandleFunc("GET /seen", s.handleSeen)
+	s.mux.HandleFunc("GET /seen/{actor}", s.handleActorSeen)
+}
+
+// Purger removes everything stored about an actor, reporting how many records
+// it removed from each store, or ErrUnknownActor.
+type Purger func(actor string, cause audit.Cause) (map[string]int, error)
+
+var ErrUnknownActor = errors.New("unknown actor")
+
+func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request) {
+	if token, ok := tokenFrom(r); !ok || !token.Scope.Allows(Admin) {
+		writeError(w, http.StatusForbidden, "purging needs an admin token")
+		return
+	}
+	removed, err := s.purge(r.PathValue("actor"), cause(r, "api"))
+	if errors.Is(err, ErrUnknownActor) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, removed)
+}
+
+// Purge deletes the stored data of an actor on request.
+func (s *Server) Purge(purge Purger) {
+	s.purge = purge
+	s.mux.HandleFunc("DELETE /actors/{actor}/data", s.handlePurge)
+}
+
+// Sequencer runs the steps of the named group or pattern in order.
+type Sequencer func(name string, cause audit.Cause) error
+
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.groups)
+}
+
+func (s *Server) handleRunGroup(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.ContainsFunc(s.groups, func(g config.Group) bool { return g.Name == name }) {
+		writeError(w, http.StatusNotFound, "unknown group")
+		return
+	}
+	if err := s.sequence(name, cause(r, "api")); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Groups exposes the switch groups and runs them, answering once a group has
+// finished.
+func (s *Server) Groups(groups []config.Group, sequence Sequencer) {
+	s.groups, s.sequence = groups, sequence
+	if s.groups == nil {
+		s.groups = []config.Group{}
+	}
+	s.mux.HandleFunc("GET /groups", s.handleGroups)
+	s.mux.HandleFunc("POST /groups/{name}", s.handleRunGroup)
+}
+
+func (s *Server) handlePatterns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.patterns)
+}
+
+func (s *Server) handlePlayPattern(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.ContainsFunc(s.patterns, func(p config.Pattern) bool { return p.Name == name }) {
+		writeError(w, http.StatusNotFound, "unknown pattern")
+		return
+	}
+	if err := s.play(name, cause(r, "api")); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Patterns exposes the switch patterns and plays them, answering once a
+// pattern has finished.
+func (s *Server) Patterns(patterns []config.Pattern, play Sequencer) {
+	s.patterns, s.play = patterns, play
+	if s.patterns == nil {
+		s.patterns = []config.Pattern{}
+	}
+	s.mux.HandleFunc("GET /patterns", s.handlePatterns)
+	s.mux.HandleFunc("POST /patterns/{name}", s.handlePlayPattern)
+}
+
+// Overrides exposes manual pins and sets or clears them.
+func (s *Server) Overrides(overrides *controller.Overrides, overrider Overrider, fallback time.Duration) {
+	s.overrides, s.overrider, s.fallback = overrides, overrider, fallback
+	s.mux.HandleFunc("GET /overrides", s.handleOverrides)
+	s.mux.HandleFunc("PUT /overrides/{switch}", s.handleSetOverride)
+	s.mux.HandleFunc("DELETE /overrides/{switch}", s.handleClearOverride)
+}
+
+// Health exposes the switch self-test results.
+func (s *Server) Health(monitor *controller.Monitor) {
+	s.monitor = monitor
+	s.mux.HandleFunc("GET /health", s.handleHealth)
+	s.mux.HandleFunc("GET /health/{switch}", s.handleSwitchHealth)
+}
+
+func (s *Server) handleAdapters(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.adapters())
+}
+
+// Adapters exposes the Bluetooth adapters and the stack they run on.
+func (s *Server) Adapters(adapters func() []radar.AdapterInfo) {
+	s.adapters = adapters
+	s.mux.HandleFunc("GET /bluetooth/adapters", s.handleAdapters)
+}
+
+func (s *Server) handleBattery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.battery.Get())
+}
+
+// Battery exposes the supply voltage last read.
+func (s *Server) Battery(battery *controller.Battery) {
+	s.battery = battery
+	s.mux.HandleFunc("GET /battery", s.handleBattery)
+}
+
+func (s *Server) handleComponents(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// Components exposes how the supervised components are doing.
+func (s *Server) Components(status func() []supervisor.Status) {
+	s.status = status
+	s.mux.HandleFunc("GET /components", s.handleComponents)
+}
+
+// trip reports a client that hit a rate limit or was locked out.
+func (s *Server) trip(client, action string) {
+	log.Info("api: %s %s", action, client)
+	if s.events != nil {
+		s.events.Publish(bus.Event{Kind: bus.Security, Name: client, Action: action})
+	}
+}
+
+func (s *Server) Serve() error {
+	if s.tls.Cert == "" {
+		log.Info("api listening on %s", s.http.Addr)
+		return s.http.ListenAndServe()
+	}
+	tc, err := tlsConfig(s.tls)
+	if err != nil {
+		return err
+	}
+	s.http.TLSConfig = tc
+	log.Info("api listening on %s with tls", s.http.Addr)
+	return s.http.ListenAndServeTLS("", "")
+}
+
+func NewServer(c config.API, presence *radar.PresenceTable) *Server {
+	s := &Server{presence: presence, tls: c.TLS, origins: c.Origins, mux: http.NewServeMux()}
+	s.limits = newLimiter(c.RateLimit, s.trip)
+	if c.TokenRequired() {
+		s.tokens = NewTokens(config.StatePath(c.TokensFile, DefaultTokensFile))
+	} else {
+		log.Error("api: requireToken is off; anyone on the network can drive the switches")
+	}
+	s.mux.HandleFunc("GET /presence", s.handlePresence)
+	s.mux.HandleFunc("GET /presence/{actor}", s.handleActorPresence)
+	s.mux.HandleFunc("POST /log/flush", s.handleFlushLog)
+	s.http = &http.Server{Addr: c.Address, Handler: s.authorize(s.mux)}
+	return s
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/log"
+)
+
+// eventFilter matches events against a list like "presence:Entering,switch",
+// each a kind optionally narrowed by action and direction, as in triggers. An
+// empty filter matches everything.
+type eventFilter [][3]string
+
+func parseFilter(filter string) eventFilter {
+	f := eventFilter{}
+	for _, part := range strings.Split(filter, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		kind, action, _ := strings.Cut(part, ":")
+		action, direction, _ := strings.Cut(action, ":")
+		f = append(f, [3]string{kind, action, direction})
+	}
+	return f
+}
+
+func (f eventFilter) Match(e bus.Event) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, p := range f {
+		if strings.EqualFold(p[0], string(e.Kind)) && (p[1] == "" || strings.EqualFold(p[1], e.Action)) &&
+			(p[2] == "" || strings.EqualFold(p[2], e.Direction)) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSSE streams bus events as Server-Sent Events, named by kind.
+func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
+	filter := parseFilter(r.URL.Query().Get("filter"))
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Error("api: event stream unsupported: %s", err.Error())
+		return
+	}
+	log.API.Debug("api: event stream client %s connected", r.RemoteAddr)
+
+	events, cancel := s.events.Subscribe(64)
+	defer cancel()
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			log.API.Debug("api: event stream client %s disconnected", r.RemoteAddr)
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if !filter.Match(e) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Error("api: failed to encode event: %s", err.Error())
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind, data)
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultTokensFile = "tokens.json"
+
+	tokenPrefix = "bvs_"
+)
+
+type Scope string
+
+const (
+	Read    Scope = "read"    // GET requests and the event stream
+	Control Scope = "control" // everything but admin, including actuating switches
+	Admin   Scope = "admin"   // everything, including purging stored data
+)
+
+// Allows reports whether the scope grants need.
+func (s Scope) Allows(need Scope) bool {
+	return s == Admin || s == need || (s == Control && need == Read)
+}
+
+// Token is a stored API token. Only a hash of the secret is kept.
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scope   Scope     `json:"scope"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+}
+
+// Tokens is the set of API tokens kept in a file, reloaded whenever the file
+// changes so tokens created or revoked from the CLI apply immediately.
+type Tokens struct {
+	path     string
+	tokens   []Token
+	modified time.Time
+	lock     sync.Mutex
+}
+
+func (t *Tokens) String() string {
+	return fmt.Sprintf("Tokens {path: %s}", t.path)
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// reload must be called with the lock held.
+func (t *Tokens) reload() error {
+	info, err := os.Stat(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.tokens, t.modified = nil, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tokens %s: %w", t.path, err)
+	}
+	if info.ModTime().Equal(t.modified) {
+		return nil
+	}
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to read tokens %s: %w", t.path, err)
+	}
+	tokens := []Token{}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("failed to decode tokens %s: %w", t.path, err)
+	}
+	t.tokens, t.modified = tokens, info.ModTime()
+	return nil
+}
+
+// save must be called with the lock held.
+func (t *Tokens) save() error {
+	data, err := json.MarshalIndent(t.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	t.modified = time.Time{}
+	return nil
+}
+
+func (t *Tokens) List() ([]Token, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return slices.Clone(t.tokens), nil
+}
+
+// Create issues a token and returns its secret, which is not stored and
+// cannot be shown again.
+func (t *Tokens) Create(name string, scope Scope) (string, Token, error) {
+	if scope != Read && scope != Control && scope != Admin {
+		return "", Token{}, fmt.Errorf("unknown scope %q", scope)
+	}
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", Token{}, err
+	}
+	secret := tokenPrefix + hex.EncodeToString(random)
+	token := Token{ID: hex.EncodeToString(random[:4]), Name: name, Scope: scope, Hash: hashToken(secret), Created: time.Now()}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.reload(); err != nil {
+		return "", Token{}, err
+	}
+	t.tokens = append(t.tokens, token)
+	return secret, token, t.save()
+}
+
+// Revoke deletes the token with the given ID or name.
+func (t *Tokens) Revoke(id string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.reload(); err != nil {
+		return err
+	}
+	n := len(t.tokens)
+	t.tokens = slices.DeleteFunc(t.tokens, func(token Token) bool { return token.ID == id || token.Name == id })
+	if len(t.tokens) == n {
+		return fmt.Errorf("unknown token %q", id)
+	}
+	return t.save()
+}
+
+// Check finds the token matching secret.
+func (t *Tokens) Check(secret string) (Token, bool) {
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return Token{}, false
+	}
+	hash := []byte(hashToken(secret))
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.reload(); err != nil {
+		log.Error("api: %s", err.Error())
+		return Token{}, false
+	}
+	for _, token := range t.tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(token.Hash)) == 1 {
+			return token, true
+		}
+	}
+	return Token{}, false
+}
+
+func NewTokens(path string) *Tokens {
+	if path == "" {
+		path = DefaultTokensFile
+	}
+	return &Tokens{path: path}
+}
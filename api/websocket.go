@@ -0,0 +1,272 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/log"
+)
+
+// RFC 6455
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+
+	wsMaxMessage   = 1 << 16
+	wsPingInterval = 30 * time.Second
+	wsWriteTimeout = 10 * time.Second
+)
+
+// Commander applies a command ("on", "off", "toggle" or "press") to the named
+// switch.
+type Commander func(name string, command string, cause audit.Cause) error
+
+type wsCommand struct {
+	ID      string `json:"id,omitempty"`
+	Command string `json:"command"`
+	Switch  string `json:"switch"`
+}
+
+type wsReply struct {
+	Kind  string `json:"kind"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex // guards writes
+}
+
+func (c *wsConn) write(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := c.conn.Write(append(frame, payload...))
+	return err
+}
+
+func (c *wsConn) writeJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.write(wsText, data)
+}
+
+// read returns the next data message, answering control frames on the way.
+func (c *wsConn) read() ([]byte, error) {
+	var message []byte
+	for {
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, head); err != nil {
+			return nil, err
+		}
+		fin, opcode := head[0]&0x80 != 0, head[0]&0x0F
+		if head[1]&0x80 == 0 {
+			return nil, errors.New("websocket: unmasked client frame")
+		}
+		n := uint64(head[1] & 0x7F)
+		switch n {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err := io.ReadFull(c.r, ext); err != nil {
+				return nil, err
+			}
+			n = uint64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(c.r, ext); err != nil {
+				return nil, err
+			}
+			n = binary.BigEndian.Uint64(ext)
+		}
+		if n+uint64(len(message)) > wsMaxMessage {
+			return nil, errors.New("websocket: message too large")
+		}
+		mask := make([]byte, 4)
+		if _, err := io.ReadFull(c.r, mask); err != nil {
+			return nil, err
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return nil, err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+		switch opcode {
+		case wsPing:
+			if err := c.write(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.write(wsClose, payload)
+			return nil, io.EOF
+		}
+		if opcode != wsContinuation {
+			message = message[:0]
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func upgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return nil, errors.New("websocket upgrade required")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connection cannot be upgraded")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// sameOrigin reports whether a browser may open the socket from the page
+// that asked, so no other site a LAN user visits can drive the switches.
+// Clients other than browsers send no Origin.
+func (s *Server) sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range s.origins {
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if s.tokens == nil {
+		writeError(w, http.StatusForbidden, "websocket requires api tokens")
+		return
+	}
+	if !s.sameOrigin(r) {
+		writeError(w, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	c, err := upgrade(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer c.conn.Close()
+	log.API.Debug("api: websocket client %s connected", r.RemoteAddr)
+
+	events, cancel := s.events.Subscribe(64)
+	defer cancel()
+	go func() {
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+		for {
+			var err error
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				err = c.writeJSON(e)
+			case <-ping.C:
+				err = c.write(wsPing, nil)
+			}
+			if err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		message, err := c.read()
+		if err != nil {
+			log.API.Debug("api: websocket client %s disconnected: %v", r.RemoteAddr, err)
+			return
+		}
+		var cmd wsCommand
+		reply := wsReply{Kind: "reply"}
+		if err := json.Unmarshal(message, &cmd); err != nil {
+			reply.Error = fmt.Sprintf("invalid command: %s", err.Error())
+		} else {
+			reply.ID = cmd.ID
+			if !s.allowed(r, Control) {
+				reply.Error = "token or client certificate does not allow control"
+			} else if !s.limit(r) {
+				reply.Error = "too many requests"
+			} else if err := s.command(cmd.Switch, cmd.Command, cause(r, "websocket")); err != nil {
+				reply.Error = err.Error()
+			}
+		}
+		if err := c.writeJSON(reply); err != nil {
+			return
+		}
+	}
+}
+
+// Events streams bus events to WebSocket and Server-Sent Events clients, and
+// accepts switch commands from WebSocket clients.
+func (s *Server) Events(events *bus.Bus, command Commander) {
+	s.events = events
+	s.command = command
+	s.mux.HandleFunc("GET /ws", s.handleWebSocket)
+	s.mux.HandleFunc("GET /events", s.handleSSE)
+}
@@ -0,0 +1,219 @@
+// Package audit records every actuation with its cause in an append-only
+// file, one JSON object per line. Each entry carries the hash of the one
+// before it, so editing or removing entries breaks the chain.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const DefaultFile = "audit.jsonl"
+
+// Cause attributes an actuation to what requested it.
+type Cause struct {
+	Kind string // e.g. "presence", "api", "cli", "vacation" or "wall switch"
+	By   string // who, e.g. the actor or API client; may be empty
+}
+
+func (c Cause) String() string {
+	if c.By == "" {
+		return c.Kind
+	}
+	return fmt.Sprintf("%s (%s)", c.Kind, c.By)
+}
+
+type Entry struct {
+	Seq    uint64    `json:"seq"`
+	Epoch  time.Time `json:"epoch"`
+	Switch string    `json:"switch"`
+	Action string    `json:"action"` // e.g. "On", "Off", "Pressed", "Failed" or "Pinned"
+	Cause  string    `json:"cause"`
+	By     string    `json:"by,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+	Prev   string    `json:"prev"` // hash of the previous entry
+	Hash   string    `json:"hash"`
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("Entry {seq: %d, switch: %s, action: %s, cause: %s, by: %s}", e.Seq, e.Switch, e.Action, e.Cause, e.By)
+}
+
+// digest hashes the entry with its own hash left out.
+func (e Entry) digest() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type Log struct {
+	path string
+	seq  uint64
+	last string // hash of the last entry
+	lock sync.Mutex
+}
+
+func (l *Log) String() string {
+	return fmt.Sprintf("Audit {path: %s, seq: %d}", l.path, l.seq)
+}
+
+// Record chains e onto the log and appends it.
+func (l *Log) Record(cause Cause, e Entry) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if e.Epoch.IsZero() {
+		e.Epoch = time.Now()
+	}
+	e.Cause, e.By = cause.Kind, cause.By
+	e.Seq, e.Prev = l.seq+1, l.last
+	e.Hash = e.digest()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", l.path, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to append audit log %s: %w", l.path, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to append audit log %s: %w", l.path, err)
+	}
+	l.seq, l.last = e.Seq, e.Hash
+	return nil
+}
+
+// Read returns every entry in the log at path, oldest first. A missing file
+// yields no entries. Corrupt lines are skipped and reported in the error
+// along with the entries that could be read.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	defer f.Close()
+	entries := []Entry{}
+	errs := []error{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			errs = append(errs, fmt.Errorf("corrupt entry on line %d of %s: %w", line, path, err))
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	return entries, errors.Join(errs...)
+}
+
+// Verify checks that entries form an unbroken chain from the first one.
+func Verify(entries []Entry) error {
+	prev := ""
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) {
+			return fmt.Errorf("entry %d: expected sequence %d; entries are missing or reordered", e.Seq, i+1)
+		}
+		if e.Prev != prev {
+			return fmt.Errorf("entry %d: does not follow entry %d; entries are missing or altered", e.Seq, i)
+		}
+		if e.digest() != e.Hash {
+			return fmt.Errorf("entry %d: hash mismatch; the entry was altered", e.Seq)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// Prune rewrites the log without the entries keep rejects, renumbering and
+// rechaining the rest, and records the removal as a "Pruned" entry of its own.
+// It refuses to prune a broken log, which would hide the break. It reports how
+// many entries it removed.
+func (l *Log) Prune(keep func(Entry) bool, cause Cause, detail string) (int, error) {
+	removed, err := l.rewrite(keep)
+	if err != nil || removed == 0 {
+		return removed, err
+	}
+	return removed, l.Record(cause, Entry{Action: "Pruned", Detail: fmt.Sprintf("%d entries removed: %s", removed, detail)})
+}
+
+func (l *Log) rewrite(keep func(Entry) bool) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	entries, err := Read(l.path)
+	if err == nil {
+		err = Verify(entries)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("audit log %s is broken: %w", l.path, err)
+	}
+	var out bytes.Buffer
+	last := Entry{}
+	for _, e := range entries {
+		if !keep(e) {
+			continue
+		}
+		e.Seq, e.Prev = last.Seq+1, last.Hash
+		e.Hash = e.digest()
+		data, err := json.Marshal(e)
+		if err != nil {
+			return 0, err
+		}
+		out.Write(append(data, '\n'))
+		last = e
+	}
+	removed := len(entries) - int(last.Seq)
+	if removed == 0 {
+		return 0, nil
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0o600); err != nil {
+		return 0, fmt.Errorf("failed to prune audit log %s: %w", l.path, err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return 0, fmt.Errorf("failed to prune audit log %s: %w", l.path, err)
+	}
+	l.seq, l.last = last.Seq, last.Hash
+	return removed, nil
+}
+
+// Open continues the log at path from its last entry. If the chain is broken
+// the log is still returned, along with an error describing the break, so
+// actuations keep being recorded.
+func Open(path string) (*Log, error) {
+	if path == "" {
+		path = DefaultFile
+	}
+	entries, err := Read(path)
+	if entries == nil && err != nil {
+		return nil, err
+	}
+	if verr := Verify(entries); verr != nil {
+		err = errors.Join(err, verr)
+	}
+	l := &Log{path: path}
+	if n := len(entries); n > 0 {
+		l.seq, l.last = entries[n-1].Seq, entries[n-1].Hash
+	}
+	if err != nil {
+		return l, fmt.Errorf("audit log %s is broken: %w", path, err)
+	}
+	return l, nil
+}
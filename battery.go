@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/power"
+)
+
+const DefaultBatteryReportMs = 3600000
+
+// batteryRead records a reading in the history every reportMs, raises a
+// battery alert when the voltage drops under alertV, and holds low power mode
+// on while it is under lowPowerV.
+func (b *Beaves) batteryRead(prev controller.Reading, r controller.Reading) {
+	interval := config.RuntimeConfig.Battery.ReportMs
+	if interval <= 0 {
+		interval = DefaultBatteryReportMs
+	}
+	if r.Epoch.Sub(b.batteryReported) >= time.Duration(interval)*time.Millisecond {
+		b.batteryReported = r.Epoch
+		b.Events.Publish(bus.Event{Kind: bus.Battery, Name: "battery", Action: "Reading", Value: r.Volts})
+	}
+	if r.Alert && !prev.Alert {
+		detail := fmt.Sprintf("battery at %.2fV", r.Volts)
+		log.Error("battery: %s", detail)
+		b.Events.Publish(bus.Event{Kind: bus.Alert, Name: "battery", Detail: detail})
+	} else if prev.Alert && !r.Alert {
+		log.Info("battery recovered to %.2fV", r.Volts)
+	}
+	power.Set(power.Battery, r.LowPower)
+}
@@ -0,0 +1,88 @@
+// Package bus fans out notable runtime events to integrations.
+package bus
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+)
+
+type Kind string
+
+const (
+	Presence Kind = "presence" // Name is the actor, Action is the radar action
+	Switch   Kind = "switch"   // Name is the switch, Action is "Pressed", "Played", "On", "Off" or "Failed"
+	Alert    Kind = "alert"    // Name is the switch, Detail is the alert
+	Health   Kind = "health"   // Name is the switch, Action is "Healthy" or "Unhealthy"
+	Energy   Kind = "energy"   // Name is the metered switch, Value is the total kWh
+	Profile  Kind = "profile"  // Name is the new profile, Action the reason, Detail the old one
+	Override Kind = "override" // Name is the switch, Action is "Pinned", "Cleared" or "Expired"
+	Security Kind = "security" // Name is the client, Action is "RateLimited" or "LockedOut"
+	Group    Kind = "group"    // Name is the group, Action is "Started", "Completed" or "Aborted"
+	Report   Kind = "report"   // Name is "daily" or "weekly", Detail is the summary
+	Battery  Kind = "battery"  // Name is "battery", Action is "Reading", Value is the voltage
+	Passage  Kind = "passage"  // Name is the actor, Action is the radar action, Detail the node that completed it
+)
+
+type Event struct {
+	Kind   Kind      `json:"kind"`
+	Name   string    `json:"name"`
+	Action string    `json:"action,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+	Value  float64   `json:"value,omitempty"`
+	Epoch  time.Time `json:"epoch"`
+
+	Direction string `json:"direction,omitempty"` // presence: "approaching" or "departing", when known
+	By        string `json:"by,omitempty"`        // switch: who or what caused the change, e.g. the arriving actor
+	Zone      string `json:"zone,omitempty"`      // presence: the zone it was sensed in
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("Event {kind: %s, name: %s, action: %s, detail: %s}", e.Kind, e.Name, e.Action, e.Detail)
+}
+
+type Bus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// Publish delivers e to every subscriber without blocking; subscribers that
+// fall behind miss events.
+func (b *Bus) Publish(e Event) {
+	if e.Epoch.IsZero() {
+		e.Epoch = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			log.DebugMemoize("bus: dropped %s for a slow subscriber", e.Kind)
+		}
+	}
+}
+
+// Subscribe returns a channel of published events and a function to stop
+// receiving them.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func New() *Bus {
+	return &Bus{subs: map[chan Event]struct{}{}}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/profile"
+	"github.com/robolivable/beaves/radar"
+)
+
+// Calendar applies the calendar rules whose events are on: their actors are
+// admitted as guests, and the first one naming a profile activates it. Once
+// none does, the profile that was active before is restored, unless it was
+// changed since.
+func (b *Beaves) Calendar(active []config.CalendarRule) {
+	guests := []string{}
+	want := ""
+	for _, r := range active {
+		guests = append(guests, r.Actors...)
+		if want == "" {
+			want = r.Profile
+		}
+	}
+	slices.Sort(guests)
+	guests = slices.Compact(guests)
+	log.Info("calendar: %d rules active, guests %v", len(active), guests)
+	radar.SetGuests(guests)
+
+	current := b.Profiles.Active().Name
+	switch {
+	case want != "" && want != current:
+		if b.calendarProfile == "" {
+			b.calendarPrior = current
+		}
+		b.calendarProfile = want
+		if err := b.Profiles.Set(want, "calendar"); err != nil {
+			log.Error(err.Error())
+		}
+	case want == "" && b.calendarProfile != "":
+		prior := b.calendarPrior
+		if prior == "" || prior == b.calendarProfile {
+			prior = profile.Default
+		}
+		if current == b.calendarProfile {
+			if err := b.Profiles.Set(prior, "calendar"); err != nil {
+				log.Error(err.Error())
+			}
+		}
+		b.calendarProfile, b.calendarPrior = "", ""
+	}
+}
@@ -0,0 +1,146 @@
+// Package calendar polls an iCalendar feed and reports which configured
+// rules its current events match, e.g. a "Vacation" event enabling the
+// vacation profile.
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/clock"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultPollMs = 900000
+
+	fetchTimeout = 30 * time.Second
+)
+
+type Calendar struct {
+	url      string
+	interval time.Duration
+	rules    []config.CalendarRule
+
+	events []Event
+	lock   sync.Mutex
+
+	Clock    *clock.Clock                       // rules are evaluated once it is trusted
+	OnChange func(active []config.CalendarRule) // called with the matching rules, in order, whenever they change
+}
+
+func (c *Calendar) String() string {
+	return fmt.Sprintf("Calendar {rules: %d, events: %d}", len(c.rules), len(c.Events()))
+}
+
+func (c *Calendar) Events() []Event {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.events
+}
+
+// fetch replaces the events with those currently in the feed, keeping the
+// previous ones if it can't be read.
+func (c *Calendar) fetch() error {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("calendar: failed to fetch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("calendar: failed to fetch: %s", resp.Status)
+	}
+	events, err := Parse(resp.Body)
+	if err != nil {
+		log.Error("calendar: %s", err.Error())
+	}
+	if events == nil {
+		return err
+	}
+	c.lock.Lock()
+	c.events = events
+	c.lock.Unlock()
+	return nil
+}
+
+// Match returns the rules matched by an event spanning t.
+func (c *Calendar) Match(t time.Time) []config.CalendarRule {
+	events := c.Events()
+	active := []config.CalendarRule{}
+	for _, r := range c.rules {
+		for _, e := range events {
+			if strings.Contains(strings.ToLower(e.Summary), strings.ToLower(r.Match)) && e.Active(t) {
+				active = append(active, r)
+				break
+			}
+		}
+	}
+	return active
+}
+
+func same(a, b []config.CalendarRule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Match != b[i].Match {
+			return false
+		}
+	}
+	return true
+}
+
+// Run polls the feed and evaluates the rules every minute, so events take
+// effect on time between polls.
+func (c *Calendar) Run() {
+	<-c.Clock.Ready()
+	var last []config.CalendarRule
+	var fetched time.Time
+	for {
+		if time.Since(fetched) >= c.interval {
+			if err := c.fetch(); err != nil {
+				log.Error(err.Error())
+			}
+			fetched = time.Now()
+		}
+		active := c.Match(time.Now())
+		if last == nil || !same(active, last) {
+			last = active
+			if c.OnChange != nil {
+				c.OnChange(active)
+			}
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+func New(c config.Calendar) (*Calendar, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("calendar url is required")
+	}
+	for i, r := range c.Rules {
+		if r.Match == "" {
+			return nil, fmt.Errorf("calendar rule %d has nothing to match", i)
+		}
+	}
+	url := c.URL
+	if rest, ok := strings.CutPrefix(url, "webcal://"); ok {
+		url = "https://" + rest
+	}
+	interval := c.PollMs
+	if interval <= 0 {
+		interval = DefaultPollMs
+	}
+	return &Calendar{url: url, interval: time.Duration(interval) * time.Millisecond, rules: c.Rules}, nil
+}
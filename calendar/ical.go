@@ -0,0 +1,312 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+)
+
+// maxOccurrences bounds the expansion of a recurring event.
+const maxOccurrences = 10000
+
+// Event is a VEVENT, possibly recurring.
+type Event struct {
+	Summary  string
+	Start    time.Time
+	Duration time.Duration
+
+	rule    *rule
+	exclude map[int64]bool // EXDATE, unix seconds
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("Event {summary: %s, start: %v, duration: %v, recurring: %v}", e.Summary, e.Start, e.Duration, e.rule != nil)
+}
+
+// rule is the supported subset of an RRULE.
+type rule struct {
+	freq     string // DAILY, WEEKLY, MONTHLY or YEARLY
+	interval int
+	count    int // 0 is unbounded
+	until    time.Time
+	byDay    []time.Weekday // WEEKLY only
+}
+
+var weekdays = map[string]time.Weekday{"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday}
+
+func parseRule(value string, loc *time.Location) (*rule, error) {
+	r := &rule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(v)
+		case "COUNT":
+			r.count, err = strconv.Atoi(v)
+		case "UNTIL":
+			r.until, _, err = parseTime(v, nil, loc)
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				wd, ok := weekdays[strings.ToUpper(d)]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY %q", d)
+				}
+				r.byDay = append(r.byDay, wd)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE %s: %w", part, err)
+		}
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported RRULE frequency %q", r.freq)
+	}
+	if r.interval <= 0 {
+		r.interval = 1
+	}
+	if len(r.byDay) > 0 && r.freq != "WEEKLY" {
+		return nil, fmt.Errorf("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	return r, nil
+}
+
+// Occurrences calls fn with the start of each occurrence in order, until fn
+// returns false.
+func (e Event) Occurrences(fn func(start time.Time) bool) {
+	if e.rule == nil {
+		fn(e.Start)
+		return
+	}
+	r := e.rule
+	n := 0
+	emit := func(t time.Time) bool {
+		if t.Before(e.Start) {
+			return true
+		}
+		if !r.until.IsZero() && t.After(r.until) {
+			return false
+		}
+		n++
+		if r.count > 0 && n > r.count {
+			return false
+		}
+		if e.exclude[t.Unix()] {
+			return true
+		}
+		return fn(t)
+	}
+	for i := 0; i < maxOccurrences; i++ {
+		k := i * r.interval
+		switch r.freq {
+		case "DAILY":
+			if !emit(e.Start.AddDate(0, 0, k)) {
+				return
+			}
+		case "WEEKLY":
+			if len(r.byDay) == 0 {
+				if !emit(e.Start.AddDate(0, 0, 7*k)) {
+					return
+				}
+				continue
+			}
+			// the week of the start, from Monday
+			week := e.Start.AddDate(0, 0, 7*k-(int(e.Start.Weekday())+6)%7)
+			for d := 0; d < 7; d++ {
+				t := week.AddDate(0, 0, d)
+				for _, wd := range r.byDay {
+					if t.Weekday() == wd && !emit(t) {
+						return
+					}
+				}
+			}
+		case "MONTHLY", "YEARLY":
+			months := k
+			if r.freq == "YEARLY" {
+				months = 12 * k
+			}
+			t := e.Start.AddDate(0, months, 0)
+			if t.Day() != e.Start.Day() {
+				continue // e.g. the 31st in a shorter month
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// Active reports whether an occurrence of the event spans t.
+func (e Event) Active(t time.Time) bool {
+	active := false
+	e.Occurrences(func(start time.Time) bool {
+		if start.After(t) {
+			return false
+		}
+		if t.Before(start.Add(e.Duration)) {
+			active = true
+			return false
+		}
+		return true
+	})
+	return active
+}
+
+// parseTime reads a DATE or DATE-TIME value: UTC when it ends in Z, in tzid
+// when given, and otherwise floating, in loc.
+func parseTime(value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.Trim(tzid, `"`)); err == nil {
+			loc = l
+		}
+	}
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration reads an RFC 5545 duration, e.g. "PT1H30M" or "P2D".
+func parseDuration(value string) (time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+var unescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+// property splits a content line into its name, parameters and value.
+func property(line string) (string, map[string]string, string) {
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, ""
+	}
+	parts := strings.Split(line[:colon], ";")
+	params := map[string]string{}
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = v
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// Parse reads the events of an iCalendar (RFC 5545) stream. Events that
+// can't be understood are skipped and reported together in the error.
+func Parse(r io.Reader) ([]Event, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	events := []Event{}
+	skipped := []string{}
+	var e *Event
+	var end time.Time
+	var allDay bool
+	var bad error
+	for _, line := range lines {
+		name, params, value := property(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			e, end, allDay, bad = &Event{exclude: map[int64]bool{}}, time.Time{}, false, nil
+			continue
+		case e == nil:
+			continue
+		case name == "END" && value == "VEVENT":
+			switch {
+			case bad != nil:
+			case e.Start.IsZero():
+				bad = fmt.Errorf("no DTSTART")
+			case !end.IsZero():
+				e.Duration = end.Sub(e.Start)
+			case e.Duration == 0 && allDay:
+				e.Duration = 24 * time.Hour
+			}
+			if bad != nil {
+				skipped = append(skipped, fmt.Sprintf("%q: %v", e.Summary, bad))
+			} else {
+				events = append(events, *e)
+			}
+			e = nil
+			continue
+		}
+		var err error
+		switch name {
+		case "SUMMARY":
+			e.Summary = unescaper.Replace(value)
+		case "DTSTART":
+			e.Start, allDay, err = parseTime(value, params, config.Location)
+		case "DTEND":
+			end, _, err = parseTime(value, params, config.Location)
+		case "DURATION":
+			e.Duration, err = parseDuration(value)
+		case "RRULE":
+			e.rule, err = parseRule(value, config.Location)
+		case "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				t, _, xerr := parseTime(v, params, config.Location)
+				if xerr != nil {
+					err = xerr
+					break
+				}
+				e.exclude[t.Unix()] = true
+			}
+		}
+		if err != nil && bad == nil {
+			bad = err
+		}
+	}
+	if len(skipped) > 0 {
+		return events, fmt.Errorf("skipped events: %s", strings.Join(skipped, "; "))
+	}
+	return events, nil
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/api"
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/history"
+	"github.com/robolivable/beaves/privacy"
+	"github.com/robolivable/beaves/radar"
+	"github.com/robolivable/beaves/version"
+)
+
+// apiURL resolves the local API from its listen address, e.g. ":8080".
+func apiURL(path string) string {
+	address := config.RuntimeConfig.API.Address
+	if strings.HasPrefix(address, ":") {
+		address = "127.0.0.1" + address
+	}
+	if config.RuntimeConfig.API.TLS.Cert != "" {
+		return "https://" + address + path
+	}
+	return "http://" + address + path
+}
+
+const (
+	TokenEnv = "BEAVES_TOKEN" // API token the CLI authenticates with
+	CertEnv  = "BEAVES_CERT"  // client certificate, when control needs one
+	KeyEnv   = "BEAVES_KEY"
+)
+
+// client trusts exactly the certificate the local API serves, whatever names
+// it was issued for, and presents the CLI's client certificate if given.
+func client() (*http.Client, error) {
+	c := config.RuntimeConfig.API.TLS
+	if c.Cert == "" {
+		return http.DefaultClient, nil
+	}
+	c = c.Resolved()
+	pinned, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+	if err != nil {
+		// the key may be readable only by the service; the certificate is enough
+		data, rerr := os.ReadFile(c.Cert)
+		if rerr != nil {
+			return nil, fmt.Errorf("failed to read api certificate: %w", rerr)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no certificate in %s", c.Cert)
+		}
+		pinned.Certificate = [][]byte{block.Bytes}
+	}
+	tc := &tls.Config{
+		InsecureSkipVerify: true, // replaced by pinning below
+		VerifyPeerCertificate: func(certs [][]byte, _ [][]*x509.Certificate) error {
+			if len(certs) == 0 || !bytes.Equal(certs[0], pinned.Certificate[0]) {
+				return fmt.Errorf("api certificate does not match %s", c.Cert)
+			}
+			return nil
+		},
+	}
+	if os.Getenv(CertEnv) != "" {
+		cert, err := tls.LoadX509KeyPair(os.Getenv(CertEnv), os.Getenv(KeyEnv))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tc}}, nil
+}
+
+// call sends a request to the local API as the current user.
+func call(method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, apiURL(path), body)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv(TokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if u, err := user.Current(); err == nil {
+		req.Header.Set(api.UserHeader, u.Username)
+	}
+	hc, err := client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach api: %w", err)
+	}
+	return resp, nil
+}
+
+// pair walks through pending pairing requests, showing the numeric comparison
+// code so it can be checked against the phone before confirming.
+func pair() error {
+	in := bufio.NewReader(os.Stdin)
+	seen := map[string]bool{}
+	fmt.Println("waiting for pairing requests (ctrl-c to quit)...")
+	for {
+		resp, err := call(http.MethodGet, "/pairing", nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("failed to list pairing requests: %s", resp.Status)
+		}
+		pending := []radar.PairingRequest{}
+		err = json.NewDecoder(resp.Body).Decode(&pending)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode pairing requests: %w", err)
+		}
+		for _, p := range pending {
+			key := p.Address + p.Epoch.String()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if p.Passkey != nil {
+				fmt.Printf("%s wants to pair; does the phone show %06d? [y/N] ", p.Address, *p.Passkey)
+			} else {
+				fmt.Printf("%s wants to pair without a code (not MITM protected); allow? [y/N] ", p.Address)
+			}
+			answer, _ := in.ReadString('\n')
+			decision := "reject"
+			if strings.EqualFold(strings.TrimSpace(answer), "y") {
+				decision = "confirm"
+			}
+			resp, err := call(http.MethodPost, "/pairing/"+p.Address+"/"+decision, nil)
+			if err != nil {
+				return fmt.Errorf("failed to %s %s: %w", decision, p.Address, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				fmt.Printf("%s: request is no longer pending\n", p.Address)
+				continue
+			}
+			fmt.Printf("%s: %sed\n", p.Address, decision)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// switchProfile prints the active profile, or switches to name if given.
+func switchProfile(args []string) error {
+	var resp *http.Response
+	var err error
+	if len(args) == 0 {
+		resp, err = call(http.MethodGet, "/profile", nil)
+	} else {
+		resp, err = call(http.MethodPut, "/profile/"+args[0], nil)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to switch profile: %s", resp.Status)
+	}
+	status := api.ProfileStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return fmt.Errorf("failed to decode profile: %w", err)
+	}
+	fmt.Printf("active: %s (since %s, %s)\n", status.Active.Name, status.Active.Since.Format(time.RFC3339), status.Active.Reason)
+	fmt.Printf("profiles: %s\n", strings.Join(status.Profiles, ", "))
+	return nil
+}
+
+// flushLog has the running sentry summarize suppressed log repeats now.
+func flushLog(args []string) error {
+	if len(args) != 1 || args[0] != "flush" {
+		return fmt.Errorf("usage: beaves log flush")
+	}
+	resp, err := call(http.MethodPost, "/log/flush", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to flush log: %s", resp.Status)
+	}
+	return nil
+}
+
+// showVersion prints the build of this binary, and of the running sentry when
+// it can be reached.
+func showVersion() error {
+	fmt.Printf("beaves %s\n", version.Get())
+	resp, err := call(http.MethodGet, "/health", nil)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if running := resp.Header.Get(api.VersionHeader); running != "" {
+		fmt.Printf("running %s\n", running)
+	}
+	return nil
+}
+
+// showTrace prints the running sentry's low level BLE trace, oldest first.
+func showTrace() error {
+	resp, err := call(http.MethodGet, "/bluetooth/trace", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("bluetooth tracing is not enabled")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to read trace: %s", resp.Status)
+	}
+	entries := []radar.BTTraceEntry{}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return fmt.Errorf("failed to decode trace: %w", err)
+	}
+	for _, e := range entries {
+		fmt.Println(privacy.Redact(e.String()))
+	}
+	return nil
+}
+
+// showPresence prints the running sentry's presence table, of the main zone
+// or the one given.
+func showPresence(args []string) error {
+	flags := flag.NewFlagSet("presence", flag.ContinueOnError)
+	zone := flags.String("zone", "", "zone to show instead of the main one")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	path := "/presence"
+	if *zone != "" {
+		path = "/zones/" + url.PathEscape(*zone) + "/presence"
+	}
+	resp, err := call(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("unknown zone %q", *zone)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to read presence: %s", resp.Status)
+	}
+	table := []radar.Presence{}
+	if err := json.NewDecoder(resp.Body).Decode(&table); err != nil {
+		return fmt.Errorf("failed to decode presence: %w", err)
+	}
+	sort.Slice(table, func(i, j int) bool { return table[i].Actor < table[j].Actor })
+	for _, p := range table {
+		line := fmt.Sprintf("%s %s", p.Actor, p.State)
+		if p.Name != "" && p.Name != string(p.Actor) {
+			line = fmt.Sprintf("%s (%s) %s", p.Actor, p.Name, p.State)
+		}
+		if !p.LastSeen.IsZero() {
+			line += " since " + p.LastSeen.Format(time.RFC3339)
+		}
+		if p.RSSI != 0 {
+			line += fmt.Sprintf(" at %d dBm", p.RSSI)
+		}
+		if p.Source != "" {
+			line += " via " + p.Source
+		}
+		fmt.Println(privacy.Redact(line))
+	}
+	return nil
+}
+
+// override lists pinned switches, or pins one ("on" or "off", optionally for a
+// duration such as "30m") or clears it.
+func override(args []string) error {
+	if len(args) == 0 {
+		resp, err := call(http.MethodGet, "/overrides", nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		pins := []controller.Pin{}
+		if err := json.NewDecoder(resp.Body).Decode(&pins); err != nil {
+			return fmt.Errorf("failed to decode overrides: %w", err)
+		}
+		for _, p := range pins {
+			until := "cleared"
+			if p.Until != nil {
+				until = p.Until.Format(time.RFC3339)
+			}
+			fmt.Printf("%s: %s by %s until %s\n", p.Switch, p.State, p.Reason, until)
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: beaves override [<switch> on|off|clear [duration]]")
+	}
+	var resp *http.Response
+	var err error
+	if args[1] == "clear" {
+		resp, err = call(http.MethodDelete, "/overrides/"+args[0], nil)
+	} else {
+		body := api.OverrideRequest{State: args[1]}
+		if len(args) > 2 {
+			d, perr := time.ParseDuration(args[2])
+			if perr != nil {
+				return fmt.Errorf("invalid duration %q: %w", args[2], perr)
+			}
+			ms := int(d.Milliseconds())
+			body.DurationMs = &ms
+		}
+		data, _ := json.Marshal(body)
+		resp, err = call(http.MethodPut, "/overrides/"+args[0], bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		failure := map[string]string{}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("failed to override %s: %s %s", args[0], resp.Status, failure["error"])
+	}
+	return override(nil)
+}
+
+// manageVault lists or edits the actors in the encrypted vault. Secrets are read
+// from stdin so they stay out of the shell history. Changes take effect once
+// beaves restarts.
+func manageVault(args []string) error {
+	v := config.Vault
+	if v == nil {
+		return fmt.Errorf("actors.vault.file is not configured")
+	}
+	usage := fmt.Errorf("usage: beaves vault [list | add <actor> | remove <actor> | secret <actor> <name>]")
+	if len(args) == 0 || args[0] == "list" {
+		for _, actor := range v.Known {
+			names := []string{}
+			for name := range v.Secrets[actor] {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			fmt.Printf("%s %s\n", actor, strings.Join(names, ", "))
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return usage
+	}
+	switch args[0] {
+	case "add":
+		v.Add(args[1])
+	case "remove":
+		if !v.Remove(args[1]) {
+			return fmt.Errorf("actor %q is not in the vault", args[1])
+		}
+	case "secret":
+		if len(args) < 3 {
+			return usage
+		}
+		fmt.Fprintf(os.Stderr, "%s for %s: ", args[2], args[1])
+		secret, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && secret == "" {
+			return fmt.Errorf("failed to read secret: %w", err)
+		}
+		v.Add(args[1])
+		v.SetSecret(args[1], args[2], strings.TrimRight(secret, "\r\n"))
+	default:
+		return usage
+	}
+	return v.Save()
+}
+
+// showAudit prints the audit log, optionally filtered, after checking that its
+// hash chain is intact.
+func showAudit(args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	name := flags.String("switch", "", "only entries for this switch")
+	kind := flags.String("cause", "", "only entries with this cause, e.g. presence or api")
+	by := flags.String("by", "", "only entries by this actor or client")
+	since := flags.Duration("since", 0, "only entries this recent, e.g. 24h")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	path := config.StatePath(config.RuntimeConfig.AuditFile, audit.DefaultFile)
+	entries, err := audit.Read(path)
+	if err == nil {
+		err = audit.Verify(entries)
+	}
+	for _, e := range entries {
+		switch {
+		case *name != "" && e.Switch != *name:
+		case *kind != "" && e.Cause != *kind:
+		case *by != "" && !strings.Contains(e.By, *by):
+		case *since > 0 && time.Since(e.Epoch) > *since:
+		default:
+			line := fmt.Sprintf("%d %s %s %s by %s", e.Seq, e.Epoch.Format(time.RFC3339), e.Switch, e.Action, audit.Cause{Kind: e.Cause, By: e.By})
+			if e.Detail != "" {
+				line += ": " + e.Detail
+			}
+			fmt.Println(privacy.Redact(line))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("audit log is not intact: %w", err)
+	}
+	return nil
+}
+
+// purge removes everything the running instance stores about an actor.
+func purge(args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	actor := flags.String("actor", "", "ID or name of the actor whose data is removed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *actor == "" {
+		return fmt.Errorf("usage: beaves purge -actor <id|name>")
+	}
+	resp, err := call(http.MethodDelete, "/actors/"+url.PathEscape(*actor)+"/data", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		failure := map[string]string{}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("failed to purge %s: %s %s", *actor, resp.Status, failure["error"])
+	}
+	removed := map[string]int{}
+	if err := json.NewDecoder(resp.Body).Decode(&removed); err != nil {
+		return fmt.Errorf("failed to decode purge: %w", err)
+	}
+	fmt.Printf("purged %s: %d presence, %d history events, %d audit entries, %d counters, %d geofence reports, %d trace entries\n",
+		*actor, removed["presence"], removed["history"], removed["audit"], removed["counters"], removed["geofence"], removed["trace"])
+	return nil
+}
+
+// showReport prints the daily or weekly report from the recorded history,
+// without publishing it.
+func showReport(args []string) error {
+	period := "daily"
+	if len(args) > 0 {
+		period = args[0]
+	}
+	store := history.New(config.StatePath(config.RuntimeConfig.HistoryFile, history.DefaultFile))
+	summary, err := summarize(store, period, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Print(summary)
+	return nil
+}
+
+// manageTokens lists, creates or revokes API tokens. A new token's secret is
+// printed once and never stored.
+func manageTokens(args []string) error {
+	tokens := api.NewTokens(config.StatePath(config.RuntimeConfig.API.TokensFile, api.DefaultTokensFile))
+	if len(args) == 0 || args[0] == "list" {
+		list, err := tokens.List()
+		if err != nil {
+			return err
+		}
+		for _, t := range list {
+			fmt.Printf("%s %s %s (created %s)\n", t.ID, t.Name, t.Scope, t.Created.Format(time.RFC3339))
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: beaves token [list | create <name> [read|control|admin] | revoke <id|name>]")
+	}
+	switch args[0] {
+	case "create":
+		scope := api.Read
+		if len(args) > 2 {
+			scope = api.Scope(args[2])
+		}
+		secret, t, err := tokens.Create(args[1], scope)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "created %s token %s (%s); it is shown only once:\n", t.Scope, t.Name, t.ID)
+		fmt.Println(secret)
+		return nil
+	case "revoke":
+		return tokens.Revoke(args[1])
+	}
+	return fmt.Errorf("unknown token command %q", args[0])
+}
+
+// Command runs a CLI subcommand against a running instance.
+func Command(args []string) error {
+	switch args[0] {
+	case "pair":
+		return pair()
+	case "profile":
+		return switchProfile(args[1:])
+	case "override":
+		return override(args[1:])
+	case "replay":
+		return replay(args[1:])
+	case "vault":
+		return manageVault(args[1:])
+	case "presence":
+		return showPresence(args[1:])
+	case "audit":
+		return showAudit(args[1:])
+	case "token":
+		return manageTokens(args[1:])
+	case "report":
+		return showReport(args[1:])
+	case "events":
+		return exportEvents(args[1:])
+	case "purge":
+		return purge(args[1:])
+	case "log":
+		return flushLog(args[1:])
+	case "trace":
+		return showTrace()
+	case "version":
+		return showVersion()
+	case "diag":
+		return diagnose(args[1:])
+	case "self-test":
+		return selfTest(args[1:])
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
@@ -0,0 +1,176 @@
+// Package clock decides whether the wall clock can be trusted. A Pi has no
+// battery-backed clock, so until NTP synchronizes it boots with the time it
+// last shut down at, or 1970; schedules and expiries wait until it is right.
+package clock
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	DefaultCheckMs   = 60000
+	DefaultMaxJumpMs = 5000
+
+	timedateService = "org.freedesktop.timedate1"
+	timedatePath    = "/org/freedesktop/timedate1"
+)
+
+// Floor is a time the clock is known to be past, required of a clock trusted
+// without synchronization. The build's own modification time raises it.
+var Floor = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type Clock struct {
+	interval time.Duration
+	maxJump  time.Duration
+	unsynced bool // trust an unsynchronized clock past the floor
+
+	trusted atomic.Bool
+	ready   chan struct{}
+	once    sync.Once
+
+	OnJump func(d time.Duration) // the wall clock moved by d relative to elapsed time
+}
+
+func (c *Clock) String() string {
+	return fmt.Sprintf("Clock {trusted: %v}", c.Trusted())
+}
+
+// Trusted reports whether the wall clock is believed to be right. A nil
+// clock is always trusted.
+func (c *Clock) Trusted() bool {
+	return c == nil || c.trusted.Load()
+}
+
+// Ready is closed once the clock is trusted.
+func (c *Clock) Ready() <-chan struct{} {
+	if c == nil {
+		ready := make(chan struct{})
+		close(ready)
+		return ready
+	}
+	return c.ready
+}
+
+// synchronized asks systemd-timedated whether NTP has set the clock.
+func synchronized() (bool, error) {
+	bus, err := dbus.SystemBus()
+	if err != nil {
+		return false, err
+	}
+	v, err := bus.Object(timedateService, timedatePath).GetProperty(timedateService + ".NTPSynchronized")
+	if err != nil {
+		return false, err
+	}
+	synced, ok := v.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("unexpected NTPSynchronized value %v", v.Value())
+	}
+	return synced, nil
+}
+
+// kernelSynchronized asks the kernel whether a time daemon keeps the clock
+// synchronized, for systems without timedated. A time restored by
+// fake-hwclock leaves it unsynchronized.
+func kernelSynchronized() (bool, error) {
+	tx := unix.Timex{}
+	state, err := unix.Adjtimex(&tx)
+	if err != nil {
+		return false, fmt.Errorf("adjtimex: %w", err)
+	}
+	return state != unix.TIME_ERROR && tx.Status&unix.STA_UNSYNC == 0, nil
+}
+
+func floor() time.Time {
+	f := Floor
+	if exe, err := os.Executable(); err == nil {
+		if info, err := os.Stat(exe); err == nil && info.ModTime().After(f) {
+			f = info.ModTime()
+		}
+	}
+	return f
+}
+
+func (c *Clock) check() {
+	if c.trusted.Load() {
+		return
+	}
+	synced, err := synchronized()
+	if err != nil {
+		log.DebugMemoize("clock: cannot query timedated: %v", err)
+		if synced, err = kernelSynchronized(); err != nil {
+			log.DebugMemoize("clock: cannot query synchronization: %v", err)
+		}
+	}
+	now := time.Now()
+	if synced || c.unsynced && now.After(floor()) {
+		c.trusted.Store(true)
+		c.once.Do(func() { close(c.ready) })
+		log.Info("clock: trusted at %s", now.Format(time.RFC3339))
+		return
+	}
+	log.InfoMemoize("clock: not synchronized (%s); deferring schedules and expiries", now.Format(time.RFC3339))
+}
+
+// Run checks the clock periodically, watching for jumps of the wall clock
+// against the monotonic one, e.g. when NTP first steps it.
+func (c *Clock) Run() {
+	c.check()
+	last := time.Now()
+	for range time.Tick(c.interval) {
+		now := time.Now()
+		jump := now.Round(0).Sub(last.Round(0)) - now.Sub(last)
+		last = now
+		if jump > c.maxJump || jump < -c.maxJump {
+			log.Info("clock: jumped by %v", jump)
+			if c.OnJump != nil {
+				c.OnJump(jump)
+			}
+		}
+		c.check()
+	}
+}
+
+func New(c config.Clock) *Clock {
+	interval := c.CheckMs
+	if interval <= 0 {
+		interval = DefaultCheckMs
+	}
+	maxJump := c.MaxJumpMs
+	if maxJump <= 0 {
+		maxJump = DefaultMaxJumpMs
+	}
+	return &Clock{
+		interval: time.Duration(interval) * time.Millisecond,
+		maxJump:  time.Duration(maxJump) * time.Millisecond,
+		unsynced: c.TrustUnsynced,
+		ready:    make(chan struct{}),
+	}
+}
+
+// Local is t in the configured timezone, or the system's when none is set.
+func Local(t time.Time) time.Time {
+	return t.In(config.Location)
+}
+
+// TimeOfDay is how far t is into its day by the wall clock, so that "07:00"
+// stays 7 hours even on days DST starts or ends.
+func TimeOfDay(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second + time.Duration(t.Nanosecond())
+}
+
+// On is the wall clock time of day on day's date, in day's location. A time
+// skipped when DST starts lands an hour later.
+func On(day time.Time, offset time.Duration) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, 0, 0, 0, int(offset), day.Location())
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/api"
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/radar"
+	"github.com/robolivable/beaves/rolling"
+	"github.com/robolivable/beaves/totp"
+)
+
+const (
+	DefaultCommandSkewSteps   = 1
+	DefaultCommandMaxFailures = 5
+	DefaultCommandLockoutMs   = 300000
+	DefaultCommandScheme      = "totp"
+
+	maxCommandBackoff = time.Hour
+)
+
+var (
+	errInvalidCode = errors.New("invalid code")
+	errBackingOff  = errors.New("backing off")
+
+	// commandSecrets name the vault secret of an actor's codes, by scheme
+	commandSecrets = map[string]string{"totp": "totp", "rolling": "hotp"}
+)
+
+// CommandMessage is what a phone writes to the command characteristic.
+type CommandMessage struct {
+	Actor string `json:"actor"` // ID or friendly name
+	Code  string `json:"code"`
+	Proof string `json:"proof"` // hex HMAC-SHA256 of the nonce then the code, keyed with the secret
+}
+
+// proven checks the proof of a command, which binds its code to the nonce
+// the sentry issued for it.
+func proven(secret []byte, nonce []byte, code string, proof string) error {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(nonce)
+	mac.Write([]byte(code))
+	given, err := hex.DecodeString(proof)
+	if err != nil || !hmac.Equal(mac.Sum(nil), given) {
+		return fmt.Errorf("%w: command is not bound to the nonce", radar.ErrBadProof)
+	}
+	return nil
+}
+
+// refusal is what a client learns of a command that isn't proven: the same
+// whether the actor is unknown, has no secret or the proof is wrong, so
+// actors can't be enumerated. The reason is kept for the log and the
+// rejection counts.
+type refusal struct {
+	reason error
+}
+
+func (r refusal) Error() string { return "command refused" }
+func (r refusal) Unwrap() error { return r.reason }
+
+// codeGuard remembers per actor the step of the last time-based code used,
+// so each works once. Unproven commands, from anyone, are counted together:
+// past maxFailures in a row each backs off twice as long as the last, so
+// guessing gets slower and slower without any actor being locked out.
+type codeGuard struct {
+	used     map[string]int64
+	failures int
+	until    time.Time
+	lock     sync.Mutex
+}
+
+// fail counts an unproven command, returning the backoff it starts, if any.
+// g.lock is held.
+func (g *codeGuard) fail(now time.Time, maxFailures int, lockout time.Duration) time.Duration {
+	if now.After(g.until.Add(maxCommandBackoff)) {
+		g.failures = 0 // quiet long enough to start over
+	}
+	g.failures++
+	if maxFailures <= 0 || g.failures < maxFailures {
+		return 0
+	}
+	wait := min(lockout<<min(g.failures-maxFailures, 16), maxCommandBackoff)
+	g.until = now.Add(wait)
+	return wait
+}
+
+// actorID resolves a friendly name to the ID it is given for.
+func actorID(actor string) string {
+	for id, name := range config.RuntimeConfig.Actors.Names {
+		if strings.EqualFold(name, actor) {
+			return id
+		}
+	}
+	return actor
+}
+
+// actorSecret looks up a vault secret of an actor by ID, however it is cased.
+func actorSecret(id string, name string) (string, bool) {
+	for actor := range config.Vault.Secrets {
+		if strings.EqualFold(actor, id) {
+			return config.Vault.Secret(actor, name)
+		}
+	}
+	return "", false
+}
+
+// commands returns the handler of the command characteristic: a valid
+// one-time code from a known actor, proven with the current nonce, pulses
+// the configured switch.
+func (b *Beaves) commands(c config.Commands) (func([]byte, []byte, func() error) error, error) {
+	if config.Vault == nil {
+		return nil, fmt.Errorf("bluetooth commands require actors.vault to hold the actors' secrets")
+	}
+	scheme := strings.ToLower(c.Scheme)
+	if scheme == "" {
+		scheme = DefaultCommandScheme
+	}
+	secretName, ok := commandSecrets[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown command scheme %q", c.Scheme)
+	}
+	name := c.Switch
+	if name == "" {
+		name = managedSwitch()
+	}
+	skew := c.SkewSteps
+	if skew <= 0 {
+		skew = DefaultCommandSkewSteps
+	}
+	maxFailures := c.MaxFailures
+	if maxFailures == 0 {
+		maxFailures = DefaultCommandMaxFailures
+	}
+	lockout := time.Duration(DefaultCommandLockoutMs) * time.Millisecond
+	if c.LockoutMs > 0 {
+		lockout = time.Duration(c.LockoutMs) * time.Millisecond
+	}
+	g := &codeGuard{used: map[string]int64{}}
+	// check spends code if it is valid; g.lock is held
+	check := func(id string, secret []byte, code string, now time.Time) error {
+		step, ok := totp.Verify(secret, code, now, skew)
+		if !ok || step <= g.used[id] {
+			return errInvalidCode
+		}
+		g.used[id] = step
+		return nil
+	}
+	if scheme == "rolling" {
+		counters, err := rolling.Open(config.StatePath(c.CountersFile, rolling.DefaultFile), c.Window, c.ResyncWindow)
+		if err != nil {
+			return nil, err
+		}
+		b.Counters = counters
+		check = func(id string, secret []byte, code string, _ time.Time) error {
+			return counters.Check(id, secret, code)
+		}
+	}
+	// refuse counts an unproven command and returns the generic refusal
+	refuse := func(reason error, now time.Time) error {
+		g.lock.Lock()
+		wait := time.Duration(0)
+		if now.Before(g.until) {
+			reason = errBackingOff
+		} else {
+			wait = g.fail(now, maxFailures, lockout)
+		}
+		g.lock.Unlock()
+		log.Info("commands: refused: %s", reason.Error())
+		if wait > 0 {
+			log.Info("commands: %s for %v", api.LockedOut, wait)
+			b.Events.Publish(bus.Event{Kind: bus.Security, Name: "commands", Action: api.LockedOut, Detail: wait.String()})
+		}
+		return refusal{reason: reason}
+	}
+	return func(nonce []byte, message []byte, spend func() error) error {
+		m := CommandMessage{}
+		if err := json.Unmarshal(message, &m); err != nil {
+			return fmt.Errorf("invalid command: %w", err)
+		}
+		if scheme == "totp" && !b.Clock.Trusted() {
+			return fmt.Errorf("clock is not trusted")
+		}
+		now := time.Now()
+		actor := radar.Actor{ID: radar.ID(actorID(m.Actor))}
+		actor.Name = radar.FriendlyName(actor.ID)
+		if !actor.Known() {
+			return refuse(fmt.Errorf("unknown actor"), now)
+		}
+		encoded, ok := actorSecret(string(actor.ID), secretName)
+		if !ok {
+			return refuse(fmt.Errorf("%s has no %s secret", actor.DisplayName(), secretName), now)
+		}
+		secret, err := totp.DecodeSecret(encoded)
+		if err != nil {
+			return refuse(fmt.Errorf("%s: %w", actor.DisplayName(), err), now)
+		}
+		code := strings.TrimSpace(m.Code)
+		if err := proven(secret, nonce, code, m.Proof); err != nil {
+			return refuse(err, now)
+		}
+		// NOTE: only the actor's secret makes a proof, so the backoff doesn't hold it up
+		if err := spend(); err != nil {
+			return err
+		}
+		id := strings.ToUpper(string(actor.ID))
+		g.lock.Lock()
+		err = check(id, secret, code, now)
+		if err == nil {
+			g.failures = 0
+		}
+		g.lock.Unlock()
+		if err != nil {
+			return err
+		}
+		return b.Press(name, actor.ID, audit.Cause{Kind: "bluetooth command", By: actor.DisplayName()})
+	}, nil
+}
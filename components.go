@@ -0,0 +1,485 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/robolivable/beaves/api"
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/calendar"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/filter"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/power"
+	"github.com/robolivable/beaves/profile"
+	"github.com/robolivable/beaves/radar"
+	"github.com/robolivable/beaves/script"
+	"github.com/robolivable/beaves/supervisor"
+	"github.com/robolivable/beaves/trigger"
+	"github.com/robolivable/beaves/vacation"
+	"github.com/robolivable/beaves/vault"
+	"github.com/robolivable/beaves/version"
+)
+
+// Components adds the parts of beaves to the supervision tree: the core
+// every other part relies on, the radar (presence sensors), the controller
+// (switches and their inputs), the scheduler, and the integrations built on
+// them. Without a radar switches are still controlled by hand, and without a
+// controller presence is still recorded.
+func (b *Beaves) Components(t *supervisor.Tree) {
+	var nbts *radar.BTSentry
+	var server *api.Server
+
+	t.Add(supervisor.Component{Name: "core", Init: func() error {
+		var err error
+		if b.Zones, err = NewZones(b.Presence); err != nil {
+			return err
+		}
+		b.Overrides.OnExpire = b.expired
+		b.Clock.OnJump = func(d time.Duration) {
+			b.Overrides.Shift(d)
+			b.Events.Publish(bus.Event{Kind: bus.Alert, Name: "clock", Detail: fmt.Sprintf("clock jumped by %v", d)})
+		}
+		if b.Audit, err = audit.Open(config.StatePath(config.RuntimeConfig.AuditFile, audit.DefaultFile)); b.Audit == nil {
+			return err
+		} else if err != nil {
+			log.Error(err.Error())
+			b.Events.Publish(bus.Event{Kind: bus.Alert, Name: "audit", Detail: err.Error()})
+		}
+		if b.Profiles, err = profile.New(config.RuntimeConfig.Profiles, config.RuntimeConfig.Profile); err != nil {
+			return err
+		}
+		b.Profiles.OnChange = func(from *profile.Active, to *profile.Active) {
+			b.Events.Publish(bus.Event{Kind: bus.Profile, Name: to.Name, Action: to.Reason, Detail: from.Name})
+			if b.Vacation == nil {
+				return
+			}
+			if to.SimulatePresence {
+				b.Vacation.Start()
+			} else {
+				b.Vacation.Stop()
+			}
+		}
+		b.Profiles.Clock = b.Clock
+		if config.RuntimeConfig.Buzzer.Enabled {
+			if b.Buzzer, err = controller.NewBuzzer(config.RuntimeConfig.Buzzer); err != nil {
+				return err
+			}
+			b.Buzzer.Clock = b.Clock
+		}
+		return nil
+	}})
+	t.Add(supervisor.Component{Name: "clock", Needs: []string{"core"}, Run: b.Clock.Run})
+	if c := config.RuntimeConfig.LowPower; c.Hours.Start != "" || c.Hours.End != "" {
+		var s *power.Schedule
+		t.Add(supervisor.Component{Name: "power", Needs: []string{"clock"}, Init: func() error {
+			var err error
+			if s, err = power.NewSchedule(c); err != nil {
+				return err
+			}
+			s.Clock = b.Clock
+			return nil
+		}, Run: func() { s.Run() }})
+	}
+	t.Add(supervisor.Component{Name: "history", Run: func() { b.History.Record(b.Events) }})
+
+	t.Add(supervisor.Component{Name: "radar", Needs: []string{"core"}, Optional: true, Init: func() error {
+		b.configuredAdapters()
+		var err error
+		if nbts, err = b.sense(); err != nil {
+			for _, z := range b.Zones {
+				z.Proximity = nil
+			}
+		}
+		return err
+	}})
+
+	t.Add(supervisor.Component{Name: "controller", Needs: []string{"core"}, Optional: true, Init: func() error {
+		if err := b.control(); err != nil {
+			b.Switches, b.Actuator, b.Monitor = nil, nil, nil
+			for _, z := range b.Zones {
+				z.Actuator = nil
+			}
+			return err
+		}
+		return nil
+	}, Run: func() { b.Monitor.Run() }})
+
+	if config.RuntimeConfig.Battery.Enabled {
+		// NOTE: apart from the controller, so an unreadable ADC leaves the
+		// relays alone
+		t.Add(supervisor.Component{Name: "battery", Needs: []string{"core"}, Optional: true, Init: func() error {
+			battery, err := controller.NewBattery(config.RuntimeConfig.Battery, b.batteryRead)
+			if err != nil {
+				return err
+			}
+			b.Battery = battery
+			return nil
+		}, Run: func() { b.Battery.Run() }})
+	}
+
+	t.Add(supervisor.Component{Name: "scheduler", Needs: []string{"core"}, After: []string{"controller"}, Init: func() error {
+		if err := b.Profiles.Schedule(config.RuntimeConfig.ProfileSchedule); err != nil {
+			return err
+		}
+		return b.ScheduleSwitches(config.RuntimeConfig.SwitchSchedule)
+	}})
+
+	if config.RuntimeConfig.HistoryRetentionDays > 0 || config.RuntimeConfig.AuditRetentionDays > 0 {
+		t.Add(supervisor.Component{Name: "retention", Needs: []string{"clock"}, Run: b.Retain})
+	}
+
+	if config.RuntimeConfig.Unseen.Days > 0 {
+		t.Add(supervisor.Component{Name: "unseen", Needs: []string{"clock"}, Run: b.WatchUnseen})
+	}
+
+	if c := config.RuntimeConfig.Report; c.Daily != "" || c.Weekly != "" {
+		t.Add(supervisor.Component{Name: "reports", Needs: []string{"clock"}, After: []string{"history"}, Init: func() error {
+			return b.ScheduleReports(c)
+		}})
+	}
+
+	if len(config.RuntimeConfig.BlinkCodes) > 0 {
+		var alerts <-chan bus.Event
+		t.Add(supervisor.Component{Name: "blink codes", Needs: []string{"controller"}, Init: func() error {
+			// NOTE: subscribed before startup publishes the degraded alerts
+			alerts, _ = b.Events.Subscribe(16)
+			return nil
+		}, Run: func() { b.BlinkCodes(alerts) }})
+	}
+
+	if config.RuntimeConfig.Calendar.URL != "" {
+		var c *calendar.Calendar
+		t.Add(supervisor.Component{Name: "calendar", Needs: []string{"scheduler"}, Optional: true, Init: func() error {
+			var err error
+			if c, err = calendar.New(config.RuntimeConfig.Calendar); err != nil {
+				return err
+			}
+			for _, r := range config.RuntimeConfig.Calendar.Rules {
+				if r.Profile == "" {
+					continue
+				}
+				if !slices.Contains(b.Profiles.Names(), r.Profile) {
+					return fmt.Errorf("calendar rule %q refers to unknown profile %q", r.Match, r.Profile)
+				}
+			}
+			c.Clock = b.Clock
+			c.OnChange = b.Calendar
+			return nil
+		}, Run: func() { c.Run() }})
+	}
+
+	if len(config.RuntimeConfig.Triggers) > 0 {
+		triggers := []*trigger.Trigger{}
+		t.Add(supervisor.Component{Name: "triggers", Needs: []string{"core"}, Optional: true, Init: func() error {
+			for _, c := range config.RuntimeConfig.Triggers {
+				tr, err := trigger.New(c)
+				if err != nil {
+					return err
+				}
+				triggers = append(triggers, tr)
+			}
+			return nil
+		}, Run: func() { trigger.Run(b.Events, triggers) }})
+	}
+
+	if c := config.RuntimeConfig.Script; c.File != "" {
+		var s *script.Script
+		t.Add(supervisor.Component{Name: "script", Needs: []string{"controller"}, Optional: true, Init: func() error {
+			var err error
+			s, err = script.Load(c, scripted{b: b, file: c.File})
+			return err
+		}, Run: func() { s.Run(b.Events) }})
+	}
+
+	web := supervisor.Component{Name: "api", Needs: []string{"core"}, After: []string{"radar", "controller", "battery"}, Policy: supervisor.Permanent, Init: func() error {
+		server = api.NewServer(config.RuntimeConfig.API, b.Presence)
+		if config.RuntimeConfig.Pairing.Enabled && nbts != nil {
+			agent, err := radar.NewAgent(
+				nbts.Adapter(),
+				radar.Capability(config.RuntimeConfig.Pairing.Capability),
+				time.Duration(config.RuntimeConfig.Pairing.TimeoutMs)*time.Millisecond,
+				config.RuntimeConfig.Pairing.RequireComparison,
+			)
+			if err != nil {
+				return err
+			}
+			agent.OnRequest = func(radar.PairingRequest) { b.Chirp(controller.EnrollmentChirp) }
+			if err := agent.Register(); err != nil {
+				return err
+			}
+			ShutdownOn(agent.Unregister)
+			server.Pairing(agent)
+		}
+		server.Events(b.Events, b.Command)
+		if nbts != nil && nbts.Adapter().Trace != nil {
+			server.BluetoothTrace(nbts.Adapter().Trace)
+		}
+		if nbts != nil {
+			server.BluetoothRejections()
+		}
+		server.Health(b.Monitor)
+		if b.Battery != nil {
+			server.Battery(b.Battery)
+		}
+		server.Components(t.Status)
+		server.Switches(b.Switches)
+		server.Profiles(b.Profiles)
+		server.Overrides(b.Overrides, b, overrideDuration())
+		server.Groups(config.RuntimeConfig.Groups, b.Sequence)
+		server.Patterns(config.RuntimeConfig.Patterns, b.Play)
+		server.Stats(b.History)
+		server.Latency(b.Latency)
+		server.Seen(b.LastSeen)
+		server.Zones(b.zonePresence())
+		if len(b.Adapters) > 0 {
+			server.Adapters(b.AdapterInfo)
+		}
+		server.Purge(b.Purge)
+		return nil
+	}}
+	if config.RuntimeConfig.API.Enabled {
+		web.Run = func() {
+			if err := server.Serve(); err != nil {
+				log.Error("api: %s", err.Error())
+			}
+		}
+	}
+	t.Add(web)
+
+	if config.RuntimeConfig.Feed.Enabled {
+		t.Add(supervisor.Component{Name: "mqtt", Needs: []string{"core"}, Optional: true, Init: func() error {
+			var err error
+			if b.Shared, err = filter.Parse(config.RuntimeConfig.Feed.Filter); err != nil {
+				return fmt.Errorf("feed: %w", err)
+			}
+			if b.Feed, err = DialFeed(); err != nil {
+				return err
+			}
+			ShutdownOn(b.Feed.Close)
+			if c := config.RuntimeConfig.Feed.Geofence; c.Enabled {
+				if err := b.FollowGeofence(c); err != nil {
+					return err
+				}
+			}
+			if c := config.RuntimeConfig.Feed.Passage; c.Enabled {
+				return b.FollowPassage(c)
+			}
+			return nil
+		}})
+	}
+}
+
+// control sets up the switches and the inputs driving them.
+func (b *Beaves) control() error {
+	switches, err := controller.NewSwitches(config.RuntimeConfig.Switches, b.Alert)
+	if err != nil {
+		return err
+	}
+	managed := managedSwitch()
+	nor, ok := switches[managed]
+	if !ok {
+		return fmt.Errorf("managed switch %q is not configured", managed)
+	}
+	b.Monitor = controller.NewMonitor(switches, time.Duration(config.RuntimeConfig.HealthCheckMs)*time.Millisecond, b.Health)
+	b.Switches = switches
+	b.Actuator = controller.NewActuator(managed, nor, config.RuntimeConfig.ActuationQueueSize)
+	b.Zones[0].Actuator = b.Actuator
+	for _, z := range b.Zones[1:] {
+		name := zoneConfig(z.Name).ManagedSwitch
+		if other, ok := b.managing(name); ok {
+			return fmt.Errorf("zone %s: switch %q is already managed by zone %s", z.Name, name, other.Name)
+		}
+		s, ok := switches[name]
+		if !ok {
+			return fmt.Errorf("zone %s: managed switch %q is not configured", z.Name, name)
+		}
+		z.Actuator = controller.NewActuator(name, s, config.RuntimeConfig.ActuationQueueSize)
+	}
+	for _, z := range b.Zones {
+		for _, c := range config.RuntimeConfig.Switches {
+			if c.Name == z.Actuator.Name() {
+				z.Switch = c
+			}
+		}
+	}
+	b.Queues = map[string]*controller.Actuator{}
+	for name, s := range switches {
+		if _, ok := b.managing(name); !ok {
+			b.Queues[name] = controller.NewActuator(name, s, config.RuntimeConfig.ActuationQueueSize)
+		}
+	}
+	if err := b.Arbitrate(config.RuntimeConfig.Switches); err != nil {
+		return err
+	}
+	for _, name := range config.RuntimeConfig.Vacation.Switches {
+		if _, ok := switches[name]; !ok {
+			return fmt.Errorf("vacation switch %q is not configured", name)
+		}
+	}
+	b.Vacation = vacation.New(config.RuntimeConfig.Vacation, b.History, b.Automate)
+	b.Vacation.Clock = b.Clock
+	if err := b.loadPatterns(config.RuntimeConfig.Patterns); err != nil {
+		return err
+	}
+	if err := b.checkGroups(config.RuntimeConfig.Groups); err != nil {
+		return err
+	}
+	for _, z := range b.Zones {
+		if err := b.checkActorActions(z); err != nil {
+			return fmt.Errorf("zone %s: %w", z.Name, err)
+		}
+	}
+	if b.Profiles.Active().SimulatePresence {
+		b.Vacation.Start()
+	}
+	if config.RuntimeConfig.Energy.Enabled {
+		if b.Energy, err = controller.NewPulseMeter(config.RuntimeConfig.Energy); err != nil {
+			return err
+		}
+		supervisor.Go("energy meter", b.Energy.Run)
+		b.Meter()
+	}
+	if config.RuntimeConfig.Override.Button != "" {
+		button, err := controller.NewButton(config.RuntimeConfig.Override.Button, config.RuntimeConfig.Override.DebounceMs)
+		if err != nil {
+			return err
+		}
+		supervisor.Go("override button", func() { button.Run(b.ToggleOverride) })
+	}
+	return nil
+}
+
+// sense sets up the sentries of every zone, and returns the Bluetooth sentry
+// of the main zone.
+func (b *Beaves) sense() (*radar.BTSentry, error) {
+	nbts, err := radar.NewBTSentry(config.RuntimeConfig.Bluetooth)
+	if err != nil {
+		return nil, err
+	}
+	ShutdownOn(nbts.Close)
+	b.adapter(nbts.Adapter())
+	if err := nbts.ServeInfo(version.Get().String()); err != nil {
+		log.Error(err.Error())
+	}
+	if c := config.RuntimeConfig.Bluetooth.Admin; c.Enabled {
+		key, err := vault.ReadKey(c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := nbts.ServeAdmin(key, applyDelta); err != nil {
+			return nil, err
+		}
+	}
+	if c := config.RuntimeConfig.Bluetooth.Commands; c.Enabled {
+		accept, err := b.commands(c)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := nbts.ServeCommands(accept); err != nil {
+			return nil, err
+		}
+	}
+	var bt radar.Proximity = nbts
+	if config.RuntimeConfig.ArrivalDwellMs > 0 {
+		bt = radar.NewDwell(nbts, time.Duration(config.RuntimeConfig.ArrivalDwellMs)*time.Millisecond)
+	}
+	sentries := []radar.Proximity{bt}
+	if config.RuntimeConfig.Bluetooth.Passive.Enabled {
+		passive, err := radar.NewPassiveSentry(config.RuntimeConfig.Bluetooth)
+		if err != nil {
+			return nil, err
+		}
+		sentries = append(sentries, passive)
+	}
+	if config.RuntimeConfig.Bluetooth.Classic.Enabled {
+		classic, err := radar.NewClassicSentry(config.RuntimeConfig.Bluetooth)
+		if err != nil {
+			return nil, err
+		}
+		sentries = append(sentries, classic)
+	}
+	if config.RuntimeConfig.NFC.Enabled {
+		nfc, err := radar.NewNFCSentry(config.RuntimeConfig.NFC)
+		if err != nil {
+			return nil, err
+		}
+		sentries = append(sentries, nfc)
+	}
+	if config.RuntimeConfig.Distance.Enabled {
+		distance, err := radar.NewDistanceSentry(config.RuntimeConfig.Distance)
+		if err != nil {
+			return nil, err
+		}
+		sentries = append(sentries, distance)
+	}
+	if config.RuntimeConfig.Ping.Enabled {
+		ping, err := radar.NewPingSentry(config.RuntimeConfig.Ping)
+		if err != nil {
+			return nil, err
+		}
+		sentries = append(sentries, ping)
+	}
+	if config.RuntimeConfig.Leases.Enabled {
+		leases, err := radar.NewLeasesSentry(config.RuntimeConfig.Leases)
+		if err != nil {
+			return nil, err
+		}
+		sentries = append(sentries, leases)
+	}
+	if config.RuntimeConfig.MMWave.Enabled {
+		mmwave, err := radar.NewLD2410Sentry(config.RuntimeConfig.MMWave)
+		if err != nil {
+			return nil, err
+		}
+		sentries = append(sentries, mmwave)
+	}
+	b.Zones[0].Proximity = radar.NewFusion(sentries...)
+	if config.RuntimeConfig.CoalesceMs > 0 {
+		b.Zones[0].Proximity = radar.NewCoalesce(b.Zones[0].Proximity, time.Duration(config.RuntimeConfig.CoalesceMs)*time.Millisecond)
+	}
+	b.Zones[0].Trend = nbts.Trend()
+	if err := nbts.Reconcile(b.Zones[0].Presence); err != nil {
+		log.Error("failed to reconcile presence: %s", err.Error())
+	}
+	nbts.SetStatus(b.Zones[0].status)
+	for _, z := range b.Zones[1:] {
+		c := zoneConfig(z.Name)
+		sentry, err := radar.NewBTSentry(c.Bluetooth)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %w", z.Name, err)
+		}
+		ShutdownOn(sentry.Close)
+		b.adapter(sentry.Adapter())
+		sentry.SetStatus(z.status)
+		z.Proximity = sentry
+		z.Trend = sentry.Trend()
+		if err := sentry.Reconcile(z.Presence); err != nil {
+			log.Error("zone %s: failed to reconcile presence: %s", z.Name, err.Error())
+		}
+		if c.ArrivalDwellMs > 0 {
+			z.Proximity = radar.NewDwell(sentry, time.Duration(c.ArrivalDwellMs)*time.Millisecond)
+		}
+		if c.Bluetooth.Passive.Enabled {
+			passive, err := radar.NewPassiveSentry(c.Bluetooth)
+			if err != nil {
+				return nil, fmt.Errorf("zone %s: %w", z.Name, err)
+			}
+			z.Proximity = radar.NewFusion(z.Proximity, passive)
+		}
+		if c.Bluetooth.Classic.Enabled {
+			classic, err := radar.NewClassicSentry(c.Bluetooth)
+			if err != nil {
+				return nil, fmt.Errorf("zone %s: %w", z.Name, err)
+			}
+			z.Proximity = radar.NewFusion(z.Proximity, classic)
+		}
+		if c.CoalesceMs > 0 {
+			z.Proximity = radar.NewCoalesce(z.Proximity, time.Duration(c.CoalesceMs)*time.Millisecond)
+		}
+	}
+	return nbts, nil
+}
@@ -1,53 +1,759 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
+	_ "time/tzdata" // timezones resolve without the system database
+
+	"github.com/robolivable/beaves/vault"
 )
 
 type Log struct {
 	Enabled bool `json:"enabled"`
 	Debug   bool `json:"debug"`
+	FlushMs int  `json:"flushMs"` // how often suppressed repeats are summarized; negative never
+
+	Categories map[string]bool `json:"categories"` // debug logging by category, overriding debug
+}
+
+type Privacy struct {
+	Pseudonymize bool   `json:"pseudonymize"` // device addresses in logs, dumps and exports
+	KeyFile      string `json:"keyFile"`      // HMAC key, created on first start
+}
+
+type ActorVault struct {
+	File    string `json:"file"`    // encrypted known actors and their secrets
+	KeyFile string `json:"keyFile"` // hex encoded AES-256 key
 }
 
 type Actors struct {
-	Known []string `json:"known"`
+	Known    []string          `json:"known"`
+	Names    map[string]string `json:"names"`    // friendly names by actor ID, used in events and logs
+	Vault    ActorVault        `json:"vault"`    // known actors kept out of plaintext config
+	Priority map[string]int    `json:"priority"` // by actor ID; higher prevails in conflicts
+	Conflict string            `json:"conflict"` // "last" (default), "priority", "entering" or "occupancy"
+
+	Actions map[string]ActorActions `json:"actions"` // by actor ID; replaces driving the managed switch
+}
+
+// ActorActions maps "Entering" and "Exiting" to what they do for an actor. An
+// action mapped to an empty list does nothing; one left out drives the managed
+// switch as usual.
+type ActorActions map[string][]ActorAction
+
+type ActorAction struct {
+	Switch  string `json:"switch"`
+	Command string `json:"command"` // "on", "off", "toggle" or "press", as in the API
+	Group   string `json:"group"`   // runs a group instead of a switch command
+	Pattern string `json:"pattern"` // plays a pattern instead of a switch command
+}
+
+// Group is a named operation driving several switches in order, e.g. powering
+// a gate opener before pulsing its trigger.
+type Group struct {
+	Name  string      `json:"name"`
+	Steps []GroupStep `json:"steps"`
+}
+
+type GroupStep struct {
+	Switch  string `json:"switch"`
+	Command string `json:"command"` // "on", "off", "toggle" or "press", as in the API
+	Pattern string `json:"pattern"` // played instead of a switch command
+	DelayMs int    `json:"delayMs"` // wait before the step
+}
+
+// Pattern is a timed on/off sequence a switch is driven through, e.g. a
+// double pulse for a gate opener or a blink code on an LED.
+type Pattern struct {
+	Name   string        `json:"name"`
+	Switch string        `json:"switch"`
+	Steps  []PatternStep `json:"steps"`
+	Times  int           `json:"times"` // the steps are played; defaults to once
+}
+
+type PatternStep struct {
+	State string `json:"state"` // "on" or "off"
+	Ms    int    `json:"ms"`    // held before the next step
 }
 
 type Bluetooth struct {
-	AdvertisementName        string `json:"advertisementName"`
-	AdvertisementDelayMs     int    `json:"advertisementDelayMs"`
-	ServiceID                string `json:"serviceId"`
-	IndicateCharacteristicID string `json:"indicateCharacteristicId"`
-	ConnectionPoolSize       int    `json:"connectionPoolSize"`
-	ConnectionsLimit         int    `json:"connectionsLimit"`
-	ConnectionLimitDelayMs   int    `json:"connectionLimitDelayMs"`
-	DisconnectionDelayMs     int    `json:"disconnectionDelayMs"`
+	Adapter                  string   `json:"adapter"` // BlueZ adapter, e.g. "hci1"; defaults to "hci0"
+	AdvertisementName        string   `json:"advertisementName"`
+	AdvertisementDelayMs     int      `json:"advertisementDelayMs"`    // time spent advertising per cycle
+	AdvertisementPauseMs     int      `json:"advertisementPauseMs"`    // radio silence between cycles
+	AdvertisementIntervalMs  int      `json:"advertisementIntervalMs"` // time between advertising packets
+	ContinuousAdvertising    bool     `json:"continuousAdvertising"`   // advertise forever without cycling
+	Occupied                 Occupied `json:"occupied"`                // advertise less while actors are home
+	ServiceID                string   `json:"serviceId"`
+	IndicateCharacteristicID string   `json:"indicateCharacteristicId"`
+	ConnectionPoolSize       int      `json:"connectionPoolSize"`
+	Reserved                 []string `json:"reserved"` // actors, by ID or name, the last pool slot is kept for
+	ConnectionsLimit         int      `json:"connectionsLimit"`
+	ConnectionLimitDelayMs   int      `json:"connectionLimitDelayMs"`
+	DisconnectionDelayMs     int      `json:"disconnectionDelayMs"`
+	WorkerPoolSize           int      `json:"workerPoolSize"`
+	NodeID                   uint16   `json:"nodeId"`    // identifies this node in manufacturer data
+	CompanyID                uint16   `json:"companyId"` // manufacturer data company identifier
+	AdapterAlias             string   `json:"adapterAlias"`
+	TxPowerDbm               *int     `json:"txPowerDbm"` // advertising TX power, where supported
+	Trend                    Trend    `json:"trend"`
+	Trace                    Trace    `json:"trace"`
+	Admin                    Admin    `json:"admin"`
+	Commands                 Commands `json:"commands"`
+	NonceTTLMs               int      `json:"nonceTtlMs"` // authenticated writes must carry a nonce issued this recently
+	Passive                  Passive  `json:"passive"`
+	Classic                  Classic  `json:"classic"`
+	Frames                   []Frame  `json:"frames"` // advertised in turn after the presence advertisement
+}
+
+// Frame is an advertisement of its own, taking turns with the presence
+// advertisement in every cycle, e.g. an iBeacon frame for beacon-based
+// automations.
+type Frame struct {
+	Type       string `json:"type"`       // "ibeacon" or "custom"
+	DurationMs int    `json:"durationMs"` // how long it is advertised each cycle
+
+	UUID          string `json:"uuid"`          // ibeacon: proximity UUID
+	Major         uint16 `json:"major"`         // ibeacon
+	Minor         uint16 `json:"minor"`         // ibeacon
+	MeasuredPower int8   `json:"measuredPower"` // ibeacon: RSSI at 1m in dBm; defaults to -59
+
+	LocalName        string   `json:"localName"`        // custom
+	ServiceUUIDs     []string `json:"serviceUuids"`     // custom
+	CompanyID        uint16   `json:"companyId"`        // custom: of the manufacturer data
+	ManufacturerData string   `json:"manufacturerData"` // custom: hex
+	Connectable      bool     `json:"connectable"`      // custom
+}
+
+// Classic finds actors by paging their Bluetooth Classic (BR/EDR) devices,
+// which never show up over BLE.
+type Classic struct {
+	Enabled    bool     `json:"enabled"`
+	Devices    []string `json:"devices"`    // addresses of known actors
+	Method     string   `json:"method"`     // "l2ping" (default) or "name"
+	IntervalMs int      `json:"intervalMs"` // between rounds of probes
+	TimeoutMs  int      `json:"timeoutMs"`  // of each probe
+	Misses     int      `json:"misses"`     // unanswered probes in a row before Exiting
+}
+
+// Occupied lengthens the pause between advertising cycles while enough
+// actors are present, cutting radio time on battery or solar powered
+// installations, and restores it once the house empties.
+type Occupied struct {
+	MinPresent int `json:"minPresent"` // actors present for the pause to apply; 0 disables
+	PauseMs    int `json:"pauseMs"`    // pause while occupied; -1 stops advertising
+}
+
+// Passive recognizes actors from their advertisements alone, never
+// connecting, e.g. watches and fitness bands that advertise constantly but
+// refuse connections.
+type Passive struct {
+	Enabled bool          `json:"enabled"`
+	AwayMs  int           `json:"awayMs"`  // unheard this long means Exiting
+	MinRSSI int           `json:"minRssi"` // weaker advertisements are ignored; 0 takes any
+	Devices []Fingerprint `json:"devices"`
+}
+
+// Fingerprint describes the advertisements of an actor's device; every field
+// given must match.
+type Fingerprint struct {
+	Actor            string   `json:"actor"`            // known actor reported for the device
+	Tracker          string   `json:"tracker"`          // "airtag", "tile" or "smarttag"
+	Address          string   `json:"address"`          // for devices that keep theirs
+	IRK              string   `json:"irk"`              // identity resolving key, for devices that rotate theirs
+	ServiceUUIDs     []string `json:"serviceUuids"`     // advertised services, 16 or 128 bit
+	CompanyID        *uint16  `json:"companyId"`        // manufacturer data company identifier
+	ManufacturerData string   `json:"manufacturerData"` // hex prefix of the manufacturer data
+	Name             string   `json:"name"`             // advertised local name
+}
+
+// Zone is another presence pipeline run by the same process, e.g. a second
+// adapter watching the front door while the top level config watches the
+// garage. It shares the known actors, switches and profiles.
+type Zone struct {
+	Name             string                  `json:"name"`
+	Bluetooth        Bluetooth               `json:"bluetooth"`     // its own sentry, on its own adapter
+	ManagedSwitch    string                  `json:"managedSwitch"` // driven by presence in the zone; no other zone's
+	Conflict         string                  `json:"conflict"`      // as actors.conflict
+	Actions          map[string]ActorActions `json:"actions"`       // as actors.actions
+	ArrivalDwellMs   int                     `json:"arrivalDwellMs"`
+	CoalesceMs       int                     `json:"coalesceMs"`
+	OperationDelayMs int                     `json:"operationDelayMs"`
+}
+
+// Admin accepts config changes pushed by an admin device over Bluetooth.
+type Admin struct {
+	Enabled  bool   `json:"enabled"`
+	KeyFile  string `json:"keyFile"`  // hex key shared with the admin device
+	Sequence uint64 `json:"sequence"` // of the last change applied; a change must be numbered higher
+}
+
+// Commands lets actors' phones pulse a switch over Bluetooth with a one-time
+// code made from a secret kept for them in the vault, for doors where
+// connecting alone is too weak.
+type Commands struct {
+	Enabled      bool   `json:"enabled"`
+	Switch       string `json:"switch"`       // pulsed by a valid command; defaults to the managed switch
+	Scheme       string `json:"scheme"`       // "totp" (default) or "rolling"
+	SkewSteps    int    `json:"skewSteps"`    // 30 second steps a code may be off by either way; defaults to 1
+	Window       int    `json:"window"`       // rolling codes accepted ahead of the next expected one
+	ResyncWindow int    `json:"resyncWindow"` // further ahead, two codes in a row resynchronize
+	CountersFile string `json:"countersFile"` // next rolling code counter of each actor
+	MaxFailures  int    `json:"maxFailures"`  // wrong codes before an actor is locked out; -1 never locks out
+	LockoutMs    int    `json:"lockoutMs"`
+}
+
+// Trace keeps low level BLE detail apart from the log, for the CLI to show.
+type Trace struct {
+	Enabled bool `json:"enabled"`
+	Size    int  `json:"size"` // entries kept; the oldest are dropped
+}
+
+// Trend infers which way known actors move from their signal strength.
+type Trend struct {
+	Enabled  bool    `json:"enabled"`  // scan for advertisements of known actors
+	WindowMs int     `json:"windowMs"` // readings considered
+	MinSlope float64 `json:"minSlope"` // dBm per second of change that counts as moving
+}
+
+type Tone struct {
+	FrequencyHz int `json:"frequencyHz"`
+	DurationMs  int `json:"durationMs"`
+	Repeat      int `json:"repeat"`
+	GapMs       int `json:"gapMs"`
+}
+
+type Clock struct {
+	CheckMs       int  `json:"checkMs"`       // how often synchronization and jumps are checked
+	MaxJumpMs     int  `json:"maxJumpMs"`     // wall clock changes beyond this are reported
+	TrustUnsynced bool `json:"trustUnsynced"` // e.g. with a battery-backed RTC and no network
+}
+
+type QuietHours struct {
+	Start string `json:"start"` // e.g. "22:00"
+	End   string `json:"end"`   // e.g. "07:00"
+}
+
+// LowPower slows the sentry down to save power, e.g. on solar powered gate
+// controllers.
+type LowPower struct {
+	Hours              QuietHours `json:"hours"`              // e.g. 22:00-06:00
+	PollFactor         float64    `json:"pollFactor"`         // sensors poll this many times less often
+	AdvertisingPauseMs int        `json:"advertisingPauseMs"` // advertising pauses at least this long
+	Debug              bool       `json:"debug"`              // keep debug logging on
+}
+
+// Unseen alerts on actors that haven't been detected for a while, usually a
+// beacon with a dead battery or a phone replaced under a new address.
+type Unseen struct {
+	Days   int      `json:"days"`
+	Actors []string `json:"actors"` // by ID or name; empty for every known actor
+}
+
+type Buzzer struct {
+	Enabled    bool            `json:"enabled"`
+	Terminal   string          `json:"terminal"`
+	Tones      map[string]Tone `json:"tones"`
+	QuietHours QuietHours      `json:"quietHours"`
+}
+
+type Delays struct {
+	OnMs  *int `json:"onMs"`  // wait before switching On; unset uses the default
+	OffMs *int `json:"offMs"` // wait before switching Off; unset uses the default
+}
+
+type Modbus struct {
+	Port      string `json:"port"` // RS-485 serial device, e.g. "/dev/ttyUSB0"
+	Baud      int    `json:"baud"`
+	TimeoutMs int    `json:"timeoutMs"`
+	Unit      byte   `json:"unit"`
+	Coil      uint16 `json:"coil"`
+}
+
+type MQTT struct {
+	Broker      string `json:"broker"` // host:port
+	ClientID    string `json:"clientID"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	KeepAliveMs int    `json:"keepAliveMs"`
+}
+
+type Feed struct {
+	Enabled  bool     `json:"enabled"`
+	Topic    string   `json:"topic"`  // prefix of the published topics; defaults to "beaves"
+	Filter   string   `json:"filter"` // expression selecting the presence events published
+	Passage  Passage  `json:"passage"`
+	Geofence Geofence `json:"geofence"`
+}
+
+// Geofence follows OwnTracks reports of actors' phones being inside a region,
+// through the feed's broker.
+type Geofence struct {
+	Enabled  bool              `json:"enabled"`
+	Region   string            `json:"region"`   // defaults to "home"
+	MaxAgeMs int               `json:"maxAgeMs"` // older reports don't count; defaults to 10 minutes
+	Topics   map[string]string `json:"topics"`   // OwnTracks topic of each actor's phone, e.g. "owntracks/alice/phone"
+}
+
+// Passage infers direction of travel from the order two nodes on the feed
+// detect an actor in.
+type Passage struct {
+	Enabled  bool   `json:"enabled"`
+	Outer    uint16 `json:"outer"`    // node ID of the sentry farther out, e.g. at the gate
+	Inner    uint16 `json:"inner"`    // node ID of the sentry nearer the house
+	WindowMs int    `json:"windowMs"` // longest time between the two detections
+}
+
+type Zigbee struct {
+	Device    string `json:"device"`    // zigbee2mqtt friendly name
+	BaseTopic string `json:"baseTopic"` // defaults to "zigbee2mqtt"
+	Property  string `json:"property"`  // e.g. "state_l2" for multi-gang relays
+	TimeoutMs int    `json:"timeoutMs"` // wait for the device to confirm
+}
+
+type HTTP struct {
+	Preset   string `json:"preset"` // "tasmota", "esphome" or "shelly"
+	Host     string `json:"host"`
+	Channel  string `json:"channel"` // relay index or ESPHome switch id
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// URL templates, e.g. "http://{{.Host}}/relay/{{.Channel}}?turn=on";
+	// these override the preset's
+	Method   string `json:"method"`
+	On       string `json:"on"`
+	Off      string `json:"off"`
+	State    string `json:"state"`
+	StateKey string `json:"stateKey"` // JSON field holding the state in responses
+
+	TimeoutMs int `json:"timeoutMs"`
+}
+
+type Failover struct {
+	Members   []Switch `json:"members"`   // in order of preference
+	Threshold int      `json:"threshold"` // consecutive errors before failing over
+	ProbeMs   int      `json:"probeMs"`   // how often preferred members are retried
+}
+
+type WallSwitch struct {
+	Input      string `json:"input"`  // GPIO wired to the wall switch, to ground
+	Rocker     bool   `json:"rocker"` // every flip toggles, rather than every press
+	DebounceMs int    `json:"debounceMs"`
+	Policy     string `json:"policy"` // "last-writer-wins" (default), "manual-wins" or "automation-only"
+	HoldMs     int    `json:"holdMs"` // manual-wins: automation waits this long after a manual change
+}
+
+type Switch struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`      // "gpio" (default), "modbus", "zigbee", "http", "failover" or "mock"
+	Terminals []string `json:"terminals"` // gpio: claimed in order; later entries are backups
+	Modbus    Modbus   `json:"modbus"`
+	Zigbee    Zigbee   `json:"zigbee"`
+	HTTP      HTTP     `json:"http"`
+	Failover  Failover `json:"failover"`
+
+	WallSwitch WallSwitch `json:"wallSwitch"` // physical input sharing the relay with automation
+
+	MaintenanceCycles uint64 `json:"maintenanceCycles"` // alert once the relay has cycled this often
+	MaxOnMs           int    `json:"maxOnMs"`           // forcibly turn Off after this long On; 0 disables
+
+	MinIntervalMs int `json:"minIntervalMs"` // minimum time between On/Off transitions
+
+	DistanceBound   DistanceBound `json:"distanceBound"`   // actors must be at the door when it is pressed for them
+	RequireGeofence bool          `json:"requireGeofence"` // and their phones must recently have reported being home
+
+	Delays       Delays            `json:"delays"`
+	ActionDelays map[string]Delays `json:"actionDelays"` // keyed by action, e.g. "entering"
+}
+
+// DistanceBound refuses to press a door or lock switch for an arriving actor
+// whose signal is weaker than a strict threshold at the moment it would
+// switch, so a device relayed from the street isn't enough. It needs the
+// signal strength trend of the zone's sentry.
+type DistanceBound struct {
+	MinRSSI  int `json:"minRssi"`  // average signal of the actor, e.g. -55; 0 disables
+	WindowMs int `json:"windowMs"` // readings averaged; defaults to 3000
+}
+
+// Profile overrides a subset of the configuration while it is active.
+type Profile struct {
+	IgnorePresence   bool              `json:"ignorePresence"`   // presence does not drive the managed switch
+	Quiet            bool              `json:"quiet"`            // buzzer stays silent
+	SimulatePresence bool              `json:"simulatePresence"` // replay past switching while away
+	OperationDelayMs *int              `json:"operationDelayMs"`
+	Delays           *Delays           `json:"delays"` // managed switch
+	ActionDelays     map[string]Delays `json:"actionDelays"`
+}
+
+type ProfileChange struct {
+	At      string `json:"at"`   // "15:04", local time
+	Cron    string `json:"cron"` // instead of at, e.g. "0 23 * * mon-fri"
+	Profile string `json:"profile"`
+}
+
+// CalendarRule applies while an event whose summary contains Match is on.
+type CalendarRule struct {
+	Match   string   `json:"match"`   // case insensitive, e.g. "vacation"
+	Profile string   `json:"profile"` // activated for the event's duration
+	Actors  []string `json:"actors"`  // known for the event's duration, e.g. a cleaner's phone
+}
+
+type Calendar struct {
+	URL    string         `json:"url"`    // iCalendar feed, e.g. a calendar's secret address
+	PollMs int            `json:"pollMs"` // how often the feed is fetched
+	Rules  []CalendarRule `json:"rules"`
+}
+
+// Supervisor tunes how components are restarted.
+type Supervisor struct {
+	Policies map[string]string `json:"policies"` // by component: "permanent", "transient" or "temporary"
+}
+
+// Update installs signed releases published at a URL.
+type Update struct {
+	Enabled     bool   `json:"enabled"`
+	URL         string `json:"url"`         // release description, see update.Release
+	PublicKey   string `json:"publicKey"`   // hex ed25519 key releases are signed with
+	CheckMs     int    `json:"checkMs"`     // how often the URL is checked
+	ProbationMs int    `json:"probationMs"` // a new binary must stay up and healthy this long
+}
+
+// SwitchChange is a recurring change of a switch.
+type SwitchChange struct {
+	Cron   string `json:"cron"`
+	Switch string `json:"switch"`
+	State  string `json:"state"` // "on" or "off"
+}
+
+type Report struct {
+	Daily  string `json:"daily"`  // cron schedule of the report on the day before, e.g. "0 7 * * *"
+	Weekly string `json:"weekly"` // cron schedule of the report on the 7 days before, e.g. "0 7 * * mon"
+	File   string `json:"file"`   // each report is appended here as well as published
+}
+
+type Vacation struct {
+	Switches      []string `json:"switches"`      // lights driven while presence is simulated
+	LookbackDays  int      `json:"lookbackDays"`  // history sampled for the schedule
+	JitterMs      int      `json:"jitterMs"`      // random shift applied to each replayed change
+	ReturnProfile string   `json:"returnProfile"` // activated on arrival; defaults to "home"
+}
+
+type Override struct {
+	DurationMs int    `json:"durationMs"` // how long a pin lasts unless given; 0 lasts until cleared
+	Button     string `json:"button"`     // GPIO of a push button that pins the managed switch
+	DebounceMs int    `json:"debounceMs"`
+}
+
+type Interlock struct {
+	Switches   []string `json:"switches"`
+	Exclusive  bool     `json:"exclusive"`  // never allow more than one switch On
+	DeadTimeMs int      `json:"deadTimeMs"` // mandatory Off time before another switch turns On
+}
+
+type NFC struct {
+	Enabled   bool              `json:"enabled"`
+	Bus       string            `json:"bus"`     // "i2c" or "spi"
+	Port      string            `json:"port"`    // bus or port name; empty selects the first
+	Address   uint16            `json:"address"` // i2c address; defaults to 0x24
+	PollMs    int               `json:"pollMs"`
+	HoldoffMs int               `json:"holdoffMs"` // ignore repeated reads of a tag held to the reader
+	Tags      map[string]string `json:"tags"`      // tag UID (hex) -> actor ID
+}
+
+type Distance struct {
+	Enabled      bool   `json:"enabled"`
+	Trigger      string `json:"trigger"` // HC-SR04 trigger pin, e.g. "GPIO23"
+	Echo         string `json:"echo"`    // HC-SR04 echo pin, e.g. "GPIO24"
+	ThresholdMm  int    `json:"thresholdMm"`
+	HysteresisMm int    `json:"hysteresisMm"`
+	Samples      int    `json:"samples"` // consecutive readings required to cross
+	PollMs       int    `json:"pollMs"`
+	Actor        string `json:"actor"` // actor reported for the detected object
+}
+
+type MMWave struct {
+	Enabled bool   `json:"enabled"`
+	Port    string `json:"port"` // serial device; defaults to /dev/serial0
+	Baud    int    `json:"baud"`
+	ClearMs int    `json:"clearMs"` // time without a target before Exiting
+	Actor   string `json:"actor"`   // actor reported for the occupied area
+}
+
+// Ping finds actors by pinging their devices on the LAN, e.g. phones with a
+// DHCP reservation.
+type Ping struct {
+	Enabled    bool              `json:"enabled"`
+	Hosts      map[string]string `json:"hosts"` // actor -> IP address or hostname
+	IntervalMs int               `json:"intervalMs"`
+	TimeoutMs  int               `json:"timeoutMs"` // of each ping
+	Misses     int               `json:"misses"`    // unanswered pings in a row before Exiting
+}
+
+// Leases finds actors by the DHCP leases of their devices, or the clients the
+// router sees, for devices that sleep their radios.
+type Leases struct {
+	Enabled     bool              `json:"enabled"`
+	Source      string            `json:"source"`      // "dnsmasq" (default), "openwrt" or "unifi"
+	File        string            `json:"file"`        // dnsmasq: lease file
+	URL         string            `json:"url"`         // openwrt, unifi: the router, e.g. "http://192.168.1.1"
+	Username    string            `json:"username"`    // openwrt, unifi
+	Password    string            `json:"password"`    // openwrt, unifi
+	Site        string            `json:"site"`        // unifi: defaults to "default"
+	UniFiOS     bool              `json:"unifiOs"`     // unifi: a UniFi OS console rather than a standalone controller
+	InsecureTLS bool              `json:"insecureTls"` // accept the router's self-signed certificate
+	Devices     map[string]string `json:"devices"`     // actor -> MAC address of its device on the network
+	IntervalMs  int               `json:"intervalMs"`
+	Misses      int               `json:"misses"` // rounds without a lease before Exiting
+}
+
+// Battery is an ADS1115 ADC reading the supply voltage through a divider.
+type Battery struct {
+	Enabled     bool    `json:"enabled"`
+	Port        string  `json:"port"`        // i2c bus; empty selects the first
+	Address     uint16  `json:"address"`     // defaults to 0x48
+	Channel     int     `json:"channel"`     // AIN0-AIN3
+	RangeV      float64 `json:"rangeV"`      // ADC full scale: 6.144, 4.096, 2.048 (default), 1.024, 0.512 or 0.256
+	Divider     float64 `json:"divider"`     // supply volts per volt at the input, e.g. 11 for 100k/10k
+	IntervalMs  int     `json:"intervalMs"`  // how often the voltage is read
+	ReportMs    int     `json:"reportMs"`    // how often readings are recorded
+	AlertV      float64 `json:"alertV"`      // a battery alert is raised below this
+	LowPowerV   float64 `json:"lowPowerV"`   // low power mode is on below this
+	HysteresisV float64 `json:"hysteresisV"` // how far above a threshold the voltage must recover
+}
+
+type Energy struct {
+	Enabled      bool   `json:"enabled"`
+	Terminal     string `json:"terminal"`     // GPIO wired to the meter's S0 output
+	PulsesPerKWh int    `json:"pulsesPerKWh"` // printed on the meter, e.g. 1000 imp/kWh
+	MinGapMs     int    `json:"minGapMs"`     // pulses closer than this are bounce
+	Load         string `json:"load"`         // switch whose load the meter measures
+	ReportMs     int    `json:"reportMs"`     // how often readings are recorded
+}
+
+type Pairing struct {
+	Enabled    bool   `json:"enabled"`
+	Capability string `json:"capability"` // "NoInputNoOutput" or "DisplayYesNo"
+	TimeoutMs  int    `json:"timeoutMs"`  // pending confirmations are rejected after this
+
+	RequireComparison bool `json:"requireComparison"` // reject Just Works pairing (no MITM protection)
+}
+
+type TLS struct {
+	Cert       string `json:"cert"` // PEM certificate; TLS is enabled when set
+	Key        string `json:"key"`
+	SelfSigned bool   `json:"selfSigned"` // generate cert and key if cert is missing
+	ClientCA   string `json:"clientCA"`   // control requests need a client certificate signed by it
+}
+
+// Resolved returns the settings with the certificate and key resolved against
+// the state directory, where the API and the CLI both look for them.
+func (c TLS) Resolved() TLS {
+	c.Cert, c.Key = StatePath(c.Cert, ""), StatePath(c.Key, "")
+	return c
+}
+
+type RateLimit struct {
+	PerMinute   int `json:"perMinute"`   // requests per client address and per token; -1 disables limiting
+	Burst       int `json:"burst"`       // requests allowed at once
+	MaxFailures int `json:"maxFailures"` // failed authentications before an address is locked out; -1 never locks out
+	LockoutMs   int `json:"lockoutMs"`
+}
+
+type API struct {
+	Enabled      bool   `json:"enabled"`
+	Address      string `json:"address"`      // e.g. ":8080"
+	RequireToken *bool  `json:"requireToken"` // every request must carry an API token; true unless set false
+	TokensFile   string `json:"tokensFile"`   // hashed API tokens
+	TLS          TLS    `json:"tls"`
+
+	RateLimit RateLimit `json:"rateLimit"`
+	Origins   []string  `json:"origins"` // web pages, besides the API's own, allowed to open the WebSocket
+}
+
+// TokenRequired reports whether requests need an API token, which they do
+// unless requireToken is explicitly false.
+func (c API) TokenRequired() bool {
+	return c.RequireToken == nil || *c.RequireToken
+}
+
+type IFTTT struct {
+	Key    string   `json:"key"`    // Webhooks service key
+	Event  string   `json:"event"`  // Webhooks event name
+	Values []string `json:"values"` // templates of value1 to value3; the event's name, action and detail by default
+}
+
+// Script is a file of rules run on every event.
+type Script struct {
+	File      string `json:"file"`
+	MaxSteps  int    `json:"maxSteps"`  // evaluation steps allowed per event
+	MaxAlloc  int    `json:"maxAlloc"`  // string bytes and list elements made per event
+	TimeoutMs int    `json:"timeoutMs"` // time allowed per event
+}
+
+type Trigger struct {
+	Event  string `json:"event"`  // "<kind>", "<kind>:<action>" or "<kind>:<action>:<direction>", e.g. "presence:Entering"
+	Filter string `json:"filter"` // expression the event must also satisfy, e.g. actor == "alice" && hour >= 18
+
+	IFTTT IFTTT `json:"ifttt"` // takes precedence over the generic request below
+
+	// generic request; url and body are templates over the event, e.g.
+	// {{.Name}}, {{.Action}}, {{.Detail}}
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Body    string            `json:"body"`
+	Headers map[string]string `json:"headers"`
+
+	// command run instead of a request, without a shell; its arguments are
+	// templates over the event
+	Exec []string `json:"exec"`
+	Dir  string   `json:"dir"`  // working directory of the command
+	User string   `json:"user"` // run the command as this user
+
+	MinIntervalMs int `json:"minIntervalMs"` // per event name
+	TimeoutMs     int `json:"timeoutMs"`
 }
 
 type Config struct {
 	Bluetooth Bluetooth `json:"bluetooth"`
 	Actors    Actors    `json:"actors"`
 	Log       Log       `json:"log"`
+	Buzzer    Buzzer    `json:"buzzer"`
+	API       API       `json:"api"`
+	Pairing   Pairing   `json:"pairing"`
+	NFC       NFC       `json:"nfc"`
+	Distance  Distance  `json:"distance"`
+	MMWave    MMWave    `json:"mmwave"`
+	Ping      Ping      `json:"ping"`
+	Leases    Leases    `json:"leases"`
+	MQTT      MQTT      `json:"mqtt"`
+	Feed      Feed      `json:"feed"` // presence published over MQTT in the wire format
+	Clock     Clock     `json:"clock"`
+	Energy    Energy    `json:"energy"`
+	Battery   Battery   `json:"battery"`
+	LowPower  LowPower  `json:"lowPower"`
+	Unseen    Unseen    `json:"unseen"`
+
+	Switches      []Switch          `json:"switches"`
+	ManagedSwitch string            `json:"managedSwitch"`
+	Zones         []Zone            `json:"zones"` // besides the one configured at the top level
+	Groups        []Group           `json:"groups"`
+	Patterns      []Pattern         `json:"patterns"`
+	BlinkCodes    map[string]string `json:"blinkCodes"` // pattern played on each alert, by alert name
+	Interlocks    []Interlock       `json:"interlocks"`
+	HealthCheckMs int               `json:"healthCheckMs"` // how often switches self-test
+	Override      Override          `json:"override"`
+
+	Triggers []Trigger `json:"triggers"`
+	Script   Script    `json:"script"`
+
+	Profiles        map[string]Profile `json:"profiles"`
+	Profile         string             `json:"profile"` // active at startup; defaults to "home"
+	ProfileSchedule []ProfileChange    `json:"profileSchedule"`
+	SwitchSchedule  []SwitchChange     `json:"switchSchedule"`
+	Vacation        Vacation           `json:"vacation"`
+	Calendar        Calendar           `json:"calendar"`
+	Report          Report             `json:"report"`
+
+	Privacy    Privacy    `json:"privacy"`
+	Update     Update     `json:"update"`
+	Supervisor Supervisor `json:"supervisor"`
 
 	EventLoopDelayMs int `json:"eventLoopDelayMs"`
 	RelayDebounceMs  int `json:"relayDebounceMs"`
 	OperationDelayMs int `json:"operationDelayMs"`
+	ArrivalDwellMs   int `json:"arrivalDwellMs"` // presence required before acting on Entering
+	CoalesceMs       int `json:"coalesceMs"`     // flaps of an actor within this long are dropped
+
+	ActuationQueueSize int `json:"actuationQueueSize"`
+
+	DumpFile string `json:"dumpFile"` // SIGUSR1 state dumps go here instead of the log
+
+	StateDir       string `json:"stateDir"`       // where the files below are kept unless absolute
+	StateFile      string `json:"stateFile"`      // runtime state persisted across restarts
+	StatePersistMs int    `json:"statePersistMs"` // how often runtime state is persisted
+	HistoryFile    string `json:"historyFile"`    // event log, one JSON object per line
+	AuditFile      string `json:"auditFile"`      // hash chained log of every actuation
+
+	HistoryRetentionDays int `json:"historyRetentionDays"` // events older are removed daily; 0 keeps them
+	AuditRetentionDays   int `json:"auditRetentionDays"`   // entries older are removed daily; 0 keeps them
+
+	Timezone string `json:"timezone"` // IANA name schedules and quiet hours use, e.g. "Europe/Berlin"; defaults to the system's
 }
 
 var RuntimeConfig Config
 
+var Checksum string // sha256 of the loaded config file
+
+var Location = time.Local // resolved from timezone
+
+var Vault *vault.Vault // opened when actors.vault.file is set
+
+var Unconfigured bool // no config file exists yet; the defaults apply until one is provisioned
+
 const ConfigFile = "config.json"
 
+const DefaultStateDir = "/var/lib/beaves"
+
+// StateDirectory is where beaves keeps the files it writes at runtime, so the
+// root filesystem can be mounted read-only.
+func StateDirectory() string {
+	if RuntimeConfig.StateDir != "" {
+		return RuntimeConfig.StateDir
+	}
+	return DefaultStateDir
+}
+
+// StatePath resolves a file written at runtime, or fallback when it isn't
+// configured, against the state directory unless it is absolute.
+func StatePath(file string, fallback string) string {
+	if file == "" {
+		file = fallback
+	}
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(StateDirectory(), file)
+}
+
 func init() {
-	file, err := os.Open(ConfigFile)
+	data, err := os.ReadFile(ConfigFile)
+	if errors.Is(err, os.ErrNotExist) {
+		Unconfigured = true
+		return
+	}
 	if err != nil {
 		log.Fatalf("app requires a %s file", ConfigFile)
 	}
-	defer file.Close()
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&RuntimeConfig); err != nil {
+	sum := sha256.Sum256(data)
+	Checksum = hex.EncodeToString(sum[:])
+	if err := json.Unmarshal(data, &RuntimeConfig); err != nil {
 		log.Fatalf("error decoding config file: %v", err.Error())
 	}
+	if err := RuntimeConfig.resolveSecrets(); err != nil {
+		log.Fatalf("error resolving config secret %v", err.Error())
+	}
+	if err := RuntimeConfig.Validate(); err != nil {
+		log.Fatalf("invalid config: %v", err.Error())
+	}
+	if RuntimeConfig.Timezone != "" {
+		if Location, err = time.LoadLocation(RuntimeConfig.Timezone); err != nil {
+			log.Fatalf("invalid timezone: %v", err.Error())
+		}
+	}
+	if c := RuntimeConfig.Actors.Vault; c.File != "" {
+		key, err := vault.ReadKey(c.KeyFile)
+		if err != nil {
+			log.Fatalf("error opening actor vault: %v", err.Error())
+		}
+		if Vault, err = vault.Open(c.File, key); err != nil {
+			log.Fatalf("error opening actor vault: %v", err.Error())
+		}
+		RuntimeConfig.Actors.Known = append(RuntimeConfig.Actors.Known, Vault.Known...)
+	}
 }
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Secret resolves a reference to a credential kept outside the config file:
+// "env:NAME" reads an environment variable and "file:/path" reads a file,
+// without its trailing newline. Other values are returned unchanged.
+func Secret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, "file:"):
+		path := strings.TrimPrefix(value, "file:")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return value, nil
+}
+
+// resolveSecrets replaces secret references in every credential field.
+func (c *Config) resolveSecrets() error {
+	fields := map[string]*string{
+		"mqtt.username": &c.MQTT.Username,
+		"mqtt.password": &c.MQTT.Password,
+		"calendar.url":  &c.Calendar.URL,
+
+		"leases.username": &c.Leases.Username,
+		"leases.password": &c.Leases.Password,
+	}
+	var visit func(prefix string, s *Switch)
+	visit = func(prefix string, s *Switch) {
+		fields[prefix+".http.username"] = &s.HTTP.Username
+		fields[prefix+".http.password"] = &s.HTTP.Password
+		for i := range s.Failover.Members {
+			visit(fmt.Sprintf("%s.failover.members[%d]", prefix, i), &s.Failover.Members[i])
+		}
+	}
+	for i := range c.Switches {
+		visit(fmt.Sprintf("switches[%d]", i), &c.Switches[i])
+	}
+	for i := range c.Triggers {
+		t := &c.Triggers[i]
+		fields[fmt.Sprintf("triggers[%d].ifttt.key", i)] = &t.IFTTT.Key
+		for name, value := range t.Headers {
+			secret, err := Secret(value)
+			if err != nil {
+				return fmt.Errorf("triggers[%d].headers.%s: %w", i, name, err)
+			}
+			t.Headers[name] = secret
+		}
+	}
+	for name, field := range fields {
+		secret, err := Secret(*field)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*field = secret
+	}
+	return nil
+}
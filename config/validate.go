@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Validate checks what can be checked of a config without opening any
+// device, so a bad config is refused when it is written rather than failing
+// every start after.
+func (c *Config) Validate() error {
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+	switches := map[string]bool{}
+	for _, s := range c.Switches {
+		if switches[s.Name] {
+			return fmt.Errorf("duplicate switch %q", s.Name)
+		}
+		switches[s.Name] = true
+	}
+	managed := map[string]string{}
+	if c.ManagedSwitch != "" {
+		if !switches[c.ManagedSwitch] {
+			return fmt.Errorf("managed switch %q is not configured", c.ManagedSwitch)
+		}
+		managed[c.ManagedSwitch] = "main"
+	}
+	if c.Bluetooth.ContinuousAdvertising && len(c.Bluetooth.Frames) > 0 {
+		return fmt.Errorf("bluetooth: frames are never advertised with continuousAdvertising")
+	}
+	zones := map[string]bool{"main": true}
+	for _, z := range c.Zones {
+		if z.Bluetooth.ContinuousAdvertising && len(z.Bluetooth.Frames) > 0 {
+			return fmt.Errorf("zone %s: frames are never advertised with continuousAdvertising", z.Name)
+		}
+		if z.Name == "" || zones[z.Name] {
+			return fmt.Errorf("zone %q must have a name of its own", z.Name)
+		}
+		zones[z.Name] = true
+		if !switches[z.ManagedSwitch] {
+			return fmt.Errorf("zone %s: managed switch %q is not configured", z.Name, z.ManagedSwitch)
+		}
+		if other, ok := managed[z.ManagedSwitch]; ok {
+			return fmt.Errorf("zone %s: switch %q is already managed by zone %s", z.Name, z.ManagedSwitch, other)
+		}
+		managed[z.ManagedSwitch] = z.Name
+	}
+	for _, s := range c.Switches {
+		if s.RequireGeofence && !(c.Feed.Enabled && c.Feed.Geofence.Enabled) {
+			return fmt.Errorf("switch %s: requireGeofence needs feed.geofence enabled", s.Name)
+		}
+		if s.DistanceBound.MinRSSI == 0 {
+			continue
+		}
+		// NOTE: without a trend there is no signal to bound the distance
+		// with, and every press would be refused
+		trend := c.Bluetooth.Trend.Enabled
+		for _, z := range c.Zones {
+			if z.ManagedSwitch == s.Name {
+				trend = z.Bluetooth.Trend.Enabled
+			}
+		}
+		if !trend {
+			return fmt.Errorf("switch %s: distanceBound needs bluetooth.trend enabled on the sentry of its zone", s.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+)
+
+const DefaultActuationQueueSize = 8
+
+type Step struct {
+	Delay   time.Duration // wait before applying State
+	State   State
+	Check   func() error // when set, called after Delay; an error refuses the step
+	Applied func()       // when set, called once State was applied
+}
+
+type actuation struct {
+	steps []Step
+	done  func(error)
+}
+
+// Actuator owns a switch and applies queued step sequences on a dedicated
+// worker, so delays never block the caller.
+type Actuator struct {
+	Switch
+	name  string
+	queue chan actuation
+}
+
+func (a *Actuator) String() string {
+	return fmt.Sprintf("Actuator {name: %s, depth: %d, switch: %s}", a.name, a.Depth(), a.Switch.String())
+}
+
+func (a *Actuator) Unwrap() Switch {
+	return a.Switch
+}
+
+func (a *Actuator) Name() string {
+	return a.name
+}
+
+func (a *Actuator) Depth() int {
+	return len(a.queue)
+}
+
+// Enqueue schedules steps for the worker. done, if set, is called with the
+// outcome once every step ran or one of them failed.
+func (a *Actuator) Enqueue(steps []Step, done func(error)) error {
+	select {
+	case a.queue <- actuation{steps: steps, done: done}:
+		return nil
+	default:
+		return fmt.Errorf("actuation queue for %s is full", a.name)
+	}
+}
+
+func applyStep(s Switch, step Step) error {
+	time.Sleep(step.Delay)
+	if step.Check != nil {
+		if err := step.Check(); err != nil {
+			return err
+		}
+	}
+	var err error
+	switch step.State {
+	case On:
+		err = s.On()
+	case Off:
+		err = s.Off()
+	default:
+		return fmt.Errorf("unable to actuate invalid state: %+v", step.State)
+	}
+	if err == nil && step.Applied != nil {
+		step.Applied()
+	}
+	return err
+}
+
+// Play applies steps to a switch in order, stopping at the first failing.
+func Play(s Switch, steps []Step) error {
+	for _, step := range steps {
+		if err := applyStep(s, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Actuator) work() {
+	for act := range a.queue {
+		err := Play(a.Switch, act.steps)
+		if err != nil {
+			log.Error("Actuator: %s: %s", a.name, err.Error())
+		}
+		if act.done != nil {
+			act.done(err)
+		}
+	}
+}
+
+func NewActuator(name string, s Switch, size int) *Actuator {
+	if size <= 0 {
+		size = DefaultActuationQueueSize
+	}
+	a := &Actuator{Switch: s, name: name, queue: make(chan actuation, size)}
+	go a.work()
+	return a
+}
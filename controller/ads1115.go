@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/host/v3"
+)
+
+const (
+	DefaultADS1115Address = 0x48
+	DefaultADS1115RangeV  = 2.048
+
+	ads1115Conversion = 0x00
+	ads1115Config     = 0x01
+
+	ads1115Start      = 1 << 15 // write: start a conversion; read: idle
+	ads1115SingleEnd  = 0b100 << 12
+	ads1115SingleShot = 1 << 8
+	ads1115Rate128    = 0b100 << 5
+	ads1115NoCompare  = 0b11
+
+	ads1115Timeout = 100 * time.Millisecond
+)
+
+// ads1115Ranges maps full scale voltages to their PGA setting.
+var ads1115Ranges = map[float64]uint16{6.144: 0b000, 4.096: 0b001, 2.048: 0b010, 1.024: 0b011, 0.512: 0b100, 0.256: 0b101}
+
+// ADS1115 reads a voltage on one single ended input of a 16 bit ADC,
+// scaled by the divider in front of it.
+type ADS1115 struct {
+	dev     *i2c.Dev
+	channel int
+	rangeV  float64
+	divider float64
+}
+
+func (a *ADS1115) String() string {
+	return fmt.Sprintf("ADS1115 {address: %#x, channel: %d, range: %.3fV}", a.dev.Addr, a.channel, a.rangeV)
+}
+
+// Volts runs a single shot conversion and returns the voltage before the
+// divider.
+func (a *ADS1115) Volts() (float64, error) {
+	setting := uint16(ads1115Start | ads1115SingleEnd | a.channel<<12 | ads1115SingleShot | ads1115Rate128 | ads1115NoCompare)
+	setting |= ads1115Ranges[a.rangeV] << 9
+	if err := a.dev.Tx([]byte{ads1115Config, byte(setting >> 8), byte(setting)}, nil); err != nil {
+		return 0, fmt.Errorf("failed to start conversion: %w", err)
+	}
+	status := make([]byte, 2)
+	for deadline := time.Now().Add(ads1115Timeout); ; time.Sleep(2 * time.Millisecond) {
+		if err := a.dev.Tx([]byte{ads1115Config}, status); err != nil {
+			return 0, fmt.Errorf("failed to read conversion status: %w", err)
+		}
+		if binary.BigEndian.Uint16(status)&ads1115Start != 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("conversion timed out")
+		}
+	}
+	raw := make([]byte, 2)
+	if err := a.dev.Tx([]byte{ads1115Conversion}, raw); err != nil {
+		return 0, fmt.Errorf("failed to read conversion: %w", err)
+	}
+	return float64(int16(binary.BigEndian.Uint16(raw))) * a.rangeV / 32768 * a.divider, nil
+}
+
+// Probe reads the config register, failing unless a device acknowledges at
+// the address: a bus without one reads as all ones on some adapters rather
+// than failing.
+func (a *ADS1115) Probe() error {
+	value := make([]byte, 2)
+	if err := a.dev.Tx([]byte{ads1115Config}, value); err != nil {
+		return fmt.Errorf("no ads1115 acknowledged at %#x: %w", a.dev.Addr, err)
+	}
+	if binary.BigEndian.Uint16(value) == 0xFFFF {
+		return fmt.Errorf("no ads1115 acknowledged at %#x", a.dev.Addr)
+	}
+	return nil
+}
+
+func NewADS1115(c config.Battery) (*ADS1115, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, fmt.Errorf("host failed to initialize for ads1115: %w", err)
+	}
+	a := &ADS1115{channel: c.Channel, rangeV: c.RangeV, divider: c.Divider}
+	if a.channel < 0 || a.channel > 3 {
+		return nil, fmt.Errorf("ads1115 has no channel %d", a.channel)
+	}
+	if a.rangeV == 0 {
+		a.rangeV = DefaultADS1115RangeV
+	}
+	if _, ok := ads1115Ranges[a.rangeV]; !ok {
+		return nil, fmt.Errorf("ads1115 has no %.3fV range", a.rangeV)
+	}
+	if a.divider <= 0 {
+		a.divider = 1
+	}
+	b, err := i2creg.Open(c.Port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open i2c bus %q: %w", c.Port, err)
+	}
+	address := c.Address
+	if address == 0 {
+		address = DefaultADS1115Address
+	}
+	a.dev = &i2c.Dev{Bus: b, Addr: address}
+	if err := a.Probe(); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return a, nil
+}
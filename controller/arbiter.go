@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+)
+
+type Policy string
+
+const (
+	LastWriterWins Policy = "last-writer-wins" // manual and automatic changes both apply
+	ManualWins     Policy = "manual-wins"      // automation waits a while after a manual change
+	AutomationOnly Policy = "automation-only"  // manual changes are ignored
+
+	DefaultHoldMs = 1800000
+)
+
+// Arbiter decides whether manual (wall switch) or automatic (presence,
+// simulation) changes may drive a switch both of them control.
+type Arbiter struct {
+	policy Policy
+	hold   time.Duration
+
+	manual time.Time // last manual change
+	lock   sync.Mutex
+}
+
+func (a *Arbiter) String() string {
+	return fmt.Sprintf("Arbiter {policy: %s, hold: %v}", a.policy, a.hold)
+}
+
+// Manual reports whether a manual change may apply, recording it if so.
+func (a *Arbiter) Manual() bool {
+	if a.policy == AutomationOnly {
+		return false
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.manual = time.Now()
+	return true
+}
+
+// Automatic reports whether an automatic change may apply now.
+func (a *Arbiter) Automatic() bool {
+	_, held := a.Held()
+	return !held
+}
+
+// Held reports until when automation is held off by a manual change. A nil
+// Arbiter, for a switch that was never set up, holds nothing.
+func (a *Arbiter) Held() (time.Time, bool) {
+	if a == nil || a.policy != ManualWins {
+		return time.Time{}, false
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	until := a.manual.Add(a.hold)
+	return until, !a.manual.IsZero() && time.Now().Before(until)
+}
+
+func NewArbiter(c config.WallSwitch) (*Arbiter, error) {
+	policy := Policy(c.Policy)
+	switch policy {
+	case "":
+		policy = LastWriterWins
+	case LastWriterWins, ManualWins, AutomationOnly:
+	default:
+		return nil, fmt.Errorf("unknown arbitration policy %q", c.Policy)
+	}
+	hold := c.HoldMs
+	if hold <= 0 {
+		hold = DefaultHoldMs
+	}
+	return &Arbiter{policy: policy, hold: time.Duration(hold) * time.Millisecond}, nil
+}
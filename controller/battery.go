@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultBatteryIntervalMs  = 60000
+	DefaultBatteryHysteresisV = 0.2
+)
+
+// Reading is the supply voltage last read, and the thresholds it is under.
+type Reading struct {
+	Volts    float64   `json:"volts"`
+	Epoch    time.Time `json:"epoch"`
+	Alert    bool      `json:"alert"`    // under alertV
+	LowPower bool      `json:"lowPower"` // under lowPowerV
+}
+
+// Battery watches the supply voltage of an off-grid installation. Once under
+// a threshold, the voltage must recover past it by the hysteresis before it
+// counts as over again, so a sagging battery doesn't flap.
+type Battery struct {
+	adc        *ADS1115
+	interval   time.Duration
+	alertV     float64
+	lowPowerV  float64
+	hysteresis float64
+	onRead     func(prev Reading, r Reading)
+
+	reading Reading
+	lock    sync.Mutex
+}
+
+func (b *Battery) String() string {
+	return fmt.Sprintf("Battery {adc: %s, volts: %.2f}", b.adc.String(), b.Get().Volts)
+}
+
+// Get returns the last reading, zero until the voltage was read.
+func (b *Battery) Get() Reading {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.reading
+}
+
+// under reports whether v is under a threshold, given whether it was.
+func (b *Battery) under(v float64, threshold float64, was bool) bool {
+	if threshold <= 0 {
+		return false
+	}
+	if was {
+		return v < threshold+b.hysteresis
+	}
+	return v < threshold
+}
+
+// Check reads the voltage once.
+func (b *Battery) Check() {
+	v, err := b.adc.Volts()
+	if err != nil {
+		log.Controller.DebugMemoize("Battery: %s", err.Error())
+		return
+	}
+	b.lock.Lock()
+	prev := b.reading
+	b.reading = Reading{
+		Volts:    v,
+		Epoch:    time.Now(),
+		Alert:    b.under(v, b.alertV, prev.Alert),
+		LowPower: b.under(v, b.lowPowerV, prev.LowPower),
+	}
+	r := b.reading
+	b.lock.Unlock()
+	b.onRead(prev, r)
+}
+
+func (b *Battery) Run() {
+	for ; ; time.Sleep(b.interval) {
+		b.Check()
+	}
+}
+
+func NewBattery(c config.Battery, onRead func(prev Reading, r Reading)) (*Battery, error) {
+	adc, err := NewADS1115(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize battery: %w", err)
+	}
+	b := &Battery{
+		adc:        adc,
+		interval:   time.Duration(DefaultBatteryIntervalMs) * time.Millisecond,
+		alertV:     c.AlertV,
+		lowPowerV:  c.LowPowerV,
+		hysteresis: DefaultBatteryHysteresisV,
+		onRead:     onRead,
+	}
+	if c.IntervalMs > 0 {
+		b.interval = time.Duration(c.IntervalMs) * time.Millisecond
+	}
+	if c.HysteresisV > 0 {
+		b.hysteresis = c.HysteresisV
+	}
+	return b, nil
+}
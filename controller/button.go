@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+	"periph.io/x/conn/v3/gpio"
+)
+
+const DefaultButtonDebounceMs = 50
+
+// Button is a push button or rocker switch wired between a GPIO input and
+// ground.
+type Button struct {
+	gpio     GPIO
+	debounce time.Duration
+}
+
+func (bt *Button) String() string {
+	return fmt.Sprintf("Button {terminal: %s}", bt.gpio.String())
+}
+
+// Run calls pressed for every press, or every flip of a rocker, until the pin
+// can no longer be watched.
+func (bt *Button) Run(pressed func()) {
+	last := time.Time{}
+	for {
+		if !bt.gpio.pin.WaitForEdge(-1) {
+			time.Sleep(bt.debounce)
+			continue
+		}
+		now := time.Now()
+		if now.Sub(last) < bt.debounce {
+			continue
+		}
+		last = now
+		log.Controller.Debug("Button: pressed on %s", bt.gpio.String())
+		pressed()
+	}
+}
+
+func NewButton(terminal string, debounceMs int) (*Button, error) {
+	return newButton(terminal, gpio.FallingEdge, debounceMs)
+}
+
+func NewRocker(terminal string, debounceMs int) (*Button, error) {
+	return newButton(terminal, gpio.BothEdges, debounceMs)
+}
+
+func newButton(terminal string, edge gpio.Edge, debounceMs int) (*Button, error) {
+	if debounceMs <= 0 {
+		debounceMs = DefaultButtonDebounceMs
+	}
+	bt := &Button{debounce: time.Duration(debounceMs) * time.Millisecond}
+	if err := bt.gpio.Claim(SerialName(terminal)); err != nil {
+		return nil, fmt.Errorf("failed to initialize button: %w", err)
+	}
+	if err := bt.gpio.pin.In(gpio.PullUp, edge); err != nil {
+		return nil, fmt.Errorf("failed to watch %s: %w", terminal, err)
+	}
+	return bt, nil
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/clock"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"periph.io/x/conn/v3/physic"
+)
+
+type Chirp string
+
+const (
+	EnteringChirp   Chirp = "entering"
+	ExitingChirp    Chirp = "exiting"
+	EnrollmentChirp Chirp = "enrollment"
+	ErrorChirp      Chirp = "error"
+)
+
+var DefaultTones = map[Chirp]config.Tone{
+	EnteringChirp:   {FrequencyHz: 2000, DurationMs: 80, Repeat: 2, GapMs: 60},
+	ExitingChirp:    {FrequencyHz: 1200, DurationMs: 150, Repeat: 1},
+	EnrollmentChirp: {FrequencyHz: 2500, DurationMs: 50, Repeat: 3, GapMs: 50},
+	ErrorChirp:      {FrequencyHz: 400, DurationMs: 600, Repeat: 1},
+}
+
+type Buzzer struct {
+	gpio  GPIO
+	tones map[Chirp]config.Tone
+
+	quiet      bool
+	quietStart time.Duration // offset from midnight
+	quietEnd   time.Duration // offset from midnight
+
+	Clock *clock.Clock // quiet hours hold until it is trusted
+
+	lock sync.Mutex
+}
+
+func (b *Buzzer) String() string {
+	return fmt.Sprintf("Buzzer {terminal: %s}", b.gpio.String())
+}
+
+// Quiet reports whether t falls within the configured quiet hours, in the
+// configured timezone. Windows that span midnight (e.g. 22:00-07:00) are
+// supported.
+func (b *Buzzer) Quiet(t time.Time) bool {
+	if !b.quiet {
+		return false
+	}
+	offset := clock.TimeOfDay(clock.Local(t))
+	if b.quietStart <= b.quietEnd {
+		return offset >= b.quietStart && offset < b.quietEnd
+	}
+	return offset >= b.quietStart || offset < b.quietEnd
+}
+
+func (b *Buzzer) Chirp(c Chirp) error {
+	if b.quiet && !b.Clock.Trusted() {
+		log.Controller.DebugMemoize("Buzzer: Chirp: muted until the clock is trusted: %s", c)
+		return nil
+	}
+	if b.Quiet(time.Now()) {
+		log.Controller.DebugMemoize("Buzzer: Chirp: muted during quiet hours: %s", c)
+		return nil
+	}
+	return b.Play(c)
+}
+
+// Play sounds a chirp even during quiet hours, e.g. to test the buzzer.
+func (b *Buzzer) Play(c Chirp) error {
+	tone, ok := b.tones[c]
+	if !ok {
+		return fmt.Errorf("no tone configured for chirp %s", c)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for i := 0; i < max(tone.Repeat, 1); i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(tone.GapMs) * time.Millisecond)
+		}
+		f := physic.Frequency(tone.FrequencyHz) * physic.Hertz
+		if err := b.gpio.Tone(f, time.Duration(tone.DurationMs)*time.Millisecond); err != nil {
+			return fmt.Errorf("failed to chirp %s: %w", c, err)
+		}
+	}
+	return nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func NewBuzzer(c config.Buzzer) (*Buzzer, error) {
+	b := &Buzzer{tones: map[Chirp]config.Tone{}}
+	for chirp, tone := range DefaultTones {
+		b.tones[chirp] = tone
+	}
+	for name, tone := range c.Tones {
+		b.tones[Chirp(name)] = tone
+	}
+	if c.QuietHours.Start != "" || c.QuietHours.End != "" {
+		start, err := parseClock(c.QuietHours.Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours start %q: %w", c.QuietHours.Start, err)
+		}
+		end, err := parseClock(c.QuietHours.End)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours end %q: %w", c.QuietHours.End, err)
+		}
+		b.quiet, b.quietStart, b.quietEnd = true, start, end
+	}
+	if err := b.gpio.Claim(SerialName(c.Terminal)); err != nil {
+		return nil, fmt.Errorf("failed to initialize buzzer: %w", err)
+	}
+	return b, nil
+}
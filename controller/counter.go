@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/robolivable/beaves/log"
+)
+
+// Counter counts the cycles of a switch, one per transition to On, to track
+// relay wear. Once the count reaches limit an alert asks for maintenance.
+type Counter struct {
+	Switch
+	name  string
+	limit uint64
+	alert Alert
+
+	cycles  uint64
+	alerted bool
+	lock    sync.Mutex
+}
+
+func (c *Counter) String() string {
+	return fmt.Sprintf("Counter {name: %s, cycles: %d, limit: %d, switch: %s}", c.name, c.Cycles(), c.limit, c.Switch.String())
+}
+
+func (c *Counter) Unwrap() Switch {
+	return c.Switch
+}
+
+func (c *Counter) Cycles() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.cycles
+}
+
+func (c *Counter) Limit() uint64 {
+	return c.limit
+}
+
+// Restore resumes counting from a persisted count.
+func (c *Counter) Restore(cycles uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cycles = cycles
+}
+
+func (c *Counter) count(op func() error) error {
+	before := c.Switch.State()
+	err := op()
+	if before == On || c.Switch.State() != On {
+		return err
+	}
+	c.lock.Lock()
+	c.cycles++
+	due := c.limit > 0 && c.cycles >= c.limit && !c.alerted
+	if due {
+		c.alerted = true
+	}
+	cycles := c.cycles
+	c.lock.Unlock()
+	if due {
+		msg := fmt.Sprintf("%s reached %d cycles of its %d cycle maintenance threshold", c.name, cycles, c.limit)
+		log.Error(msg)
+		if c.alert != nil {
+			c.alert(c.name, msg)
+		}
+	}
+	return err
+}
+
+func (c *Counter) On() error {
+	return c.count(c.Switch.On)
+}
+
+func (c *Counter) Off() error {
+	return c.count(c.Switch.Off)
+}
+
+func (c *Counter) Toggle() error {
+	return c.count(c.Switch.Toggle)
+}
+
+func NewCounter(name string, s Switch, limit uint64, alert Alert) *Counter {
+	return &Counter{Switch: s, name: name, limit: limit, alert: alert}
+}
+
+// Find looks through the wrappers of s for the first one of type T.
+func Find[T Switch](s Switch) (T, bool) {
+	for {
+		if t, ok := s.(T); ok {
+			return t, true
+		}
+		w, ok := s.(interface{ Unwrap() Switch })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		s = w.Unwrap()
+	}
+}
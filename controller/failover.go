@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultFailoverThreshold = 3
+	DefaultFailoverProbeMs   = 30000
+)
+
+// Failover drives the first healthy member of an ordered list of switches.
+// A member that fails threshold times in a row is taken out of rotation and
+// the request is retried on the next one. Members preferred over the active
+// one are probed periodically and take over again once they recover.
+type Failover struct {
+	name      string
+	members   []Switch
+	threshold int
+	alert     Alert
+
+	active   int
+	failures []int
+	want     State
+	lock     sync.Mutex
+}
+
+func (f *Failover) String() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	members := []string{}
+	for _, m := range f.members {
+		members = append(members, m.String())
+	}
+	return fmt.Sprintf("Failover {name: %s, active: %d, members: [%s]}", f.name, f.active, strings.Join(members, ", "))
+}
+
+func (f *Failover) State() State {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.members[f.active].State()
+}
+
+// Probe checks the active member, without holding up commands meanwhile.
+func (f *Failover) Probe() error {
+	f.lock.Lock()
+	m := f.members[f.active]
+	f.lock.Unlock()
+	return Probe(m)
+}
+
+// Active reports the index of the member currently in use.
+func (f *Failover) Active() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.active
+}
+
+func (f *Failover) notify(msg string) {
+	log.Error(msg)
+	if f.alert != nil {
+		f.alert(f.name, msg)
+	}
+}
+
+func apply(s Switch, state State) error {
+	if state == On {
+		return s.On()
+	}
+	return s.Off()
+}
+
+func (f *Failover) set(state State) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.want = state
+	var errs []error
+	for i := f.active; i < len(f.members); i++ {
+		err := apply(f.members[i], state)
+		if err == nil {
+			f.failures[i] = 0
+			if i != f.active {
+				f.active = i
+				f.notify(fmt.Sprintf("%s failed over to member %d", f.name, i))
+			}
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("member %d: %w", i, err))
+		f.failures[i]++
+		if f.failures[i] < f.threshold {
+			return errors.Join(errs...)
+		}
+	}
+	return fmt.Errorf("all members of %s failed: %w", f.name, errors.Join(errs...))
+}
+
+func (f *Failover) On() error {
+	return f.set(On)
+}
+
+func (f *Failover) Off() error {
+	return f.set(Off)
+}
+
+func (f *Failover) Toggle() error {
+	s := f.State()
+	if !s.Valid() {
+		return fmt.Errorf("unable to toggle invalid state: %+v", s)
+	}
+	if s == On {
+		return f.Off()
+	}
+	return f.On()
+}
+
+// failback returns to the most preferred member that passes its probe and
+// accepts the current state. Members are probed without the lock, so commands
+// aren't held up for as long as a probe can take.
+func (f *Failover) failback() {
+	active := f.Active()
+	for i := 0; i < active; i++ {
+		if err := Probe(f.members[i]); err != nil {
+			log.Controller.DebugMemoize("Failover: %s member %d still down: %s", f.name, i, err.Error())
+			continue
+		}
+		if f.takeOver(i) {
+			return
+		}
+	}
+}
+
+// takeOver makes a member that passed its probe the active one, unless a
+// command moved to a more preferred member meanwhile.
+func (f *Failover) takeOver(i int) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if i >= f.active {
+		return true
+	}
+	m := f.members[i]
+	if f.want.Valid() {
+		if err := apply(m, f.want); err != nil {
+			log.Controller.DebugMemoize("Failover: %s member %d still down: %s", f.name, i, err.Error())
+			return false
+		}
+	}
+	previous := f.members[f.active]
+	f.active = i
+	f.failures[i] = 0
+	if previous.State() == On {
+		if err := previous.Off(); err != nil {
+			log.Error("Failover: %s failed to release member: %s", f.name, err.Error())
+		}
+	}
+	f.notify(fmt.Sprintf("%s failed back to member %d", f.name, i))
+	return true
+}
+
+// standby stands in for a failover member whose device was down at startup,
+// building it once it can be reached.
+type standby struct {
+	backends *backends
+	config   config.Switch
+
+	lock sync.Mutex
+	s    Switch
+}
+
+func (sb *standby) get() (Switch, error) {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+	if sb.s != nil {
+		return sb.s, nil
+	}
+	sb.backends.lock.Lock()
+	s, err := sb.backends.build(sb.config)
+	sb.backends.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	sb.s = s
+	return s, nil
+}
+
+func (sb *standby) String() string {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+	if sb.s != nil {
+		return sb.s.String()
+	}
+	return fmt.Sprintf("standby {type: %s}", sb.config.Type)
+}
+
+func (sb *standby) State() State {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+	if sb.s == nil {
+		return Unknown
+	}
+	return sb.s.State()
+}
+
+func (sb *standby) On() error {
+	s, err := sb.get()
+	if err != nil {
+		return err
+	}
+	return s.On()
+}
+
+func (sb *standby) Off() error {
+	s, err := sb.get()
+	if err != nil {
+		return err
+	}
+	return s.Off()
+}
+
+func (sb *standby) Toggle() error {
+	s, err := sb.get()
+	if err != nil {
+		return err
+	}
+	return s.Toggle()
+}
+
+// Probe builds the member if it hasn't been yet, then probes it.
+func (sb *standby) Probe() error {
+	s, err := sb.get()
+	if err != nil {
+		return err
+	}
+	return Probe(s)
+}
+
+func (f *Failover) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if f.Active() > 0 {
+			f.failback()
+		}
+	}
+}
+
+func NewFailover(name string, members []Switch, threshold int, interval time.Duration, alert Alert) (*Failover, error) {
+	if len(members) == 0 {
+		return nil, fmt.Errorf("failover %s requires members", name)
+	}
+	if threshold <= 0 {
+		threshold = DefaultFailoverThreshold
+	}
+	if interval <= 0 {
+		interval = time.Duration(DefaultFailoverProbeMs) * time.Millisecond
+	}
+	f := &Failover{
+		name:      name,
+		members:   members,
+		threshold: threshold,
+		alert:     alert,
+		failures:  make([]int, len(members)),
+	}
+	// members down at startup count as failed, so the first one up is used
+	for i, m := range members {
+		if _, down := m.(*standby); !down {
+			f.active = i
+			break
+		}
+		f.failures[i] = threshold
+	}
+	f.want = members[f.active].State()
+	go f.watch(interval)
+	return f, nil
+}
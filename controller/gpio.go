@@ -2,11 +2,14 @@ package controller
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/robolivable/beaves/log"
 	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/pin"
 	"periph.io/x/host/v3"
 )
 
@@ -19,6 +22,18 @@ const (
 	Error
 )
 
+func (s State) String() string {
+	switch s {
+	case On:
+		return "On"
+	case Off:
+		return "Off"
+	case Error:
+		return "Error"
+	}
+	return "Unknown"
+}
+
 func (s State) Level() gpio.Level {
 	switch s {
 	case On:
@@ -77,13 +92,29 @@ func (g *GPIO) Claim(sn SerialName) error {
 	return nil
 }
 
+// Check verifies the claimed pin is still present and, once driven, still
+// configured as an output.
+func (g *GPIO) Check() error {
+	if gpioreg.ByName(string(g.name)) == nil {
+		return fmt.Errorf("pin %s is no longer present on host", g.name)
+	}
+	pf, ok := g.pin.(pin.PinFunc)
+	if !ok || g.last.IsZero() {
+		return nil
+	}
+	if f := strings.ToUpper(string(pf.Func())); !strings.HasPrefix(f, "OUT") {
+		return fmt.Errorf("pin %s is no longer an output: %s", g.name, f)
+	}
+	return nil
+}
+
 func (g *GPIO) Receive() State {
 	return GetState(g.pin.Read())
 }
 
 func (g *GPIO) Send(s State) error {
 	if time.Now().Before(g.last.Add(g.debounce)) {
-		log.DebugMemoize("GPIO: Send: debounced: %v", s)
+		log.Controller.DebugMemoize("GPIO: Send: debounced: %v", s)
 		return nil
 	}
 	if err := g.pin.Out(s.Level()); err != nil {
@@ -92,3 +123,14 @@ func (g *GPIO) Send(s State) error {
 	g.last = time.Now()
 	return nil
 }
+
+func (g *GPIO) Tone(f physic.Frequency, d time.Duration) error {
+	if err := g.pin.PWM(gpio.DutyHalf, f); err != nil {
+		return fmt.Errorf("failed to sound %s on %s: %w", f, g.name, err)
+	}
+	time.Sleep(d)
+	if err := g.pin.Out(gpio.Low); err != nil {
+		return fmt.Errorf("failed to silence %s: %w", g.name, err)
+	}
+	return nil
+}
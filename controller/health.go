@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+)
+
+const DefaultHealthCheckMs = 60000
+
+// Prober is implemented by switches that can check their backend is working
+// without actuating it.
+type Prober interface {
+	Probe() error
+}
+
+// Probe checks s, looking through wrappers for the switch that implements
+// Prober. Switches without one are assumed healthy.
+func Probe(s Switch) error {
+	for {
+		if p, ok := s.(Prober); ok {
+			return p.Probe()
+		}
+		w, ok := s.(interface{ Unwrap() Switch })
+		if !ok {
+			return nil
+		}
+		s = w.Unwrap()
+	}
+}
+
+type Health struct {
+	Switch  string    `json:"switch"`
+	Healthy bool      `json:"healthy"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+	Since   time.Time `json:"since"` // when Healthy last changed
+}
+
+// Monitor periodically probes every switch and reports changes in health.
+type Monitor struct {
+	switches map[string]Switch
+	interval time.Duration
+	onChange func(Health)
+
+	health map[string]Health
+	lock   sync.Mutex
+}
+
+// Check probes every switch once.
+func (m *Monitor) Check() {
+	for name, s := range m.switches {
+		err := Probe(s)
+		now := time.Now()
+		m.lock.Lock()
+		prev, seen := m.health[name]
+		h := Health{Switch: name, Healthy: err == nil, Checked: now, Since: prev.Since}
+		if err != nil {
+			h.Error = err.Error()
+		}
+		changed := !seen || prev.Healthy != h.Healthy
+		if changed {
+			h.Since = now
+		}
+		m.health[name] = h
+		m.lock.Unlock()
+		if !changed || (!seen && h.Healthy) {
+			continue
+		}
+		if h.Healthy {
+			log.Info("switch %s recovered", name)
+		}
+		if m.onChange != nil {
+			m.onChange(h)
+		}
+	}
+}
+
+func (m *Monitor) Get(name string) (Health, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	h, ok := m.health[name]
+	return h, ok
+}
+
+func (m *Monitor) Snapshot() []Health {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	out := []Health{}
+	for _, h := range m.health {
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Switch < out[j].Switch })
+	return out
+}
+
+func (m *Monitor) Run() {
+	m.Check()
+	for range time.Tick(m.interval) {
+		m.Check()
+	}
+}
+
+func NewMonitor(switches map[string]Switch, interval time.Duration, onChange func(Health)) *Monitor {
+	if interval <= 0 {
+		interval = time.Duration(DefaultHealthCheckMs) * time.Millisecond
+	}
+	return &Monitor{
+		switches: switches,
+		interval: interval,
+		onChange: onChange,
+		health:   map[string]Health{},
+	}
+}
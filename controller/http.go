@@ -0,0 +1,261 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+const DefaultHTTPTimeoutMs = 3000
+
+// httpPreset fills in the endpoints of a known device firmware. Templates see
+// the switch's config.HTTP, e.g. {{.Host}} and {{.Channel}}.
+type httpPreset struct {
+	method   string
+	on       string
+	off      string
+	state    string
+	stateKey string
+}
+
+var httpPresets = map[string]httpPreset{
+	"tasmota": {
+		method:   http.MethodGet,
+		on:       "http://{{.Host}}/cm?cmnd=Power{{.Channel}}%20On",
+		off:      "http://{{.Host}}/cm?cmnd=Power{{.Channel}}%20Off",
+		state:    "http://{{.Host}}/cm?cmnd=Power{{.Channel}}",
+		stateKey: "POWER{{.Channel}}",
+	},
+	"esphome": {
+		method:   http.MethodPost,
+		on:       "http://{{.Host}}/switch/{{.Channel}}/turn_on",
+		off:      "http://{{.Host}}/switch/{{.Channel}}/turn_off",
+		state:    "http://{{.Host}}/switch/{{.Channel}}",
+		stateKey: "state",
+	},
+	"shelly": {
+		method:   http.MethodGet,
+		on:       "http://{{.Host}}/relay/{{.Channel}}?turn=on",
+		off:      "http://{{.Host}}/relay/{{.Channel}}?turn=off",
+		state:    "http://{{.Host}}/relay/{{.Channel}}",
+		stateKey: "ison",
+	},
+}
+
+// HTTPSwitch drives a WiFi relay through its REST API. The relay can be
+// switched outside beaves (its app, its button or its own schedule), so
+// commands are always sent, and state follows what the device reports.
+type HTTPSwitch struct {
+	client   *http.Client
+	method   string
+	on       string
+	off      string
+	query    string
+	stateKey string
+	username string
+	password string
+
+	mu    sync.Mutex
+	state State
+}
+
+func (hs *HTTPSwitch) String() string {
+	return fmt.Sprintf("HTTPSwitch {state: %v, on: %s, off: %s}", hs.State(), hs.on, hs.off)
+}
+
+func (hs *HTTPSwitch) State() State {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return hs.state
+}
+
+func (hs *HTTPSwitch) set(s State) {
+	hs.mu.Lock()
+	hs.state = s
+	hs.mu.Unlock()
+}
+
+func (hs *HTTPSwitch) call(method string, url string) (State, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return Unknown, err
+	}
+	if hs.username != "" {
+		req.SetBasicAuth(hs.username, hs.password)
+	}
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return Unknown, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return Unknown, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return Unknown, fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	if hs.stateKey == "" {
+		return Unknown, nil
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(body, &msg); err != nil {
+		// not every endpoint answers with the state, e.g. ESPHome actions
+		return Unknown, nil
+	}
+	switch v := msg[hs.stateKey].(type) {
+	case bool:
+		if v {
+			return On, nil
+		}
+		return Off, nil
+	case string:
+		switch strings.ToUpper(v) {
+		case "ON":
+			return On, nil
+		case "OFF":
+			return Off, nil
+		}
+	}
+	return Unknown, nil
+}
+
+func (hs *HTTPSwitch) send(s State) error {
+	url := hs.off
+	if s == On {
+		url = hs.on
+	}
+	reported, err := hs.call(hs.method, url)
+	if err != nil {
+		hs.set(Error)
+		return fmt.Errorf("failed to switch %v: %w", s, err)
+	}
+	if reported.Valid() && reported != s {
+		hs.set(reported)
+		return fmt.Errorf("failed to switch %v: device reports %v", s, reported)
+	}
+	hs.set(s)
+	return nil
+}
+
+func (hs *HTTPSwitch) On() error {
+	log.Controller.Debug("HTTPSwitch.On: %s", hs.String())
+	return hs.send(On)
+}
+
+func (hs *HTTPSwitch) Off() error {
+	log.Controller.Debug("HTTPSwitch.Off: %s", hs.String())
+	return hs.send(Off)
+}
+
+func (hs *HTTPSwitch) Toggle() error {
+	log.Controller.Debug("HTTPSwitch.Toggle: %s", hs.String())
+	if err := hs.Probe(); err != nil {
+		return err
+	}
+	s := hs.State()
+	if !s.Valid() {
+		return fmt.Errorf("unable to toggle invalid state: %+v", s)
+	}
+	if s == On {
+		return hs.send(Off)
+	}
+	return hs.send(On)
+}
+
+// Probe queries the device's state endpoint, if it has one, and takes the
+// state it reports.
+func (hs *HTTPSwitch) Probe() error {
+	if hs.query == "" {
+		return nil
+	}
+	reported, err := hs.call(http.MethodGet, hs.query)
+	if err != nil {
+		return err
+	}
+	if reported.Valid() {
+		hs.set(reported)
+	}
+	return nil
+}
+
+func expand(name string, text string, c config.HTTP) (string, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, c); err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return b.String(), nil
+}
+
+func NewHTTPSwitch(c config.HTTP) (*HTTPSwitch, error) {
+	p := httpPreset{method: http.MethodGet}
+	if c.Preset != "" {
+		var ok bool
+		if p, ok = httpPresets[strings.ToLower(c.Preset)]; !ok {
+			return nil, fmt.Errorf("unknown http preset %q", c.Preset)
+		}
+	}
+	// explicit settings override the preset
+	for _, o := range []struct {
+		dst *string
+		src string
+	}{
+		{&p.method, c.Method},
+		{&p.on, c.On},
+		{&p.off, c.Off},
+		{&p.state, c.State},
+		{&p.stateKey, c.StateKey},
+	} {
+		if o.src != "" {
+			*o.dst = o.src
+		}
+	}
+	if p.on == "" || p.off == "" {
+		return nil, fmt.Errorf("http switch requires on and off urls")
+	}
+	timeout := c.TimeoutMs
+	if timeout == 0 {
+		timeout = DefaultHTTPTimeoutMs
+	}
+	hs := &HTTPSwitch{
+		client:   &http.Client{Timeout: time.Duration(timeout) * time.Millisecond},
+		method:   strings.ToUpper(p.method),
+		username: c.Username,
+		password: c.Password,
+	}
+	var err error
+	if hs.on, err = expand("on", p.on, c); err != nil {
+		return nil, err
+	}
+	if hs.off, err = expand("off", p.off, c); err != nil {
+		return nil, err
+	}
+	if hs.stateKey, err = expand("stateKey", p.stateKey, c); err != nil {
+		return nil, err
+	}
+	if p.state == "" {
+		return hs, nil
+	}
+	if hs.query, err = expand("state", p.state, c); err != nil {
+		return nil, err
+	}
+	if err := hs.Probe(); err != nil {
+		// NOTE: an offline relay mustn't keep the others from starting; the
+		// health monitor reports it failing until it answers
+		log.Error("HTTPSwitch: failed to query state of %s: %v", hs.query, err)
+	}
+	return hs, nil
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+// Interlock guards a set of switches against unsafe combinations. Exclusive
+// interlocks refuse to turn a member On while another member is On, and a
+// dead time forces members to wait after any other member turned Off.
+type Interlock struct {
+	exclusive bool
+	deadTime  time.Duration
+	members   []*Interlocked
+
+	lock sync.Mutex
+}
+
+func (il *Interlock) String() string {
+	names := []string{}
+	for _, m := range il.members {
+		names = append(names, m.name)
+	}
+	return fmt.Sprintf("Interlock {switches: %v, exclusive: %t, deadTime: %v}", names, il.exclusive, il.deadTime)
+}
+
+// clear must be called with the interlock held.
+func (il *Interlock) clear(s *Interlocked) error {
+	for _, m := range il.members {
+		if m == s {
+			continue
+		}
+		if il.exclusive && m.Switch.State() != Off {
+			return fmt.Errorf("interlock refused %s: %s is %v", s.name, m.name, m.Switch.State())
+		}
+		if wait := time.Until(m.lastOff.Add(il.deadTime)); wait > 0 {
+			log.Controller.Debug("Interlock: holding %s for %v dead time after %s", s.name, wait, m.name)
+			time.Sleep(wait)
+		}
+	}
+	return nil
+}
+
+// Interlocked wraps a Switch so every transition to On is cleared by each
+// interlock it is a member of.
+type Interlocked struct {
+	Switch
+	name       string
+	interlocks []*Interlock
+	lastOff    time.Time
+}
+
+func (s *Interlocked) String() string {
+	return fmt.Sprintf("Interlocked {name: %s, switch: %s}", s.name, s.Switch.String())
+}
+
+func (s *Interlocked) Unwrap() Switch {
+	return s.Switch
+}
+
+func (s *Interlocked) acquire() func() {
+	for _, il := range s.interlocks {
+		il.lock.Lock()
+	}
+	return func() {
+		for i := len(s.interlocks) - 1; i >= 0; i-- {
+			s.interlocks[i].lock.Unlock()
+		}
+	}
+}
+
+func (s *Interlocked) On() error {
+	release := s.acquire()
+	defer release()
+	for _, il := range s.interlocks {
+		if err := il.clear(s); err != nil {
+			return err
+		}
+	}
+	return s.Switch.On()
+}
+
+func (s *Interlocked) Off() error {
+	release := s.acquire()
+	defer release()
+	wasOff := s.Switch.State() == Off
+	if err := s.Switch.Off(); err != nil {
+		return err
+	}
+	if !wasOff {
+		s.lastOff = time.Now()
+	}
+	return nil
+}
+
+func (s *Interlocked) Toggle() error {
+	if s.Switch.State() == On {
+		return s.Off()
+	}
+	return s.On()
+}
+
+func ApplyInterlocks(switches map[string]Switch, cfgs []config.Interlock) (map[string]Switch, error) {
+	wrapped := map[string]*Interlocked{}
+	for i, c := range cfgs {
+		if len(c.Switches) < 2 {
+			return nil, fmt.Errorf("interlock %d needs at least two switches", i)
+		}
+		il := &Interlock{
+			exclusive: c.Exclusive,
+			deadTime:  time.Duration(c.DeadTimeMs) * time.Millisecond,
+		}
+		for _, name := range c.Switches {
+			s, ok := switches[name]
+			if !ok {
+				return nil, fmt.Errorf("interlock %d references unknown switch %q", i, name)
+			}
+			w, ok := wrapped[name]
+			if !ok {
+				w = &Interlocked{Switch: s, name: name}
+				wrapped[name] = w
+			}
+			w.interlocks = append(w.interlocks, il)
+			il.members = append(il.members, w)
+		}
+		log.Controller.Debug("applied %s", il.String())
+	}
+	result := map[string]Switch{}
+	for name, s := range switches {
+		result[name] = s
+		if w, ok := wrapped[name]; ok {
+			result[name] = w
+		}
+	}
+	return result, nil
+}
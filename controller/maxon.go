@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+)
+
+// MaxOn is a failsafe that forcibly turns a switch Off once it has been On
+// for longer than limit, e.g. when an Exiting event was missed.
+type MaxOn struct {
+	Switch
+	name  string
+	limit time.Duration
+	alert Alert
+
+	timer    *time.Timer
+	deadline time.Time
+	lock     sync.Mutex // guards timer and deadline
+
+	switching sync.Mutex // serializes the cutoff with commands from the actuator
+}
+
+func (m *MaxOn) String() string {
+	return fmt.Sprintf("MaxOn {name: %s, limit: %v, switch: %s}", m.name, m.limit, m.Switch.String())
+}
+
+func (m *MaxOn) Unwrap() Switch {
+	return m.Switch
+}
+
+func (m *MaxOn) arm() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.timer != nil {
+		return
+	}
+	m.deadline = time.Now().Add(m.limit)
+	m.timer = time.AfterFunc(m.limit, m.cutoff)
+}
+
+func (m *MaxOn) disarm() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+		m.deadline = time.Time{}
+	}
+}
+
+// Deadline reports when the pending cutoff fires, if one is armed.
+func (m *MaxOn) Deadline() (time.Time, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.deadline, m.timer != nil
+}
+
+// Restore re-arms a cutoff persisted before a restart, so the remaining time
+// is honored rather than starting a fresh limit. A deadline further away than
+// the limit, as seen from a clock that is behind, is cut down to it.
+func (m *MaxOn) Restore(deadline time.Time) {
+	if limit := time.Now().Add(m.limit); deadline.After(limit) {
+		deadline = limit
+	}
+	if m.Switch.State() != On {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.deadline = deadline
+	m.timer = time.AfterFunc(max(time.Until(deadline), 0), m.cutoff)
+}
+
+func (m *MaxOn) cutoff() {
+	m.lock.Lock()
+	m.timer = nil
+	m.deadline = time.Time{}
+	m.lock.Unlock()
+	msg := fmt.Sprintf("%s exceeded max on duration of %v; forcing off", m.name, m.limit)
+	log.Error(msg)
+	m.switching.Lock()
+	err := m.Switch.Off()
+	m.switching.Unlock()
+	if err != nil {
+		msg = fmt.Sprintf("%s: %s", msg, err.Error())
+		log.Error("failed max on cutoff: %s", err.Error())
+		m.arm()
+	}
+	if m.alert != nil {
+		m.alert(m.name, msg)
+	}
+}
+
+func (m *MaxOn) track() {
+	if m.Switch.State() == On {
+		m.arm()
+		return
+	}
+	m.disarm()
+}
+
+func (m *MaxOn) On() error {
+	m.switching.Lock()
+	defer m.switching.Unlock()
+	err := m.Switch.On()
+	m.track()
+	return err
+}
+
+func (m *MaxOn) Off() error {
+	m.switching.Lock()
+	defer m.switching.Unlock()
+	err := m.Switch.Off()
+	m.track()
+	return err
+}
+
+func (m *MaxOn) Toggle() error {
+	m.switching.Lock()
+	defer m.switching.Unlock()
+	err := m.Switch.Toggle()
+	m.track()
+	return err
+}
+
+func NewMaxOn(name string, s Switch, limit time.Duration, alert Alert) *MaxOn {
+	m := &MaxOn{Switch: s, name: name, limit: limit, alert: alert}
+	m.track()
+	return m
+}
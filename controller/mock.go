@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Transition struct {
+	Switch string
+	State  State
+	Epoch  time.Time
+}
+
+// Mock is an in-memory switch that records its transitions, so traces can be
+// replayed without hardware.
+type Mock struct {
+	name        string
+	state       State
+	transitions []Transition
+	lock        sync.Mutex
+}
+
+func (m *Mock) String() string {
+	return fmt.Sprintf("Mock {name: %s, state: %v}", m.name, m.State())
+}
+
+func (m *Mock) State() State {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.state
+}
+
+func (m *Mock) set(state State) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.state == state {
+		return nil
+	}
+	m.state = state
+	m.transitions = append(m.transitions, Transition{Switch: m.name, State: state, Epoch: time.Now()})
+	return nil
+}
+
+func (m *Mock) On() error {
+	return m.set(On)
+}
+
+func (m *Mock) Off() error {
+	return m.set(Off)
+}
+
+func (m *Mock) Toggle() error {
+	if m.State() == On {
+		return m.Off()
+	}
+	return m.On()
+}
+
+func (m *Mock) Transitions() []Transition {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]Transition{}, m.transitions...)
+}
+
+func NewMock(name string) *Mock {
+	return &Mock{name: name, state: Off}
+}
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultModbusBaud      = 9600
+	DefaultModbusTimeoutMs = 500
+
+	modbusReadCoils       = 0x01
+	modbusWriteSingleCoil = 0x05
+	modbusException       = 0x80
+)
+
+func modbusCRC(b []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, v := range b {
+		crc ^= uint16(v)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Modbus is a Modbus RTU client on an RS-485 bus. Devices sharing a bus share
+// one client.
+type Modbus struct {
+	uart    *UART
+	timeout time.Duration
+}
+
+func (m *Modbus) String() string {
+	return fmt.Sprintf("Modbus {uart: %s}", m.uart.String())
+}
+
+// call sends a request PDU to unit and returns the response PDU's data.
+func (m *Modbus) call(unit byte, function byte, data []byte, size int) ([]byte, error) {
+	adu := append([]byte{unit, function}, data...)
+	adu = binary.LittleEndian.AppendUint16(adu, modbusCRC(adu))
+	return m.uart.Transact(adu, m.timeout, func(u *UART) ([]byte, error) {
+		head, err := u.ReadFull(2)
+		if err != nil {
+			return nil, fmt.Errorf("modbus: no response from unit %d: %w", unit, err)
+		}
+		if head[0] != unit {
+			return nil, fmt.Errorf("modbus: response from unit %d, expected %d", head[0], unit)
+		}
+		n := size
+		if head[1] == function|modbusException {
+			n = 1
+		}
+		rest, err := u.ReadFull(n + 2)
+		if err != nil {
+			return nil, fmt.Errorf("modbus: truncated response from unit %d: %w", unit, err)
+		}
+		frame := append(head, rest...)
+		if binary.LittleEndian.Uint16(frame[len(frame)-2:]) != modbusCRC(frame[:len(frame)-2]) {
+			return nil, fmt.Errorf("modbus: crc mismatch from unit %d", unit)
+		}
+		if head[1] == function|modbusException {
+			return nil, fmt.Errorf("modbus: unit %d raised exception %#x", unit, rest[0])
+		}
+		return frame[2 : len(frame)-2], nil
+	})
+}
+
+func (m *Modbus) ReadCoil(unit byte, coil uint16) (bool, error) {
+	data := binary.BigEndian.AppendUint16(nil, coil)
+	data = binary.BigEndian.AppendUint16(data, 1)
+	r, err := m.call(unit, modbusReadCoils, data, 2)
+	if err != nil {
+		return false, err
+	}
+	return r[1]&1 == 1, nil
+}
+
+func (m *Modbus) WriteCoil(unit byte, coil uint16, on bool) error {
+	value := uint16(0x0000)
+	if on {
+		value = 0xFF00
+	}
+	data := binary.BigEndian.AppendUint16(nil, coil)
+	data = binary.BigEndian.AppendUint16(data, value)
+	_, err := m.call(unit, modbusWriteSingleCoil, data, 4)
+	return err
+}
+
+func NewModbus(c config.Modbus) (*Modbus, error) {
+	baud := c.Baud
+	if baud == 0 {
+		baud = DefaultModbusBaud
+	}
+	timeout := c.TimeoutMs
+	if timeout == 0 {
+		timeout = DefaultModbusTimeoutMs
+	}
+	uart, err := OpenUART(c.Port, baud)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize modbus: %w", err)
+	}
+	return &Modbus{uart: uart, timeout: time.Duration(timeout) * time.Millisecond}, nil
+}
+
+// ModbusCoil is a relay module output addressed by unit ID and coil. Its
+// state is read at startup and on every probe, and stays Unknown until the
+// unit answers.
+type ModbusCoil struct {
+	bus  *Modbus
+	unit byte
+	coil uint16
+
+	mu    sync.Mutex
+	state State
+}
+
+func (mc *ModbusCoil) String() string {
+	return fmt.Sprintf("ModbusCoil {state: %v, unit: %d, coil: %d, bus: %s}", mc.State(), mc.unit, mc.coil, mc.bus.String())
+}
+
+func (mc *ModbusCoil) State() State {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.state
+}
+
+func (mc *ModbusCoil) set(s State) {
+	mc.mu.Lock()
+	mc.state = s
+	mc.mu.Unlock()
+}
+
+func (mc *ModbusCoil) send(s State) error {
+	if err := mc.bus.WriteCoil(mc.unit, mc.coil, s == On); err != nil {
+		mc.set(Error)
+		return fmt.Errorf("failed to switch coil %d of unit %d %v: %w", mc.coil, mc.unit, s, err)
+	}
+	mc.set(s)
+	return nil
+}
+
+func (mc *ModbusCoil) On() error {
+	if mc.State() == On {
+		return nil
+	}
+	return mc.send(On)
+}
+
+func (mc *ModbusCoil) Off() error {
+	if mc.State() == Off {
+		return nil
+	}
+	return mc.send(Off)
+}
+
+func (mc *ModbusCoil) Toggle() error {
+	s := mc.State()
+	if !s.Valid() {
+		return fmt.Errorf("unable to toggle invalid state: %+v", s)
+	}
+	if s == On {
+		return mc.send(Off)
+	}
+	return mc.send(On)
+}
+
+// Probe reads the coil and takes its state.
+func (mc *ModbusCoil) Probe() error {
+	on, err := mc.bus.ReadCoil(mc.unit, mc.coil)
+	if err != nil {
+		return err
+	}
+	if on {
+		mc.set(On)
+	} else {
+		mc.set(Off)
+	}
+	return nil
+}
+
+func NewModbusCoil(bus *Modbus, unit byte, coil uint16) (*ModbusCoil, error) {
+	mc := &ModbusCoil{bus: bus, unit: unit, coil: coil}
+	if err := mc.Probe(); err != nil {
+		// NOTE: a unit that doesn't answer mustn't keep the other switches
+		// from starting; the health monitor reports it failing until it does
+		log.Error("ModbusCoil: failed to read coil %d of unit %d: %v", coil, unit, err)
+	}
+	return mc, nil
+}
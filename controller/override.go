@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Pin holds a switch in a manually chosen state, keeping automation off it.
+type Pin struct {
+	Switch string     `json:"switch"`
+	State  string     `json:"state"`
+	Reason string     `json:"reason"` // what pinned it, e.g. "api" or "button"
+	Since  time.Time  `json:"since"`
+	Until  *time.Time `json:"until,omitempty"` // unset pins until cleared
+
+	Restored bool `json:"-"` // loaded from saved state; does not expire until rearmed
+}
+
+// Overrides tracks pinned switches and releases them once they expire.
+type Overrides struct {
+	pins   map[string]Pin
+	timers map[string]*time.Timer
+	armed  map[string]uint64 // which Pin call armed each timer
+	seq    uint64
+	lock   sync.Mutex
+
+	OnExpire func(Pin)
+}
+
+func (o *Overrides) String() string {
+	return fmt.Sprintf("Overrides {pins: %d}", len(o.Snapshot()))
+}
+
+// Pin replaces any pin on p.Switch and arms its expiry, unless it was
+// restored.
+func (o *Overrides) Pin(p Pin) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.release(p.Switch)
+	o.pins[p.Switch] = p
+	if p.Until == nil || p.Restored {
+		return
+	}
+	o.arm(p)
+}
+
+// arm must be called with the lock held.
+func (o *Overrides) arm(p Pin) {
+	o.seq++
+	seq := o.seq
+	o.armed[p.Switch] = seq
+	o.timers[p.Switch] = time.AfterFunc(time.Until(*p.Until), func() {
+		o.lock.Lock()
+		current, ok := o.pins[p.Switch]
+		if !ok || o.armed[p.Switch] != seq {
+			o.lock.Unlock()
+			return
+		}
+		o.release(p.Switch)
+		o.lock.Unlock()
+		if o.OnExpire != nil {
+			o.OnExpire(current)
+		}
+	})
+}
+
+// Rearm arms the expiry of restored pins, once the clock can be trusted to
+// compare against the times they were saved with.
+func (o *Overrides) Rearm() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for name, p := range o.pins {
+		if !p.Restored {
+			continue
+		}
+		p.Restored = false
+		o.pins[name] = p
+		if p.Until != nil {
+			o.arm(p)
+		}
+	}
+}
+
+// Shift follows a jump of the wall clock by d. Pins made during this run keep
+// their remaining time, since their timers run on elapsed time, so only their
+// times move.
+func (o *Overrides) Shift(d time.Duration) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for name, p := range o.pins {
+		if p.Restored {
+			continue
+		}
+		p.Since = p.Since.Add(d)
+		if p.Until != nil {
+			until := p.Until.Add(d)
+			p.Until = &until
+		}
+		o.pins[name] = p
+	}
+}
+
+func (o *Overrides) release(name string) {
+	if t, ok := o.timers[name]; ok {
+		t.Stop()
+		delete(o.timers, name)
+		delete(o.armed, name)
+	}
+	delete(o.pins, name)
+}
+
+// Clear releases the pin on a switch, reporting the pin that was removed.
+func (o *Overrides) Clear(name string) (Pin, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	p, ok := o.pins[name]
+	o.release(name)
+	return p, ok
+}
+
+func (o *Overrides) Get(name string) (Pin, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	p, ok := o.pins[name]
+	return p, ok
+}
+
+func (o *Overrides) Snapshot() []Pin {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	pins := []Pin{}
+	for _, p := range o.pins {
+		pins = append(pins, p)
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Switch < pins[j].Switch })
+	return pins
+}
+
+func NewOverrides() *Overrides {
+	return &Overrides{pins: map[string]Pin{}, timers: map[string]*time.Timer{}, armed: map[string]uint64{}}
+}
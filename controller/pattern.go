@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+)
+
+// Pattern is a timed on/off sequence for a switch, e.g. a double pulse for a
+// gate opener or a blink code on an LED.
+type Pattern struct {
+	Name   string
+	Switch string
+	Steps  []Step
+}
+
+func (p Pattern) String() string {
+	return fmt.Sprintf("Pattern {name: %s, switch: %s, steps: %d}", p.Name, p.Switch, len(p.Steps))
+}
+
+// NewPattern expands a configured pattern into the steps played. A step is
+// held until the next one; the hold of the last only separates repeats.
+func NewPattern(c config.Pattern) (Pattern, error) {
+	if len(c.Steps) == 0 {
+		return Pattern{}, fmt.Errorf("pattern %q has no steps", c.Name)
+	}
+	times := c.Times
+	if times <= 0 {
+		times = 1
+	}
+	p := Pattern{Name: c.Name, Switch: c.Switch}
+	var hold time.Duration
+	for range times {
+		for i, s := range c.Steps {
+			state := Unknown
+			switch strings.ToLower(s.State) {
+			case "on":
+				state = On
+			case "off":
+				state = Off
+			default:
+				return Pattern{}, fmt.Errorf("step %d of pattern %q: state must be on or off", i+1, c.Name)
+			}
+			if s.Ms < 0 {
+				return Pattern{}, fmt.Errorf("step %d of pattern %q: negative hold", i+1, c.Name)
+			}
+			p.Steps = append(p.Steps, Step{Delay: hold, State: state})
+			hold = time.Duration(s.Ms) * time.Millisecond
+		}
+	}
+	return p, nil
+}
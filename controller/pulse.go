@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"periph.io/x/conn/v3/gpio"
+)
+
+const (
+	DefaultPulsesPerKWh  = 1000
+	DefaultPulseMinGapMs = 30 // S0 pulses last at least 30ms
+)
+
+// PulseMeter accumulates the consumption reported by an S0 energy meter,
+// whose open collector output pulls a GPIO input low once per unit.
+type PulseMeter struct {
+	gpio   GPIO
+	perKWh float64
+	minGap time.Duration
+
+	pulses uint64
+	base   float64 // kWh restored from a previous run
+	lock   sync.Mutex
+}
+
+func (pm *PulseMeter) String() string {
+	return fmt.Sprintf("PulseMeter {kWh: %.3f, terminal: %s}", pm.KWh(), pm.gpio.String())
+}
+
+func (pm *PulseMeter) KWh() float64 {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	return pm.base + float64(pm.pulses)/pm.perKWh
+}
+
+// Counted reads the kWh along with the pulses counted towards them, for
+// Restore.
+func (pm *PulseMeter) Counted() (float64, uint64) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	return pm.base + float64(pm.pulses)/pm.perKWh, pm.pulses
+}
+
+// Restore resumes accumulating from a persisted reading of kwh, pulses of
+// which were counted. Pulses counted since startup are kept.
+func (pm *PulseMeter) Restore(kwh float64, pulses uint64) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	pm.base = kwh - float64(pulses)/pm.perKWh
+	pm.pulses += pulses
+}
+
+// Run counts pulses until the pin can no longer be watched.
+func (pm *PulseMeter) Run() {
+	last := time.Time{}
+	for {
+		if !pm.gpio.pin.WaitForEdge(-1) {
+			time.Sleep(pm.minGap)
+			continue
+		}
+		now := time.Now()
+		if now.Sub(last) < pm.minGap {
+			continue
+		}
+		last = now
+		pm.lock.Lock()
+		pm.pulses++
+		pm.lock.Unlock()
+		log.Controller.DebugMemoize("PulseMeter: pulse on %s", pm.gpio.String())
+	}
+}
+
+func NewPulseMeter(c config.Energy) (*PulseMeter, error) {
+	perKWh := c.PulsesPerKWh
+	if perKWh <= 0 {
+		perKWh = DefaultPulsesPerKWh
+	}
+	minGap := c.MinGapMs
+	if minGap <= 0 {
+		minGap = DefaultPulseMinGapMs
+	}
+	pm := &PulseMeter{perKWh: float64(perKWh), minGap: time.Duration(minGap) * time.Millisecond}
+	if err := pm.gpio.Claim(SerialName(c.Terminal)); err != nil {
+		return nil, fmt.Errorf("failed to initialize pulse meter: %w", err)
+	}
+	if err := pm.gpio.pin.In(gpio.PullUp, gpio.FallingEdge); err != nil {
+		return nil, fmt.Errorf("failed to watch %s: %w", c.Terminal, err)
+	}
+	return pm, nil
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+)
+
+// RateLimited guarantees a minimum interval between transitions of a switch.
+// Requests arriving too early wait for the interval to elapse; when several
+// are waiting only the most recent one is carried out.
+type RateLimited struct {
+	Switch
+	name     string
+	interval time.Duration
+
+	last time.Time
+	gen  uint64
+	lock sync.Mutex
+}
+
+func (r *RateLimited) String() string {
+	return fmt.Sprintf("RateLimited {name: %s, interval: %v, switch: %s}", r.name, r.interval, r.Switch.String())
+}
+
+func (r *RateLimited) Unwrap() Switch {
+	return r.Switch
+}
+
+func (r *RateLimited) transition(op func() error) error {
+	r.lock.Lock()
+	r.gen++
+	gen := r.gen
+	wait := time.Until(r.last.Add(r.interval))
+	r.lock.Unlock()
+	if wait > 0 {
+		log.Controller.Debug("RateLimited: %s queued for %v", r.name, wait)
+		time.Sleep(wait)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if gen != r.gen {
+		log.Controller.Debug("RateLimited: %s coalesced into a newer request", r.name)
+		return nil
+	}
+	before := r.Switch.State()
+	if err := op(); err != nil {
+		return err
+	}
+	if r.Switch.State() != before {
+		r.last = time.Now()
+	}
+	return nil
+}
+
+func (r *RateLimited) On() error {
+	return r.transition(r.Switch.On)
+}
+
+func (r *RateLimited) Off() error {
+	return r.transition(r.Switch.Off)
+}
+
+func (r *RateLimited) Toggle() error {
+	return r.transition(r.Switch.Toggle)
+}
+
+func NewRateLimited(name string, s Switch, interval time.Duration) *RateLimited {
+	return &RateLimited{Switch: s, name: name, interval: interval}
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/mqtt"
+)
+
+const (
+	DefaultSwitch  = "relay"
+	DefaultDelayMs = 1000
+)
+
+// ActionDelays resolves the delays before switching On and Off for an action,
+// preferring the action's own delays over the switch-wide ones.
+func ActionDelays(c config.Switch, action string) (time.Duration, time.Duration) {
+	resolve := func(pick func(config.Delays) *int) time.Duration {
+		if ms := pick(c.ActionDelays[strings.ToLower(action)]); ms != nil {
+			return time.Duration(*ms) * time.Millisecond
+		}
+		if ms := pick(c.Delays); ms != nil {
+			return time.Duration(*ms) * time.Millisecond
+		}
+		return time.Duration(DefaultDelayMs) * time.Millisecond
+	}
+	on := resolve(func(d config.Delays) *int { return d.OnMs })
+	off := resolve(func(d config.Delays) *int { return d.OffMs })
+	return on, off
+}
+
+// Alert is called when a switch takes a safety action on its own, outside of
+// any caller's request.
+type Alert func(name string, msg string)
+
+// backends holds connections shared by the switches built on them.
+type backends struct {
+	modbus map[string]*Modbus // by port
+	mqtt   *mqtt.Client
+	alert  Alert
+	lock   sync.Mutex // for standby members built after startup
+}
+
+// unavailable marks a switch that couldn't be built for want of its device or
+// connection, rather than because of its configuration.
+type unavailable struct{ error }
+
+func (u unavailable) Unwrap() error { return u.error }
+
+func (b *backends) build(c config.Switch) (Switch, error) {
+	switch c.Type {
+	case "", "gpio":
+		terminals := []SerialName{}
+		for _, t := range c.Terminals {
+			terminals = append(terminals, SerialName(t))
+		}
+		s, err := NewOptoRelaySwitch(terminals...)
+		if err != nil {
+			return nil, unavailable{err}
+		}
+		return s, nil
+	case "modbus":
+		bus, ok := b.modbus[c.Modbus.Port]
+		if !ok {
+			var err error
+			if bus, err = NewModbus(c.Modbus); err != nil {
+				return nil, unavailable{err}
+			}
+			b.modbus[c.Modbus.Port] = bus
+		}
+		return NewModbusCoil(bus, c.Modbus.Unit, c.Modbus.Coil)
+	case "zigbee":
+		if b.mqtt == nil {
+			client, err := mqtt.Dial(config.RuntimeConfig.MQTT)
+			if err != nil {
+				return nil, unavailable{err}
+			}
+			b.mqtt = client
+		}
+		return NewZigbeeSwitch(b.mqtt, c.Zigbee)
+	case "http":
+		return NewHTTPSwitch(c.HTTP)
+	case "mock":
+		return NewMock(c.Name), nil
+	case "failover":
+		members := []Switch{}
+		for i, m := range c.Failover.Members {
+			s, err := b.build(m)
+			var down unavailable
+			if errors.As(err, &down) {
+				// NOTE: a member that is down at startup is exactly what the
+				// failover is for; it's skipped until fail-back brings it up
+				log.Error("failover %s: member %d is down: %v", c.Name, i, err)
+				s, err = &standby{backends: b, config: m}, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize member %d: %w", i, err)
+			}
+			members = append(members, s)
+		}
+		interval := time.Duration(c.Failover.ProbeMs) * time.Millisecond
+		return NewFailover(c.Name, members, c.Failover.Threshold, interval, b.alert)
+	}
+	return nil, fmt.Errorf("unknown switch type %q", c.Type)
+}
+
+func NewSwitches(cfgs []config.Switch, alert Alert) (map[string]Switch, error) {
+	if len(cfgs) == 0 {
+		cfgs = []config.Switch{{Name: DefaultSwitch}}
+	}
+	b := &backends{modbus: map[string]*Modbus{}, alert: alert}
+	switches := map[string]Switch{}
+	for _, c := range cfgs {
+		if _, ok := switches[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate switch %q", c.Name)
+		}
+		s, err := b.build(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize switch %q: %w", c.Name, err)
+		}
+		s = NewCounter(c.Name, s, c.MaintenanceCycles, alert)
+		if c.MinIntervalMs > 0 {
+			s = NewRateLimited(c.Name, s, time.Duration(c.MinIntervalMs)*time.Millisecond)
+		}
+		switches[c.Name] = s
+	}
+	switches, err := ApplyInterlocks(switches, config.RuntimeConfig.Interlocks)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cfgs {
+		if c.MaxOnMs > 0 {
+			switches[c.Name] = NewMaxOn(c.Name, switches[c.Name], time.Duration(c.MaxOnMs)*time.Millisecond, alert)
+		}
+	}
+	return switches, nil
+}
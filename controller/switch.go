@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/robolivable/beaves/config"
@@ -9,27 +11,36 @@ import (
 )
 
 type Switch interface {
-	On(Delay time.Duration) error
-	Off(Delay time.Duration) error
-	Toggle(Delay time.Duration) error
+	On() error
+	Off() error
+	Toggle() error
+	State() State
 	String() string
 }
 
 type OptoRelay struct {
 	state State
 	gpio  GPIO
+	lock  sync.Mutex // guards state and the terminal
 }
 
 func (or *OptoRelay) String() string {
-	return fmt.Sprintf("OptoRelay {state: %v, terminal: %s}", or.state, or.gpio.String())
+	return fmt.Sprintf("OptoRelay {state: %v, terminal: %s}", or.State(), or.gpio.String())
 }
 
-func (or *OptoRelay) On(d time.Duration) error {
-	log.Debug("OptoRelay.On: %s", or.String())
+func (or *OptoRelay) State() State {
+	or.lock.Lock()
+	defer or.lock.Unlock()
+	return or.state
+}
+
+func (or *OptoRelay) On() error {
+	log.Controller.Debug("OptoRelay.On: %s", or.String())
+	or.lock.Lock()
+	defer or.lock.Unlock()
 	if or.state == On {
 		return nil
 	}
-	time.Sleep(d)
 	if err := or.gpio.Send(On); err != nil {
 		or.state = Error
 		return fmt.Errorf("failed to turn on relay: %w", err)
@@ -38,12 +49,13 @@ func (or *OptoRelay) On(d time.Duration) error {
 	return nil
 }
 
-func (or *OptoRelay) Off(d time.Duration) error {
-	log.Debug("OptoRelay.Off: %s", or.String())
+func (or *OptoRelay) Off() error {
+	log.Controller.Debug("OptoRelay.Off: %s", or.String())
+	or.lock.Lock()
+	defer or.lock.Unlock()
 	if or.state == Off {
 		return nil
 	}
-	time.Sleep(d)
 	if err := or.gpio.Send(Off); err != nil {
 		or.state = Error
 		return fmt.Errorf("failed to turn off relay: %w", err)
@@ -52,8 +64,10 @@ func (or *OptoRelay) Off(d time.Duration) error {
 	return nil
 }
 
-func (or *OptoRelay) Toggle(d time.Duration) error {
-	log.Debug("OptoRelay.Toggle: %s", or.String())
+func (or *OptoRelay) Toggle() error {
+	log.Controller.Debug("OptoRelay.Toggle: %s", or.String())
+	or.lock.Lock()
+	defer or.lock.Unlock()
 	if !or.state.Valid() {
 		return fmt.Errorf("unable to toggle invalid state: %+v", or.state)
 	}
@@ -61,7 +75,6 @@ func (or *OptoRelay) Toggle(d time.Duration) error {
 	if or.state == toggle {
 		toggle = Off
 	}
-	time.Sleep(d)
 	if err := or.gpio.Send(toggle); err != nil {
 		or.state = Error
 		return fmt.Errorf("failed to toggle relay: %w", err)
@@ -70,14 +83,34 @@ func (or *OptoRelay) Toggle(d time.Duration) error {
 	return nil
 }
 
-func NewOptoRelaySwitch() (*OptoRelay, error) {
+// Probe checks the relay's terminal is still claimed and reads back the level
+// last driven.
+func (or *OptoRelay) Probe() error {
+	or.lock.Lock()
+	defer or.lock.Unlock()
+	if err := or.gpio.Check(); err != nil {
+		return err
+	}
+	if or.state.Valid() {
+		if read := or.gpio.Receive(); read != or.state {
+			return fmt.Errorf("%s reads %v, expected %v", or.gpio.String(), read, or.state)
+		}
+	}
+	return nil
+}
+
+func NewOptoRelaySwitch(terminals ...SerialName) (*OptoRelay, error) {
+	if len(terminals) == 0 {
+		terminals = []SerialName{RelayTerminal, RelayBackupTerminal}
+	}
 	g := GPIO{debounce: time.Duration(config.RuntimeConfig.RelayDebounceMs) * time.Millisecond}
-	if err := g.Claim(RelayTerminal); err != nil {
-		_err := fmt.Errorf("failed to initialize serial module on default terminal: %w", err)
-		if bErr := g.Claim(RelayBackupTerminal); bErr != nil {
-			_bErr := fmt.Errorf("failed to initialize serial module on backup terminal: %w", bErr)
-			return &OptoRelay{}, fmt.Errorf("%w; %w", _err, _bErr)
+	errs := []error{}
+	for _, t := range terminals {
+		err := g.Claim(t)
+		if err == nil {
+			return &OptoRelay{state: g.Receive(), gpio: g}, nil
 		}
+		errs = append(errs, fmt.Errorf("failed to initialize serial module on terminal %s: %w", t, err))
 	}
-	return &OptoRelay{state: g.Receive(), gpio: g}, nil
+	return &OptoRelay{}, errors.Join(errs...)
 }
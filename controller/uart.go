@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// UART is a raw 8N1 serial port shared by the drivers that speak UART.
+type UART struct {
+	port   *os.File
+	reader *bufio.Reader
+
+	lock sync.Mutex
+}
+
+func (u *UART) String() string {
+	return fmt.Sprintf("UART {port: %s}", u.port.Name())
+}
+
+func (u *UART) Read(p []byte) (int, error) {
+	return u.reader.Read(p)
+}
+
+func (u *UART) Write(p []byte) (int, error) {
+	return u.port.Write(p)
+}
+
+func (u *UART) Close() error {
+	return u.port.Close()
+}
+
+// SetReadTimeout bounds every following read; zero disables the timeout.
+func (u *UART) SetReadTimeout(d time.Duration) error {
+	if d == 0 {
+		return u.port.SetReadDeadline(time.Time{})
+	}
+	return u.port.SetReadDeadline(time.Now().Add(d))
+}
+
+// Flush discards anything buffered but not yet read.
+func (u *UART) Flush() error {
+	u.reader.Reset(u.port)
+	return unix.IoctlSetInt(int(u.port.Fd()), unix.TCFLSH, unix.TCIFLUSH)
+}
+
+// Transact writes a request and reads its response while holding the port,
+// so request/response protocols on a shared bus never interleave.
+func (u *UART) Transact(request []byte, timeout time.Duration, response func(*UART) ([]byte, error)) ([]byte, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if err := u.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to flush %s: %w", u.port.Name(), err)
+	}
+	if _, err := u.port.Write(request); err != nil {
+		return nil, fmt.Errorf("failed to write to %s: %w", u.port.Name(), err)
+	}
+	if err := u.SetReadTimeout(timeout); err != nil {
+		return nil, err
+	}
+	defer u.SetReadTimeout(0)
+	return response(u)
+}
+
+// SyncTo discards input until marker has been read.
+func (u *UART) SyncTo(marker []byte) error {
+	window := make([]byte, 0, len(marker))
+	for !bytes.Equal(window, marker) {
+		b, err := u.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if len(window) == len(marker) {
+			window = window[1:]
+		}
+		window = append(window, b)
+	}
+	return nil
+}
+
+func (u *UART) ReadFull(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(u.reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Frame describes a header/length/payload/footer framing, as used by many
+// sensor modules.
+type Frame struct {
+	Header       []byte
+	Footer       []byte
+	LengthSize   int // bytes in the length field; 0 for none
+	LittleEndian bool
+	MaxLength    int
+}
+
+var ErrFrameFooter = errors.New("frame footer mismatch")
+
+// ReadFrame returns the payload of the next frame, skipping any noise before
+// its header.
+func (u *UART) ReadFrame(f Frame) ([]byte, error) {
+	if err := u.SyncTo(f.Header); err != nil {
+		return nil, err
+	}
+	size, err := u.ReadFull(f.LengthSize)
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	switch {
+	case f.LengthSize == 1:
+		n = int(size[0])
+	case f.LengthSize == 2 && f.LittleEndian:
+		n = int(binary.LittleEndian.Uint16(size))
+	case f.LengthSize == 2:
+		n = int(binary.BigEndian.Uint16(size))
+	default:
+		return nil, fmt.Errorf("unsupported frame length size %d", f.LengthSize)
+	}
+	if f.MaxLength > 0 && n > f.MaxLength {
+		return nil, fmt.Errorf("oversized frame of %d bytes", n)
+	}
+	frame, err := u.ReadFull(n + len(f.Footer))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(frame[n:], f.Footer) {
+		return nil, ErrFrameFooter
+	}
+	return frame[:n], nil
+}
+
+func OpenUART(path string, baud int) (*UART, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	t, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS2)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to configure %s: %w", path, err)
+	}
+	t.Iflag = 0
+	t.Oflag = 0
+	t.Lflag = 0
+	// NOTE: BOTHER takes the baud rate verbatim, so non-standard rates work
+	t.Cflag = unix.CS8 | unix.CREAD | unix.CLOCAL | unix.BOTHER
+	t.Ispeed = uint32(baud)
+	t.Ospeed = uint32(baud)
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(int(f.Fd()), unix.TCSETS2, t); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to configure %s: %w", path, err)
+	}
+	return &UART{port: f, reader: bufio.NewReader(f)}, nil
+}
@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/mqtt"
+)
+
+const (
+	DefaultZigbeeBaseTopic = "zigbee2mqtt"
+	DefaultZigbeeProperty  = "state"
+	DefaultZigbeeTimeoutMs = 5000
+)
+
+// ZigbeeSwitch actuates a Zigbee plug or relay through a zigbee2mqtt bridge.
+// State follows the device's own reports, so changes made elsewhere (e.g. the
+// plug's button) are picked up too.
+type ZigbeeSwitch struct {
+	client   *mqtt.Client
+	topic    string
+	property string
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	state   State
+	reports chan State   // for send
+	probes  []chan State // for Probe, each answered by the next report
+}
+
+func (z *ZigbeeSwitch) String() string {
+	return fmt.Sprintf("ZigbeeSwitch {state: %v, topic: %s, property: %s}", z.State(), z.topic, z.property)
+}
+
+func (z *ZigbeeSwitch) State() State {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.state
+}
+
+func (z *ZigbeeSwitch) report(_ string, payload []byte) {
+	var msg map[string]any
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Error("ZigbeeSwitch.report: %s: %v", z.topic, err)
+		return
+	}
+	v, ok := msg[z.property].(string)
+	if !ok {
+		return
+	}
+	s := Unknown
+	switch strings.ToUpper(v) {
+	case "ON":
+		s = On
+	case "OFF":
+		s = Off
+	}
+	z.mu.Lock()
+	z.state = s
+	for _, p := range z.probes {
+		p <- s
+	}
+	z.probes = nil
+	z.mu.Unlock()
+	select {
+	case z.reports <- s:
+	default:
+	}
+}
+
+func (z *ZigbeeSwitch) send(s State) error {
+	payload, err := json.Marshal(map[string]string{z.property: strings.ToUpper(s.String())})
+	if err != nil {
+		return err
+	}
+	// drain reports that predate this request
+	select {
+	case <-z.reports:
+	default:
+	}
+	if err := z.client.Publish(z.topic+"/set", payload); err != nil {
+		z.mu.Lock()
+		z.state = Error
+		z.mu.Unlock()
+		return fmt.Errorf("failed to switch %s %v: %w", z.topic, s, err)
+	}
+	deadline := time.After(z.timeout)
+	for {
+		select {
+		case r := <-z.reports:
+			if r == s {
+				return nil
+			}
+		case <-deadline:
+			z.mu.Lock()
+			z.state = Error
+			z.mu.Unlock()
+			return fmt.Errorf("failed to switch %s %v: no confirmation within %v", z.topic, s, z.timeout)
+		}
+	}
+}
+
+func (z *ZigbeeSwitch) On() error {
+	if z.State() == On {
+		return nil
+	}
+	return z.send(On)
+}
+
+func (z *ZigbeeSwitch) Off() error {
+	if z.State() == Off {
+		return nil
+	}
+	return z.send(Off)
+}
+
+func (z *ZigbeeSwitch) Toggle() error {
+	s := z.State()
+	if !s.Valid() {
+		return fmt.Errorf("unable to toggle invalid state: %+v", s)
+	}
+	if s == On {
+		return z.send(Off)
+	}
+	return z.send(On)
+}
+
+// Probe asks the bridge for the device's state and waits for its report,
+// leaving the reports a switch command waits for alone.
+func (z *ZigbeeSwitch) Probe() error {
+	reply := make(chan State, 1)
+	z.mu.Lock()
+	z.probes = append(z.probes, reply)
+	z.mu.Unlock()
+	defer func() {
+		z.mu.Lock()
+		z.probes = slices.DeleteFunc(z.probes, func(p chan State) bool { return p == reply })
+		z.mu.Unlock()
+	}()
+	if err := z.query(); err != nil {
+		return err
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-time.After(z.timeout):
+		return fmt.Errorf("no report from %s within %v", z.topic, z.timeout)
+	}
+}
+
+func (z *ZigbeeSwitch) query() error {
+	get, _ := json.Marshal(map[string]string{z.property: ""})
+	return z.client.Publish(z.topic+"/get", get)
+}
+
+func NewZigbeeSwitch(client *mqtt.Client, c config.Zigbee) (*ZigbeeSwitch, error) {
+	if c.Device == "" {
+		return nil, fmt.Errorf("zigbee switch requires a device")
+	}
+	base := c.BaseTopic
+	if base == "" {
+		base = DefaultZigbeeBaseTopic
+	}
+	property := c.Property
+	if property == "" {
+		property = DefaultZigbeeProperty
+	}
+	timeout := c.TimeoutMs
+	if timeout == 0 {
+		timeout = DefaultZigbeeTimeoutMs
+	}
+	z := &ZigbeeSwitch{
+		client:   client,
+		topic:    base + "/" + c.Device,
+		property: property,
+		timeout:  time.Duration(timeout) * time.Millisecond,
+		reports:  make(chan State, 1),
+	}
+	if err := client.Subscribe(z.topic, z.report); err != nil {
+		return nil, err
+	}
+	// ask the bridge for the current state; the reply arrives as a report
+	if err := z.query(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
@@ -0,0 +1,214 @@
+// Package cron parses cron expressions and runs functions on their schedule,
+// by the wall clock of the configured timezone.
+package cron
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/clock"
+)
+
+// Schedule is a parsed expression of five fields (minute, hour, day of month,
+// month, day of week) or six, with seconds first.
+type Schedule struct {
+	expr string
+
+	second, minute, hour, dom, month, dow uint64 // bit sets
+	domStar, dowStar                      bool   // unrestricted
+}
+
+func (s *Schedule) String() string {
+	return fmt.Sprintf("Cron {expr: %s}", s.expr)
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+func value(s string, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(s)]; ok {
+		return n, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// field parses a comma separated list of "*", values, ranges "a-b" and steps
+// "*/n" or "a-b/n" into a bit set.
+func field(expr string, lo, hi int, names map[string]int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(expr, ",") {
+		rng, step := part, 1
+		if r, s, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			rng, step = r, n
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = value(a, names); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			to = from
+			if isRange {
+				if to, err = value(b, names); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				to = hi // "a/n" runs from a to the end
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, lo, hi)
+		}
+		for i := from; i <= to; i += step {
+			set |= 1 << i
+		}
+	}
+	return set, nil
+}
+
+// Parse reads a cron expression, or one of the macros @yearly, @monthly,
+// @weekly, @daily and @hourly. Day of week is 0-7, both 0 and 7 being Sunday.
+// As in cron, a day matches either a restricted day of month or a restricted
+// day of week; a field starting with * is unrestricted.
+func Parse(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) == 1 {
+		if m, ok := macros[strings.ToLower(fields[0])]; ok {
+			fields = strings.Fields(m)
+		}
+	}
+	if len(fields) == 5 {
+		fields = append([]string{"0"}, fields...)
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 or 6 fields", expr)
+	}
+	// NOTE: as in cron, a field starting with * (e.g. */2) doesn't restrict
+	// the day, however it steps
+	s := &Schedule{expr: expr, domStar: strings.HasPrefix(fields[3], "*"), dowStar: strings.HasPrefix(fields[5], "*")}
+	var err error
+	for i, f := range []struct {
+		set    *uint64
+		lo, hi int
+		names  map[string]int
+	}{
+		{&s.second, 0, 59, nil},
+		{&s.minute, 0, 59, nil},
+		{&s.hour, 0, 23, nil},
+		{&s.dom, 1, 31, nil},
+		{&s.month, 1, 12, monthNames},
+		{&s.dow, 0, 7, dayNames},
+	} {
+		if *f.set, err = field(fields[i], f.lo, f.hi, f.names); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func (s *Schedule) day(t time.Time) bool {
+	dom, dow := s.dom&(1<<t.Day()) != 0, s.dow&(1<<int(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func lowest(set uint64) int {
+	return bits.TrailingZeros64(set)
+}
+
+// forward moves to next, or by unit when the wall clock repeats itself as
+// DST ends and next isn't later.
+func forward(t, next time.Time, unit time.Duration) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(unit).Truncate(unit)
+}
+
+// Next is the first time after t the schedule matches, or the zero time if it
+// never does within five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = clock.Local(t).Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, mo, d := t.Date()
+		h, mi, sec := t.Clock()
+		loc := t.Location()
+		switch {
+		case s.month&(1<<mo) == 0:
+			t = forward(t, time.Date(y, mo+1, 1, 0, 0, 0, 0, loc), time.Hour)
+		case !s.day(t):
+			t = forward(t, time.Date(y, mo, d+1, 0, 0, 0, 0, loc), time.Hour)
+		case s.hour&(1<<h) == 0:
+			next := time.Date(y, mo, d, h+1, 0, 0, 0, loc)
+			if skipped := h + 1; next.Hour() != skipped%24 && s.hour&(1<<skipped) != 0 {
+				// DST starts and skips a wanted hour: run its first match an
+				// hour later instead
+				return time.Date(y, mo, d, skipped, lowest(s.minute), lowest(s.second), 0, loc)
+			}
+			t = forward(t, next, time.Hour)
+		case s.minute&(1<<mi) == 0:
+			t = forward(t, time.Date(y, mo, d, h, mi+1, 0, 0, loc), time.Minute)
+		case s.second&(1<<sec) == 0:
+			t = forward(t, time.Date(y, mo, d, h, mi, sec+1, 0, loc), time.Second)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Run calls fn every time the schedule matches, once ready is closed. It wakes
+// at least every minute, so a jump of the wall clock can't throw a run off by
+// more than that. It returns if the schedule never matches.
+func (s *Schedule) Run(ready <-chan struct{}, fn func()) {
+	<-ready
+	at := s.Next(time.Now())
+	for !at.IsZero() {
+		time.Sleep(min(time.Until(at), time.Minute))
+		now := time.Now()
+		if now.Before(at) {
+			// the clock may have gone back
+			if sooner := s.Next(now); sooner.Before(at) {
+				at = sooner
+			}
+			continue
+		}
+		fn()
+		at = s.Next(now)
+	}
+}
+
+// Daily is the schedule of a "15:04" time of day.
+func Daily(at string) (*Schedule, error) {
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(fmt.Sprintf("%d %d * * *", t.Minute(), t.Hour()))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/radar"
+)
+
+// readiness counts the checks of a diagnosis or self-test, printing each as
+// it's made.
+type readiness struct {
+	failed int
+}
+
+func (r *readiness) ok(format string, args ...any) {
+	fmt.Printf("  ok    %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *readiness) warn(format string, args ...any) {
+	fmt.Printf("  warn  %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *readiness) fail(format string, args ...any) {
+	r.failed++
+	fmt.Printf("  FAIL  %s\n", fmt.Sprintf(format, args...))
+}
+
+// diagnose inspects a subsystem and prints a readiness report, without
+// needing a running sentry.
+func diagnose(args []string) error {
+	if len(args) < 1 || args[0] != "bluetooth" || len(args) > 2 {
+		return fmt.Errorf("usage: beaves diag bluetooth [adapter]")
+	}
+	if len(args) == 2 {
+		configured := slices.ContainsFunc(sentryConfigs(), func(s sentryConfig) bool { return s.Adapter == args[1] })
+		if !configured {
+			(&readiness{}).warn("no zone's sentry runs on %s", args[1])
+		}
+		return diagnoseBluetooth(args[1])
+	}
+	failed := 0
+	for _, s := range sentryConfigs() {
+		fmt.Printf("zone %s\n", s.Zone)
+		if err := diagnoseBluetooth(s.Adapter); err != nil {
+			fmt.Println(err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("bluetooth is not ready: %d adapters failed", failed)
+	}
+	return nil
+}
+
+// diagnoseBluetooth reports whether the adapter is usable and which known
+// actors BlueZ has paired with.
+func diagnoseBluetooth(id string) error {
+	r := &readiness{}
+	adapter, err := radar.NewBlueZAdapter(id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("adapter %s\n", id)
+	if !adapter.Present() {
+		r.fail("adapter is not known to BlueZ")
+		return fmt.Errorf("bluetooth is not ready: %d checks failed", r.failed)
+	}
+	address, _ := adapter.Property("Address")
+	alias, _ := adapter.Alias()
+	r.ok("present at %v as %q", address.Value(), alias)
+	flag := func(name string) bool {
+		v, err := adapter.Property(name)
+		if err != nil {
+			return false
+		}
+		b, _ := v.Value().(bool)
+		return b
+	}
+	if flag("Powered") {
+		r.ok("powered")
+	} else {
+		r.fail("not powered (bluetoothctl power on)")
+	}
+	if flag("Discoverable") {
+		r.ok("discoverable")
+	} else {
+		r.warn("not discoverable; new phones can't pair until it is")
+	}
+	if active, supported, err := adapter.Advertisements(); err != nil {
+		r.fail("%v", err)
+	} else if supported == 0 {
+		r.fail("no advertisement slots free, %d registered", active)
+	} else {
+		r.ok("%d advertisements registered, %d more supported", active, supported)
+	}
+
+	devices, err := adapter.Devices()
+	if err != nil {
+		r.fail("%v", err)
+	}
+	fmt.Println("paired devices")
+	paired := 0
+	for _, d := range devices {
+		if !d.Paired && !d.Bonded {
+			continue
+		}
+		paired++
+		flags := []string{}
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{{"bonded", d.Bonded}, {"trusted", d.Trusted}, {"connected", d.Connected}} {
+			if f.set {
+				flags = append(flags, f.name)
+			}
+		}
+		fmt.Printf("  %s %q %s\n", d.Address, d.Name, strings.Join(flags, " "))
+	}
+	if paired == 0 {
+		fmt.Println("  none")
+	}
+
+	fmt.Println("known actors")
+	known := config.RuntimeConfig.Actors.Known
+	if len(known) == 0 {
+		r.warn("no actors are known; add some to actors.known or the vault")
+	}
+	for _, actor := range known {
+		var found *radar.DeviceInfo
+		for i, d := range devices {
+			if strings.EqualFold(d.Address, actor) {
+				found = &devices[i]
+				break
+			}
+		}
+		switch {
+		case found == nil:
+			r.warn("%s has not been seen by BlueZ", actor)
+		case !found.Paired && !found.Bonded:
+			r.warn("%s is cached but not paired (beaves pair)", actor)
+		default:
+			r.ok("%s is paired", actor)
+		}
+	}
+
+	if r.failed > 0 {
+		return fmt.Errorf("bluetooth is not ready: %d checks failed", r.failed)
+	}
+	fmt.Println("bluetooth is ready")
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/power"
+	"github.com/robolivable/beaves/privacy"
+	"github.com/robolivable/beaves/radar"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+type SwitchDump struct {
+	State      string             `json:"state"`
+	QueueDepth int                `json:"queueDepth,omitempty"`
+	Cycles     uint64             `json:"cycles"`
+	Health     *controller.Health `json:"health,omitempty"`
+	Override   *controller.Pin    `json:"override,omitempty"`
+	HeldUntil  *time.Time         `json:"heldUntil,omitempty"` // automation waits for a manual change
+}
+
+type Dump struct {
+	Epoch          time.Time                    `json:"epoch"`
+	ConfigChecksum string                       `json:"configChecksum"`
+	Goroutines     int                          `json:"goroutines"`
+	Presence       []radar.Presence             `json:"presence"`
+	Seen           []radar.Seen                 `json:"seen"` // when each actor was last detected
+	Switches       map[string]SwitchDump        `json:"switches"`
+	LastOperation  map[string]time.Time         `json:"lastOperation"` // by zone
+	EnergyKWh      float64                      `json:"energyKWh,omitempty"`
+	Battery        *controller.Reading          `json:"battery,omitempty"`
+	ClockTrusted   bool                         `json:"clockTrusted"`
+	Components     []supervisor.Status          `json:"components"`
+	Rejections     map[string]map[string]uint64 `json:"rejections"` // refused BLE writes by service and reason
+	LowPower       []string                     `json:"lowPower"`   // why low power mode is on, if it is
+	Adapters       []radar.AdapterInfo          `json:"adapters"`
+}
+
+func (b *Beaves) Dump() Dump {
+	d := Dump{
+		Epoch:          time.Now(),
+		ConfigChecksum: config.Checksum,
+		Goroutines:     runtime.NumGoroutine(),
+		Presence:       b.Presence.Snapshot(),
+		Seen:           b.LastSeen(),
+		Switches:       map[string]SwitchDump{},
+		LastOperation:  map[string]time.Time{},
+		ClockTrusted:   b.Clock.Trusted(),
+		Rejections:     radar.Rejections(),
+		LowPower:       power.Reasons(),
+		Adapters:       b.AdapterInfo(),
+	}
+	if b.Tree != nil {
+		d.Components = b.Tree.Status()
+	}
+	for _, z := range b.Zones {
+		d.LastOperation[z.Name] = z.Last()
+	}
+	if b.Energy != nil {
+		d.EnergyKWh = b.Energy.KWh()
+	}
+	if b.Battery != nil {
+		r := b.Battery.Get()
+		d.Battery = &r
+	}
+	for name, s := range b.Switches {
+		sd := SwitchDump{State: s.State().String()}
+		if z, ok := b.managing(name); ok {
+			sd.QueueDepth = z.Actuator.Depth()
+		}
+		if c, ok := controller.Find[*controller.Counter](s); ok {
+			sd.Cycles = c.Cycles()
+		}
+		if b.Monitor != nil {
+			if h, ok := b.Monitor.Get(name); ok {
+				sd.Health = &h
+			}
+		}
+		if p, ok := b.Overrides.Get(name); ok {
+			sd.Override = &p
+		}
+		if until, held := b.Arbiters[name].Held(); held {
+			sd.HeldUntil = &until
+		}
+		d.Switches[name] = sd
+	}
+	return d
+}
+
+func (b *Beaves) writeDump() error {
+	data, err := json.MarshalIndent(b.Dump(), "", "  ")
+	if err != nil {
+		return err
+	}
+	data = []byte(privacy.Redact(string(data)))
+	if config.RuntimeConfig.DumpFile == "" {
+		log.Info("state dump: %s", data)
+		return nil
+	}
+	path := config.StatePath(config.RuntimeConfig.DumpFile, "")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	log.Info("state dump written to %s", path)
+	return nil
+}
+
+// FlushLogsOnSignal summarizes suppressed log repeats every time the process
+// receives SIGUSR2.
+func FlushLogsOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+	go func() {
+		for range signals {
+			log.Flush()
+		}
+	}()
+}
+
+// DumpOnSignal writes a state dump every time the process receives SIGUSR1.
+func (b *Beaves) DumpOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			if err := b.writeDump(); err != nil {
+				log.Error("failed to dump state: %s", err.Error())
+			}
+		}
+	}()
+}
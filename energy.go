@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+)
+
+const DefaultEnergyReportMs = 3600000
+
+// Meter records the pulse meter's reading periodically and alongside every
+// presence event, so the history shows what the load consumed between an
+// arrival and the following departure.
+func (b *Beaves) Meter() {
+	load := config.RuntimeConfig.Energy.Load
+	if load == "" {
+		load = b.Actuator.Name()
+	}
+	interval := config.RuntimeConfig.Energy.ReportMs
+	if interval <= 0 {
+		interval = DefaultEnergyReportMs
+	}
+	events, _ := b.Events.Subscribe(16)
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	go func() {
+		defer ticker.Stop()
+		for {
+			reading := bus.Event{Kind: bus.Energy, Name: load, Action: "Reading"}
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				if e.Kind != bus.Presence {
+					continue
+				}
+				reading.Detail = fmt.Sprintf("%s %s", e.Name, e.Action)
+			case <-ticker.C:
+			}
+			reading.Value = b.Energy.KWh()
+			b.Events.Publish(reading)
+		}
+	}()
+}
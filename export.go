@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/history"
+	"github.com/robolivable/beaves/privacy"
+)
+
+// exportColumns are the CSV header.
+var exportColumns = []string{"epoch", "kind", "name", "action", "detail", "value", "direction", "by", "zone"}
+
+// exportTime parses a date, which is taken in the configured timezone and
+// ends at midnight, or an RFC 3339 time.
+func exportTime(value string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, config.Location); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// exportEvents writes the recorded events between -from and -to to stdout as
+// CSV or a JSON array, oldest first.
+func exportEvents(args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return fmt.Errorf("usage: beaves events export [-from <date|time>] [-to <date|time>] [-format csv|json]")
+	}
+	flags := flag.NewFlagSet("events export", flag.ContinueOnError)
+	fromFlag := flags.String("from", "", "first day or RFC 3339 time exported; defaults to the start of the history")
+	toFlag := flags.String("to", "", "last day or RFC 3339 time exported; defaults to now")
+	format := flags.String("format", "csv", "csv or json")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	var from, to time.Time
+	var err error
+	if *fromFlag != "" {
+		if from, err = exportTime(*fromFlag, false); err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+	}
+	if *toFlag != "" {
+		if to, err = exportTime(*toFlag, true); err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+	store := history.New(config.StatePath(config.RuntimeConfig.HistoryFile, history.DefaultFile))
+	events, err := store.Read(from)
+	if err != nil {
+		return err
+	}
+	if events == nil {
+		events = []bus.Event{}
+	}
+	if !to.IsZero() {
+		for i, e := range events {
+			if !e.Epoch.Before(to) {
+				events = events[:i]
+				break
+			}
+		}
+	}
+	var out bytes.Buffer
+	switch *format {
+	case "csv":
+		err = writeCSV(&out, events)
+	case "json":
+		enc := json.NewEncoder(&out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(events)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.WriteString(privacy.Redact(out.String()))
+	return err
+}
+
+func writeCSV(w io.Writer, events []bus.Event) error {
+	out := csv.NewWriter(w)
+	out.Write(exportColumns)
+	for _, e := range events {
+		out.Write([]string{
+			e.Epoch.Format(time.RFC3339Nano), string(e.Kind), e.Name, e.Action, e.Detail,
+			strconv.FormatFloat(e.Value, 'f', -1, 64), e.Direction, e.By, e.Zone,
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/geofence"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/mqtt"
+	"github.com/robolivable/beaves/radar"
+	"github.com/robolivable/beaves/wire"
+)
+
+const (
+	DefaultFeedTopic        = "beaves"
+	DefaultGeofenceMaxAgeMs = 600000
+)
+
+// DialFeed connects to the broker for the presence feed, with a client ID of
+// its own so it doesn't displace the zigbee connection.
+func DialFeed() (*mqtt.Client, error) {
+	c := config.RuntimeConfig.MQTT
+	if c.ClientID == "" {
+		c.ClientID = mqtt.DefaultClientID
+	}
+	c.ClientID += "-feed"
+	return mqtt.Dial(c)
+}
+
+// feedTopic is the topic prefix of a node's messages.
+func feedTopic(node uint16) string {
+	topic := config.RuntimeConfig.Feed.Topic
+	if topic == "" {
+		topic = DefaultFeedTopic
+	}
+	return fmt.Sprintf("%s/%d", topic, node)
+}
+
+// Share publishes an event, and the presence it leaves its actor in, to
+// <topic>/<node>/event and <topic>/<node>/presence.
+func (b *Beaves) Share(event *radar.Event) {
+	if b.Feed == nil {
+		return
+	}
+	node := config.RuntimeConfig.Bluetooth.NodeID
+	topic := feedTopic(node)
+	if err := b.Feed.Publish(topic+"/event", wire.EncodeEvent(node, event)); err != nil {
+		log.Error(err.Error())
+	}
+	if p, ok := b.Presence.Get(event.Actor.ID); ok {
+		if err := b.Feed.Publish(topic+"/presence", wire.EncodePresence(node, p)); err != nil {
+			log.Error(err.Error())
+		}
+	}
+}
+
+// FollowGeofence subscribes to the OwnTracks topics of actors' phones, given
+// by actor ID or name, for both location reports and region transitions.
+// The reports are kept when the feed restarts.
+func (b *Beaves) FollowGeofence(c config.Geofence) error {
+	b.Geofence.CompareAndSwap(nil, geofence.New(c.Region))
+	tracker := b.Geofence.Load()
+	for actor, topic := range c.Topics {
+		actor := actorID(actor)
+		handle := func(topic string, payload []byte) {
+			if err := tracker.Handle(actor, payload, time.Now()); err != nil {
+				log.Error("feed: %s: %v", topic, err)
+			}
+		}
+		for _, t := range []string{topic, topic + "/event"} {
+			if err := b.Feed.Subscribe(t, handle); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// atHome refuses a press for actor of a switch requiring the geofence,
+// unless its phone recently reported being home. Presses not made for an
+// actor aren't bound.
+func (b *Beaves) atHome(z *Zone, actor radar.ID) error {
+	if !z.Switch.RequireGeofence || actor == "" {
+		return nil
+	}
+	maxAge := time.Duration(DefaultGeofenceMaxAgeMs) * time.Millisecond
+	if ms := config.RuntimeConfig.Feed.Geofence.MaxAgeMs; ms > 0 {
+		maxAge = time.Duration(ms) * time.Millisecond
+	}
+	tracker := b.Geofence.Load()
+	if tracker == nil {
+		return fmt.Errorf("%s: no geofence reports, the feed isn't running", radar.FriendlyName(actor))
+	}
+	if err := tracker.Home(string(actor), time.Now(), maxAge); err != nil {
+		return fmt.Errorf("%s: %w", radar.FriendlyName(actor), err)
+	}
+	return nil
+}
+
+// FollowPassage pairs this node with the other sentry of the passage, whose
+// events arrive over the feed. When the other sentry's report completes a
+// passage, the direction is published as a presence event of its own, since
+// this node's event has already gone out untagged.
+func (b *Beaves) FollowPassage(c config.Passage) error {
+	var err error
+	if b.Passage, err = radar.NewPassage(c.Outer, c.Inner, time.Duration(c.WindowMs)*time.Millisecond); err != nil {
+		return err
+	}
+	peer, ok := b.Passage.Peer(config.RuntimeConfig.Bluetooth.NodeID)
+	if !ok {
+		return fmt.Errorf("node %d is neither sentry of the passage", config.RuntimeConfig.Bluetooth.NodeID)
+	}
+	return b.Feed.Subscribe(feedTopic(peer)+"/event", func(topic string, payload []byte) {
+		m, err := wire.Decode(payload)
+		if err != nil {
+			log.Error("feed: %s: %v", topic, err)
+			return
+		}
+		if m.Event == nil || m.Node != peer {
+			return
+		}
+		direction := b.Passage.Observe(peer, m.Event)
+		if direction == "" {
+			return
+		}
+		log.Info("%s is %s (passage)", m.Event.Actor.DisplayName(), direction)
+		// NOTE: the node's own presence event of the transition was published already
+		b.Events.Publish(bus.Event{
+			Kind:   bus.Passage,
+			Name:   m.Event.Actor.DisplayName(),
+			Action: m.Event.Action.String(),
+			Detail: fmt.Sprintf("node %d", peer),
+			Epoch:  m.Event.Epoch,
+
+			Direction: string(direction),
+		})
+	})
+}
@@ -0,0 +1,305 @@
+// Package filter selects bus events with small expressions, such as
+// actor == "alice" && action == "Entering" && hour >= 18, so integrations
+// receive only the events they act on.
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/clock"
+)
+
+type kind int
+
+const (
+	text kind = iota
+	number
+	boolean
+)
+
+func (k kind) String() string {
+	return [...]string{"text", "number", "boolean"}[k]
+}
+
+// node is a parsed expression, evaluated against an event to a string,
+// float64 or bool as its kind says.
+type node struct {
+	kind kind
+	eval func(e bus.Event) any
+}
+
+// fields are the event attributes an expression can refer to. Times are in
+// the configured timezone.
+var fields = map[string]node{
+	"kind":      {text, func(e bus.Event) any { return string(e.Kind) }},
+	"name":      {text, func(e bus.Event) any { return e.Name }},
+	"action":    {text, func(e bus.Event) any { return e.Action }},
+	"detail":    {text, func(e bus.Event) any { return e.Detail }},
+	"direction": {text, func(e bus.Event) any { return e.Direction }},
+	"by":        {text, func(e bus.Event) any { return e.By }},
+	"zone":      {text, func(e bus.Event) any { return e.Zone }},
+	"value":     {number, func(e bus.Event) any { return e.Value }},
+	"hour":      {number, func(e bus.Event) any { return float64(clock.Local(e.Epoch).Hour()) }},
+	"minute":    {number, func(e bus.Event) any { return float64(clock.Local(e.Epoch).Minute()) }},
+	"weekday":   {text, func(e bus.Event) any { return clock.Local(e.Epoch).Weekday().String() }},
+	// the actor of a presence event, or who caused any other
+	"actor": {text, func(e bus.Event) any {
+		if e.Kind == bus.Presence {
+			return e.Name
+		}
+		return e.By
+	}},
+}
+
+// Filter is a parsed expression. The nil Filter, like the empty expression,
+// matches every event.
+type Filter struct {
+	src  string
+	root node
+}
+
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.src
+}
+
+// Match reports whether e satisfies the expression.
+func (f *Filter) Match(e bus.Event) bool {
+	return f == nil || f.root.eval(e).(bool)
+}
+
+// Parse reads an expression of event fields, quoted strings, numbers, true
+// and false, compared with == != < <= > >= and combined with && || ! and
+// parentheses. Strings compare without regard to case.
+func Parse(src string) (*Filter, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	p := &parser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	if root.kind != boolean {
+		return nil, fmt.Errorf("filter %q is %s, not a condition", src, root.kind)
+	}
+	return &Filter{src: src, root: root}, nil
+}
+
+type parser struct {
+	src    string
+	pos    int
+	tok    string // current token; empty at the end
+	quoted bool   // tok is a string literal
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("filter %q at %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+// next moves to the following token.
+func (p *parser) next() error {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	p.tok, p.quoted = "", false
+	if p.pos >= len(p.src) {
+		return nil
+	}
+	start := p.pos
+	switch c := p.src[p.pos]; {
+	case c == '"':
+		end := strings.IndexByte(p.src[p.pos+1:], '"')
+		if end < 0 {
+			return p.errorf("unclosed string")
+		}
+		p.tok, p.quoted = p.src[p.pos+1:p.pos+1+end], true
+		p.pos += end + 2
+		return nil
+	case strings.HasPrefix(p.src[p.pos:], "&&"), strings.HasPrefix(p.src[p.pos:], "||"),
+		strings.HasPrefix(p.src[p.pos:], "=="), strings.HasPrefix(p.src[p.pos:], "!="),
+		strings.HasPrefix(p.src[p.pos:], "<="), strings.HasPrefix(p.src[p.pos:], ">="):
+		p.pos += 2
+	case strings.IndexByte("()!<>", c) >= 0:
+		p.pos++
+	case c == '-' || c == '.' || c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			if c != '-' && c != '.' && c != '_' && !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+				break
+			}
+			p.pos++
+		}
+	default:
+		return p.errorf("unexpected %q", c)
+	}
+	p.tok = p.src[start:p.pos]
+	return nil
+}
+
+func (p *parser) or() (node, error) {
+	return p.logical("||", p.and, func(a, b bool) bool { return a || b })
+}
+
+func (p *parser) and() (node, error) {
+	return p.logical("&&", p.not, func(a, b bool) bool { return a && b })
+}
+
+// logical parses operands joined by op, short-circuiting when the left one
+// decides.
+func (p *parser) logical(op string, operand func() (node, error), join func(a, b bool) bool) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return node{}, err
+	}
+	for p.tok == op && !p.quoted {
+		if err := p.next(); err != nil {
+			return node{}, err
+		}
+		right, err := operand()
+		if err != nil {
+			return node{}, err
+		}
+		if left.kind != boolean || right.kind != boolean {
+			return node{}, p.errorf("%s joins conditions, not %s and %s", op, left.kind, right.kind)
+		}
+		l, r := left.eval, right.eval
+		short := join(true, false) // the left value that decides on its own
+		left = node{boolean, func(e bus.Event) any {
+			if v := l(e).(bool); v == short {
+				return v
+			}
+			return r(e).(bool)
+		}}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (node, error) {
+	if p.tok != "!" || p.quoted {
+		return p.comparison()
+	}
+	if err := p.next(); err != nil {
+		return node{}, err
+	}
+	n, err := p.not()
+	if err != nil {
+		return node{}, err
+	}
+	if n.kind != boolean {
+		return node{}, p.errorf("! negates a condition, not %s", n.kind)
+	}
+	return node{boolean, func(e bus.Event) any { return !n.eval(e).(bool) }}, nil
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.operand()
+	if err != nil {
+		return node{}, err
+	}
+	op := p.tok
+	switch {
+	case p.quoted:
+		return left, nil
+	case op == "==" || op == "!=":
+	case op == "<" || op == "<=" || op == ">" || op == ">=":
+	default:
+		return left, nil
+	}
+	if err := p.next(); err != nil {
+		return node{}, err
+	}
+	right, err := p.operand()
+	if err != nil {
+		return node{}, err
+	}
+	if left.kind != right.kind {
+		return node{}, p.errorf("cannot compare %s with %s", left.kind, right.kind)
+	}
+	if left.kind == boolean && op != "==" && op != "!=" {
+		return node{}, p.errorf("conditions cannot be ordered with %s", op)
+	}
+	l, r := left.eval, right.eval
+	return node{boolean, func(e bus.Event) any {
+		return compare(op, l(e), r(e))
+	}}, nil
+}
+
+func compare(op string, a, b any) bool {
+	var c int
+	switch a := a.(type) {
+	case string:
+		c = strings.Compare(strings.ToLower(a), strings.ToLower(b.(string)))
+	case float64:
+		switch b := b.(float64); {
+		case a < b:
+			c = -1
+		case a > b:
+			c = 1
+		}
+	case bool:
+		if a != b.(bool) {
+			c = 1
+		}
+	}
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func (p *parser) operand() (node, error) {
+	tok, quoted := p.tok, p.quoted
+	switch {
+	case tok == "" && !quoted:
+		return node{}, p.errorf("unexpected end")
+	case quoted:
+		return constant(text, tok), p.next()
+	case tok == "(":
+		if err := p.next(); err != nil {
+			return node{}, err
+		}
+		n, err := p.or()
+		if err != nil {
+			return node{}, err
+		}
+		if p.tok != ")" || p.quoted {
+			return node{}, p.errorf("missing )")
+		}
+		return n, p.next()
+	case tok == "true" || tok == "false":
+		return constant(boolean, tok == "true"), p.next()
+	}
+	if n, err := strconv.ParseFloat(tok, 64); err == nil {
+		return constant(number, n), p.next()
+	}
+	if f, ok := fields[strings.ToLower(tok)]; ok {
+		return f, p.next()
+	}
+	return node{}, p.errorf("unknown field %q", tok)
+}
+
+func constant(k kind, v any) node {
+	return node{k, func(bus.Event) any { return v }}
+}
@@ -0,0 +1,115 @@
+// Package geofence follows OwnTracks reports of whether actors' phones are
+// inside a region, such as home.
+package geofence
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultRegion = "home"
+
+// Report is what an actor's phone last said about the region.
+type Report struct {
+	Inside bool      `json:"inside"`
+	Epoch  time.Time `json:"epoch"`
+}
+
+// message is the part of an OwnTracks location or transition message read.
+type message struct {
+	Type      string   `json:"_type"`
+	Timestamp int64    `json:"tst"`
+	InRegions []string `json:"inregions"` // location: regions the phone is in
+	Event     string   `json:"event"`     // transition: "enter" or "leave"
+	Desc      string   `json:"desc"`      // transition: region
+}
+
+// Tracker keeps the last report of each actor.
+type Tracker struct {
+	region  string
+	reports map[string]Report // by actor, upper cased
+	lock    sync.Mutex
+}
+
+func (t *Tracker) String() string {
+	return fmt.Sprintf("Tracker {region: %s, actors: %d}", t.region, len(t.reports))
+}
+
+// Handle reads an OwnTracks message published by actor's phone. Messages
+// that say nothing about the region are ignored. A report is dated by the
+// phone, but never later than now.
+func (t *Tracker) Handle(actor string, payload []byte, now time.Time) error {
+	m := message{}
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return fmt.Errorf("geofence: invalid message of %s: %w", actor, err)
+	}
+	r := Report{Epoch: now}
+	if m.Timestamp > 0 && time.Unix(m.Timestamp, 0).Before(now) {
+		r.Epoch = time.Unix(m.Timestamp, 0)
+	}
+	switch m.Type {
+	case "location":
+		r.Inside = slices.ContainsFunc(m.InRegions, func(region string) bool { return strings.EqualFold(region, t.region) })
+	case "transition":
+		if !strings.EqualFold(m.Desc, t.region) {
+			return nil
+		}
+		r.Inside = m.Event == "enter"
+	default:
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	actor = strings.ToUpper(actor)
+	if last, ok := t.reports[actor]; ok && last.Epoch.After(r.Epoch) {
+		return nil
+	}
+	t.reports[actor] = r
+	return nil
+}
+
+// Get returns the last report of an actor.
+func (t *Tracker) Get(actor string) (Report, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	r, ok := t.reports[strings.ToUpper(actor)]
+	return r, ok
+}
+
+// Forget drops the last report of an actor.
+func (t *Tracker) Forget(actor string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	_, ok := t.reports[strings.ToUpper(actor)]
+	delete(t.reports, strings.ToUpper(actor))
+	return ok
+}
+
+// Home refuses unless actor's phone reported being inside the region no
+// longer than maxAge before now.
+func (t *Tracker) Home(actor string, now time.Time, maxAge time.Duration) error {
+	if t == nil {
+		return fmt.Errorf("no geofence is followed")
+	}
+	r, ok := t.Get(actor)
+	switch {
+	case !ok:
+		return fmt.Errorf("no geofence report")
+	case !r.Inside:
+		return fmt.Errorf("geofence reports it outside %s", t.region)
+	case now.Sub(r.Epoch) > maxAge:
+		return fmt.Errorf("geofence report is %s old", now.Sub(r.Epoch).Round(time.Second))
+	}
+	return nil
+}
+
+func New(region string) *Tracker {
+	if region == "" {
+		region = DefaultRegion
+	}
+	return &Tracker{region: region, reports: map[string]Report{}}
+}
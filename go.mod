@@ -3,7 +3,9 @@ module github.com/robolivable/beaves
 go 1.24.4
 
 require (
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/kofalt/go-memoize v0.0.0-20240506050413-9e5eb99a0f2a
+	golang.org/x/sys v0.11.0
 	periph.io/x/conn/v3 v3.7.2
 	periph.io/x/host/v3 v3.8.5
 	tinygo.org/x/bluetooth v0.13.0
@@ -11,7 +13,6 @@ require (
 
 require (
 	github.com/go-ole/go-ole v1.2.6 // indirect
-	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/patrickmn/go-cache v2.1.0+incompatible // indirect
 	github.com/saltosystems/winrt-go v0.0.0-20240509164145-4f7860a3bd2b // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
@@ -21,5 +22,4 @@ require (
 	github.com/tinygo-org/pio v0.2.0 // indirect
 	golang.org/x/exp v0.0.0-20241204233417-43b7b7cde48d // indirect
 	golang.org/x/sync v0.10.0 // indirect
-	golang.org/x/sys v0.11.0 // indirect
 )
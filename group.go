@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/log"
+)
+
+var sequencing sync.Map // names of the groups running
+
+func group(name string) (config.Group, bool) {
+	for _, g := range config.RuntimeConfig.Groups {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return config.Group{}, false
+}
+
+// checkGroups validates the groups against the configured switches.
+func (b *Beaves) checkGroups(groups []config.Group) error {
+	names := map[string]bool{}
+	for _, g := range groups {
+		if g.Name == "" || names[g.Name] {
+			return fmt.Errorf("group %q must have a name of its own", g.Name)
+		}
+		names[g.Name] = true
+		if len(g.Steps) == 0 {
+			return fmt.Errorf("group %q has no steps", g.Name)
+		}
+		for i, step := range g.Steps {
+			if step.Pattern != "" {
+				if _, ok := b.Patterns[step.Pattern]; !ok {
+					return fmt.Errorf("step %d of group %q refers to unknown pattern %q", i+1, g.Name, step.Pattern)
+				}
+				continue
+			}
+			if _, ok := b.Switches[step.Switch]; !ok {
+				return fmt.Errorf("step %d of group %q refers to unknown switch %q", i+1, g.Name, step.Switch)
+			}
+			switch strings.ToLower(step.Command) {
+			case "on", "off", "toggle":
+			case "press":
+				if _, ok := b.managing(step.Switch); !ok {
+					return fmt.Errorf("step %d of group %q: switch %q is not managed by a zone and cannot be pressed", i+1, g.Name, step.Switch)
+				}
+			default:
+				return fmt.Errorf("step %d of group %q: unknown command %q", i+1, g.Name, step.Command)
+			}
+		}
+	}
+	return nil
+}
+
+// Sequence runs the steps of a group in order, each after its delay, waiting
+// for presses to complete. It stops at the first failing step, and switches
+// off again what the group switched on, so e.g. an opener isn't left powered.
+func (b *Beaves) Sequence(name string, cause audit.Cause) error {
+	g, ok := group(name)
+	if !ok {
+		return fmt.Errorf("unknown group %q", name)
+	}
+	if _, running := sequencing.LoadOrStore(name, true); running {
+		return fmt.Errorf("group %q is already running", name)
+	}
+	defer sequencing.Delete(name)
+	b.Events.Publish(bus.Event{Kind: bus.Group, Name: name, Action: "Started", Detail: cause.Kind, By: cause.By})
+	powered := []string{}
+	for i, step := range g.Steps {
+		time.Sleep(time.Duration(step.DelayMs) * time.Millisecond)
+		var err error
+		switch {
+		case step.Pattern != "":
+			err = b.Play(step.Pattern, cause)
+		case strings.EqualFold(step.Command, "press"):
+			done := make(chan error, 1)
+			if err = b.press(step.Switch, "", cause, func(err error) { done <- err }); err == nil {
+				err = <-done
+			}
+		default:
+			err = b.Command(step.Switch, step.Command, cause)
+			if s := b.Switches[step.Switch]; err == nil && s.State() == controller.On && !slices.Contains(powered, step.Switch) {
+				powered = append(powered, step.Switch)
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("group %s aborted at step %d: %w", name, i+1, err)
+			b.Events.Publish(bus.Event{Kind: bus.Group, Name: name, Action: "Aborted", Detail: err.Error(), By: cause.By})
+			for _, s := range slices.Backward(powered) {
+				if b.Switches[s].State() != controller.On {
+					continue
+				}
+				if err := b.Set(s, controller.Off, cause); err != nil {
+					log.Error("group %s: failed to switch %s off after aborting: %s", name, s, err.Error())
+				}
+			}
+			return err
+		}
+	}
+	b.Events.Publish(bus.Event{Kind: bus.Group, Name: name, Action: "Completed", Detail: cause.Kind, By: cause.By})
+	return nil
+}
+
+// AutomateGroup runs a group as automation, unless any of its switches is
+// pinned or was recently changed by hand: half a sequence could leave them
+// unsafe, e.g. an opener powered but never triggered.
+func (b *Beaves) AutomateGroup(name string, cause audit.Cause) error {
+	g, ok := group(name)
+	if !ok {
+		return fmt.Errorf("unknown group %q", name)
+	}
+	for _, step := range g.Steps {
+		s := step.Switch
+		if step.Pattern != "" {
+			s = b.Patterns[step.Pattern].Switch
+		}
+		if !b.automatic(s, cause) {
+			return nil
+		}
+	}
+	return b.Sequence(name, cause)
+}
@@ -0,0 +1,132 @@
+// Package history keeps an append-only log of bus events on disk, one JSON
+// object per line.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/log"
+)
+
+const DefaultFile = "history.jsonl"
+
+type Store struct {
+	path string
+	lock sync.Mutex
+}
+
+func (s *Store) String() string {
+	return fmt.Sprintf("History {path: %s}", s.path)
+}
+
+func (s *Store) Append(e bus.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history %s: %w", s.path, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to append history %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Read returns the events recorded at or after since, oldest first. A missing
+// file yields no events.
+func (s *Store) Read(since time.Time) ([]bus.Event, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history %s: %w", s.path, err)
+	}
+	defer f.Close()
+	events := []bus.Event{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e bus.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.DebugMemoize("history: skipping corrupt entry in %s: %v", s.path, err)
+			continue
+		}
+		if !e.Epoch.Before(since) {
+			events = append(events, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history %s: %w", s.path, err)
+	}
+	return events, nil
+}
+
+// Prune rewrites the history without the events keep rejects, and reports how
+// many it removed.
+func (s *Store) Prune(keep func(bus.Event) bool) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read history %s: %w", s.path, err)
+	}
+	var kept bytes.Buffer
+	removed := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		var e bus.Event
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(line, &e); err == nil && !keep(e) {
+			removed++
+			continue
+		}
+		kept.Write(line)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, kept.Bytes(), 0o644); err != nil {
+		return 0, fmt.Errorf("failed to prune history %s: %w", s.path, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return 0, fmt.Errorf("failed to prune history %s: %w", s.path, err)
+	}
+	return removed, nil
+}
+
+// Record appends every event published on b until the subscription ends.
+func (s *Store) Record(b *bus.Bus) {
+	events, _ := b.Subscribe(256)
+	for e := range events {
+		if err := s.Append(e); err != nil {
+			log.Error(err.Error())
+		}
+	}
+}
+
+func New(path string) *Store {
+	if path == "" {
+		path = DefaultFile
+	}
+	return &Store{path: path}
+}
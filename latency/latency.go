@@ -0,0 +1,118 @@
+// Package latency keeps histograms of how long each actor waited at each
+// stage of the pipeline, from the first signal of its device to the event,
+// and from the event to the switch actuating, so tuning can be measured.
+package latency
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Stage string
+
+const (
+	Detection Stage = "detection" // from the first signal to the event
+	Actuation Stage = "actuation" // from the event to the switch actuating
+)
+
+// Bounds are the upper bounds of the histogram buckets; longer latencies
+// fall into a last, unbounded bucket.
+var Bounds = []time.Duration{
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+type Bucket struct {
+	LeMs  int64  `json:"leMs,omitempty"` // upper bound; 0 for the unbounded bucket
+	Count uint64 `json:"count"`
+}
+
+// Histogram counts latencies by bucket, not cumulatively.
+type Histogram struct {
+	Buckets []Bucket `json:"buckets"`
+	Count   uint64   `json:"count"`
+	SumMs   int64    `json:"sumMs"`
+	MaxMs   int64    `json:"maxMs"`
+}
+
+func newHistogram() *Histogram {
+	h := &Histogram{}
+	for _, bound := range Bounds {
+		h.Buckets = append(h.Buckets, Bucket{LeMs: bound.Milliseconds()})
+	}
+	h.Buckets = append(h.Buckets, Bucket{})
+	return h
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(Bounds) && d > Bounds[i] {
+		i++
+	}
+	h.Buckets[i].Count++
+	h.Count++
+	h.SumMs += d.Milliseconds()
+	h.MaxMs = max(h.MaxMs, d.Milliseconds())
+}
+
+// Recorder keeps a histogram per actor and stage, from startup.
+type Recorder struct {
+	histograms map[string]map[Stage]*Histogram // by actor name
+	lock       sync.Mutex
+}
+
+func (r *Recorder) String() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return fmt.Sprintf("Recorder {actors: %d}", len(r.histograms))
+}
+
+// Observe records a latency of actor at a stage. Negative latencies, from a
+// clock jump, are dropped.
+func (r *Recorder) Observe(actor string, stage Stage, d time.Duration) {
+	if r == nil || d < 0 {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	stages, ok := r.histograms[actor]
+	if !ok {
+		stages = map[Stage]*Histogram{}
+		r.histograms[actor] = stages
+	}
+	h, ok := stages[stage]
+	if !ok {
+		h = newHistogram()
+		stages[stage] = h
+	}
+	h.observe(d)
+}
+
+// Snapshot copies the histograms of every actor.
+func (r *Recorder) Snapshot() map[string]map[Stage]Histogram {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	snapshot := map[string]map[Stage]Histogram{}
+	for actor, stages := range r.histograms {
+		snapshot[actor] = map[Stage]Histogram{}
+		for stage, h := range stages {
+			c := *h
+			c.Buckets = append([]Bucket(nil), h.Buckets...)
+			snapshot[actor][stage] = c
+		}
+	}
+	return snapshot
+}
+
+func New() *Recorder {
+	return &Recorder{histograms: map[string]map[Stage]*Histogram{}}
+}
@@ -0,0 +1,49 @@
+package log
+
+import (
+	"slices"
+
+	"github.com/robolivable/beaves/config"
+)
+
+// Category is a part of the system whose debug logging can be turned on on its
+// own with log.categories, falling back to log.debug.
+type Category string
+
+const (
+	Radar      Category = "radar"      // sensors and presence
+	Bluetooth  Category = "bluetooth"  // BLE connections, advertising and pairing
+	Controller Category = "controller" // switches, relays and GPIO inputs
+	Rules      Category = "rules"      // automation deciding what to switch
+	API        Category = "api"
+)
+
+var Categories = []Category{Radar, Bluetooth, Controller, Rules, API}
+
+func (c Category) Known() bool {
+	return slices.Contains(Categories, c)
+}
+
+func (c Category) Enabled() bool {
+	if reduced.Load() {
+		return false
+	}
+	if on, ok := config.RuntimeConfig.Log.Categories[string(c)]; ok {
+		return on
+	}
+	return config.RuntimeConfig.Log.Debug
+}
+
+func (c Category) Debug(msg string, args ...any) {
+	if !c.Enabled() {
+		return
+	}
+	println("debug: "+string(c)+": "+msg, args...)
+}
+
+func (c Category) DebugMemoize(msg string, args ...any) {
+	if !c.Enabled() {
+		return
+	}
+	printMemoize(string(c)+": "+msg, args...)
+}
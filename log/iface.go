@@ -4,14 +4,29 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/privacy"
 )
 
+// DefaultFlushMs is how often suppressed repeats are summarized.
+const DefaultFlushMs = 60000
+
 type memo struct {
 	Exp   int64
-	Count int64
+	Count int64 // repeats suppressed since Since
+	Since int64
+	Msg   string
+}
+
+// reduced turns debug logging off, e.g. in low power mode.
+var reduced atomic.Bool
+
+// Reduce turns debug logging off, or back to what is configured.
+func Reduce(on bool) {
+	reduced.Store(on)
 }
 
 var memoizeLogs = map[string]memo{}
@@ -21,11 +36,11 @@ func println(msg string, args ...any) {
 	if !config.RuntimeConfig.Log.Enabled {
 		return
 	}
-	fmt.Printf(msg+"\n", args...)
+	fmt.Print(privacy.Redact(fmt.Sprintf(msg+"\n", args...)))
 }
 
 func Debug(msg string, args ...any) {
-	if !config.RuntimeConfig.Log.Debug {
+	if !config.RuntimeConfig.Log.Debug || reduced.Load() {
 		return
 	}
 	println("debug: "+msg, args...)
@@ -50,16 +65,44 @@ func printMemoize(msg string, args ...any) {
 		return
 	}
 	count := m.Count
+	now := time.Now()
 	m = memo{
-		Exp:   time.Now().Add(time.Duration(60) * time.Second).UnixMilli(),
+		Exp:   now.Add(time.Duration(60) * time.Second).UnixMilli(),
 		Count: 0,
+		Since: now.UnixMilli(),
+		Msg:   fmt.Sprintf(msg, args...),
 	}
 	memoizeLogs[log] = m
-	println(fmt.Sprintf("[%d, %d]", time.Now().UnixMilli(), count)+" "+msg, args...)
+	println(fmt.Sprintf("[%d, %d]", now.UnixMilli(), count)+" "+msg, args...)
+}
+
+// Flush logs a summary of every message with suppressed repeats and starts
+// counting them afresh. Messages no longer suppressed are forgotten.
+func Flush() {
+	memoizeLock.Lock()
+	defer memoizeLock.Unlock()
+	now := time.Now().UnixMilli()
+	for log, m := range memoizeLogs {
+		if m.Count > 0 {
+			println("info: %q suppressed %d times in the last %v", m.Msg, m.Count, (time.Duration(now-m.Since) * time.Millisecond).Round(time.Second))
+			m.Count, m.Since = 0, now
+			memoizeLogs[log] = m
+		}
+		if m.Exp <= now {
+			delete(memoizeLogs, log)
+		}
+	}
+}
+
+// FlushEvery flushes suppressed repeats at interval, forever.
+func FlushEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		Flush()
+	}
 }
 
 func DebugMemoize(msg string, args ...any) {
-	if !config.RuntimeConfig.Log.Debug {
+	if !config.RuntimeConfig.Log.Debug || reduced.Load() {
 		return
 	}
 	printMemoize(msg, args...)
@@ -1,45 +1,299 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/clock"
 	"github.com/robolivable/beaves/config"
 	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/filter"
+	"github.com/robolivable/beaves/geofence"
+	"github.com/robolivable/beaves/history"
+	"github.com/robolivable/beaves/latency"
 	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/mqtt"
+	"github.com/robolivable/beaves/privacy"
+	"github.com/robolivable/beaves/profile"
 	"github.com/robolivable/beaves/radar"
+	"github.com/robolivable/beaves/rolling"
+	"github.com/robolivable/beaves/supervisor"
+	"github.com/robolivable/beaves/update"
+	"github.com/robolivable/beaves/vacation"
+	"github.com/robolivable/beaves/version"
 )
 
 type Beaves struct {
-	Proximity radar.Proximity // proximity driver
+	Zones     []*Zone               // presence pipelines, the main zone first
+	Adapters  []*radar.BlueZAdapter // of the Bluetooth sentries, the main zone's first
+	Buzzer    *controller.Buzzer    // optional audible feedback
+	Presence  *radar.PresenceTable
+	Seen      *radar.SeenTable // when each actor was last detected, in any zone
+	Switches  map[string]controller.Switch
+	Actuator  *controller.Actuator            // actuator of the main zone's managed switch
+	Queues    map[string]*controller.Actuator // of the switches no zone manages
+	Patterns  map[string]controller.Pattern
+	Monitor   *controller.Monitor
+	Energy    *controller.PulseMeter // optional load consumption
+	Battery   *controller.Battery    // optional supply voltage
+	History   *history.Store
+	Profiles  *profile.Manager
+	Vacation  *vacation.Simulator
+	Overrides *controller.Overrides
+	Arbiters  map[string]*controller.Arbiter // by switch
+	Events    *bus.Bus
+	Audit     *audit.Log
+	Feed      *mqtt.Client                     // optional presence feed
+	Shared    *filter.Filter                   // presence events published on the feed; nil for all
+	Passage   *radar.Passage                   // direction of travel from another node on the feed
+	Geofence  atomic.Pointer[geofence.Tracker] // phones' reports of being home, from the feed
+	Counters  *rolling.Counters                // of rolling code commands; nil unless used
+	Clock     *clock.Clock
+	Latency   *latency.Recorder // how long actors waited, from startup
+	Tree      *supervisor.Tree  // components and how they are doing
 
-	Delay time.Duration // minimum time to wait between operations
-	last  time.Time
+	calendarProfile string // activated by the calendar
+	calendarPrior   string // active before it
+	batteryReported time.Time
 }
 
-func (b *Beaves) Operate(s controller.Switch) error {
-	if time.Now().Before(b.last.Add(b.Delay)) {
-		return nil
+// Record adds an actuation to the audit log, if one is kept.
+func (b *Beaves) Record(cause audit.Cause, e audit.Entry) {
+	if b.Audit == nil {
+		return
 	}
-	log.Debug("pressing button")
-	if err := s.On(time.Duration(1) * time.Second); err != nil {
-		return err
+	if err := b.Audit.Record(cause, e); err != nil {
+		log.Error(err.Error())
 	}
-	if err := s.Off(time.Duration(1) * time.Second); err != nil {
-		return err
+}
+
+// Operate queues a button press on the actuator of a zone, for actor if one
+// caused it. It reports whether the press was queued; the outcome is
+// signalled through the buzzer once it completes, and handed to done if
+// given. For a press caused by an event received at since, the actuation
+// latency of its actor is recorded.
+func (b *Beaves) Operate(z *Zone, action radar.Action, actor radar.ID, since time.Time, cause audit.Cause, done func(error)) (bool, error) {
+	a := z.Actuator
+	active := b.Profiles.Active()
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	if time.Now().Before(z.last.Add(active.OperationDelay(z.Delay))) {
+		return false, nil
+	}
+	on, off := controller.ActionDelays(active.Switch(z.Switch), action.String())
+	log.Rules.Debug("pressing button {on: %v, off: %v}", on, off)
+	steps := []controller.Step{{Delay: on, State: controller.On}, {Delay: off, State: controller.Off}}
+	if action == radar.Entering {
+		steps[0].Check = func() error {
+			if err := z.atDoor(actor); err != nil {
+				return err
+			}
+			return b.atHome(z, actor)
+		}
+	}
+	if !since.IsZero() {
+		steps[0].Applied = func() {
+			b.Latency.Observe(radar.FriendlyName(actor), latency.Actuation, time.Since(since))
+		}
+	}
+	if err := a.Enqueue(steps, func(err error) {
+		e := bus.Event{Kind: bus.Switch, Name: a.Name(), Action: "Pressed", Detail: cause.Kind, By: cause.By}
+		if err != nil {
+			e.Action, e.Detail = "Failed", err.Error()
+		}
+		b.Events.Publish(e)
+		entry := audit.Entry{Switch: a.Name(), Action: e.Action}
+		if err != nil {
+			entry.Detail = err.Error()
+		}
+		b.Record(cause, entry)
+		switch {
+		case err != nil:
+			b.Chirp(controller.ErrorChirp)
+		case action == radar.Entering:
+			b.Chirp(controller.EnteringChirp)
+		default:
+			b.Chirp(controller.ExitingChirp)
+		}
+		if done != nil {
+			done(err)
+		}
+	}); err != nil {
+		return false, err
+	}
+	z.last = time.Now()
+	return true, nil
+}
+
+// Press presses the managed switch of a zone, for actor if one asked.
+func (b *Beaves) Press(name string, actor radar.ID, cause audit.Cause) error {
+	return b.press(name, actor, cause, nil)
+}
+
+// press queues a press of the managed switch of a zone, handing its outcome
+// to done once it completes.
+func (b *Beaves) press(name string, actor radar.ID, cause audit.Cause, done func(error)) error {
+	z, ok := b.managing(name)
+	if !ok {
+		return fmt.Errorf("switch %q is not managed by a zone and cannot be pressed", name)
+	}
+	queued, err := b.Operate(z, radar.Entering, actor, time.Time{}, cause, done)
+	if err == nil && !queued {
+		err = fmt.Errorf("switch %q was pressed too recently", name)
+	}
+	return err
+}
+
+// Command applies a remote command to a switch. Switches are driven through
+// their actuators so commands queue behind automatic presses and each other.
+func (b *Beaves) Command(name string, command string, cause audit.Cause) error {
+	s, ok := b.Switches[name]
+	if !ok {
+		return fmt.Errorf("unknown switch %q", name)
+	}
+	command = strings.ToLower(command)
+	if command == "press" {
+		return b.Press(name, "", cause)
+	}
+	state := controller.Unknown
+	switch command {
+	case "on":
+		state = controller.On
+	case "off":
+		state = controller.Off
+	case "toggle":
+		state = controller.On
+		if s.State() == controller.On {
+			state = controller.Off
+		}
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+	return b.Set(name, state, cause)
+}
+
+// Set drives a switch to state, publishes the outcome and audits it.
+func (b *Beaves) Set(name string, state controller.State, cause audit.Cause) error {
+	s, ok := b.Switches[name]
+	if !ok {
+		return fmt.Errorf("unknown switch %q", name)
+	}
+	a := b.Queues[name]
+	if z, ok := b.managing(name); ok {
+		a = z.Actuator
+	}
+	var err error
+	if a != nil {
+		done := make(chan error, 1)
+		if err = a.Enqueue([]controller.Step{{State: state}}, func(err error) { done <- err }); err == nil {
+			err = <-done
+		}
+	} else if state == controller.On {
+		err = s.On()
+	} else {
+		err = s.Off()
+	}
+	e := bus.Event{Kind: bus.Switch, Name: name, Action: state.String(), Detail: cause.Kind, By: cause.By}
+	if err != nil {
+		e.Action, e.Detail = "Failed", err.Error()
+	}
+	b.Events.Publish(e)
+	entry := audit.Entry{Switch: name, Action: e.Action}
+	if err != nil {
+		entry.Detail = err.Error()
+	}
+	b.Record(cause, entry)
+	return err
+}
+
+func (b *Beaves) Chirp(c controller.Chirp) {
+	if b.Buzzer == nil || b.Profiles.Active().Quiet {
+		return
+	}
+	go func() {
+		if err := b.Buzzer.Chirp(c); err != nil {
+			log.Error(err.Error())
+		}
+	}()
+}
+
+func (b *Beaves) Alert(name string, msg string) {
+	log.Error("alert from switch %s: %s", name, msg)
+	b.Events.Publish(bus.Event{Kind: bus.Alert, Name: name, Detail: msg})
+	b.Record(audit.Cause{Kind: "controller"}, audit.Entry{Switch: name, Action: "Alert", Detail: msg})
+	b.Chirp(controller.ErrorChirp)
+}
+
+func (b *Beaves) Health(h controller.Health) {
+	e := bus.Event{Kind: bus.Health, Name: h.Switch, Action: "Healthy", Epoch: h.Checked}
+	if !h.Healthy {
+		e.Action, e.Detail = "Unhealthy", h.Error
+	}
+	b.Events.Publish(e)
+	if !h.Healthy {
+		b.Alert(h.Switch, fmt.Sprintf("self-test failed: %s", h.Error))
+	}
+}
+
+// Healthy reports the first degraded component or switch failing its
+// self-test, if any.
+func (b *Beaves) Healthy() error {
+	if degraded := b.Tree.Degraded(); len(degraded) > 0 {
+		return fmt.Errorf("%s is degraded: %s", degraded[0].Name, degraded[0].Error)
+	}
+	if b.Monitor == nil {
+		return nil
+	}
+	for _, h := range b.Monitor.Snapshot() {
+		if !h.Healthy {
+			return fmt.Errorf("switch %s is unhealthy: %s", h.Switch, h.Error)
+		}
 	}
-	b.last = time.Now()
 	return nil
 }
 
-func (b *Beaves) Manage(s controller.Switch) error {
-	log.Debug("managing switch on %s", s.String())
-	events, err := b.Proximity.Search()
+// Return leaves a presence simulating profile once someone actually arrives.
+func (b *Beaves) Return() {
+	name := config.RuntimeConfig.Vacation.ReturnProfile
+	if name == "" {
+		name = profile.Default
+	}
+	if err := b.Profiles.Set(name, "arrival"); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// Degrade alerts about the components beaves runs without.
+func (b *Beaves) Degrade() {
+	for _, s := range b.Tree.Degraded() {
+		b.Events.Publish(bus.Event{Kind: bus.Alert, Name: s.Name, Detail: "degraded: " + s.Error})
+		b.Chirp(controller.ErrorChirp)
+	}
+}
+
+// Manage drives the managed switch of a zone from presence. Without an
+// actuator, presence is only recorded, and each arrival or departure raises an
+// alert.
+func (b *Beaves) Manage(z *Zone) error {
+	a := z.Actuator
+	if a != nil {
+		log.Rules.Debug("managing switch of zone %s on %s", z.Name, a.String())
+	}
+	events, err := z.Proximity.Search()
 	if err != nil {
 		return err
 	}
 
-eventloop:
-	for {
+	closed := false
+	for !closed {
 		time.Sleep(time.Duration(config.RuntimeConfig.EventLoopDelayMs) * time.Millisecond)
 		proc := []*radar.Event{}
 
@@ -50,7 +304,9 @@ eventloop:
 				break loaderloop
 			case event, ok := <-events:
 				if !ok {
-					break eventloop
+					// the sentries are done; act on what they sent last
+					closed = true
+					break loaderloop
 				}
 				proc = append(proc, event)
 			}
@@ -60,13 +316,87 @@ eventloop:
 			continue
 		}
 
-		event := proc[len(proc)-1]
-		log.Debug("%s", event.String())
+		received := time.Now()
+		for _, event := range proc {
+			sensed := event.Sensed
+			if sensed.IsZero() {
+				sensed = event.Epoch
+			}
+			b.Latency.Observe(event.Actor.DisplayName(), latency.Detection, received.Sub(sensed))
+			b.Seen.See(event.Actor.ID, event.Epoch)
+			passed := b.Passage.Observe(z.NodeID, event)
+			if passed != "" {
+				event.Direction = passed
+			}
+			z.Presence.Observe(event)
+			e := bus.Event{
+				Kind:   bus.Presence,
+				Name:   event.Actor.DisplayName(),
+				Action: event.Action.String(),
+				Detail: event.Source,
+				Epoch:  event.Epoch,
+
+				Direction: string(event.Direction),
+				Zone:      z.Name,
+			}
+			if b.Shared.Match(e) {
+				b.Share(event)
+			}
+			if event.Action == radar.Entering && b.Profiles.Active().SimulatePresence {
+				b.Return()
+			}
+			b.Events.Publish(e)
+			if passed != "" {
+				b.Events.Publish(bus.Event{Kind: bus.Passage, Name: e.Name, Action: e.Action, Detail: fmt.Sprintf("node %d", z.NodeID), Epoch: e.Epoch, Direction: e.Direction, Zone: z.Name})
+			}
+		}
+
+		if a == nil {
+			b.Events.Publish(bus.Event{Kind: bus.Alert, Name: "controller", Detail: fmt.Sprintf("switches are unavailable; %d presence events unacted on", len(proc)), Zone: z.Name})
+			b.Chirp(controller.ErrorChirp)
+			continue
+		}
+
+		if active := b.Profiles.Active(); active.IgnorePresence {
+			log.Rules.Debug("profile %s ignores presence", active.Name)
+			continue
+		}
+
+		// actors with actions of their own don't drive the managed switch
+		unmapped := []*radar.Event{}
+		for _, event := range proc {
+			if event.PresenceOnly {
+				continue
+			}
+			if !b.Perform(z, event, received) {
+				unmapped = append(unmapped, event)
+			}
+		}
+		if len(unmapped) == 0 {
+			continue
+		}
+
+		event := z.Conflict.Resolve(unmapped, z.Presence.Occupancy())
+		if event == nil {
+			log.Rules.Debug("%s policy leaves %d events unacted on", z.Conflict, len(unmapped))
+			continue
+		}
+		log.Rules.Debug("%s", event.String())
+
+		if p, ok := b.Overrides.Get(a.Name()); ok {
+			log.Rules.Debug("switch %s is pinned %s by %s", a.Name(), p.State, p.Reason)
+			continue
+		}
+		if !b.Arbiters[a.Name()].Automatic() {
+			log.Rules.Debug("switch %s was changed by hand recently", a.Name())
+			continue
+		}
 
 		switch event.Action {
 		case radar.Entering, radar.Exiting:
-			if err := b.Operate(s); err != nil {
+			if _, err := b.Operate(z, event.Action, event.Actor.ID, received, audit.Cause{Kind: "presence", By: event.Actor.DisplayName()}, nil); err != nil {
 				log.Error(err.Error())
+				b.Chirp(controller.ErrorChirp)
 				continue
 			}
 		}
@@ -75,20 +405,119 @@ eventloop:
 	return nil
 }
 
+// managedSwitch names the switch driven by presence.
+func managedSwitch() string {
+	if config.RuntimeConfig.ManagedSwitch != "" {
+		return config.RuntimeConfig.ManagedSwitch
+	}
+	return controller.DefaultSwitch
+}
+
 func main() {
-	nbts, err := radar.NewBTSentry(config.RuntimeConfig.Bluetooth)
-	if err != nil {
+	if len(os.Args) > 1 {
+		if config.Unconfigured && os.Args[1] != "version" {
+			fmt.Fprintf(os.Stderr, "app requires a %s file\n", config.ConfigFile)
+			os.Exit(1)
+		}
+		if err := privacy.Open(config.RuntimeConfig.Privacy); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := Command(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if config.Unconfigured {
+		if err := provision(); err != nil {
+			panic(err)
+		}
+	}
+	log.Info("beaves %s", version.Get())
+	if err := os.MkdirAll(config.StateDirectory(), 0o750); err != nil {
 		panic(err)
 	}
-	nor, err := controller.NewOptoRelaySwitch()
-	if err != nil {
+	migrate(stateFiles())
+	var updater *update.Updater
+	if config.RuntimeConfig.Update.Enabled {
+		binary, err := os.Executable()
+		if err != nil {
+			panic(err)
+		}
+		if updater, err = update.New(config.RuntimeConfig.Update, binary, version.Version, config.StateDirectory()); err != nil {
+			panic(err)
+		}
+		files := map[string]string{}
+		for _, f := range updater.Files() {
+			files[binary+filepath.Ext(f)] = f
+		}
+		migrate(files)
+		updater.Restart = Restart
+		if err := updater.Start(); err != nil {
+			log.Error(err.Error())
+		}
+	}
+	for c := range config.RuntimeConfig.Log.Categories {
+		if !log.Category(c).Known() {
+			panic(fmt.Errorf("unknown log category %q, expected one of %v", c, log.Categories))
+		}
+	}
+	if err := privacy.Open(config.RuntimeConfig.Privacy); err != nil {
 		panic(err)
 	}
 	b := Beaves{
-		Proximity: nbts,
-		Delay:     time.Duration(config.RuntimeConfig.OperationDelayMs) * time.Millisecond,
+		Presence:  radar.NewPresenceTable(),
+		Seen:      radar.NewSeenTable(),
+		Events:    bus.New(),
+		History:   history.New(config.StatePath(config.RuntimeConfig.HistoryFile, history.DefaultFile)),
+		Overrides: controller.NewOverrides(),
+		Clock:     clock.New(config.RuntimeConfig.Clock),
+		Latency:   latency.New(),
+	}
+	tree, err := supervisor.NewTree(config.RuntimeConfig.Supervisor.Policies)
+	if err != nil {
+		panic(err)
 	}
-	if err := b.Manage(nor); err != nil {
+	b.Tree = tree
+	b.Components(tree)
+	if err := tree.Start(); err != nil {
 		panic(err)
 	}
+	b.Degrade()
+	if err := b.Restore(); err != nil {
+		log.Error("failed to restore state: %s", err.Error())
+	}
+	b.Persist()
+	b.DumpOnSignal()
+	FlushLogsOnSignal()
+	if interval := config.RuntimeConfig.Log.FlushMs; interval >= 0 {
+		if interval == 0 {
+			interval = log.DefaultFlushMs
+		}
+		supervisor.Go("log flush", func() { log.FlushEvery(time.Duration(interval) * time.Millisecond) })
+	}
+	if updater != nil {
+		updater.Healthy = b.Healthy
+		supervisor.Go("updater", updater.Run)
+	}
+	// beaves exits once the sentries of every zone are done
+	managed := sync.WaitGroup{}
+	for _, z := range b.Zones {
+		if z.Proximity == nil {
+			log.Error("zone %s has no presence sensors; its switch is controlled by hand only", z.Name)
+			continue
+		}
+		managed.Add(1)
+		go func() {
+			defer managed.Done()
+			if err := b.Manage(z); err != nil {
+				panic(err)
+			}
+		}()
+	}
+	if !slices.ContainsFunc(b.Zones, func(z *Zone) bool { return z.Proximity != nil }) {
+		select {}
+	}
+	managed.Wait()
 }
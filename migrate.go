@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/robolivable/beaves/api"
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/history"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/privacy"
+	"github.com/robolivable/beaves/rolling"
+	"github.com/robolivable/beaves/state"
+)
+
+// stateFiles maps where each file beaves writes was kept before the state
+// directory existed, relative to the working directory, to where it is kept
+// now.
+func stateFiles() map[string]string {
+	c := config.RuntimeConfig
+	files := map[string]string{}
+	for _, f := range [][2]string{
+		{c.StateFile, state.DefaultFile},
+		{c.HistoryFile, history.DefaultFile},
+		{c.AuditFile, audit.DefaultFile},
+		{c.API.TokensFile, api.DefaultTokensFile},
+		{c.API.TLS.Cert, ""},
+		{c.API.TLS.Key, ""},
+		{c.Bluetooth.Commands.CountersFile, rolling.DefaultFile},
+		{c.Privacy.KeyFile, privacy.DefaultKeyFile},
+		{c.Report.File, ""},
+	} {
+		file := f[0]
+		if file == "" {
+			file = f[1]
+		}
+		if file == "" || filepath.IsAbs(file) {
+			continue
+		}
+		files[file] = config.StatePath(file, "")
+	}
+	return files
+}
+
+// migrate moves files kept elsewhere by an earlier version into the state
+// directory on first start, so an upgrade keeps its state, audit log, tokens
+// and keys. A file already in the state directory is left alone.
+func migrate(files map[string]string) {
+	for from, to := range files {
+		if a, err := filepath.Abs(from); err != nil || a == to {
+			continue
+		}
+		if _, err := os.Stat(to); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+		if err := move(from, to); err != nil {
+			log.Error("failed to move %s to the state directory: %s", from, err.Error())
+			continue
+		}
+		log.Info("moved %s to %s", from, to)
+	}
+}
+
+// move renames a file, copying it where the rename can't cross filesystems.
+func move(from string, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0o750); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(to)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(to)
+		return err
+	}
+	return os.Remove(from)
+}
@@ -0,0 +1,358 @@
+// Package mqtt is a minimal MQTT 3.1.1 client: QoS 0 publish and subscribe
+// over plain TCP, with keepalive and reconnection.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+const (
+	DefaultClientID    = "beaves"
+	DefaultKeepAliveMs = 30000
+
+	reconnectDelay = 5 * time.Second
+	dialTimeout    = 10 * time.Second
+)
+
+const (
+	packetConnect    = 0x10
+	packetConnAck    = 0x20
+	packetPublish    = 0x30
+	packetSubscribe  = 0x82
+	packetSubAck     = 0x90
+	packetPingReq    = 0xC0
+	packetPingResp   = 0xD0
+	packetDisconnect = 0xE0
+)
+
+var ErrClosed = errors.New("mqtt: client closed")
+
+type Handler func(topic string, payload []byte)
+
+type Client struct {
+	cfg       config.MQTT
+	keepAlive time.Duration
+
+	mu       sync.Mutex // guards conn, reader, writes and handlers
+	conn     net.Conn
+	reader   *bufio.Reader // of the connection made by Dial, until run takes it
+	handlers map[string]Handler
+	packetID uint16
+
+	closed chan struct{}
+}
+
+func (c *Client) String() string {
+	return fmt.Sprintf("MQTT {broker: %s, clientID: %s}", c.cfg.Broker, c.clientID())
+}
+
+func (c *Client) clientID() string {
+	if c.cfg.ClientID == "" {
+		return DefaultClientID
+	}
+	return c.cfg.ClientID
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func packet(kind byte, body []byte) []byte {
+	p := []byte{kind}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		p = append(p, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(p, body...)
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if i == 4 {
+			return 0, nil, fmt.Errorf("mqtt: malformed remaining length")
+		}
+		n += int(digit&0x7F) * mult
+		mult *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return kind, body, nil
+}
+
+// write sends a packet on the current connection. Callers hold c.mu.
+func (c *Client) write(p []byte) error {
+	if c.conn == nil {
+		return fmt.Errorf("mqtt: not connected to %s", c.cfg.Broker)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive))
+	_, err := c.conn.Write(p)
+	return err
+}
+
+func (c *Client) subscribe(topic string) error {
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID = 1
+	}
+	body := binary.BigEndian.AppendUint16(nil, c.packetID)
+	body = appendString(body, topic)
+	body = append(body, 0) // QoS 0
+	return c.write(packet(packetSubscribe, body))
+}
+
+func (c *Client) connect() (*bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", c.cfg.Broker, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: failed to dial %s: %w", c.cfg.Broker, err)
+	}
+	flags := byte(0x02) // clean session
+	if c.cfg.Username != "" {
+		flags |= 0x80
+	}
+	if c.cfg.Password != "" {
+		flags |= 0x40
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(c.keepAlive/time.Second))
+	body = appendString(body, c.clientID())
+	if c.cfg.Username != "" {
+		body = appendString(body, c.cfg.Username)
+	}
+	if c.cfg.Password != "" {
+		body = appendString(body, c.cfg.Password)
+	}
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	if _, err := conn.Write(packet(packetConnect, body)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: failed to connect to %s: %w", c.cfg.Broker, err)
+	}
+	r := bufio.NewReader(conn)
+	kind, ack, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: no acknowledgement from %s: %w", c.cfg.Broker, err)
+	}
+	if kind != packetConnAck || len(ack) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: unexpected packet %#x from %s", kind, c.cfg.Broker)
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: %s refused connection with code %d", c.cfg.Broker, ack[1])
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn = conn
+	for topic := range c.handlers {
+		if err := c.subscribe(topic); err != nil {
+			conn.Close()
+			c.conn = nil
+			return nil, fmt.Errorf("mqtt: failed to resubscribe to %s: %w", topic, err)
+		}
+	}
+	return r, nil
+}
+
+func (c *Client) receive(conn net.Conn, r *bufio.Reader) error {
+	for {
+		conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		kind, body, err := readPacket(r)
+		if err != nil {
+			return err
+		}
+		if kind&0xF0 != packetPublish {
+			continue
+		}
+		if len(body) < 2 {
+			return fmt.Errorf("mqtt: malformed publish")
+		}
+		n := int(binary.BigEndian.Uint16(body))
+		if len(body) < 2+n {
+			return fmt.Errorf("mqtt: malformed publish")
+		}
+		topic := string(body[2 : 2+n])
+		payload := body[2+n:]
+		if kind&0x06 != 0 && len(payload) >= 2 {
+			payload = payload[2:] // packet identifier for QoS > 0
+		}
+		c.mu.Lock()
+		h := c.handlers[topic]
+		c.mu.Unlock()
+		if h != nil {
+			h(topic, payload)
+		}
+	}
+}
+
+func (c *Client) ping() {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			if c.conn != nil {
+				if err := c.write([]byte{packetPingReq, 0}); err != nil {
+					log.Error("MQTT.ping: %v", err)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// reconnect dials the broker again until it answers, returning nil once the
+// client is closed.
+func (c *Client) reconnect() *bufio.Reader {
+	for {
+		select {
+		case <-c.closed:
+			return nil
+		case <-time.After(reconnectDelay):
+		}
+		r, err := c.connect()
+		if err == nil {
+			log.Info("MQTT: reconnected to %s", c.cfg.Broker)
+			return r
+		}
+		log.Error("MQTT: %v", err)
+	}
+}
+
+// run receives on the connection made by Dial, and on a new one whenever it
+// is lost. Started over after a panic, it reconnects rather than read from a
+// connection that may be gone.
+func (c *Client) run() {
+	c.mu.Lock()
+	r, conn := c.reader, c.conn
+	c.reader = nil
+	if r == nil && conn != nil {
+		conn.Close()
+		c.conn = nil
+	}
+	c.mu.Unlock()
+	for {
+		if r == nil {
+			if r = c.reconnect(); r == nil {
+				return
+			}
+			c.mu.Lock()
+			conn = c.conn
+			c.mu.Unlock()
+		}
+		err := c.receive(conn, r)
+		r = nil
+		c.mu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.mu.Unlock()
+		conn.Close()
+		select {
+		case <-c.closed:
+			return
+		default:
+		}
+		log.Error("MQTT: lost connection to %s: %v", c.cfg.Broker, err)
+	}
+}
+
+// Publish sends payload to topic at QoS 0.
+func (c *Client) Publish(topic string, payload []byte) error {
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.write(packet(packetPublish, body)); err != nil {
+		return fmt.Errorf("mqtt: failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Subscribe routes messages on topic to h. Subscriptions survive reconnects.
+// Wildcard topics are not supported.
+func (c *Client) Subscribe(topic string, h Handler) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[topic] = h
+	if err := c.subscribe(topic); err != nil {
+		return fmt.Errorf("mqtt: failed to subscribe to %s: %w", topic, err)
+	}
+	return nil
+}
+
+func (c *Client) Close() error {
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+	close(c.closed)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	c.write([]byte{packetDisconnect, 0})
+	return c.conn.Close()
+}
+
+func Dial(cfg config.MQTT) (*Client, error) {
+	keepAlive := cfg.KeepAliveMs
+	if keepAlive == 0 {
+		keepAlive = DefaultKeepAliveMs
+	}
+	c := &Client{
+		cfg:       cfg,
+		keepAlive: time.Duration(keepAlive) * time.Millisecond,
+		handlers:  map[string]Handler{},
+		closed:    make(chan struct{}),
+	}
+	r, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	c.reader = r
+	supervisor.Go("mqtt receiver", c.run)
+	supervisor.Go("mqtt keepalive", c.ping)
+	return c, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/log"
+)
+
+func overrideDuration() time.Duration {
+	return time.Duration(config.RuntimeConfig.Override.DurationMs) * time.Millisecond
+}
+
+// Override pins a switch to state, keeping automation off it for duration, or
+// until cleared when duration is zero.
+func (b *Beaves) Override(name string, state controller.State, duration time.Duration, cause audit.Cause) error {
+	if state != controller.On && state != controller.Off {
+		return fmt.Errorf("cannot pin switch %q %s", name, state)
+	}
+	if err := b.Set(name, state, cause); err != nil {
+		return err
+	}
+	p := controller.Pin{Switch: name, State: state.String(), Reason: cause.Kind, Since: time.Now()}
+	if duration > 0 {
+		until := p.Since.Add(duration)
+		p.Until = &until
+	}
+	b.Overrides.Pin(p)
+	log.Info("switch %s pinned %s by %s", name, p.State, cause)
+	b.Events.Publish(bus.Event{Kind: bus.Override, Name: name, Action: "Pinned", Detail: fmt.Sprintf("%s by %s", p.State, cause.Kind)})
+	b.Record(cause, audit.Entry{Switch: name, Action: "Pinned", Detail: fmt.Sprintf("%s for %v", p.State, duration)})
+	return nil
+}
+
+func (b *Beaves) ClearOverride(name string, cause audit.Cause) error {
+	if _, ok := b.Overrides.Clear(name); !ok {
+		return fmt.Errorf("switch %q is not overridden", name)
+	}
+	log.Info("switch %s released by %s", name, cause)
+	b.Events.Publish(bus.Event{Kind: bus.Override, Name: name, Action: "Cleared", Detail: cause.Kind})
+	b.Record(cause, audit.Entry{Switch: name, Action: "Cleared"})
+	return nil
+}
+
+func (b *Beaves) expired(p controller.Pin) {
+	log.Info("switch %s override expired", p.Switch)
+	b.Events.Publish(bus.Event{Kind: bus.Override, Name: p.Switch, Action: "Expired", Detail: p.State})
+	b.Record(audit.Cause{Kind: "expiry"}, audit.Entry{Switch: p.Switch, Action: "Expired", Detail: p.State})
+}
+
+// automatic reports whether automation may change a switch: it may not while
+// the switch is pinned or was recently changed by hand.
+func (b *Beaves) automatic(name string, cause audit.Cause) bool {
+	if p, ok := b.Overrides.Get(name); ok {
+		log.Rules.Debug("switch %s is pinned %s, ignoring %s", name, p.State, cause)
+		return false
+	}
+	if !b.Arbiters[name].Automatic() {
+		log.Rules.Debug("switch %s was changed by hand recently, ignoring %s", name, cause)
+		return false
+	}
+	return true
+}
+
+// Automate applies a change made by automation, leaving alone switches that
+// are pinned or were recently changed by hand.
+func (b *Beaves) Automate(name string, state controller.State, cause audit.Cause) error {
+	if !b.automatic(name, cause) {
+		return nil
+	}
+	return b.Set(name, state, cause)
+}
+
+// ToggleOverride pins the managed switch opposite to its current state, or
+// releases it if it is already pinned.
+func (b *Beaves) ToggleOverride() {
+	name := b.Actuator.Name()
+	var err error
+	if _, ok := b.Overrides.Get(name); ok {
+		err = b.ClearOverride(name, audit.Cause{Kind: "button"})
+	} else {
+		state := controller.On
+		if b.Actuator.State() == controller.On {
+			state = controller.Off
+		}
+		err = b.Override(name, state, overrideDuration(), audit.Cause{Kind: "button"})
+	}
+	if err != nil {
+		log.Error(err.Error())
+		b.Chirp(controller.ErrorChirp)
+	}
+}
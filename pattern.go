@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/log"
+)
+
+var playing sync.Map // switches playing a pattern
+
+// loadPatterns checks the configured patterns against the switches and
+// expands them.
+func (b *Beaves) loadPatterns(patterns []config.Pattern) error {
+	b.Patterns = map[string]controller.Pattern{}
+	for _, c := range patterns {
+		if _, ok := b.Patterns[c.Name]; ok || c.Name == "" {
+			return fmt.Errorf("pattern %q must have a name of its own", c.Name)
+		}
+		if _, ok := b.Switches[c.Switch]; !ok {
+			return fmt.Errorf("pattern %q refers to unknown switch %q", c.Name, c.Switch)
+		}
+		p, err := controller.NewPattern(c)
+		if err != nil {
+			return err
+		}
+		b.Patterns[c.Name] = p
+	}
+	for alert, name := range config.RuntimeConfig.BlinkCodes {
+		if _, ok := b.Patterns[name]; !ok {
+			return fmt.Errorf("blink code for %q refers to unknown pattern %q", alert, name)
+		}
+	}
+	return nil
+}
+
+// Play drives a switch through a pattern and waits for it to finish. The
+// managed switch of a zone plays it through its actuator, after the presses
+// queued before it.
+func (b *Beaves) Play(name string, cause audit.Cause) error {
+	p, ok := b.Patterns[name]
+	if !ok {
+		return fmt.Errorf("unknown pattern %q", name)
+	}
+	var err error
+	if z, ok := b.managing(p.Switch); ok {
+		done := make(chan error, 1)
+		if err = z.Actuator.Enqueue(p.Steps, func(err error) { done <- err }); err == nil {
+			err = <-done
+		}
+	} else if _, busy := playing.LoadOrStore(p.Switch, true); busy {
+		err = fmt.Errorf("switch %q is already playing a pattern", p.Switch)
+	} else {
+		err = controller.Play(b.Switches[p.Switch], p.Steps)
+		playing.Delete(p.Switch)
+	}
+	e := bus.Event{Kind: bus.Switch, Name: p.Switch, Action: "Played", Detail: name, By: cause.By}
+	if err != nil {
+		e.Action, e.Detail = "Failed", err.Error()
+	}
+	b.Events.Publish(e)
+	b.Record(cause, audit.Entry{Switch: p.Switch, Action: e.Action, Detail: e.Detail})
+	return err
+}
+
+// AutomatePlay plays a pattern as automation, unless its switch is pinned or
+// was recently changed by hand.
+func (b *Beaves) AutomatePlay(name string, cause audit.Cause) error {
+	p, ok := b.Patterns[name]
+	if !ok {
+		return fmt.Errorf("unknown pattern %q", name)
+	}
+	if !b.automatic(p.Switch, cause) {
+		return nil
+	}
+	return b.Play(name, cause)
+}
+
+// BlinkCodes plays the configured pattern of every alert it is given, e.g. an
+// LED blinking three times while the radar is degraded.
+func (b *Beaves) BlinkCodes(events <-chan bus.Event) {
+	for e := range events {
+		name, ok := config.RuntimeConfig.BlinkCodes[e.Name]
+		if e.Kind != bus.Alert || !ok {
+			continue
+		}
+		if err := b.Play(name, audit.Cause{Kind: "blink code", By: e.Name}); err != nil {
+			log.Error(err.Error())
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/radar"
+	"github.com/robolivable/beaves/state"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+func stateFile() string {
+	return config.StatePath(config.RuntimeConfig.StateFile, state.DefaultFile)
+}
+
+// LastSeen lists when each actor was last detected, taking the latest of
+// the seen table and the presence entries of every zone. It changes neither.
+func (b *Beaves) LastSeen() []radar.Seen {
+	seen := b.Seen.Snapshot()
+	for _, z := range b.Zones {
+		for _, p := range z.Presence.Snapshot() {
+			i := slices.IndexFunc(seen, func(s radar.Seen) bool { return strings.EqualFold(string(s.Actor), string(p.Actor)) })
+			switch {
+			case i < 0 && !p.LastSeen.IsZero():
+				seen = append(seen, radar.Seen{Actor: p.Actor, Name: radar.FriendlyName(p.Actor), LastSeen: p.LastSeen})
+			case i >= 0 && p.LastSeen.After(seen[i].LastSeen):
+				seen[i].LastSeen = p.LastSeen
+			}
+		}
+	}
+	sort.Slice(seen, func(i, j int) bool { return seen[i].Actor < seen[j].Actor })
+	return seen
+}
+
+func (b *Beaves) Snapshot() *state.Snapshot {
+	snapshot := &state.Snapshot{
+		Epoch:    time.Now(),
+		Zones:    map[string][]radar.Presence{},
+		Timers:   []state.Timer{},
+		Cycles:   map[string]uint64{},
+		Profile:  b.Profiles.Active().Name,
+		Pins:     b.Overrides.Snapshot(),
+		Seen:     b.LastSeen(),
+	}
+	for _, z := range b.Zones {
+		snapshot.Zones[z.Name] = z.Presence.Snapshot()
+	}
+	if b.Energy != nil {
+		snapshot.Energy, snapshot.Pulses = b.Energy.Counted()
+	}
+	for name, s := range b.Switches {
+		if c, ok := controller.Find[*controller.Counter](s); ok {
+			snapshot.Cycles[name] = c.Cycles()
+		}
+		m, ok := s.(*controller.MaxOn)
+		if !ok {
+			continue
+		}
+		if deadline, ok := m.Deadline(); ok {
+			snapshot.Timers = append(snapshot.Timers, state.Timer{Switch: name, Deadline: deadline})
+		}
+	}
+	return snapshot
+}
+
+func (b *Beaves) Restore() error {
+	snapshot, err := state.Load(stateFile())
+	if err != nil {
+		return err
+	}
+	b.Seen.Restore(snapshot.Seen)
+	for _, z := range b.Zones {
+		presence, ok := snapshot.Zones[z.Name]
+		if !ok && z.Name == MainZone {
+			// NOTE: state from before presence was kept by zone
+			presence = snapshot.Presence
+		}
+		z.Presence.Restore(presence)
+		for _, p := range presence {
+			// NOTE: state from before last seen times were kept
+			if !p.LastSeen.IsZero() {
+				b.Seen.See(p.Actor, p.LastSeen)
+			}
+		}
+	}
+	if snapshot.Profile != "" {
+		if err := b.Profiles.Set(snapshot.Profile, "restored"); err != nil {
+			log.Error("failed to restore profile: %s", err.Error())
+		}
+	}
+	if b.Energy != nil {
+		b.Energy.Restore(snapshot.Energy, snapshot.Pulses)
+	}
+	for name, cycles := range snapshot.Cycles {
+		if c, ok := controller.Find[*controller.Counter](b.Switches[name]); ok {
+			c.Restore(cycles)
+		}
+	}
+	trusted := b.Clock.Trusted()
+	for _, p := range snapshot.Pins {
+		if p.Until != nil && p.Until.Before(time.Now()) && trusted {
+			continue
+		}
+		// with an untrusted clock, pins don't expire until it is
+		p.Restored = !trusted
+		state := controller.Off
+		if p.State == controller.On.String() {
+			state = controller.On
+		}
+		log.Info("restoring override of %s %s", p.Switch, p.State)
+		if err := b.Set(p.Switch, state, audit.Cause{Kind: "restore", By: p.Reason}); err != nil {
+			log.Error("failed to restore override: %s", err.Error())
+			continue
+		}
+		b.Overrides.Pin(p)
+	}
+	if !trusted {
+		go func() {
+			<-b.Clock.Ready()
+			b.Overrides.Rearm()
+		}()
+	}
+	for _, t := range snapshot.Timers {
+		if m, ok := b.Switches[t.Switch].(*controller.MaxOn); ok {
+			log.Info("restoring auto-off of %s at %v", t.Switch, t.Deadline)
+			m.Restore(t.Deadline)
+		}
+	}
+	return nil
+}
+
+// Persist periodically saves runtime state so it can be restored on startup.
+func (b *Beaves) Persist() {
+	interval := config.RuntimeConfig.StatePersistMs
+	if interval <= 0 {
+		interval = state.DefaultPersistMs
+	}
+	supervisor.Go("state persistence", func() {
+		for {
+			time.Sleep(time.Duration(interval) * time.Millisecond)
+			if err := state.Save(stateFile(), b.Snapshot()); err != nil {
+				log.Error(err.Error())
+			}
+		}
+	})
+}
@@ -0,0 +1,150 @@
+// Package power puts the sentry in low power mode, as solar powered gate
+// controllers need at night: sensors poll less often, advertising pauses
+// longer and debug logging stops. Low power mode is on while any of its
+// reasons is, such as the configured hours.
+package power
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robolivable/beaves/clock"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultPollFactor         = 4
+	DefaultAdvertisingPauseMs = 30000
+
+	Hours   = "hours"   // reason: within the configured hours
+	Battery = "battery" // reason: the battery runs low
+
+	checkInterval = time.Minute
+)
+
+var (
+	low     atomic.Bool
+	reasons = map[string]bool{}
+	lock    sync.Mutex
+)
+
+// Low reports whether low power mode is on.
+func Low() bool {
+	return low.Load()
+}
+
+// Reasons lists why low power mode is on, sorted.
+func Reasons() []string {
+	lock.Lock()
+	defer lock.Unlock()
+	list := []string{}
+	for reason := range reasons {
+		list = append(list, reason)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// Set turns one reason for low power mode on or off, logging when the mode
+// changes.
+func Set(reason string, on bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	if reasons[reason] == on {
+		return
+	}
+	if on {
+		reasons[reason] = true
+	} else {
+		delete(reasons, reason)
+	}
+	now := len(reasons) > 0
+	if low.Swap(now) == now {
+		return
+	}
+	log.Reduce(now && !config.RuntimeConfig.LowPower.Debug)
+	if now {
+		log.Info("power: low power mode on (%s)", reason)
+	} else {
+		log.Info("power: low power mode off (%s)", reason)
+	}
+}
+
+// Poll stretches a sensor's poll interval in low power mode.
+func Poll(interval time.Duration) time.Duration {
+	if !Low() {
+		return interval
+	}
+	factor := config.RuntimeConfig.LowPower.PollFactor
+	if factor <= 0 {
+		factor = DefaultPollFactor
+	}
+	return time.Duration(float64(interval) * factor)
+}
+
+// AdvertisingPause lengthens a pause between advertisements in low power
+// mode. Negative pauses, which never end, are kept.
+func AdvertisingPause(pause time.Duration) time.Duration {
+	if !Low() || pause < 0 {
+		return pause
+	}
+	ms := config.RuntimeConfig.LowPower.AdvertisingPauseMs
+	if ms <= 0 {
+		ms = DefaultAdvertisingPauseMs
+	}
+	return max(pause, time.Duration(ms)*time.Millisecond)
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Schedule keeps low power mode on within the configured hours, in the
+// configured timezone, checking every minute. Hours that span midnight (e.g.
+// 22:00-06:00) are supported. Until the clock is trusted the hours are
+// ignored, so a Pi booting in 1970 stays responsive.
+type Schedule struct {
+	Clock *clock.Clock
+
+	start time.Duration
+	end   time.Duration
+}
+
+func (s *Schedule) String() string {
+	return fmt.Sprintf("Schedule {start: %v, end: %v}", s.start, s.end)
+}
+
+// within reports whether t falls within the hours.
+func (s *Schedule) within(t time.Time) bool {
+	offset := clock.TimeOfDay(clock.Local(t))
+	if s.start <= s.end {
+		return offset >= s.start && offset < s.end
+	}
+	return offset >= s.start || offset < s.end
+}
+
+func (s *Schedule) Run() {
+	for ; ; time.Sleep(checkInterval) {
+		Set(Hours, s.Clock.Trusted() && s.within(time.Now()))
+	}
+}
+
+func NewSchedule(c config.LowPower) (*Schedule, error) {
+	start, err := parseClock(c.Hours.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid low power start %q: %w", c.Hours.Start, err)
+	}
+	end, err := parseClock(c.Hours.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid low power end %q: %w", c.Hours.End, err)
+	}
+	return &Schedule{start: start, end: end}, nil
+}
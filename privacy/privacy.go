@@ -0,0 +1,95 @@
+// Package privacy pseudonymizes device addresses in text meant to be shared,
+// such as logs and exports, with an HMAC under a key kept on the device.
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/robolivable/beaves/config"
+)
+
+const (
+	DefaultKeyFile = "privacy.key"
+
+	keySize = 32
+)
+
+// address matches MAC addresses however they are separated, including in
+// BlueZ object paths (dev_AA_BB_CC_DD_EE_FF).
+var address = regexp.MustCompile(`[0-9A-Fa-f]{2}(?:[:_-][0-9A-Fa-f]{2}){5}`)
+
+var (
+	key  []byte // nil while pseudonymizing is off
+	lock sync.RWMutex
+)
+
+// Open turns pseudonymizing on when configured, reading the key, or creating
+// it on first start.
+func Open(c config.Privacy) error {
+	if !c.Pseudonymize {
+		return nil
+	}
+	path := config.StatePath(c.KeyFile, DefaultKeyFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		data = make([]byte, keySize)
+		if _, err := rand.Read(data); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(data)+"\n"), 0o600); err != nil {
+			return fmt.Errorf("failed to create privacy key %s: %w", path, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to read privacy key %s: %w", path, err)
+	} else if data, err = hex.DecodeString(strings.TrimSpace(string(data))); err != nil || len(data) < keySize {
+		return fmt.Errorf("privacy key %s must be %d hex encoded bytes", path, keySize)
+	}
+	lock.Lock()
+	key = data
+	lock.Unlock()
+	return nil
+}
+
+// normalize writes an address the way the configuration does.
+func normalize(s string) string {
+	return strings.ToUpper(strings.NewReplacer("_", ":", "-", ":").Replace(s))
+}
+
+// Pseudonym is a stable stand-in for an address, the same for as long as the
+// key is kept.
+func Pseudonym(addr string) string {
+	lock.RLock()
+	defer lock.RUnlock()
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(normalize(addr)))
+	return "device-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// Redact replaces the addresses in s with the friendly names of the actors
+// they belong to, or with pseudonyms. It leaves s as it is while
+// pseudonymizing is off.
+func Redact(s string) string {
+	lock.RLock()
+	off := key == nil
+	lock.RUnlock()
+	if off {
+		return s
+	}
+	return address.ReplaceAllStringFunc(s, func(addr string) string {
+		for id, name := range config.RuntimeConfig.Actors.Names {
+			if normalize(id) == normalize(addr) {
+				return name
+			}
+		}
+		return Pseudonym(addr)
+	})
+}
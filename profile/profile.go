@@ -0,0 +1,147 @@
+// Package profile switches between named sets of behavior overrides, e.g.
+// home, away, night or vacation.
+package profile
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robolivable/beaves/clock"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/cron"
+	"github.com/robolivable/beaves/log"
+)
+
+const Default = "home"
+
+type Active struct {
+	Name   string    `json:"name"`
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason"` // what switched to it, e.g. "api" or "schedule"
+
+	config.Profile `json:"profile"`
+}
+
+// Switch applies the profile's delay overrides to a switch's configuration.
+func (a *Active) Switch(c config.Switch) config.Switch {
+	if a.Delays != nil {
+		c.Delays = *a.Delays
+	}
+	if a.ActionDelays != nil {
+		c.ActionDelays = a.ActionDelays
+	}
+	return c
+}
+
+// OperationDelay resolves the minimum time between operations.
+func (a *Active) OperationDelay(fallback time.Duration) time.Duration {
+	if a.OperationDelayMs != nil {
+		return time.Duration(*a.OperationDelayMs) * time.Millisecond
+	}
+	return fallback
+}
+
+type Manager struct {
+	profiles map[string]config.Profile
+	active   atomic.Pointer[Active]
+	lock     sync.Mutex // serializes changes
+
+	OnChange func(from *Active, to *Active)
+	Clock    *clock.Clock // schedules wait until it is trusted
+}
+
+func (m *Manager) String() string {
+	return fmt.Sprintf("Profiles {active: %s, names: %v}", m.Active().Name, m.Names())
+}
+
+// Active returns the current profile. It is replaced, never mutated, so the
+// result is consistent even while a change is in flight.
+func (m *Manager) Active() *Active {
+	return m.active.Load()
+}
+
+func (m *Manager) Names() []string {
+	names := []string{}
+	for name := range m.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *Manager) Set(name string, reason string) error {
+	p, ok := m.profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	from := m.Active()
+	if from.Name == name {
+		return nil
+	}
+	to := &Active{Name: name, Since: time.Now(), Reason: reason, Profile: p}
+	m.active.Store(to)
+	log.Info("profile changed from %s to %s (%s)", from.Name, to.Name, reason)
+	if m.OnChange != nil {
+		m.OnChange(from, to)
+	}
+	return nil
+}
+
+// when parses the schedule of a change, given as a time of day or a cron
+// expression.
+func when(c config.ProfileChange) (*cron.Schedule, error) {
+	if c.Cron != "" {
+		return cron.Parse(c.Cron)
+	}
+	s, err := cron.Daily(c.At)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile schedule time %q: %w", c.At, err)
+	}
+	return s, nil
+}
+
+// Schedule switches profiles at times of day or on cron schedules, once the
+// clock is trusted.
+func (m *Manager) Schedule(changes []config.ProfileChange) error {
+	schedules := []*cron.Schedule{}
+	for _, c := range changes {
+		s, err := when(c)
+		if err != nil {
+			return err
+		}
+		if _, ok := m.profiles[c.Profile]; !ok {
+			return fmt.Errorf("profile schedule refers to unknown profile %q", c.Profile)
+		}
+		schedules = append(schedules, s)
+	}
+	for i, s := range schedules {
+		name := changes[i].Profile
+		go s.Run(m.Clock.Ready(), func() {
+			if err := m.Set(name, "schedule"); err != nil {
+				log.Error(err.Error())
+			}
+		})
+	}
+	return nil
+}
+
+func New(profiles map[string]config.Profile, initial string) (*Manager, error) {
+	m := &Manager{profiles: map[string]config.Profile{Default: {}}}
+	for name, p := range profiles {
+		m.profiles[name] = p
+	}
+	if initial == "" {
+		initial = Default
+	}
+	p, ok := m.profiles[initial]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", initial)
+	}
+	m.active.Store(&Active{Name: initial, Since: time.Now(), Reason: "config", Profile: p})
+	return m, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/radar"
+)
+
+const provisionName = "Beaves Setup"
+
+// Provisioning is what a phone sends a device without configuration.
+type Provisioning struct {
+	WiFi   *WiFi           `json:"wifi"`   // network to join, if any
+	Config json.RawMessage `json:"config"` // written as config.json
+}
+
+type WiFi struct {
+	SSID       string `json:"ssid"`
+	Passphrase string `json:"passphrase"`
+}
+
+// decodeConfig checks a provisioned config the way startup would read it,
+// refusing fields beaves doesn't know so typos don't go unnoticed.
+func decodeConfig(data []byte) (config.Config, error) {
+	c := config.Config{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return c, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return c, fmt.Errorf("invalid config: %w", err)
+	}
+	return c, nil
+}
+
+// joinWiFi connects through NetworkManager, which keeps the connection for
+// later boots. The passphrase is answered on stdin so it never shows in the
+// process list.
+func joinWiFi(w WiFi) error {
+	cmd := exec.Command("nmcli", "--ask", "device", "wifi", "connect", w.SSID)
+	cmd.Stdin = strings.NewReader(w.Passphrase + "\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to join %q: %w: %s", w.SSID, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// writeConfig replaces the config file atomically; it may hold secrets. The
+// file it replaces is kept as config.json.prev.
+func writeConfig(data []byte) error {
+	tmp := config.ConfigFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if previous, err := os.ReadFile(config.ConfigFile); err == nil {
+		if err := os.WriteFile(config.ConfigFile+".prev", previous, 0o600); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to keep previous config: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, config.ConfigFile); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// redactCode keeps only the last group of a setup code, enough to tell codes
+// apart in the persistent log without giving one away.
+func redactCode(code string) string {
+	groups := strings.Split(code, "-")
+	for i := range groups[:len(groups)-1] {
+		groups[i] = strings.Repeat("*", len(groups[i]))
+	}
+	return strings.Join(groups, "-")
+}
+
+// provision waits for a phone to send the first config over Bluetooth, then
+// restarts beaves with it.
+func provision() error {
+	p, err := radar.NewProvisioner()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("no %s; waiting to be provisioned over Bluetooth as %q with setup code %s\n", config.ConfigFile, provisionName, p.Code())
+	log.Info("waiting to be provisioned as %q, setup code %s", provisionName, redactCode(p.Code()))
+	err = p.Run(provisionName, func(message []byte) error {
+		provisioning := Provisioning{}
+		if err := json.Unmarshal(message, &provisioning); err != nil {
+			return fmt.Errorf("invalid provisioning: %w", err)
+		}
+		if _, err := decodeConfig(provisioning.Config); err != nil {
+			return err
+		}
+		if provisioning.WiFi != nil {
+			if err := joinWiFi(*provisioning.WiFi); err != nil {
+				return err
+			}
+		}
+		return writeConfig(provisioning.Config)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to provision: %w", err)
+	}
+	log.Info("provisioned %s", config.ConfigFile)
+	return Restart()
+}
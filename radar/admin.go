@@ -0,0 +1,21 @@
+package radar
+
+const (
+	AdminServiceID = "6b1e0011-5a3c-4f0e-9d2b-be4e5e500001"
+	AdminWriteID   = "6b1e0012-5a3c-4f0e-9d2b-be4e5e500001" // sealed config changes from the admin device
+	AdminStatusID  = "6b1e0013-5a3c-4f0e-9d2b-be4e5e500001" // outcome of the last change
+	AdminNonceID   = "6b1e0014-5a3c-4f0e-9d2b-be4e5e500001" // nonce the next change must carry
+)
+
+var adminLabel = []byte("beaves-admin-2")
+
+// ServeAdmin adds the service through which an admin device sharing key
+// pushes config changes, each handed to accept once it opens.
+func (bts *BTSentry) ServeAdmin(key []byte, accept func([]byte) error) (*SealedService, error) {
+	sealed, err := NewSealed(key, adminLabel, DefaultSealedMaxLength)
+	if err != nil {
+		return nil, err
+	}
+	ids := [4]string{AdminServiceID, AdminWriteID, AdminStatusID, AdminNonceID}
+	return ServeSealed(bts.bluez, "admin", ids, sealed, accept)
+}
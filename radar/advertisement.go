@@ -0,0 +1,284 @@
+package radar
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/robolivable/beaves/supervisor"
+	"tinygo.org/x/bluetooth"
+)
+
+const (
+	bluezAdvertisingManager = "org.bluez.LEAdvertisingManager1"
+	bluezAdvertisement      = "org.bluez.LEAdvertisement1"
+	bluezDevice             = "org.bluez.Device1"
+
+	advertisementNS = "/org/robolivable/beaves/advertisement"
+)
+
+var advertisementID uint64
+
+// AdvertisementOptions extends the bluetooth package's options with the
+// properties BlueZ supports but the package does not expose.
+type AdvertisementOptions struct {
+	bluetooth.AdvertisementOptions
+
+	TxPower     *int16 // requested TX power in dBm; nil leaves it to the controller
+	Connectable bool   // advertise as a peripheral, for clients of a GATT service
+}
+
+// Advertisement is an org.bluez.LEAdvertisement1 object exported by Beaves
+// itself, so every property BlueZ understands can be set.
+type Advertisement struct {
+	adapter *BlueZAdapter
+	path    dbus.ObjectPath
+	props   *prop.Properties
+
+	lock         sync.Mutex
+	started      bool
+	discoverable *bool // of the adapter before the advertisement started
+}
+
+// Release is called by BlueZ when it drops the advertisement on its own,
+// e.g. when the adapter goes away.
+func (ad *Advertisement) Release() *dbus.Error {
+	ad.adapter.Trace.Add(ad.path, "advertisement released", "")
+	ad.lock.Lock()
+	defer ad.lock.Unlock()
+	ad.started = false
+	ad.restore()
+	return nil
+}
+
+// restore puts the adapter's Discoverable back how Start found it.
+func (ad *Advertisement) restore() {
+	if ad.discoverable == nil {
+		return
+	}
+	if err := ad.adapter.SetProperty("Discoverable", *ad.discoverable); err != nil {
+		ad.adapter.Trace.Error(ad.adapter.obj.Path(), "set Discoverable", err)
+	}
+	ad.discoverable = nil
+}
+
+func (ad *Advertisement) Configure(options AdvertisementOptions) error {
+	ad.lock.Lock()
+	defer ad.lock.Unlock()
+	if ad.started {
+		return fmt.Errorf("advertisement %s is already started", ad.path)
+	}
+	serviceUUIDs := []string{}
+	for _, uuid := range options.ServiceUUIDs {
+		serviceUUIDs = append(serviceUUIDs, uuid.String())
+	}
+	serviceData := map[string]any{}
+	for _, element := range options.ServiceData {
+		serviceData[element.UUID.String()] = element.Data
+	}
+	manufacturerData := map[uint16]any{}
+	for _, element := range options.ManufacturerData {
+		manufacturerData[element.CompanyID] = element.Data
+	}
+	kind := "broadcast"
+	if options.Connectable || options.AdvertisementType == bluetooth.AdvertisingTypeInd {
+		kind = "peripheral"
+	}
+	spec := map[string]*prop.Prop{
+		"Type":             {Value: kind},
+		"ServiceUUIDs":     {Value: serviceUUIDs},
+		"ManufacturerData": {Value: manufacturerData},
+		"LocalName":        {Value: options.LocalName},
+		"ServiceData":      {Value: serviceData, Writable: true},
+		"Timeout":          {Value: uint16(0)},
+	}
+	if options.Interval > 0 {
+		interval := uint32(time.Duration(options.Interval) * 625 * time.Microsecond / time.Millisecond)
+		spec["MinInterval"] = &prop.Prop{Value: interval}
+		spec["MaxInterval"] = &prop.Prop{Value: interval}
+	}
+	if options.TxPower != nil {
+		spec["TxPower"] = &prop.Prop{Value: *options.TxPower}
+		spec["Includes"] = &prop.Prop{Value: []string{"tx-power"}}
+	}
+	id := atomic.AddUint64(&advertisementID, 1)
+	ad.path = dbus.ObjectPath(fmt.Sprintf("%s%d", advertisementNS, id))
+	props, err := prop.Export(ad.adapter.bus, ad.path, map[string]map[string]*prop.Prop{bluezAdvertisement: spec})
+	if err != nil {
+		return fmt.Errorf("failed to export advertisement: %w", err)
+	}
+	if err := ad.adapter.bus.Export(ad, ad.path, bluezAdvertisement); err != nil {
+		return fmt.Errorf("failed to export advertisement: %w", err)
+	}
+	ad.props = props
+	return nil
+}
+
+func (ad *Advertisement) Start() error {
+	call := ad.adapter.obj.Call(bluezAdvertisingManager+".RegisterAdvertisement", 0, ad.path, map[string]any{})
+	if call.Err != nil {
+		ad.adapter.Trace.Error(ad.path, "RegisterAdvertisement", call.Err)
+		return fmt.Errorf("failed to start advertisement: %w", call.Err)
+	}
+	ad.adapter.Trace.Add(ad.path, "advertisement registered", "")
+	ad.lock.Lock()
+	defer ad.lock.Unlock()
+	if v, err := ad.adapter.Property("Discoverable"); err == nil {
+		if discoverable, ok := v.Value().(bool); ok {
+			ad.discoverable = &discoverable
+		}
+	}
+	if err := ad.adapter.SetProperty("Discoverable", true); err != nil {
+		ad.adapter.Trace.Error(ad.adapter.obj.Path(), "set Discoverable", err)
+		return err
+	}
+	ad.started = true
+	return nil
+}
+
+func (ad *Advertisement) Stop() error {
+	call := ad.adapter.obj.Call(bluezAdvertisingManager+".UnregisterAdvertisement", 0, ad.path)
+	if call.Err != nil {
+		ad.adapter.Trace.Error(ad.path, "UnregisterAdvertisement", call.Err)
+		return fmt.Errorf("failed to stop advertisement: %w", call.Err)
+	}
+	ad.adapter.Trace.Add(ad.path, "advertisement unregistered", "")
+	ad.lock.Lock()
+	ad.restore()
+	ad.lock.Unlock()
+	ad.Reset()
+	return nil
+}
+
+// Reset forgets a started advertisement without telling BlueZ, for when the
+// adapter it was registered with no longer exists.
+func (ad *Advertisement) Reset() {
+	ad.lock.Lock()
+	ad.started = false
+	ad.discoverable = nil
+	ad.lock.Unlock()
+	ad.adapter.bus.Export(nil, ad.path, bluezAdvertisement)
+	ad.adapter.bus.Export(nil, ad.path, "org.freedesktop.DBus.Properties")
+}
+
+func (a *BlueZAdapter) NewAdvertisement() *Advertisement {
+	return &Advertisement{adapter: a}
+}
+
+// Device is a remote device known to the adapter.
+type Device struct {
+	Address string
+	obj     dbus.BusObject
+	trace   *BTTrace
+}
+
+func (d Device) Disconnect() error {
+	if err := d.obj.Call(bluezDevice+".Disconnect", 0).Err; err != nil {
+		d.trace.Error(d.obj.Path(), "Disconnect", err)
+		return fmt.Errorf("failed to disconnect %s: %w", d.Address, err)
+	}
+	d.trace.Add(d.obj.Path(), "disconnected by beaves", "")
+	return nil
+}
+
+// RSSI reads the signal strength BlueZ last heard from the device, 0 when
+// no running discovery has heard it.
+func (d Device) RSSI() int16 {
+	v, err := d.obj.GetProperty(bluezDevice + ".RSSI")
+	if err != nil {
+		return 0
+	}
+	rssi, _ := v.Value().(int16)
+	return rssi
+}
+
+func (a *BlueZAdapter) device(path dbus.ObjectPath, props map[string]dbus.Variant) (Device, bool) {
+	if !strings.HasPrefix(string(path), bluezAdapterNS+a.id+"/") {
+		return Device{}, false
+	}
+	obj := a.bus.Object(bluezService, path)
+	if props == nil {
+		if err := obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, bluezDevice).Store(&props); err != nil {
+			a.Trace.Error(path, "GetAll", err)
+			return Device{}, false
+		}
+	}
+	address, ok := props["Address"].Value().(string)
+	if !ok {
+		a.Trace.Add(path, "device without address", "")
+		return Device{}, false
+	}
+	return Device{Address: address, obj: obj, trace: a.Trace}, true
+}
+
+// WatchConnections calls handler whenever a device connects to or
+// disconnects from the adapter.
+func (a *BlueZAdapter) WatchConnections(handler func(Device, bool)) error {
+	if err := a.bus.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+		dbus.WithMatchArg(0, bluezDevice),
+	); err != nil {
+		return fmt.Errorf("failed to watch connections: %w", err)
+	}
+	if err := a.bus.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.DBus.ObjectManager"),
+		dbus.WithMatchMember("InterfacesAdded"),
+	); err != nil {
+		return fmt.Errorf("failed to watch connections: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 16)
+	a.bus.Signal(signals)
+	handle := func(d Device, connected bool) {
+		defer supervisor.Recover("connection handler")
+		handler(d, connected)
+	}
+	go func() {
+		for sig := range signals {
+			switch sig.Name {
+			case "org.freedesktop.DBus.ObjectManager.InterfacesAdded":
+				if len(sig.Body) < 2 {
+					continue
+				}
+				path, _ := sig.Body[0].(dbus.ObjectPath)
+				interfaces, _ := sig.Body[1].(map[string]map[string]dbus.Variant)
+				props, ok := interfaces[bluezDevice]
+				if !ok || !a.owns(path) {
+					continue
+				}
+				a.Trace.Add(path, "device added", properties(props))
+				connected, ok := props["Connected"].Value().(bool)
+				if !ok {
+					continue
+				}
+				if d, ok := a.device(path, props); ok {
+					handle(d, connected)
+				}
+			case "org.freedesktop.DBus.Properties.PropertiesChanged":
+				if len(sig.Body) < 2 || !a.owns(sig.Path) {
+					continue
+				}
+				if iface, _ := sig.Body[0].(string); iface != bluezDevice {
+					continue
+				}
+				changes, _ := sig.Body[1].(map[string]dbus.Variant)
+				if _, rssi := changes["RSSI"]; !rssi || len(changes) > 1 {
+					// NOTE: signal strength alone would flood the trace while discovering
+					a.Trace.Add(sig.Path, "properties changed", properties(changes))
+				}
+				connected, ok := changes["Connected"].Value().(bool)
+				if !ok {
+					continue
+				}
+				if d, ok := a.device(sig.Path, nil); ok {
+					handle(d, connected)
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,221 @@
+package radar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	bluezAgent        = "org.bluez.Agent1"
+	bluezAgentManager = "org.bluez.AgentManager1"
+
+	agentPath = dbus.ObjectPath("/org/robolivable/beaves/agent")
+
+	DefaultPairingTimeoutMs = 30000
+)
+
+type Capability string
+
+const (
+	DisplayYesNo    Capability = "DisplayYesNo"
+	NoInputNoOutput Capability = "NoInputNoOutput"
+)
+
+var errRejected = dbus.NewError("org.bluez.Error.Rejected", nil)
+
+// PairingRequest is a bonding request waiting on a decision.
+type PairingRequest struct {
+	Address string    `json:"address"`
+	Passkey *uint32   `json:"passkey,omitempty"` // numeric comparison value, if any
+	Epoch   time.Time `json:"epoch"`
+
+	decision chan bool
+}
+
+// Agent is an org.bluez.Agent1 that completes bonding headlessly. With
+// NoInputNoOutput BlueZ pairs without asking; with DisplayYesNo every request
+// waits for Resolve, e.g. from the API, until the timeout rejects it.
+type Agent struct {
+	adapter    *BlueZAdapter
+	capability Capability
+	timeout    time.Duration
+	comparison bool // reject pairing that cannot be verified by numeric comparison
+
+	// OnRequest, if set, is called when a request starts waiting on a decision.
+	OnRequest func(PairingRequest)
+
+	pending map[string]*PairingRequest
+	lock    sync.Mutex
+}
+
+func (ag *Agent) String() string {
+	return fmt.Sprintf("Agent {capability: %s, timeout: %v}", ag.capability, ag.timeout)
+}
+
+func (ag *Agent) address(device dbus.ObjectPath) string {
+	v, err := ag.adapter.bus.Object(bluezService, device).GetProperty(bluezDevice + ".Address")
+	if err != nil {
+		return string(device)
+	}
+	address, _ := v.Value().(string)
+	return address
+}
+
+func (ag *Agent) await(device dbus.ObjectPath, passkey *uint32) *dbus.Error {
+	request := &PairingRequest{
+		Address:  ag.address(device),
+		Passkey:  passkey,
+		Epoch:    time.Now(),
+		decision: make(chan bool, 1),
+	}
+	key := strings.ToUpper(request.Address)
+	ag.lock.Lock()
+	ag.pending[key] = request
+	ag.lock.Unlock()
+	defer func() {
+		ag.lock.Lock()
+		delete(ag.pending, key)
+		ag.lock.Unlock()
+	}()
+	log.Info("pairing request from %s awaiting confirmation", request.Address)
+	if ag.OnRequest != nil {
+		ag.OnRequest(*request)
+	}
+	select {
+	case accept := <-request.decision:
+		if accept {
+			log.Info("pairing with %s confirmed", request.Address)
+			return nil
+		}
+	case <-time.After(ag.timeout):
+		log.Info("pairing request from %s timed out", request.Address)
+	}
+	return errRejected
+}
+
+// Pending lists the requests waiting on a decision, oldest first.
+func (ag *Agent) Pending() []PairingRequest {
+	ag.lock.Lock()
+	defer ag.lock.Unlock()
+	pending := make([]PairingRequest, 0, len(ag.pending))
+	for _, r := range ag.pending {
+		pending = append(pending, *r)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Epoch.Before(pending[j].Epoch) })
+	return pending
+}
+
+// Resolve accepts or rejects the pending request from address.
+func (ag *Agent) Resolve(address string, accept bool) error {
+	ag.lock.Lock()
+	defer ag.lock.Unlock()
+	request, ok := ag.pending[strings.ToUpper(address)]
+	if !ok {
+		return fmt.Errorf("no pairing request pending for %s", address)
+	}
+	select {
+	case request.decision <- accept:
+	default:
+	}
+	return nil
+}
+
+func (ag *Agent) Release() *dbus.Error {
+	log.Bluetooth.Debug("pairing agent released")
+	return nil
+}
+
+func (ag *Agent) RequestPinCode(device dbus.ObjectPath) (string, *dbus.Error) {
+	return "", errRejected
+}
+
+func (ag *Agent) DisplayPinCode(device dbus.ObjectPath, pincode string) *dbus.Error {
+	return nil
+}
+
+func (ag *Agent) RequestPasskey(device dbus.ObjectPath) (uint32, *dbus.Error) {
+	return 0, errRejected
+}
+
+func (ag *Agent) DisplayPasskey(device dbus.ObjectPath, passkey uint32, entered uint16) *dbus.Error {
+	return nil
+}
+
+func (ag *Agent) RequestConfirmation(device dbus.ObjectPath, passkey uint32) *dbus.Error {
+	if ag.capability == NoInputNoOutput {
+		return nil
+	}
+	return ag.await(device, &passkey)
+}
+
+func (ag *Agent) RequestAuthorization(device dbus.ObjectPath) *dbus.Error {
+	if ag.comparison {
+		log.Info("rejecting pairing from %s without numeric comparison", ag.address(device))
+		return errRejected
+	}
+	if ag.capability == NoInputNoOutput {
+		return nil
+	}
+	return ag.await(device, nil)
+}
+
+func (ag *Agent) AuthorizeService(device dbus.ObjectPath, uuid string) *dbus.Error {
+	return nil
+}
+
+func (ag *Agent) Cancel() *dbus.Error {
+	log.Bluetooth.Debug("pairing request canceled by remote")
+	return nil
+}
+
+// Register exports the agent and makes it BlueZ's default agent.
+func (ag *Agent) Register() error {
+	if err := ag.adapter.bus.Export(ag, agentPath, bluezAgent); err != nil {
+		return fmt.Errorf("failed to export pairing agent: %w", err)
+	}
+	manager := ag.adapter.bus.Object(bluezService, "/org/bluez")
+	if err := manager.Call(bluezAgentManager+".RegisterAgent", 0, agentPath, string(ag.capability)).Err; err != nil {
+		return fmt.Errorf("failed to register pairing agent: %w", err)
+	}
+	if err := manager.Call(bluezAgentManager+".RequestDefaultAgent", 0, agentPath).Err; err != nil {
+		return fmt.Errorf("failed to make pairing agent the default: %w", err)
+	}
+	return nil
+}
+
+func (ag *Agent) Unregister() error {
+	manager := ag.adapter.bus.Object(bluezService, "/org/bluez")
+	if err := manager.Call(bluezAgentManager+".UnregisterAgent", 0, agentPath).Err; err != nil {
+		return fmt.Errorf("failed to unregister pairing agent: %w", err)
+	}
+	return nil
+}
+
+func NewAgent(adapter *BlueZAdapter, capability Capability, timeout time.Duration, comparison bool) (*Agent, error) {
+	switch capability {
+	case "":
+		capability = NoInputNoOutput
+	case DisplayYesNo, NoInputNoOutput:
+	default:
+		return nil, fmt.Errorf("unsupported pairing capability %q", capability)
+	}
+	if comparison && capability != DisplayYesNo {
+		return nil, fmt.Errorf("numeric comparison requires the %s capability", DisplayYesNo)
+	}
+	if timeout <= 0 {
+		timeout = time.Duration(DefaultPairingTimeoutMs) * time.Millisecond
+	}
+	return &Agent{
+		adapter:    adapter,
+		capability: capability,
+		timeout:    timeout,
+		comparison: comparison,
+		pending:    map[string]*PairingRequest{},
+	}, nil
+}
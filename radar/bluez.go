@@ -0,0 +1,460 @@
+package radar
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const DefaultAdapterID = "hci0"
+
+const (
+	bluezService   = "org.bluez"
+	bluezAdapter   = "org.bluez.Adapter1"
+	bluezAdapterNS = "/org/bluez/"
+)
+
+// BlueZAdapter exposes the adapter properties the bluetooth package keeps
+// to itself, straight over D-Bus.
+type BlueZAdapter struct {
+	id  string
+	bus *dbus.Conn
+	obj dbus.BusObject
+
+	Trace *BTTrace // low level detail of connections and advertising, when kept
+}
+
+func (a *BlueZAdapter) String() string {
+	return fmt.Sprintf("BlueZAdapter {id: %s}", a.id)
+}
+
+func (a *BlueZAdapter) Property(name string) (dbus.Variant, error) {
+	v, err := a.obj.GetProperty(bluezAdapter + "." + name)
+	if err != nil {
+		return dbus.Variant{}, fmt.Errorf("failed to read %s of %s: %w", name, a.id, err)
+	}
+	return v, nil
+}
+
+func (a *BlueZAdapter) SetProperty(name string, value any) error {
+	if err := a.obj.SetProperty(bluezAdapter+"."+name, dbus.MakeVariant(value)); err != nil {
+		return fmt.Errorf("failed to set %s of %s: %w", name, a.id, err)
+	}
+	return nil
+}
+
+// owns reports whether a D-Bus object, e.g. a device, belongs to the adapter.
+func (a *BlueZAdapter) owns(path dbus.ObjectPath) bool {
+	return strings.HasPrefix(string(path), bluezAdapterNS+a.id+"/")
+}
+
+// ID names the adapter, e.g. "hci0".
+func (a *BlueZAdapter) ID() string {
+	return a.id
+}
+
+// Present reports whether the adapter is currently known to BlueZ.
+func (a *BlueZAdapter) Present() bool {
+	_, err := a.Property("Address")
+	return err == nil
+}
+
+// WatchAdapter reports the adapter appearing (true) and disappearing (false),
+// e.g. when a USB dongle is replugged.
+func (a *BlueZAdapter) WatchAdapter() (chan bool, error) {
+	for _, member := range []string{"InterfacesAdded", "InterfacesRemoved"} {
+		if err := a.bus.AddMatchSignal(
+			dbus.WithMatchInterface("org.freedesktop.DBus.ObjectManager"),
+			dbus.WithMatchMember(member),
+		); err != nil {
+			return nil, fmt.Errorf("failed to watch %s: %w", a.id, err)
+		}
+	}
+	signals := make(chan *dbus.Signal, 16)
+	a.bus.Signal(signals)
+	events := make(chan bool, 1)
+	path := dbus.ObjectPath(bluezAdapterNS + a.id)
+	go func() {
+		for sig := range signals {
+			if len(sig.Body) < 2 {
+				continue
+			}
+			if p, _ := sig.Body[0].(dbus.ObjectPath); p != path {
+				continue
+			}
+			switch sig.Name {
+			case "org.freedesktop.DBus.ObjectManager.InterfacesAdded":
+				if interfaces, _ := sig.Body[1].(map[string]map[string]dbus.Variant); interfaces[bluezAdapter] != nil {
+					a.Trace.Add(path, "adapter added", "")
+					events <- true
+				}
+			case "org.freedesktop.DBus.ObjectManager.InterfacesRemoved":
+				if interfaces, _ := sig.Body[1].([]string); slices.Contains(interfaces, bluezAdapter) {
+					a.Trace.Add(path, "adapter removed", "")
+					events <- false
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// StartDiscovery scans for LE devices. With duplicates every advertisement is
+// reported, so their signal strength keeps updating; without, a device is
+// reported once until discovery restarts.
+func (a *BlueZAdapter) StartDiscovery(duplicates bool) error {
+	filter := map[string]dbus.Variant{
+		"Transport":     dbus.MakeVariant("le"),
+		"DuplicateData": dbus.MakeVariant(duplicates),
+	}
+	if err := a.obj.Call(bluezAdapter+".SetDiscoveryFilter", 0, filter).Err; err != nil {
+		a.Trace.Error(a.obj.Path(), "SetDiscoveryFilter", err)
+		return fmt.Errorf("failed to filter discovery on %s: %w", a.id, err)
+	}
+	if err := a.obj.Call(bluezAdapter+".StartDiscovery", 0).Err; err != nil {
+		var derr dbus.Error
+		if errors.As(err, &derr) && derr.Name == "org.bluez.Error.InProgress" {
+			// NOTE: another sentry on the adapter started it over this connection
+			return nil
+		}
+		a.Trace.Error(a.obj.Path(), "StartDiscovery", err)
+		return fmt.Errorf("failed to start discovery on %s: %w", a.id, err)
+	}
+	a.Trace.Add(a.obj.Path(), "discovery started", "")
+	return nil
+}
+
+// StopDiscovery stops a discovery started by StartDiscovery.
+func (a *BlueZAdapter) StopDiscovery() error {
+	if err := a.obj.Call(bluezAdapter+".StopDiscovery", 0).Err; err != nil {
+		var derr dbus.Error
+		if errors.As(err, &derr) && derr.Name == "org.bluez.Error.Failed" {
+			// NOTE: not discovering
+			return nil
+		}
+		a.Trace.Error(a.obj.Path(), "StopDiscovery", err)
+		return fmt.Errorf("failed to stop discovery on %s: %w", a.id, err)
+	}
+	a.Trace.Add(a.obj.Path(), "discovery stopped", "")
+	return nil
+}
+
+// WatchRSSI calls handler with the signal strength of devices seen while
+// discovering.
+func (a *BlueZAdapter) WatchRSSI(handler func(address string, rssi int16)) error {
+	if err := a.bus.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+		dbus.WithMatchArg(0, bluezDevice),
+	); err != nil {
+		return fmt.Errorf("failed to watch signal strength: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 64)
+	a.bus.Signal(signals)
+	go func() {
+		for sig := range signals {
+			if sig.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" || len(sig.Body) < 2 {
+				continue
+			}
+			if iface, _ := sig.Body[0].(string); iface != bluezDevice {
+				continue
+			}
+			changes, _ := sig.Body[1].(map[string]dbus.Variant)
+			rssi, ok := changes["RSSI"].Value().(int16)
+			if !ok {
+				continue
+			}
+			// NOTE: the path carries the address; advertisements come too
+			// fast to look it up every time
+			prefix := bluezAdapterNS + a.id + "/dev_"
+			if address, ok := strings.CutPrefix(string(sig.Path), prefix); ok {
+				handler(strings.ReplaceAll(address, "_", ":"), rssi)
+			}
+		}
+	}()
+	return nil
+}
+
+// Sighting is what a device advertises, as BlueZ last reported it.
+type Sighting struct {
+	Address          string
+	Name             string
+	RSSI             int16
+	UUIDs            []string          // lower case, 128 bit
+	ManufacturerData map[uint16][]byte // by company identifier
+	ServiceData      map[string][]byte // by lower case, 128 bit UUID
+}
+
+func newSighting(props map[string]dbus.Variant) Sighting {
+	s := Sighting{ManufacturerData: map[uint16][]byte{}, ServiceData: map[string][]byte{}}
+	s.Address, _ = props["Address"].Value().(string)
+	s.Name, _ = props["Name"].Value().(string)
+	s.RSSI, _ = props["RSSI"].Value().(int16)
+	uuids, _ := props["UUIDs"].Value().([]string)
+	for _, u := range uuids {
+		s.UUIDs = append(s.UUIDs, strings.ToLower(u))
+	}
+	data, _ := props["ManufacturerData"].Value().(map[uint16]dbus.Variant)
+	for company, v := range data {
+		s.ManufacturerData[company], _ = v.Value().([]byte)
+	}
+	services, _ := props["ServiceData"].Value().(map[string]dbus.Variant)
+	for uuid, v := range services {
+		s.ServiceData[strings.ToLower(uuid)], _ = v.Value().([]byte)
+	}
+	return s
+}
+
+const (
+	sightingsIdle = 5 * time.Minute // devices unheard this long are forgotten
+	maxSightings  = 1024
+)
+
+// WatchSightings calls handler every time BlueZ reports an advertisement of a
+// device on the adapter while discovering, with everything the device has
+// advertised. Nothing is ever connected to.
+func (a *BlueZAdapter) WatchSightings(handler func(Sighting)) error {
+	rules := [][]dbus.MatchOption{
+		{dbus.WithMatchInterface("org.freedesktop.DBus.Properties"), dbus.WithMatchMember("PropertiesChanged"), dbus.WithMatchArg(0, bluezDevice)},
+		{dbus.WithMatchInterface("org.freedesktop.DBus.ObjectManager"), dbus.WithMatchMember("InterfacesRemoved")},
+	}
+	for _, rule := range rules {
+		if err := a.bus.AddMatchSignal(rule...); err != nil {
+			return fmt.Errorf("failed to watch advertisements: %w", err)
+		}
+	}
+	signals := make(chan *dbus.Signal, 64)
+	a.bus.Signal(signals)
+	go func() {
+		devices := map[dbus.ObjectPath]map[string]dbus.Variant{}
+		heard := map[dbus.ObjectPath]time.Time{}
+		swept := time.Now()
+		for sig := range signals {
+			if now := time.Now(); now.Sub(swept) > sightingsIdle || len(devices) > maxSightings {
+				// NOTE: passers-by rotating their addresses would otherwise pile up
+				for path, at := range heard {
+					if now.Sub(at) > sightingsIdle || len(devices) > maxSightings {
+						delete(devices, path)
+						delete(heard, path)
+					}
+				}
+				swept = now
+			}
+			switch sig.Name {
+			case "org.freedesktop.DBus.ObjectManager.InterfacesRemoved":
+				if len(sig.Body) > 0 {
+					path, _ := sig.Body[0].(dbus.ObjectPath)
+					delete(devices, path)
+					delete(heard, path)
+				}
+			case "org.freedesktop.DBus.Properties.PropertiesChanged":
+				if len(sig.Body) < 2 || !a.owns(sig.Path) {
+					continue
+				}
+				if iface, _ := sig.Body[0].(string); iface != bluezDevice {
+					continue
+				}
+				changes, _ := sig.Body[1].(map[string]dbus.Variant)
+				props, ok := devices[sig.Path]
+				if !ok {
+					// NOTE: only looked up the first time; later advertisements
+					// carry what changed
+					props = map[string]dbus.Variant{}
+					device := a.bus.Object(bluezService, sig.Path)
+					if err := device.Call("org.freedesktop.DBus.Properties.GetAll", 0, bluezDevice).Store(&props); err != nil {
+						a.Trace.Error(sig.Path, "GetAll", err)
+						continue
+					}
+					devices[sig.Path] = props
+				}
+				maps.Copy(props, changes)
+				heard[sig.Path] = time.Now()
+				handler(newSighting(props))
+			}
+		}
+	}()
+	return nil
+}
+
+// DeviceInfo is what BlueZ remembers about a remote device.
+type DeviceInfo struct {
+	Path      string
+	Address   string
+	Name      string
+	Paired    bool
+	Bonded    bool
+	Trusted   bool
+	Connected bool
+	RSSI      int16 // 0 unless a running discovery has heard the device
+}
+
+// Devices lists the remote devices BlueZ knows on the adapter.
+func (a *BlueZAdapter) Devices() ([]DeviceInfo, error) {
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{}
+	root := a.bus.Object(bluezService, "/")
+	if err := root.Call("org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0).Store(&objects); err != nil {
+		return nil, fmt.Errorf("failed to list devices of %s: %w", a.id, err)
+	}
+	devices := []DeviceInfo{}
+	for path, interfaces := range objects {
+		props, ok := interfaces[bluezDevice]
+		if !ok || !a.owns(path) {
+			continue
+		}
+		flag := func(name string) bool { b, _ := props[name].Value().(bool); return b }
+		d := DeviceInfo{
+			Path:      string(path),
+			Paired:    flag("Paired"),
+			Bonded:    flag("Bonded"),
+			Trusted:   flag("Trusted"),
+			Connected: flag("Connected"),
+		}
+		d.Address, _ = props["Address"].Value().(string)
+		d.Name, _ = props["Alias"].Value().(string)
+		d.RSSI, _ = props["RSSI"].Value().(int16)
+		devices = append(devices, d)
+	}
+	slices.SortFunc(devices, func(x, y DeviceInfo) int { return strings.Compare(x.Address, y.Address) })
+	return devices, nil
+}
+
+// Advertisements reports how many advertisements are registered with the
+// adapter, and how many it supports at once.
+func (a *BlueZAdapter) Advertisements() (uint8, uint8, error) {
+	active, err := a.obj.GetProperty(bluezAdvertisingManager + ".ActiveInstances")
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s does not report advertisements: %w", a.id, err)
+	}
+	supported, err := a.obj.GetProperty(bluezAdvertisingManager + ".SupportedInstances")
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s does not report advertisements: %w", a.id, err)
+	}
+	n, _ := active.Value().(uint8)
+	m, _ := supported.Value().(uint8)
+	return n, m, nil
+}
+
+// AdapterInfo is what remote support would otherwise ask for from
+// bluetoothctl show.
+type AdapterInfo struct {
+	ID           string `json:"id"`
+	Present      bool   `json:"present"`
+	Address      string `json:"address,omitempty"`
+	Alias        string `json:"alias,omitempty"`
+	BlueZ        string `json:"bluez,omitempty"` // version, when the adapter's modalias tells
+	Powered      bool   `json:"powered"`
+	Discoverable bool   `json:"discoverable"`
+	Connections  int    `json:"connections"` // of remote devices, over any transport
+}
+
+func (i AdapterInfo) String() string {
+	if !i.Present {
+		return fmt.Sprintf("adapter %s is not present", i.ID)
+	}
+	bluez := i.BlueZ
+	if bluez == "" {
+		bluez = "unknown"
+	}
+	return fmt.Sprintf("adapter %s {address: %s, alias: %q, bluez: %s, powered: %t, discoverable: %t, connections: %d}",
+		i.ID, i.Address, i.Alias, bluez, i.Powered, i.Discoverable, i.Connections)
+}
+
+// Info reads the adapter's identity and state. An adapter BlueZ doesn't know
+// is reported as not present rather than as an error.
+func (a *BlueZAdapter) Info() (AdapterInfo, error) {
+	info := AdapterInfo{ID: a.id}
+	props := map[string]dbus.Variant{}
+	if err := a.obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, bluezAdapter).Store(&props); err != nil {
+		if !a.Present() {
+			return info, nil
+		}
+		return info, fmt.Errorf("failed to read %s: %w", a.id, err)
+	}
+	info.Present = true
+	info.Address, _ = props["Address"].Value().(string)
+	info.Alias, _ = props["Alias"].Value().(string)
+	info.Powered, _ = props["Powered"].Value().(bool)
+	info.Discoverable, _ = props["Discoverable"].Value().(bool)
+	modalias, _ := props["Modalias"].Value().(string)
+	info.BlueZ = bluezVersion(modalias)
+	devices, err := a.Devices()
+	if err != nil {
+		return info, err
+	}
+	for _, d := range devices {
+		if d.Connected {
+			info.Connections++
+		}
+	}
+	return info, nil
+}
+
+// bluezVersion reads the BlueZ version from an adapter's modalias. Unless
+// main.conf overrides its DeviceID, BlueZ identifies adapters as the Linux
+// Foundation's (1D6B) product 0246, at version major << 8 | minor, e.g.
+// usb:v1D6Bp0246d0542 for 5.66.
+func bluezVersion(modalias string) string {
+	_, id, ok := strings.Cut(modalias, ":")
+	if !ok {
+		return ""
+	}
+	var vendor, product, version uint16
+	if _, err := fmt.Sscanf(id, "v%4Xp%4Xd%4X", &vendor, &product, &version); err != nil {
+		return ""
+	}
+	if vendor != 0x1D6B || product != 0x0246 {
+		return ""
+	}
+	return fmt.Sprintf("%d.%d", version>>8, version&0xFF)
+}
+
+func (a *BlueZAdapter) Alias() (string, error) {
+	v, err := a.Property("Alias")
+	if err != nil {
+		return "", err
+	}
+	alias, ok := v.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected alias of %s: %v", a.id, v)
+	}
+	return alias, nil
+}
+
+func (a *BlueZAdapter) SetAlias(alias string) error {
+	return a.SetProperty("Alias", alias)
+}
+
+// ClampTxPower validates a requested advertising TX power against what the
+// controller reports it supports, clamping it into range. Stacks that report
+// no TX power capabilities cannot honor the request.
+func (a *BlueZAdapter) ClampTxPower(dbm int16) (*int16, error) {
+	v, err := a.obj.GetProperty(bluezAdvertisingManager + ".SupportedCapabilities")
+	if err != nil {
+		return nil, fmt.Errorf("%s does not report advertising capabilities: %w", a.id, err)
+	}
+	capabilities, _ := v.Value().(map[string]dbus.Variant)
+	lo, okLo := capabilities["MinTxPower"].Value().(int16)
+	hi, okHi := capabilities["MaxTxPower"].Value().(int16)
+	if !okLo || !okHi {
+		return nil, fmt.Errorf("%s does not support tx power control", a.id)
+	}
+	clamped := min(max(dbm, lo), hi)
+	return &clamped, nil
+}
+
+func NewBlueZAdapter(id string) (*BlueZAdapter, error) {
+	bus, err := dbus.SystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system bus: %w", err)
+	}
+	return &BlueZAdapter{
+		id:  id,
+		bus: bus,
+		obj: bus.Object(bluezService, dbus.ObjectPath(bluezAdapterNS+id)),
+	}, nil
+}
@@ -0,0 +1,119 @@
+package radar
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const DefaultBTTraceSize = 1000
+
+// BTTraceEntry is one step of a connection or advertising lifecycle as BlueZ
+// reported it.
+type BTTraceEntry struct {
+	Epoch  time.Time `json:"epoch"`
+	Path   string    `json:"path,omitempty"` // D-Bus object, e.g. /org/bluez/hci0/dev_11_22_33_AA_BB_CC
+	Event  string    `json:"event"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+func (e BTTraceEntry) String() string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s %s", e.Epoch.Format("15:04:05.000"), e.Path, e.Event, e.Detail))
+}
+
+// BTTrace keeps the latest low level BLE detail in a ring buffer, apart from
+// the log, for debugging devices that connect without producing events. A nil
+// BTTrace records nothing.
+type BTTrace struct {
+	entries []BTTraceEntry
+	next    int
+	full    bool
+	lock    sync.Mutex
+}
+
+func (t *BTTrace) String() string {
+	return fmt.Sprintf("BTTrace {size: %d}", len(t.entries))
+}
+
+func (t *BTTrace) Add(path dbus.ObjectPath, event string, detail string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.entries[t.next] = BTTraceEntry{Epoch: time.Now(), Path: string(path), Event: event, Detail: detail}
+	t.next = (t.next + 1) % len(t.entries)
+	t.full = t.full || t.next == 0
+}
+
+// Forget drops the entries matching, returning how many it dropped.
+func (t *BTTrace) Forget(match func(BTTraceEntry) bool) int {
+	if t == nil {
+		return 0
+	}
+	t.lock.Lock()
+	kept := []BTTraceEntry{}
+	ordered := t.entries[:t.next]
+	if t.full {
+		ordered = append(append([]BTTraceEntry{}, t.entries[t.next:]...), t.entries[:t.next]...)
+	}
+	for _, e := range ordered {
+		if !match(e) {
+			kept = append(kept, e)
+		}
+	}
+	removed := len(ordered) - len(kept)
+	t.entries = append(kept, make([]BTTraceEntry, len(t.entries)-len(kept))...)
+	t.next, t.full = len(kept)%len(t.entries), len(kept) == len(t.entries)
+	t.lock.Unlock()
+	return removed
+}
+
+// Error records a failed call, with the D-Bus error name when there is one.
+func (t *BTTrace) Error(path dbus.ObjectPath, call string, err error) {
+	var dberr dbus.Error
+	if errors.As(err, &dberr) {
+		t.Add(path, call+" failed", dberr.Name+": "+strings.TrimSpace(fmt.Sprint(dberr.Body...)))
+		return
+	}
+	t.Add(path, call+" failed", err.Error())
+}
+
+// Entries returns the recorded entries, oldest first.
+func (t *BTTrace) Entries() []BTTraceEntry {
+	if t == nil {
+		return []BTTraceEntry{}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.full {
+		return append([]BTTraceEntry{}, t.entries[:t.next]...)
+	}
+	return append(append([]BTTraceEntry{}, t.entries[t.next:]...), t.entries[:t.next]...)
+}
+
+// properties formats changed D-Bus properties as name=value pairs.
+func properties(props map[string]dbus.Variant) string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%v", name, props[name].Value())
+	}
+	return strings.Join(pairs, " ")
+}
+
+func NewBTTrace(size int) *BTTrace {
+	if size <= 0 {
+		size = DefaultBTTraceSize
+	}
+	return &BTTrace{entries: make([]BTTraceEntry, size)}
+}
@@ -0,0 +1,85 @@
+package radar
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+)
+
+const (
+	DefaultClassicIntervalMs = 30000
+	DefaultClassicTimeoutMs  = 5000
+	DefaultProbeMisses       = 3
+)
+
+// classicProbes page a Bluetooth Classic device, by method. Each succeeds
+// only if the device answered.
+var classicProbes = map[string]func(ctx context.Context, adapter string, address string, timeout time.Duration) error{
+	"l2ping": func(ctx context.Context, adapter string, address string, timeout time.Duration) error {
+		seconds := fmt.Sprint(max(1, int(timeout.Seconds())))
+		out, err := exec.CommandContext(ctx, "l2ping", "-i", adapter, "-c", "1", "-t", seconds, address).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("l2ping: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	},
+	"name": func(ctx context.Context, adapter string, address string, _ time.Duration) error {
+		out, err := exec.CommandContext(ctx, "hcitool", "-i", adapter, "name", address).Output()
+		if err != nil {
+			return fmt.Errorf("hcitool: %w", err)
+		}
+		if strings.TrimSpace(string(out)) == "" {
+			return fmt.Errorf("no name")
+		}
+		return nil
+	},
+}
+
+// NewClassicSentry finds Bluetooth Classic devices, such as older phones and
+// car head units that don't do BLE, by paging their addresses in turn.
+func NewClassicSentry(c config.Bluetooth) (*ProbeSentry, error) {
+	adapter := c.Adapter
+	if adapter == "" {
+		adapter = DefaultAdapterID
+	}
+	method := c.Classic.Method
+	if method == "" {
+		method = "l2ping"
+	}
+	probe, ok := classicProbes[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown classic probe method %q", c.Classic.Method)
+	}
+	timeout := time.Duration(DefaultClassicTimeoutMs) * time.Millisecond
+	if c.Classic.TimeoutMs > 0 {
+		timeout = time.Duration(c.Classic.TimeoutMs) * time.Millisecond
+	}
+	p := &ProbeSentry{
+		name: "classic",
+		probe: func(address string) error {
+			// NOTE: some time past the probe's own timeout for the page to give up
+			ctx, cancel := context.WithTimeout(context.Background(), timeout+time.Second)
+			defer cancel()
+			return probe(ctx, adapter, address, timeout)
+		},
+		interval: time.Duration(DefaultClassicIntervalMs) * time.Millisecond,
+		misses:   DefaultProbeMisses,
+	}
+	if c.Classic.IntervalMs > 0 {
+		p.interval = time.Duration(c.Classic.IntervalMs) * time.Millisecond
+	}
+	if c.Classic.Misses > 0 {
+		p.misses = c.Classic.Misses
+	}
+	for _, address := range c.Classic.Devices {
+		p.targets = append(p.targets, probed{actor: Actor{ID: ID(address), Name: FriendlyName(ID(address))}, target: address})
+	}
+	if len(p.targets) == 0 {
+		return nil, fmt.Errorf("classic sentry requires device addresses")
+	}
+	return p, nil
+}
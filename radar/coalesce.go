@@ -0,0 +1,71 @@
+package radar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+)
+
+// Coalesce holds every event back for the window. An event of the opposite
+// action for the same actor within that window cancels both, so an actor
+// flapping between Entering and Exiting never reaches the rules; once it
+// settles, its last action goes through.
+type Coalesce struct {
+	Proximity
+	window time.Duration
+}
+
+func (c *Coalesce) String() string {
+	return fmt.Sprintf("Coalesce {window: %v}", c.window)
+}
+
+func (c *Coalesce) Search() (chan *Event, error) {
+	events, err := c.Proximity.Search()
+	if err != nil {
+		return nil, err
+	}
+	response := make(chan *Event, cap(events))
+	go func() {
+		defer close(response)
+		ticker := time.NewTicker(max(c.window/4, time.Duration(100)*time.Millisecond))
+		defer ticker.Stop()
+		pending := map[ID]*Event{}
+		since := map[ID]time.Time{} // when the pending event arrived, which may be well after its epoch
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					for _, event := range pending {
+						response <- event
+					}
+					return
+				}
+				id := event.Actor.ID
+				held, ok := pending[id]
+				switch {
+				case !ok:
+					pending[id], since[id] = event, time.Now()
+				case held.Action != event.Action:
+					log.Radar.DebugMemoize("Coalesce: discarding %s flapping %s", id, event.Action.String())
+					delete(pending, id)
+					delete(since, id)
+				}
+			case now := <-ticker.C:
+				for id, event := range pending {
+					if now.Sub(since[id]) < c.window {
+						continue
+					}
+					delete(pending, id)
+					delete(since, id)
+					response <- event
+				}
+			}
+		}
+	}()
+	return response, nil
+}
+
+func NewCoalesce(p Proximity, window time.Duration) *Coalesce {
+	return &Coalesce{Proximity: p, window: window}
+}
@@ -0,0 +1,19 @@
+package radar
+
+const (
+	CommandServiceID = "6b1e0031-5a3c-4f0e-9d2b-be4e5e500001"
+	CommandWriteID   = "6b1e0032-5a3c-4f0e-9d2b-be4e5e500001" // commands from actors' phones
+	CommandStatusID  = "6b1e0033-5a3c-4f0e-9d2b-be4e5e500001" // outcome of the last command
+	CommandNonceID   = "6b1e0034-5a3c-4f0e-9d2b-be4e5e500001" // nonce the next command must carry
+
+	commandMaxLength = 512
+)
+
+// ServeCommands adds the service through which actors' phones send commands,
+// written in chunks like sealed messages but in the clear after the nonce.
+// Each carries its own proof, bound to the nonce, and is handed to accept
+// with it; accept spends the nonce once the proof holds.
+func (bts *BTSentry) ServeCommands(accept func(nonce []byte, message []byte, spend func() error) error) (*SealedService, error) {
+	ids := [4]string{CommandServiceID, CommandWriteID, CommandStatusID, CommandNonceID}
+	return serve(bts.bluez, "commands", ids, commandMaxLength, nil, accept)
+}
@@ -0,0 +1,99 @@
+package radar
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/robolivable/beaves/config"
+)
+
+// Conflict is the policy choosing which event to act on when a batch holds
+// events of different actions, e.g. one actor entering as another leaves.
+type Conflict string
+
+const (
+	LastWins      Conflict = "last"      // the latest event
+	PriorityWins  Conflict = "priority"  // the latest event of the highest priority actor
+	EnteringWins  Conflict = "entering"  // the latest Entering event
+	OccupancyWins Conflict = "occupancy" // Entering while anyone is home, Exiting once nobody is
+)
+
+func ParseConflict(s string) (Conflict, error) {
+	switch c := Conflict(strings.ToLower(s)); c {
+	case "":
+		return LastWins, nil
+	case LastWins, PriorityWins, EnteringWins, OccupancyWins:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q", s)
+}
+
+// Guest reports whether the actor is only known temporarily.
+func (a *Actor) Guest() bool {
+	for _, id := range config.RuntimeConfig.Actors.Known {
+		if strings.EqualFold(string(a.ID), id) {
+			return false
+		}
+	}
+	guestsLock.RLock()
+	defer guestsLock.RUnlock()
+	for _, id := range guests {
+		if strings.EqualFold(string(a.ID), id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Priority is the configured priority of the actor. Actors without one rank
+// 0, and guests -1, so owners prevail over them.
+func (a *Actor) Priority() int {
+	for id, p := range config.RuntimeConfig.Actors.Priority {
+		if strings.EqualFold(string(a.ID), id) {
+			return p
+		}
+	}
+	if a.Guest() {
+		return -1
+	}
+	return 0
+}
+
+// Resolve picks the event of a batch, in order, to act on, or nil if none
+// should be. occupancy is the number of actors present after the batch.
+func (c Conflict) Resolve(events []*Event, occupancy int) *Event {
+	if len(events) == 0 {
+		return nil
+	}
+	last := events[len(events)-1]
+	latest := func(keep func(*Event) bool) *Event {
+		for i := len(events) - 1; i >= 0; i-- {
+			if keep(events[i]) {
+				return events[i]
+			}
+		}
+		return nil
+	}
+	switch c {
+	case PriorityWins:
+		best := last
+		for i := len(events) - 2; i >= 0; i-- {
+			if events[i].Actor.Priority() > best.Actor.Priority() {
+				best = events[i]
+			}
+		}
+		return best
+	case EnteringWins:
+		if e := latest(func(e *Event) bool { return e.Action == Entering }); e != nil {
+			return e
+		}
+	case OccupancyWins:
+		// an actor leaving while others stay is not acted on
+		want := Exiting
+		if occupancy > 0 {
+			want = Entering
+		}
+		return latest(func(e *Event) bool { return e.Action == want })
+	}
+	return last
+}
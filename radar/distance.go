@@ -0,0 +1,100 @@
+package radar
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/power"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+const (
+	DefaultDistanceActor   = "distance"
+	DefaultDistancePollMs  = 500
+	DefaultDistanceSamples = 3
+	DefaultDistanceSlackMm = 50
+)
+
+// DistanceSentry emits Entering when an object comes closer than the
+// threshold and Exiting once it moves back beyond it. A hysteresis band and a
+// number of consecutive agreeing samples keep noisy readings from flapping.
+type DistanceSentry struct {
+	ranger    Ranger
+	actor     Actor
+	threshold int
+	slack     int
+	samples   int
+	poll      time.Duration
+}
+
+func (d *DistanceSentry) String() string {
+	return fmt.Sprintf("DistanceSentry {actor: %s, threshold: %dmm}", d.actor.ID, d.threshold)
+}
+
+func (d *DistanceSentry) Search() (chan *Event, error) {
+	response := make(chan *Event, 1)
+	supervisor.Go("distance sentry", func() {
+		near := false
+		streak := 0
+		for {
+			time.Sleep(power.Poll(d.poll))
+			mm, err := d.ranger.DistanceMm()
+			if err != nil {
+				log.Radar.DebugMemoize("DistanceSentry: %s", err.Error())
+				continue
+			}
+			crossed := (!near && mm < d.threshold-d.slack) || (near && mm > d.threshold+d.slack)
+			if !crossed {
+				streak = 0
+				continue
+			}
+			if streak++; streak < d.samples {
+				continue
+			}
+			streak = 0
+			near = !near
+			actor := d.actor
+			log.Radar.Debug("DistanceSentry: %s at %dmm", GetAction(near).String(), mm)
+			response <- &Event{Actor: &actor, Action: GetAction(near), Epoch: time.Now(), Source: "distance"}
+		}
+	})
+	return response, nil
+}
+
+func (d *DistanceSentry) Message(payload *Payload) error {
+	return errors.New("distance sentry cannot message actors")
+}
+
+func NewDistanceSentry(c config.Distance) (*DistanceSentry, error) {
+	if c.ThresholdMm <= 0 {
+		return nil, fmt.Errorf("distance sentry requires a threshold")
+	}
+	ranger, err := NewHCSR04(c.Trigger, c.Echo)
+	if err != nil {
+		return nil, err
+	}
+	d := &DistanceSentry{
+		ranger:    ranger,
+		actor:     Actor{ID: DefaultDistanceActor, Name: DefaultDistanceActor},
+		threshold: c.ThresholdMm,
+		slack:     DefaultDistanceSlackMm,
+		samples:   DefaultDistanceSamples,
+		poll:      time.Duration(DefaultDistancePollMs) * time.Millisecond,
+	}
+	if c.Actor != "" {
+		d.actor = Actor{ID: ID(c.Actor), Name: c.Actor}
+	}
+	if c.HysteresisMm > 0 {
+		d.slack = c.HysteresisMm
+	}
+	if c.Samples > 0 {
+		d.samples = c.Samples
+	}
+	if c.PollMs > 0 {
+		d.poll = time.Duration(c.PollMs) * time.Millisecond
+	}
+	return d, nil
+}
@@ -0,0 +1,69 @@
+package radar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+)
+
+// Dwell holds back Entering events until the actor has remained present for
+// the dwell duration. An Exiting event within that window cancels both, so
+// drive-by detections never reach the switch.
+type Dwell struct {
+	Proximity
+	dwell time.Duration
+}
+
+func (d *Dwell) String() string {
+	return fmt.Sprintf("Dwell {dwell: %v}", d.dwell)
+}
+
+func (d *Dwell) Search() (chan *Event, error) {
+	events, err := d.Proximity.Search()
+	if err != nil {
+		return nil, err
+	}
+	response := make(chan *Event, cap(events))
+	go func() {
+		defer close(response)
+		ticker := time.NewTicker(max(d.dwell/4, time.Duration(100)*time.Millisecond))
+		defer ticker.Stop()
+		pending := map[ID]*Event{}
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				id := event.Actor.ID
+				switch event.Action {
+				case Entering:
+					if _, ok := pending[id]; !ok {
+						pending[id] = event
+					}
+				case Exiting:
+					if _, ok := pending[id]; ok {
+						log.Radar.DebugMemoize("Dwell: discarding drive-by of %s", id)
+						delete(pending, id)
+						continue
+					}
+					response <- event
+				}
+			case now := <-ticker.C:
+				for id, event := range pending {
+					if now.Sub(event.Epoch) < d.dwell {
+						continue
+					}
+					delete(pending, id)
+					response <- event
+				}
+			}
+		}
+	}()
+	return response, nil
+}
+
+func NewDwell(p Proximity, dwell time.Duration) *Dwell {
+	return &Dwell{Proximity: p, dwell: dwell}
+}
@@ -0,0 +1,103 @@
+package radar
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"tinygo.org/x/bluetooth"
+)
+
+const (
+	DefaultFrameDurationMs    = 1000
+	DefaultIBeaconMeasuredDbm = -59
+
+	appleCompanyID = 0x004C
+	ibeaconType    = 0x02
+	ibeaconLength  = 0x15
+)
+
+// frame is an advertisement taking turns with the presence advertisement.
+type frame struct {
+	name     string
+	options  AdvertisementOptions
+	duration time.Duration
+}
+
+// ibeacon lays out Apple's iBeacon manufacturer data: type, length, proximity
+// UUID, major and minor, big endian, then the measured power.
+func ibeacon(c config.Frame) (AdvertisementOptions, error) {
+	// NOTE: in the order it is written, unlike bluetooth.UUID's bytes
+	uuid, err := hex.DecodeString(strings.ReplaceAll(c.UUID, "-", ""))
+	if err != nil || len(uuid) != 16 {
+		return AdvertisementOptions{}, fmt.Errorf("invalid ibeacon uuid %q", c.UUID)
+	}
+	power := c.MeasuredPower
+	if power == 0 {
+		power = DefaultIBeaconMeasuredDbm
+	}
+	data := []byte{ibeaconType, ibeaconLength}
+	data = append(data, uuid...)
+	data = binary.BigEndian.AppendUint16(data, c.Major)
+	data = binary.BigEndian.AppendUint16(data, c.Minor)
+	data = append(data, byte(power))
+	return AdvertisementOptions{
+		AdvertisementOptions: bluetooth.AdvertisementOptions{
+			AdvertisementType: bluetooth.AdvertisingTypeNonConnInd,
+			ManufacturerData:  []bluetooth.ManufacturerDataElement{{CompanyID: appleCompanyID, Data: data}},
+		},
+	}, nil
+}
+
+func custom(c config.Frame) (AdvertisementOptions, error) {
+	options := AdvertisementOptions{
+		AdvertisementOptions: bluetooth.AdvertisementOptions{LocalName: c.LocalName, AdvertisementType: bluetooth.AdvertisingTypeNonConnInd},
+		Connectable:          c.Connectable,
+	}
+	if c.Connectable {
+		options.AdvertisementType = bluetooth.AdvertisingTypeInd
+	}
+	for _, id := range c.ServiceUUIDs {
+		uuid, err := bluetooth.ParseUUID(id)
+		if err != nil {
+			return options, fmt.Errorf("invalid service uuid %q: %w", id, err)
+		}
+		options.ServiceUUIDs = append(options.ServiceUUIDs, uuid)
+	}
+	if c.ManufacturerData != "" {
+		data, err := hex.DecodeString(c.ManufacturerData)
+		if err != nil {
+			return options, fmt.Errorf("invalid manufacturer data: %w", err)
+		}
+		options.ManufacturerData = []bluetooth.ManufacturerDataElement{{CompanyID: c.CompanyID, Data: data}}
+	}
+	return options, nil
+}
+
+var frameTypes = map[string]func(config.Frame) (AdvertisementOptions, error){
+	"ibeacon": ibeacon,
+	"custom":  custom,
+}
+
+func newFrames(configs []config.Frame) ([]frame, error) {
+	frames := []frame{}
+	for i, c := range configs {
+		build, ok := frameTypes[c.Type]
+		if !ok {
+			return nil, fmt.Errorf("frame %d: unknown type %q", i, c.Type)
+		}
+		options, err := build(c)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		f := frame{name: fmt.Sprintf("%s frame %d", c.Type, i), options: options, duration: time.Duration(DefaultFrameDurationMs) * time.Millisecond}
+		if c.DurationMs > 0 {
+			f.duration = time.Duration(c.DurationMs) * time.Millisecond
+		}
+		frames = append(frames, f)
+	}
+	return frames, nil
+}
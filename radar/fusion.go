@@ -0,0 +1,96 @@
+package radar
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/robolivable/beaves/log"
+)
+
+// Fusion merges the events of several sentries into a single stream, per
+// actor: an actor is present while any sentry sees it, so it only enters
+// when the first sentry sees it, and only exits once every sentry agrees.
+// A phone whose WiFi naps then doesn't leave while Bluetooth still sees it.
+type Fusion struct {
+	sentries []Proximity
+
+	lock    sync.Mutex
+	present map[ID]map[int]bool // by actor, the sentries seeing it, and whether they may drive switches
+}
+
+// fuse reports whether an event of sentry i changes the actor's presence.
+func (f *Fusion) fuse(i int, event *Event) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	id := ID(strings.ToLower(string(event.Actor.ID)))
+	seeing := f.present[id]
+	if seeing == nil {
+		seeing = map[int]bool{}
+		f.present[id] = seeing
+	}
+	if event.Action == Exiting {
+		delete(seeing, i)
+		return len(seeing) == 0
+	}
+	acting := slices.Contains(slices.Collect(maps.Values(seeing)), true)
+	fresh := len(seeing) == 0
+	seeing[i] = !event.PresenceOnly
+	// NOTE: a sign strong enough to act on passes even if a weaker one came first
+	return fresh || (!event.PresenceOnly && !acting)
+}
+
+func (f *Fusion) Search() (chan *Event, error) {
+	streams := []chan *Event{}
+	size := 0
+	for _, s := range f.sentries {
+		events, err := s.Search()
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, events)
+		size += cap(events)
+	}
+	response := make(chan *Event, size)
+	var wg sync.WaitGroup
+	for i, events := range streams {
+		wg.Add(1)
+		go func(events chan *Event) {
+			defer wg.Done()
+			for event := range events {
+				if !f.fuse(i, event) {
+					log.Radar.DebugMemoize("Fusion: %s still seen by another sentry", event.String())
+					continue
+				}
+				response <- event
+			}
+		}(events)
+	}
+	go func() {
+		wg.Wait()
+		close(response)
+	}()
+	return response, nil
+}
+
+// Message delivers the payload through the first sentry able to.
+func (f *Fusion) Message(payload *Payload) error {
+	errs := []error{}
+	for _, s := range f.sentries {
+		err := s.Message(payload)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func NewFusion(sentries ...Proximity) Proximity {
+	if len(sentries) == 1 {
+		return sentries[0]
+	}
+	return &Fusion{sentries: sentries, present: map[ID]map[int]bool{}}
+}
@@ -0,0 +1,139 @@
+package radar
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+	"tinygo.org/x/bluetooth"
+)
+
+const (
+	bluezGattManager        = "org.bluez.GattManager1"
+	bluezGattService        = "org.bluez.GattService1"
+	bluezGattCharacteristic = "org.bluez.GattCharacteristic1"
+
+	gattNS = "/org/robolivable/beaves/service"
+)
+
+var gattServiceID uint64
+
+// GATTCharacteristic is an org.bluez.GattCharacteristic1 object exported by
+// Beaves itself. Unlike the bluetooth package's, its handlers learn which
+// device read or wrote, so state can be kept per connection.
+type GATTCharacteristic struct {
+	UUID    bluetooth.UUID
+	Flags   []string // e.g. "read", "write", "notify"
+	Value   []byte   // read unless OnRead is set, and notified
+	OnRead  func(device dbus.ObjectPath) []byte
+	OnWrite func(device dbus.ObjectPath, value []byte)
+
+	props *prop.Properties
+}
+
+func (c *GATTCharacteristic) String() string {
+	return fmt.Sprintf("GATTCharacteristic {uuid: %s}", c.UUID.String())
+}
+
+func device(options map[string]dbus.Variant) dbus.ObjectPath {
+	path, _ := options["device"].Value().(dbus.ObjectPath)
+	return path
+}
+
+func (c *GATTCharacteristic) ReadValue(options map[string]dbus.Variant) ([]byte, *dbus.Error) {
+	if c.OnRead != nil {
+		return c.OnRead(device(options)), nil
+	}
+	return c.props.GetMust(bluezGattCharacteristic, "Value").([]byte), nil
+}
+
+func (c *GATTCharacteristic) WriteValue(value []byte, options map[string]dbus.Variant) *dbus.Error {
+	if c.OnWrite != nil {
+		c.OnWrite(device(options), value)
+	}
+	return nil
+}
+
+func (c *GATTCharacteristic) StartNotify() *dbus.Error {
+	return nil
+}
+
+func (c *GATTCharacteristic) StopNotify() *dbus.Error {
+	return nil
+}
+
+// Notify replaces the value, notifying the devices subscribed to it.
+func (c *GATTCharacteristic) Notify(value []byte) error {
+	if c.props == nil {
+		return fmt.Errorf("characteristic %s is not served", c.UUID.String())
+	}
+	if err := c.props.Set(bluezGattCharacteristic, "Value", dbus.MakeVariant(value)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// gattApplication is the object manager BlueZ reads a service from.
+type gattApplication struct {
+	objects map[dbus.ObjectPath]map[string]map[string]*prop.Prop
+}
+
+func (app *gattApplication) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{}
+	for path, interfaces := range app.objects {
+		objects[path] = map[string]map[string]dbus.Variant{}
+		for iface, props := range interfaces {
+			objects[path][iface] = map[string]dbus.Variant{}
+			for name, p := range props {
+				objects[path][iface][name] = dbus.MakeVariant(p.Value)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// AddService exports a primary service with its characteristics and
+// registers it with the adapter.
+func (a *BlueZAdapter) AddService(uuid bluetooth.UUID, characteristics ...*GATTCharacteristic) error {
+	id := atomic.AddUint64(&gattServiceID, 1)
+	path := dbus.ObjectPath(fmt.Sprintf("%s%d", gattNS, id))
+	app := &gattApplication{objects: map[dbus.ObjectPath]map[string]map[string]*prop.Prop{
+		path: {bluezGattService: {
+			"UUID":    {Value: uuid.String()},
+			"Primary": {Value: true},
+		}},
+	}}
+	for i, c := range characteristics {
+		value := c.Value
+		if value == nil {
+			value = []byte{}
+		}
+		charPath := path + dbus.ObjectPath("/char"+strconv.Itoa(i))
+		spec := map[string]map[string]*prop.Prop{bluezGattCharacteristic: {
+			"UUID":    {Value: c.UUID.String()},
+			"Service": {Value: path},
+			"Flags":   {Value: c.Flags},
+			"Value":   {Value: value, Writable: true, Emit: prop.EmitTrue},
+		}}
+		props, err := prop.Export(a.bus, charPath, spec)
+		if err != nil {
+			return fmt.Errorf("failed to export characteristic %s: %w", c.UUID.String(), err)
+		}
+		c.props = props
+		if err := a.bus.Export(c, charPath, bluezGattCharacteristic); err != nil {
+			return fmt.Errorf("failed to export characteristic %s: %w", c.UUID.String(), err)
+		}
+		app.objects[charPath] = spec
+	}
+	if err := a.bus.Export(app, path, "org.freedesktop.DBus.ObjectManager"); err != nil {
+		return fmt.Errorf("failed to export service %s: %w", uuid.String(), err)
+	}
+	if err := a.obj.Call(bluezGattManager+".RegisterApplication", 0, path, map[string]dbus.Variant{}).Err; err != nil {
+		a.Trace.Error(path, "RegisterApplication", err)
+		return fmt.Errorf("failed to register service %s: %w", uuid.String(), err)
+	}
+	a.Trace.Add(path, "service registered", uuid.String())
+	return nil
+}
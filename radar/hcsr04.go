@@ -0,0 +1,75 @@
+package radar
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/host/v3"
+)
+
+// Ranger measures the distance to the nearest object, in millimetres.
+type Ranger interface {
+	DistanceMm() (int, error)
+}
+
+const (
+	hcsr04EchoTimeout  = time.Duration(40) * time.Millisecond // ~6.8m round trip
+	speedOfSoundMmPerS = 343000
+)
+
+var errNoEcho = errors.New("hc-sr04: no echo")
+
+// HCSR04 is an ultrasonic ranger driven by a trigger and an echo pin.
+type HCSR04 struct {
+	trigger gpio.PinIO
+	echo    gpio.PinIO
+}
+
+func (h *HCSR04) String() string {
+	return fmt.Sprintf("HCSR04 {trigger: %s, echo: %s}", h.trigger, h.echo)
+}
+
+// DistanceMm times one echo. Edges left queued by an earlier reading, e.g. the
+// falling edge of one that timed out, are drained first, and each edge must
+// leave the echo at the level it stands for, so a stale edge can't pass for
+// the start of the pulse.
+func (h *HCSR04) DistanceMm() (int, error) {
+	for h.echo.WaitForEdge(0) {
+	}
+	if err := h.trigger.Out(gpio.High); err != nil {
+		return 0, fmt.Errorf("hc-sr04: failed to trigger: %w", err)
+	}
+	time.Sleep(time.Duration(10) * time.Microsecond)
+	if err := h.trigger.Out(gpio.Low); err != nil {
+		return 0, fmt.Errorf("hc-sr04: failed to trigger: %w", err)
+	}
+	if !h.echo.WaitForEdge(hcsr04EchoTimeout) || h.echo.Read() != gpio.High {
+		return 0, errNoEcho
+	}
+	start := time.Now()
+	if !h.echo.WaitForEdge(hcsr04EchoTimeout) || h.echo.Read() != gpio.Low {
+		return 0, errNoEcho
+	}
+	pulse := time.Since(start)
+	return int(pulse.Seconds() * speedOfSoundMmPerS / 2), nil
+}
+
+func NewHCSR04(trigger string, echo string) (*HCSR04, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, fmt.Errorf("host failed to initialize for hc-sr04: %w", err)
+	}
+	h := &HCSR04{trigger: gpioreg.ByName(trigger), echo: gpioreg.ByName(echo)}
+	if h.trigger == nil || h.echo == nil {
+		return nil, fmt.Errorf("hc-sr04: pins %s/%s are not present on host", trigger, echo)
+	}
+	if err := h.trigger.Out(gpio.Low); err != nil {
+		return nil, fmt.Errorf("hc-sr04: failed to claim trigger %s: %w", trigger, err)
+	}
+	if err := h.echo.In(gpio.PullDown, gpio.BothEdges); err != nil {
+		return nil, fmt.Errorf("hc-sr04: failed to claim echo %s: %w", echo, err)
+	}
+	return h, nil
+}
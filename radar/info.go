@@ -0,0 +1,31 @@
+package radar
+
+import (
+	"fmt"
+
+	"tinygo.org/x/bluetooth"
+)
+
+const (
+	InfoServiceID        = "6b1e0021-5a3c-4f0e-9d2b-be4e5e500001"
+	InfoCharacteristicID = "6b1e0022-5a3c-4f0e-9d2b-be4e5e500001" // build info, readable
+)
+
+// ServeInfo adds a service from which a phone can read which build the node
+// runs.
+func (bts *BTSentry) ServeInfo(info string) error {
+	serviceUUID, _ := bluetooth.ParseUUID(InfoServiceID)
+	characteristicUUID, _ := bluetooth.ParseUUID(InfoCharacteristicID)
+	err := bts.adapter.AddService(&bluetooth.Service{
+		UUID: serviceUUID,
+		Characteristics: []bluetooth.CharacteristicConfig{{
+			UUID:  characteristicUUID,
+			Value: []byte(info),
+			Flags: bluetooth.CharacteristicReadPermission,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add info service: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package radar
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+const (
+	DefaultLD2410Port    = "/dev/serial0"
+	DefaultLD2410Baud    = 256000
+	DefaultLD2410Actor   = "mmwave"
+	DefaultLD2410ClearMs = 5000
+
+	ld2410MaxFrame = 64
+)
+
+type LD2410Target byte
+
+const (
+	NoTarget LD2410Target = iota
+	MovingTarget
+	StationaryTarget
+	MovingAndStationaryTarget
+)
+
+// LD2410Report is a periodic target report from the sensor.
+type LD2410Report struct {
+	Target               LD2410Target
+	MovingDistanceCm     uint16
+	MovingEnergy         byte
+	StationaryDistanceCm uint16
+	StationaryEnergy     byte
+}
+
+var ld2410Frame = controller.Frame{
+	Header:       []byte{0xF4, 0xF3, 0xF2, 0xF1},
+	Footer:       []byte{0xF8, 0xF7, 0xF6, 0xF5},
+	LengthSize:   2,
+	LittleEndian: true,
+	MaxLength:    ld2410MaxFrame,
+}
+
+func parseLD2410Report(frame []byte) (LD2410Report, error) {
+	// type (0x01 engineering, 0x02 basic), 0xAA, target state, moving distance,
+	// moving energy, stationary distance, stationary energy, ...
+	if len(frame) < 9 || frame[1] != 0xAA {
+		return LD2410Report{}, fmt.Errorf("ld2410: unexpected report: % x", frame)
+	}
+	return LD2410Report{
+		Target:               LD2410Target(frame[2]),
+		MovingDistanceCm:     binary.LittleEndian.Uint16(frame[3:5]),
+		MovingEnergy:         frame[5],
+		StationaryDistanceCm: binary.LittleEndian.Uint16(frame[6:8]),
+		StationaryEnergy:     frame[8],
+	}, nil
+}
+
+// LD2410Sentry turns the reports of an LD2410 mmWave radar into occupancy
+// events. Unlike BLE it detects people sitting still, without a phone. The
+// room must stay clear for a while before Exiting is emitted, since the radar
+// briefly loses stationary targets.
+type LD2410Sentry struct {
+	port  *controller.UART
+	actor Actor
+	clear time.Duration
+}
+
+func (l *LD2410Sentry) String() string {
+	return fmt.Sprintf("LD2410Sentry {port: %s, actor: %s}", l.port.String(), l.actor.ID)
+}
+
+func (l *LD2410Sentry) Search() (chan *Event, error) {
+	response := make(chan *Event, 1)
+	emit := func(action Action) {
+		actor := l.actor
+		response <- &Event{Actor: &actor, Action: action, Epoch: time.Now(), Source: "ld2410"}
+	}
+	go func() {
+		defer close(response)
+		supervisor.Run("ld2410 sentry", func() {
+			occupied := false
+			var lastSeen time.Time
+			for {
+				frame, err := l.port.ReadFrame(ld2410Frame)
+				if errors.Is(err, io.EOF) || errors.Is(err, os.ErrClosed) {
+					log.Error("LD2410Sentry: port closed: %s", err.Error())
+					return
+				}
+				if err != nil {
+					log.Radar.DebugMemoize("LD2410Sentry: %s", err.Error())
+					continue
+				}
+				report, err := parseLD2410Report(frame)
+				if err != nil {
+					log.Radar.DebugMemoize("LD2410Sentry: %s", err.Error())
+					continue
+				}
+				if report.Target != NoTarget {
+					lastSeen = time.Now()
+					if !occupied {
+						occupied = true
+						emit(Entering)
+					}
+					continue
+				}
+				if occupied && time.Since(lastSeen) >= l.clear {
+					occupied = false
+					emit(Exiting)
+				}
+			}
+		})
+	}()
+	return response, nil
+}
+
+func (l *LD2410Sentry) Message(payload *Payload) error {
+	return errors.New("ld2410 sentry cannot message actors")
+}
+
+func NewLD2410Sentry(c config.MMWave) (*LD2410Sentry, error) {
+	path, baud := c.Port, c.Baud
+	if path == "" {
+		path = DefaultLD2410Port
+	}
+	if baud == 0 {
+		baud = DefaultLD2410Baud
+	}
+	port, err := controller.OpenUART(path, baud)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ld2410: %w", err)
+	}
+	l := &LD2410Sentry{
+		port:  port,
+		actor: Actor{ID: DefaultLD2410Actor, Name: DefaultLD2410Actor},
+		clear: time.Duration(DefaultLD2410ClearMs) * time.Millisecond,
+	}
+	if c.Actor != "" {
+		l.actor = Actor{ID: ID(c.Actor), Name: c.Actor}
+	}
+	if c.ClearMs > 0 {
+		l.clear = time.Duration(c.ClearMs) * time.Millisecond
+	}
+	return l, nil
+}
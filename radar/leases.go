@@ -0,0 +1,248 @@
+package radar
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+)
+
+const (
+	DefaultLeasesFile       = "/var/lib/misc/dnsmasq.leases"
+	DefaultLeasesIntervalMs = 30000
+	DefaultLeasesMisses     = 2
+	DefaultUniFiSite        = "default"
+
+	leasesTimeout = 10 * time.Second
+)
+
+// leaseSources fetch the MAC addresses with an active lease, upper cased.
+var leaseSources = map[string]func(l *leases) (map[string]bool, error){
+	"dnsmasq": (*leases).dnsmasq,
+	"openwrt": (*leases).openwrt,
+	"unifi":   (*leases).unifi,
+}
+
+// leases fetches active leases from where the configuration says.
+type leases struct {
+	config.Leases
+	client  *http.Client
+	session string // openwrt: ubus session
+	active  map[string]bool
+}
+
+// dnsmasq reads a lease file, one lease a line: expiry, MAC, IP, hostname
+// and client ID. An expiry of 0 never ends.
+func (l *leases) dnsmasq() (map[string]bool, error) {
+	path := l.File
+	if path == "" {
+		path = DefaultLeasesFile
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read leases: %w", err)
+	}
+	active := map[string]bool{}
+	now := time.Now().Unix()
+	lines := bufio.NewScanner(bytes.NewReader(data))
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || (expiry != 0 && expiry < now) {
+			continue
+		}
+		active[strings.ToUpper(fields[1])] = true
+	}
+	return active, nil
+}
+
+// call makes a JSON request to the router, decoding the response into out.
+func (l *leases) call(method string, path string, body any, out any) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(l.URL, "/")+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// ubus calls an OpenWrt ubus method over JSON-RPC, as LuCI does.
+func (l *leases) ubus(session string, object string, method string, args any, out any) error {
+	var res struct {
+		Result []json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	req := map[string]any{"jsonrpc": "2.0", "id": 1, "method": "call", "params": []any{session, object, method, args}}
+	if err := l.call(http.MethodPost, "/ubus", req, &res); err != nil {
+		return err
+	}
+	if res.Error != nil {
+		return fmt.Errorf("ubus %s %s: %s", object, method, res.Error.Message)
+	}
+	if len(res.Result) < 2 {
+		code := "no result"
+		if len(res.Result) == 1 {
+			code = "status " + string(res.Result[0])
+		}
+		return fmt.Errorf("ubus %s %s: %s", object, method, code)
+	}
+	return json.Unmarshal(res.Result[1], out)
+}
+
+// openwrt lists the DHCP leases through LuCI's RPC, logging in again when
+// the session has expired.
+func (l *leases) openwrt() (map[string]bool, error) {
+	var res struct {
+		Leases []struct {
+			MAC string `json:"macaddr"`
+		} `json:"dhcp_leases"`
+	}
+	err := l.ubus(l.session, "luci-rpc", "getDHCPLeases", map[string]any{}, &res)
+	if err != nil {
+		var login struct {
+			Session string `json:"ubus_rpc_session"`
+		}
+		credentials := map[string]string{"username": l.Username, "password": l.Password}
+		if err := l.ubus(strings.Repeat("0", 32), "session", "login", credentials, &login); err != nil {
+			return nil, fmt.Errorf("failed to log in to openwrt: %w", err)
+		}
+		l.session = login.Session
+		if err := l.ubus(l.session, "luci-rpc", "getDHCPLeases", map[string]any{}, &res); err != nil {
+			return nil, err
+		}
+	}
+	active := map[string]bool{}
+	for _, lease := range res.Leases {
+		active[strings.ToUpper(lease.MAC)] = true
+	}
+	return active, nil
+}
+
+// unifi lists the clients the UniFi Network application sees connected,
+// logging in again when its cookie has expired. UniFi OS consoles serve the
+// application under /proxy/network.
+func (l *leases) unifi() (map[string]bool, error) {
+	site := l.Site
+	if site == "" {
+		site = DefaultUniFiSite
+	}
+	var res struct {
+		Data []struct {
+			MAC string `json:"mac"`
+		} `json:"data"`
+	}
+	prefix := ""
+	if l.UniFiOS {
+		prefix = "/proxy/network"
+	}
+	path := prefix + "/api/s/" + site + "/stat/sta"
+	if err := l.call(http.MethodGet, path, nil, &res); err != nil {
+		login := "/api/login"
+		if l.UniFiOS {
+			login = "/api/auth/login"
+		}
+		credentials := map[string]string{"username": l.Username, "password": l.Password}
+		if err := l.call(http.MethodPost, login, credentials, nil); err != nil {
+			return nil, fmt.Errorf("failed to log in to unifi: %w", err)
+		}
+		if err := l.call(http.MethodGet, path, nil, &res); err != nil {
+			return nil, err
+		}
+	}
+	active := map[string]bool{}
+	for _, client := range res.Data {
+		active[strings.ToUpper(client.MAC)] = true
+	}
+	return active, nil
+}
+
+// NewLeasesSentry finds actors by the DHCP leases of their devices, from
+// dnsmasq's lease file or the router, complementing BLE for devices that
+// sleep their radios.
+func NewLeasesSentry(c config.Leases) (*ProbeSentry, error) {
+	source := c.Source
+	if source == "" {
+		source = "dnsmasq"
+	}
+	fetch, ok := leaseSources[source]
+	if !ok {
+		return nil, fmt.Errorf("unknown lease source %q", c.Source)
+	}
+	if source != "dnsmasq" && c.URL == "" {
+		return nil, fmt.Errorf("%s leases require the router's url", source)
+	}
+	jar, _ := cookiejar.New(nil)
+	l := &leases{
+		Leases: c,
+		client: &http.Client{
+			Timeout:   leasesTimeout,
+			Jar:       jar,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: c.InsecureTLS}},
+		},
+	}
+	p := &ProbeSentry{
+		name: "leases",
+		prepare: func() error {
+			active, err := fetch(l)
+			if err != nil {
+				return err
+			}
+			l.active = active
+			return nil
+		},
+		probe: func(mac string) error {
+			if !l.active[strings.ToUpper(mac)] {
+				return fmt.Errorf("no active lease")
+			}
+			return nil
+		},
+		interval: time.Duration(DefaultLeasesIntervalMs) * time.Millisecond,
+		misses:   DefaultLeasesMisses,
+	}
+	if c.IntervalMs > 0 {
+		p.interval = time.Duration(c.IntervalMs) * time.Millisecond
+	}
+	if c.Misses > 0 {
+		p.misses = c.Misses
+	}
+	for actor, mac := range c.Devices {
+		p.targets = append(p.targets, probed{actor: Actor{ID: ID(actor), Name: FriendlyName(ID(actor))}, target: mac})
+	}
+	if len(p.targets) == 0 {
+		return nil, fmt.Errorf("leases sentry requires devices")
+	}
+	slices.SortFunc(p.targets, func(a, b probed) int { return strings.Compare(string(a.actor.ID), string(b.actor.ID)) })
+	return p, nil
+}
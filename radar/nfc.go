@@ -0,0 +1,96 @@
+package radar
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/power"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+const (
+	DefaultNFCPollMs    = 200
+	DefaultNFCHoldoffMs = 3000
+)
+
+// NFCSentry emits Entering whenever an enrolled tag is tapped, as a fallback
+// for actors whose phones are dead.
+type NFCSentry struct {
+	reader  *PN532
+	tags    map[string]ID
+	poll    time.Duration
+	holdoff time.Duration
+}
+
+func (n *NFCSentry) String() string {
+	return fmt.Sprintf("NFCSentry {tags: %d, poll: %v}", len(n.tags), n.poll)
+}
+
+func (n *NFCSentry) Search() (chan *Event, error) {
+	response := make(chan *Event, 1)
+	supervisor.Go("nfc sentry", func() {
+		last := map[string]time.Time{}
+		for {
+			time.Sleep(power.Poll(n.poll))
+			uid, err := n.reader.ReadUID()
+			if err != nil {
+				log.Radar.DebugMemoize("NFCSentry: %s", err.Error())
+				continue
+			}
+			if uid == "" {
+				continue
+			}
+			if time.Since(last[uid]) < n.holdoff {
+				continue
+			}
+			last[uid] = time.Now()
+			id, ok := n.tags[uid]
+			if !ok {
+				log.InfoMemoize("NFCSentry: unenrolled tag %s", uid)
+				continue
+			}
+			actor := Actor{ID: id, Name: string(id)}
+			if !actor.Known() {
+				log.InfoMemoize("NFCSentry: tag %s maps to unknown actor %s", uid, id)
+				continue
+			}
+			select {
+			case response <- &Event{Actor: &actor, Action: Entering, Epoch: time.Now(), Source: "nfc"}:
+			default:
+				log.Radar.DebugMemoize("NFCSentry: dropping tap of %s", uid)
+			}
+		}
+	})
+	return response, nil
+}
+
+func (n *NFCSentry) Message(payload *Payload) error {
+	return errors.New("nfc sentry cannot message actors")
+}
+
+func NewNFCSentry(c config.NFC) (*NFCSentry, error) {
+	reader, err := NewPN532(c.Bus, c.Port, c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize nfc reader: %w", err)
+	}
+	n := &NFCSentry{
+		reader:  reader,
+		tags:    map[string]ID{},
+		poll:    time.Duration(DefaultNFCPollMs) * time.Millisecond,
+		holdoff: time.Duration(DefaultNFCHoldoffMs) * time.Millisecond,
+	}
+	if c.PollMs > 0 {
+		n.poll = time.Duration(c.PollMs) * time.Millisecond
+	}
+	if c.HoldoffMs > 0 {
+		n.holdoff = time.Duration(c.HoldoffMs) * time.Millisecond
+	}
+	for uid, actor := range c.Tags {
+		n.tags[strings.ToUpper(strings.ReplaceAll(uid, ":", ""))] = ID(actor)
+	}
+	return n, nil
+}
@@ -0,0 +1,175 @@
+package radar
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+const (
+	NonceSize         = 16
+	DefaultNonceTTLMs = 30000
+
+	noncesKept   = 8   // recently issued nonces, refused as stale rather than unknown
+	noncesIssued = 256 // devices holding a nonce at once
+)
+
+var (
+	ErrStaleNonce   = errors.New("stale nonce")
+	ErrUnknownNonce = errors.New("unknown nonce")
+	ErrBadProof     = errors.New("bad proof")
+	ErrMalformed    = errors.New("malformed message")
+)
+
+var (
+	rejections     = map[string]map[string]uint64{} // by service, then reason
+	rejectionsLock sync.Mutex
+)
+
+// reject counts a refused write.
+func reject(service string, err error) {
+	reason := "refused"
+	for _, known := range []error{ErrStaleNonce, ErrUnknownNonce, ErrBadProof, ErrMalformed} {
+		if errors.Is(err, known) {
+			reason = known.Error()
+			break
+		}
+	}
+	rejectionsLock.Lock()
+	defer rejectionsLock.Unlock()
+	if rejections[service] == nil {
+		rejections[service] = map[string]uint64{}
+	}
+	rejections[service][reason]++
+}
+
+// Rejections counts the authenticated writes refused since start, by service
+// and then reason: "stale nonce", "unknown nonce", "bad proof", "malformed
+// message", or "refused" for anything the service itself turned down.
+func Rejections() map[string]map[string]uint64 {
+	rejectionsLock.Lock()
+	defer rejectionsLock.Unlock()
+	counts := map[string]map[string]uint64{}
+	for service, reasons := range rejections {
+		counts[service] = map[string]uint64{}
+		for reason, n := range reasons {
+			counts[service][reason] = n
+		}
+	}
+	return counts
+}
+
+// Nonces issues the nonce a phone binds into its next write to a service,
+// one per connected device, so no client can spend or stall another's. A
+// device's nonce is issued when it reads it, is spent once a write carrying
+// it proves itself, and expires after ttl, whichever comes first.
+type Nonces struct {
+	name   string
+	ttl    time.Duration
+	issued map[dbus.ObjectPath]issued // by device
+	recent [][]byte
+	lock   sync.Mutex
+
+	characteristic *GATTCharacteristic
+}
+
+type issued struct {
+	nonce []byte
+	at    time.Time
+}
+
+func newNonces(name string) *Nonces {
+	n := &Nonces{name: name, ttl: time.Duration(DefaultNonceTTLMs) * time.Millisecond, issued: map[dbus.ObjectPath]issued{}}
+	if ms := config.RuntimeConfig.Bluetooth.NonceTTLMs; ms > 0 {
+		n.ttl = time.Duration(ms) * time.Millisecond
+	}
+	return n
+}
+
+// retire forgets a device's nonce, remembering it as stale; it must be
+// called with the lock held.
+func (n *Nonces) retire(device dbus.ObjectPath) {
+	n.recent = append(n.recent, n.issued[device].nonce)
+	if len(n.recent) > noncesKept {
+		n.recent = n.recent[1:]
+	}
+	delete(n.issued, device)
+}
+
+// Issue is the nonce the device's next write must carry, made when it has
+// none fresh.
+func (n *Nonces) Issue(device dbus.ObjectPath) []byte {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if i, ok := n.issued[device]; ok && time.Since(i.at) <= n.ttl {
+		return append([]byte{}, i.nonce...)
+	}
+	if _, ok := n.issued[device]; !ok && len(n.issued) >= noncesIssued {
+		// NOTE: a flood of devices reading nonces takes the oldest's turn
+		var oldest dbus.ObjectPath
+		for d, i := range n.issued {
+			if oldest == "" || i.at.Before(n.issued[oldest].at) {
+				oldest = d
+			}
+		}
+		n.retire(oldest)
+	}
+	nonce := make([]byte, NonceSize)
+	rand.Read(nonce)
+	n.issued[device] = issued{nonce: nonce, at: time.Now()}
+	return append([]byte{}, nonce...)
+}
+
+// Check reports whether nonce is the device's and still fresh, without
+// spending it.
+func (n *Nonces) Check(device dbus.ObjectPath, nonce []byte) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if i, ok := n.issued[device]; ok && subtle.ConstantTimeCompare(nonce, i.nonce) == 1 {
+		if time.Since(i.at) > n.ttl {
+			n.retire(device)
+			return ErrStaleNonce
+		}
+		return nil
+	}
+	for _, old := range n.recent {
+		if subtle.ConstantTimeCompare(nonce, old) == 1 {
+			return ErrStaleNonce
+		}
+	}
+	return ErrUnknownNonce
+}
+
+// Spend uses up the device's nonce once a write carrying it proved itself,
+// failing if another write spent it first.
+func (n *Nonces) Spend(device dbus.ObjectPath, nonce []byte) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	i, ok := n.issued[device]
+	if !ok || subtle.ConstantTimeCompare(nonce, i.nonce) != 1 {
+		return ErrStaleNonce
+	}
+	n.retire(device)
+	return nil
+}
+
+// Start forgets nonces that expired unused.
+func (n *Nonces) Start() {
+	supervisor.Go(n.name+" nonces", func() {
+		for range time.Tick(n.ttl) {
+			n.lock.Lock()
+			for device, i := range n.issued {
+				if time.Since(i.at) > n.ttl {
+					n.retire(device)
+				}
+			}
+			n.lock.Unlock()
+		}
+	})
+}
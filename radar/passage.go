@@ -0,0 +1,86 @@
+package radar
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const DefaultPassageWindowMs = 60000
+
+type sighting struct {
+	node   uint16
+	action Action
+	at     time.Time
+}
+
+// Passage infers which way actors travel between two sentries, an outer one
+// (e.g. at the gate) and an inner one (at the door), from the order in which
+// they report the same action: outer then inner is approaching the property,
+// inner then outer departing it. A nil Passage knows nothing.
+type Passage struct {
+	outer, inner uint16
+	window       time.Duration
+	last         map[ID]sighting
+	lock         sync.Mutex
+}
+
+func (p *Passage) String() string {
+	return fmt.Sprintf("Passage {outer: %d, inner: %d, window: %v}", p.outer, p.inner, p.window)
+}
+
+// Peer is the sentry paired with node, and false if node is neither.
+func (p *Passage) Peer(node uint16) (uint16, bool) {
+	switch node {
+	case p.outer:
+		return p.inner, true
+	case p.inner:
+		return p.outer, true
+	}
+	return 0, false
+}
+
+// Observe records an event reported by node, and returns the direction of
+// travel if the other sentry reported the same action for the actor within
+// the window.
+func (p *Passage) Observe(node uint16, e *Event) Direction {
+	if p == nil {
+		return ""
+	}
+	if _, ok := p.Peer(node); !ok {
+		return ""
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for id, s := range p.last {
+		if d := e.Epoch.Sub(s.at); d > p.window || d < -p.window {
+			delete(p.last, id)
+		}
+	}
+	id := e.Actor.ID
+	s, ok := p.last[id]
+	if !ok || s.node == node || s.action != e.Action {
+		p.last[id] = sighting{node: node, action: e.Action, at: e.Epoch}
+		return ""
+	}
+	delete(p.last, id)
+	// reports from the other node can arrive late, so go by the event times
+	first := s.node
+	if e.Epoch.Before(s.at) {
+		first = node
+	}
+	if first == p.outer {
+		return Approaching
+	}
+	return Departing
+}
+
+func NewPassage(outer, inner uint16, window time.Duration) (*Passage, error) {
+	if outer == inner {
+		return nil, fmt.Errorf("passage needs two sentries, got node %d twice", outer)
+	}
+	if window <= 0 {
+		window = time.Duration(DefaultPassageWindowMs) * time.Millisecond
+	}
+	return &Passage{outer: outer, inner: inner, window: window, last: map[ID]sighting{}}, nil
+}
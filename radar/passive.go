@@ -0,0 +1,278 @@
+package radar
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+const (
+	DefaultPassiveAwayMs = 60000
+
+	passiveSweep = time.Second
+)
+
+// rotating trackers change their address too, so pinning one doesn't keep a
+// stranger's tag of the same kind from matching for long.
+var rotating = []string{"airtag", "smarttag"}
+
+// trackers recognize the advertisements of common item trackers. Their
+// identifiers rotate and can't be resolved without the owner's keys, so a
+// tracker matches any tag of its kind unless its address is pinned.
+var trackers = map[string]func(s Sighting) bool{
+	// Find My: Apple manufacturer data of the offline finding type
+	"airtag": func(s Sighting) bool {
+		d := s.ManufacturerData[0x004c]
+		return len(d) > 0 && d[0] == 0x12
+	},
+	// Tile's own service
+	"tile": func(s Sighting) bool {
+		return s.advertises(uuid128("feed")) || s.advertises(uuid128("feec"))
+	},
+	// Samsung offline finding service
+	"smarttag": func(s Sighting) bool {
+		return s.advertises(uuid128("fd5a"))
+	},
+}
+
+// advertises reports whether a service is listed or carries data.
+func (s Sighting) advertises(uuid string) bool {
+	_, ok := s.ServiceData[uuid]
+	return ok || slices.Contains(s.UUIDs, uuid)
+}
+
+// fingerprint recognizes an actor's device by what it advertises.
+type fingerprint struct {
+	actor   Actor
+	tracker func(Sighting) bool
+	rotates bool // a tracker whose address can't be pinned
+	address string
+	uuids   []string
+	company *uint16
+	data    []byte
+	name    string
+	irk     cipher.Block
+}
+
+// unique reports whether the fingerprint can only match the actor's own
+// device. Services, companies and names are shared by every device of a
+// model, so a stranger's matches as well: such sightings only count as
+// presence and never drive a switch.
+func (f fingerprint) unique() bool {
+	return !f.rotates && (f.irk != nil || f.address != "")
+}
+
+// resolves reports whether a resolvable private address was made from the
+// identity resolving key (Core Specification Vol 3, Part H, 2.2.2): the low
+// 24 bits of the address are the hash of the high 24 under the key.
+func resolves(irk cipher.Block, address string) bool {
+	a, err := hex.DecodeString(strings.ReplaceAll(address, ":", ""))
+	if err != nil || len(a) != 6 || a[0]>>6 != 0b01 {
+		return false
+	}
+	r, hash := make([]byte, aes.BlockSize), make([]byte, aes.BlockSize)
+	copy(r[aes.BlockSize-3:], a[:3])
+	irk.Encrypt(hash, r)
+	return subtle.ConstantTimeCompare(hash[aes.BlockSize-3:], a[3:]) == 1
+}
+
+// uuid128 writes a 16 or 128 bit UUID the way BlueZ reports it.
+func uuid128(u string) string {
+	u = strings.ToLower(u)
+	if len(u) == 4 {
+		return "0000" + u + "-0000-1000-8000-00805f9b34fb"
+	}
+	return u
+}
+
+func (f fingerprint) matches(s Sighting) bool {
+	if f.tracker != nil && !f.tracker(s) {
+		return false
+	}
+	if f.address != "" && !strings.EqualFold(f.address, s.Address) {
+		return false
+	}
+	if f.irk != nil && !resolves(f.irk, s.Address) {
+		return false
+	}
+	for _, u := range f.uuids {
+		if !slices.Contains(s.UUIDs, u) {
+			return false
+		}
+	}
+	if f.name != "" && f.name != s.Name {
+		return false
+	}
+	if f.company == nil && f.data == nil {
+		return true
+	}
+	for company, data := range s.ManufacturerData {
+		if (f.company == nil || *f.company == company) && bytes.HasPrefix(data, f.data) {
+			return true
+		}
+	}
+	return false
+}
+
+// PassiveSentry emits Entering when a known actor's device is heard
+// advertising, and Exiting once it hasn't been for a while. It only listens:
+// devices that refuse connections are recognized all the same.
+type PassiveSentry struct {
+	bluez   *BlueZAdapter
+	devices []fingerprint
+	away    time.Duration
+	minRSSI int16
+
+	duplicates bool // every advertisement is needed, not just one per discovery
+}
+
+func (p *PassiveSentry) String() string {
+	return fmt.Sprintf("PassiveSentry {adapter: %s, devices: %d}", p.bluez.id, len(p.devices))
+}
+
+func (p *PassiveSentry) Search() (chan *Event, error) {
+	response := make(chan *Event, 2*len(p.devices))
+	var lock sync.Mutex
+	heard := map[ID]time.Time{} // actors present, by when last heard
+	emit := func(f fingerprint, action Action, rssi int16) bool {
+		actor := f.actor
+		select {
+		case response <- &Event{Actor: &actor, Action: action, Epoch: time.Now(), Source: "passive", RSSI: rssi, PresenceOnly: !f.unique()}:
+			return true
+		default:
+			log.Radar.DebugMemoize("PassiveSentry: dropped %s of %s", action, actor.DisplayName())
+			return false
+		}
+	}
+	if err := p.bluez.WatchSightings(func(s Sighting) {
+		if p.minRSSI != 0 && s.RSSI < p.minRSSI {
+			return
+		}
+		for _, f := range p.devices {
+			if !f.matches(s) {
+				continue
+			}
+			if !f.actor.Known() {
+				log.Radar.DebugMemoize("PassiveSentry: unknown actor: %v", f.actor)
+				return
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			if _, here := heard[f.actor.ID]; here || emit(f, Entering, s.RSSI) {
+				heard[f.actor.ID] = time.Now()
+			}
+			return
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if len(p.devices) == 0 {
+		return response, nil
+	}
+	if err := p.bluez.StartDiscovery(p.duplicates); err != nil {
+		return nil, err
+	}
+	supervisor.Go("passive sentry", func() {
+		restarted := time.Now()
+		for range time.Tick(passiveSweep) {
+			if !p.duplicates && time.Since(restarted) > p.away/3 {
+				if err := p.bluez.StopDiscovery(); err != nil {
+					log.Error(err.Error())
+				}
+				if err := p.bluez.StartDiscovery(false); err != nil {
+					log.Error(err.Error())
+				}
+				restarted = time.Now()
+			}
+			lock.Lock()
+			for _, f := range p.devices {
+				last, here := heard[f.actor.ID]
+				if here && time.Since(last) > p.away && emit(f, Exiting, 0) {
+					delete(heard, f.actor.ID)
+				}
+			}
+			lock.Unlock()
+		}
+	})
+	return response, nil
+}
+
+func (p *PassiveSentry) Message(payload *Payload) error {
+	return errors.New("passive sentry cannot message actors")
+}
+
+func NewPassiveSentry(c config.Bluetooth) (*PassiveSentry, error) {
+	id := c.Adapter
+	if id == "" {
+		id = DefaultAdapterID
+	}
+	bluez, err := NewBlueZAdapter(id)
+	if err != nil {
+		return nil, err
+	}
+	p := &PassiveSentry{
+		bluez:   bluez,
+		away:    time.Duration(DefaultPassiveAwayMs) * time.Millisecond,
+		minRSSI: int16(c.Passive.MinRSSI),
+		// NOTE: without minRssi or a trend sharing the discovery, only
+		// presence matters: each device is heard once per discovery, and
+		// discovery restarts well within awayMs
+		duplicates: c.Passive.MinRSSI != 0 || c.Trend.Enabled,
+	}
+	if c.Passive.AwayMs > 0 {
+		p.away = time.Duration(c.Passive.AwayMs) * time.Millisecond
+	}
+	for _, d := range c.Passive.Devices {
+		if d.Actor == "" {
+			return nil, fmt.Errorf("passive device fingerprint requires an actor")
+		}
+		f := fingerprint{actor: Actor{ID: ID(d.Actor), Name: FriendlyName(ID(d.Actor))}, address: d.Address, company: d.CompanyID, name: d.Name}
+		if d.Tracker != "" {
+			var ok bool
+			if f.tracker, ok = trackers[strings.ToLower(d.Tracker)]; !ok {
+				return nil, fmt.Errorf("passive device of %s: unknown tracker %q", d.Actor, d.Tracker)
+			}
+			f.rotates = slices.Contains(rotating, strings.ToLower(d.Tracker))
+		}
+		for _, u := range d.ServiceUUIDs {
+			f.uuids = append(f.uuids, uuid128(u))
+		}
+		if d.IRK != "" {
+			key, err := hex.DecodeString(d.IRK)
+			if err != nil || len(key) != aes.BlockSize {
+				return nil, fmt.Errorf("passive device of %s: irk must be 16 bytes of hex", d.Actor)
+			}
+			// NOTE: BlueZ keeps keys least significant byte first
+			slices.Reverse(key)
+			f.irk, _ = aes.NewCipher(key)
+		}
+		if d.ManufacturerData != "" {
+			if f.data, err = hex.DecodeString(d.ManufacturerData); err != nil {
+				return nil, fmt.Errorf("passive device of %s: invalid manufacturer data: %w", d.Actor, err)
+			}
+		}
+		if f.tracker == nil && f.address == "" && f.irk == nil && f.uuids == nil && f.company == nil && f.data == nil && f.name == "" {
+			return nil, fmt.Errorf("passive device of %s matches every advertisement", d.Actor)
+		}
+		if !f.unique() {
+			log.Info("passive device of %s is not unique to it; its sightings won't drive switches", d.Actor)
+		}
+		p.devices = append(p.devices, f)
+	}
+	if len(p.devices) == 0 {
+		return nil, fmt.Errorf("passive sentry requires device fingerprints")
+	}
+	return p, nil
+}
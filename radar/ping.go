@@ -0,0 +1,59 @@
+package radar
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+)
+
+const (
+	DefaultPingIntervalMs = 15000
+	DefaultPingTimeoutMs  = 1000
+	DefaultPingMisses     = 8 // phones sleep their WiFi for minutes at a time
+)
+
+// ping reports whether host answered an ICMP echo within timeout.
+func ping(host string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+time.Second)
+	defer cancel()
+	seconds := fmt.Sprint(max(1, int(timeout.Seconds())))
+	out, err := exec.CommandContext(ctx, "ping", "-n", "-q", "-c", "1", "-W", seconds, host).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ping: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// NewPingSentry finds actors by pinging their devices on the LAN, a fallback
+// without any hardware for devices with a fixed address.
+func NewPingSentry(c config.Ping) (*ProbeSentry, error) {
+	timeout := time.Duration(DefaultPingTimeoutMs) * time.Millisecond
+	if c.TimeoutMs > 0 {
+		timeout = time.Duration(c.TimeoutMs) * time.Millisecond
+	}
+	p := &ProbeSentry{
+		name:     "ping",
+		probe:    func(host string) error { return ping(host, timeout) },
+		interval: time.Duration(DefaultPingIntervalMs) * time.Millisecond,
+		misses:   DefaultPingMisses,
+	}
+	if c.IntervalMs > 0 {
+		p.interval = time.Duration(c.IntervalMs) * time.Millisecond
+	}
+	if c.Misses > 0 {
+		p.misses = c.Misses
+	}
+	for actor, host := range c.Hosts {
+		p.targets = append(p.targets, probed{actor: Actor{ID: ID(actor), Name: FriendlyName(ID(actor))}, target: host})
+	}
+	if len(p.targets) == 0 {
+		return nil, fmt.Errorf("ping sentry requires hosts")
+	}
+	slices.SortFunc(p.targets, func(a, b probed) int { return strings.Compare(string(a.actor.ID), string(b.actor.ID)) })
+	return p, nil
+}
@@ -0,0 +1,231 @@
+package radar
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+	"periph.io/x/conn/v3/spi/spireg"
+	"periph.io/x/host/v3"
+)
+
+const (
+	DefaultPN532Address = 0x24
+
+	pn532HostToPN532 = 0xD4
+	pn532PN532ToHost = 0xD5
+
+	pn532SAMConfiguration      = 0x14
+	pn532RFConfiguration       = 0x32
+	pn532InListPassiveTarget   = 0x4A
+	pn532ReadyTimeout          = time.Duration(500) * time.Millisecond
+	pn532ResponseBufferSize    = 64
+	pn532PassiveActivationMaxR = 0x02 // retries before InListPassiveTarget gives up
+)
+
+var pn532Ack = []byte{0x00, 0x00, 0xFF, 0x00, 0xFF, 0x00}
+
+var errPN532NotReady = errors.New("pn532 not ready")
+
+type pn532Transport interface {
+	write(frame []byte) error
+	ready() (bool, error)
+	read(n int) ([]byte, error)
+}
+
+type pn532I2C struct {
+	dev *i2c.Dev
+}
+
+func (t *pn532I2C) write(frame []byte) error {
+	return t.dev.Tx(frame, nil)
+}
+
+func (t *pn532I2C) ready() (bool, error) {
+	status := make([]byte, 1)
+	if err := t.dev.Tx(nil, status); err != nil {
+		return false, err
+	}
+	return status[0] == 0x01, nil
+}
+
+func (t *pn532I2C) read(n int) ([]byte, error) {
+	// NOTE: every I2C read is prefixed with a status byte
+	r := make([]byte, n+1)
+	if err := t.dev.Tx(nil, r); err != nil {
+		return nil, err
+	}
+	return r[1:], nil
+}
+
+// pn532SPI speaks the PN532's LSB-first SPI framing; bytes are reversed in
+// software since not every SPI controller supports LSB-first transfers.
+type pn532SPI struct {
+	conn spi.Conn
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i, v := range b {
+		r[i] = bits.Reverse8(v)
+	}
+	return r
+}
+
+func (t *pn532SPI) write(frame []byte) error {
+	return t.conn.Tx(reverse(append([]byte{0x01}, frame...)), nil)
+}
+
+func (t *pn532SPI) ready() (bool, error) {
+	r := make([]byte, 2)
+	if err := t.conn.Tx(reverse([]byte{0x02, 0x00}), r); err != nil {
+		return false, err
+	}
+	return bits.Reverse8(r[1]) == 0x01, nil
+}
+
+func (t *pn532SPI) read(n int) ([]byte, error) {
+	w := make([]byte, n+1)
+	w[0] = 0x03
+	r := make([]byte, n+1)
+	if err := t.conn.Tx(reverse(w), r); err != nil {
+		return nil, err
+	}
+	return reverse(r[1:]), nil
+}
+
+// PN532 is a minimal driver for the NXP PN532 NFC controller, enough to read
+// the UID of ISO14443A tags.
+type PN532 struct {
+	transport pn532Transport
+}
+
+func (p *PN532) wait(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		ok, err := p.transport.ready()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		time.Sleep(time.Duration(10) * time.Millisecond)
+	}
+	return errPN532NotReady
+}
+
+func (p *PN532) command(data ...byte) ([]byte, error) {
+	length := byte(len(data) + 1)
+	sum := byte(pn532HostToPN532)
+	for _, b := range data {
+		sum += b
+	}
+	frame := append([]byte{0x00, 0x00, 0xFF, length, ^length + 1, pn532HostToPN532}, data...)
+	frame = append(frame, ^sum+1, 0x00)
+	if err := p.transport.write(frame); err != nil {
+		return nil, fmt.Errorf("pn532: failed to send command %#x: %w", data[0], err)
+	}
+	if err := p.wait(pn532ReadyTimeout); err != nil {
+		return nil, fmt.Errorf("pn532: no ack for command %#x: %w", data[0], err)
+	}
+	ack, err := p.transport.read(len(pn532Ack))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(ack, pn532Ack) {
+		return nil, fmt.Errorf("pn532: invalid ack for command %#x: % x", data[0], ack)
+	}
+	if err := p.wait(pn532ReadyTimeout); err != nil {
+		return nil, err
+	}
+	r, err := p.transport.read(pn532ResponseBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.Index(r, []byte{0x00, 0xFF})
+	if start < 0 || start+4 >= len(r) {
+		return nil, fmt.Errorf("pn532: malformed response: % x", r)
+	}
+	n := int(r[start+2])
+	if r[start+2]+r[start+3] != 0 || start+4+n > len(r) || n < 2 {
+		return nil, fmt.Errorf("pn532: corrupt response length: % x", r)
+	}
+	body := r[start+4 : start+4+n]
+	if body[0] != pn532PN532ToHost || body[1] != data[0]+1 {
+		return nil, fmt.Errorf("pn532: unexpected response to %#x: % x", data[0], body)
+	}
+	return body[2:], nil
+}
+
+// ReadUID polls for a single ISO14443A tag, returning its UID in upper case
+// hex, or an empty string when no tag is in the field.
+func (p *PN532) ReadUID() (string, error) {
+	r, err := p.command(pn532InListPassiveTarget, 0x01, 0x00)
+	if errors.Is(err, errPN532NotReady) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// NbTg, Tg, SENS_RES (2), SEL_RES, NFCIDLength, NFCID...
+	if len(r) < 1 || r[0] == 0 {
+		return "", nil
+	}
+	if len(r) < 6 || len(r) < 6+int(r[5]) {
+		return "", fmt.Errorf("pn532: truncated target: % x", r)
+	}
+	return strings.ToUpper(hex.EncodeToString(r[6 : 6+int(r[5])])), nil
+}
+
+func (p *PN532) init() error {
+	if _, err := p.command(pn532SAMConfiguration, 0x01, 0x14, 0x01); err != nil {
+		return err
+	}
+	_, err := p.command(pn532RFConfiguration, 0x05, 0xFF, 0x01, pn532PassiveActivationMaxR)
+	return err
+}
+
+// NewPN532 opens a PN532 on bus "i2c" or "spi". An empty port selects the
+// first one available.
+func NewPN532(bus string, port string, address uint16) (*PN532, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, fmt.Errorf("host failed to initialize for pn532: %w", err)
+	}
+	p := &PN532{}
+	switch bus {
+	case "", "i2c":
+		b, err := i2creg.Open(port)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open i2c bus %q: %w", port, err)
+		}
+		if address == 0 {
+			address = DefaultPN532Address
+		}
+		p.transport = &pn532I2C{dev: &i2c.Dev{Bus: b, Addr: address}}
+	case "spi":
+		s, err := spireg.Open(port)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open spi port %q: %w", port, err)
+		}
+		c, err := s.Connect(physic.MegaHertz, spi.Mode0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to spi port %q: %w", port, err)
+		}
+		p.transport = &pn532SPI{conn: c}
+	default:
+		return nil, fmt.Errorf("unsupported pn532 bus %q", bus)
+	}
+	if err := p.init(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
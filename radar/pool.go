@@ -0,0 +1,50 @@
+package radar
+
+import (
+	"hash/fnv"
+
+	"github.com/robolivable/beaves/supervisor"
+)
+
+const DefaultWorkerPoolSize = 4
+
+// pool is a fixed set of workers. Tasks are sharded by key so that all work
+// for one device runs in submission order on the same worker.
+type pool struct {
+	shards []chan func()
+}
+
+func (p *pool) shard(key string) chan func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return p.shards[h.Sum32()%uint32(len(p.shards))]
+}
+
+// Submit queues a task for key, reporting false when its worker is saturated.
+func (p *pool) Submit(key string, task func()) bool {
+	select {
+	case p.shard(key) <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+func newPool(workers int, depth int) *pool {
+	if workers <= 0 {
+		workers = DefaultWorkerPoolSize
+	}
+	p := &pool{shards: make([]chan func(), workers)}
+	for i := range p.shards {
+		p.shards[i] = make(chan func(), max(depth, 1))
+		go func(tasks chan func()) {
+			for task := range tasks {
+				func() {
+					defer supervisor.Recover("bluetooth worker task")
+					task()
+				}()
+			}
+		}(p.shards[i])
+	}
+	return p
+}
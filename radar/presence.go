@@ -0,0 +1,123 @@
+package radar
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+)
+
+type PresenceState string
+
+const (
+	Unseen  PresenceState = "unseen"
+	Present PresenceState = "present"
+	Away    PresenceState = "away"
+)
+
+type Presence struct {
+	Actor    ID            `json:"actor"`
+	Name     string        `json:"name"`
+	State    PresenceState `json:"state"`
+	LastSeen time.Time     `json:"lastSeen"`
+	RSSI     int16         `json:"rssi,omitempty"`
+	Source   string        `json:"source"`
+
+	Direction Direction `json:"direction,omitempty"` // of the last event
+}
+
+// PresenceTable is what Beaves currently believes about every actor.
+type PresenceTable struct {
+	entries map[ID]*Presence
+	lock    sync.RWMutex
+}
+
+func (t *PresenceTable) Observe(e *Event) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	p, ok := t.entries[e.Actor.ID]
+	if !ok {
+		p = &Presence{Actor: e.Actor.ID}
+		t.entries[e.Actor.ID] = p
+	}
+	p.Name = e.Actor.Name
+	p.State = Away
+	if e.Action == Entering {
+		p.State = Present
+	}
+	p.LastSeen = e.Epoch
+	p.RSSI = e.RSSI
+	p.Source = e.Source
+	p.Direction = e.Direction
+}
+
+func (t *PresenceTable) Get(id ID) (Presence, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	p, ok := t.entries[id]
+	if !ok {
+		return Presence{}, false
+	}
+	return *p, true
+}
+
+func (t *PresenceTable) Occupancy() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	count := 0
+	for _, p := range t.entries {
+		if p.State == Present {
+			count++
+		}
+	}
+	return count
+}
+
+func (t *PresenceTable) Snapshot() []Presence {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	snapshot := make([]Presence, 0, len(t.entries))
+	for _, p := range t.entries {
+		snapshot = append(snapshot, *p)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Actor < snapshot[j].Actor })
+	return snapshot
+}
+
+// Forget drops what the table holds about an actor, reporting whether there
+// was anything.
+func (t *PresenceTable) Forget(id ID) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for k := range t.entries {
+		if strings.EqualFold(string(k), string(id)) {
+			delete(t.entries, k)
+			return true
+		}
+	}
+	return false
+}
+
+// Restore seeds the table from a persisted snapshot. Entries observed since
+// startup take precedence.
+func (t *PresenceTable) Restore(snapshot []Presence) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, p := range snapshot {
+		if e, ok := t.entries[p.Actor]; ok && e.State != Unseen {
+			continue
+		}
+		restored := p
+		t.entries[p.Actor] = &restored
+	}
+}
+
+func NewPresenceTable() *PresenceTable {
+	t := &PresenceTable{entries: map[ID]*Presence{}}
+	for _, id := range config.RuntimeConfig.Actors.Known {
+		t.entries[ID(id)] = &Presence{Actor: ID(id), Name: id, State: Unseen}
+	}
+	return t
+}
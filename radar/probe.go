@@ -0,0 +1,77 @@
+package radar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/power"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+// probed is an actor and what is probed to find it.
+type probed struct {
+	actor  Actor
+	target string
+}
+
+// ProbeSentry polls whether actors' devices answer a probe, one after
+// another. It emits Entering on the first answer and Exiting after a number
+// of probes in a row went unanswered, so a single lost reply doesn't flap.
+// Devices answering the first round were there before beaves started, so
+// their Entering only counts as presence.
+type ProbeSentry struct {
+	name     string
+	targets  []probed
+	prepare  func() error // when set, called before each round, e.g. to fetch what probes look up
+	probe    func(target string) error
+	interval time.Duration
+	misses   int
+}
+
+func (p *ProbeSentry) String() string {
+	return fmt.Sprintf("ProbeSentry {name: %s, targets: %d, interval: %v}", p.name, len(p.targets), p.interval)
+}
+
+func (p *ProbeSentry) Search() (chan *Event, error) {
+	response := make(chan *Event, len(p.targets))
+	supervisor.Go(p.name+" sentry", func() {
+		here := map[ID]bool{}
+		missed := map[ID]int{}
+		seeded := false
+		for ; ; time.Sleep(power.Poll(p.interval)) {
+			if p.prepare != nil {
+				if err := p.prepare(); err != nil {
+					log.Radar.DebugMemoize("%s: %s", p.name, err.Error())
+					continue
+				}
+			}
+			for _, t := range p.targets {
+				if !t.actor.Known() {
+					log.Radar.DebugMemoize("%s: unknown actor: %v", p.name, t.actor)
+					continue
+				}
+				err := p.probe(t.target)
+				if err != nil {
+					log.Radar.DebugMemoize("%s: %s: %s", p.name, t.target, err.Error())
+					if missed[t.actor.ID]++; !here[t.actor.ID] || missed[t.actor.ID] < p.misses {
+						continue
+					}
+				}
+				missed[t.actor.ID] = 0
+				if here[t.actor.ID] == (err == nil) {
+					continue
+				}
+				here[t.actor.ID] = err == nil
+				actor := t.actor
+				response <- &Event{Actor: &actor, Action: GetAction(err == nil), Epoch: time.Now(), Source: p.name, PresenceOnly: !seeded}
+			}
+			seeded = true
+		}
+	})
+	return response, nil
+}
+
+func (p *ProbeSentry) Message(payload *Payload) error {
+	return fmt.Errorf("%s sentry cannot message actors", p.name)
+}
@@ -0,0 +1,87 @@
+package radar
+
+import (
+	"fmt"
+	"sync"
+
+	"tinygo.org/x/bluetooth"
+)
+
+const (
+	ProvisionServiceID = "6b1e0001-5a3c-4f0e-9d2b-be4e5e500001"
+	ProvisionWriteID   = "6b1e0002-5a3c-4f0e-9d2b-be4e5e500001" // sealed chunks from the phone
+	ProvisionStatusID  = "6b1e0003-5a3c-4f0e-9d2b-be4e5e500001" // progress, readable and notified
+	ProvisionNonceID   = "6b1e0004-5a3c-4f0e-9d2b-be4e5e500001" // nonce the provisioning must carry
+)
+
+var provisionLabel = []byte("beaves-provision-2")
+
+// Provisioner serves a GATT service through which a phone can hand a device
+// without configuration its first config, sealed with the printed setup code.
+type Provisioner struct {
+	adapter *BlueZAdapter
+	code    string
+}
+
+func (p *Provisioner) String() string {
+	return fmt.Sprintf("Provisioner {adapter: %s}", p.adapter.id)
+}
+
+func (p *Provisioner) Code() string {
+	return p.code
+}
+
+// Run advertises the provisioning service as name and hands every message
+// opened with the setup code to accept, until it accepts one.
+func (p *Provisioner) Run(name string, accept func([]byte) error) error {
+	if err := p.adapter.SetProperty("Powered", true); err != nil {
+		return err
+	}
+	sealed, err := NewSealed(CodeKey(p.code, provisionLabel), provisionLabel, DefaultSealedMaxLength)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	ids := [4]string{ProvisionServiceID, ProvisionWriteID, ProvisionStatusID, ProvisionNonceID}
+	_, err = ServeSealed(p.adapter, "provisioning", ids, sealed, func(message []byte) error {
+		if err := accept(message); err != nil {
+			return err
+		}
+		once.Do(func() { close(done) })
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	serviceUUID, _ := bluetooth.ParseUUID(ProvisionServiceID)
+	advertisement := p.adapter.NewAdvertisement()
+	err = advertisement.Configure(AdvertisementOptions{
+		AdvertisementOptions: bluetooth.AdvertisementOptions{
+			LocalName:         name,
+			AdvertisementType: bluetooth.AdvertisingTypeInd,
+			ServiceUUIDs:      []bluetooth.UUID{serviceUUID},
+		},
+		Connectable: true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := advertisement.Start(); err != nil {
+		return err
+	}
+	<-done
+	return advertisement.Stop()
+}
+
+func NewProvisioner() (*Provisioner, error) {
+	bluez, err := NewBlueZAdapter(DefaultAdapterID)
+	if err != nil {
+		return nil, err
+	}
+	code, err := SetupCode()
+	if err != nil {
+		return nil, err
+	}
+	return &Provisioner{adapter: bluez, code: code}, nil
+}
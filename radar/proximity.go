@@ -1,20 +1,71 @@
 package radar
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/godbus/dbus/v5"
 	"github.com/robolivable/beaves/config"
 	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/power"
+	"github.com/robolivable/beaves/supervisor"
 	"tinygo.org/x/bluetooth"
 )
 
 type ID string
 
 type Actor struct {
-	ID   ID
-	Name string
+	ID   ID     `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// FriendlyName is the name configured for an actor ID while pseudonymizing
+// is on, or the ID itself.
+func FriendlyName(id ID) string {
+	if !config.RuntimeConfig.Privacy.Pseudonymize {
+		return string(id)
+	}
+	for k, name := range config.RuntimeConfig.Actors.Names {
+		if strings.EqualFold(k, string(id)) {
+			return name
+		}
+	}
+	return string(id)
+}
+
+// DisplayName is the actor's name, falling back to its ID.
+func (a *Actor) DisplayName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return string(a.ID)
+}
+
+var (
+	guests     []string
+	guestsLock sync.RWMutex
+)
+
+// SetGuests replaces the actors that are known temporarily, on top of those
+// configured.
+func SetGuests(ids []string) {
+	guestsLock.Lock()
+	defer guestsLock.Unlock()
+	guests = ids
+}
+
+// tracking reports whether any actor is known, configured or as a guest.
+func tracking() bool {
+	if len(config.RuntimeConfig.Actors.Known) > 0 {
+		return true
+	}
+	guestsLock.RLock()
+	defer guestsLock.RUnlock()
+	return len(guests) > 0
 }
 
 func (a *Actor) Known() bool {
@@ -23,6 +74,13 @@ func (a *Actor) Known() bool {
 			return true
 		}
 	}
+	guestsLock.RLock()
+	defer guestsLock.RUnlock()
+	for _, id := range guests {
+		if strings.EqualFold(string(a.ID), id) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -40,6 +98,22 @@ func (a Action) String() string {
 	return "Exiting"
 }
 
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Action) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "entering":
+		*a = Entering
+	case "exiting":
+		*a = Exiting
+	default:
+		return fmt.Errorf("unknown action %q", text)
+	}
+	return nil
+}
+
 func GetAction(connected bool) Action {
 	if connected {
 		return Entering
@@ -48,15 +122,22 @@ func GetAction(connected bool) Action {
 }
 
 type Event struct {
-	Actor *Actor
+	Actor *Actor `json:"actor"`
 
-	Action Action
+	Action Action `json:"action"`
 
-	Epoch time.Time
+	Epoch time.Time `json:"epoch"`
+
+	Source    string    `json:"source,omitempty"`    // sentry that observed the event
+	RSSI      int16     `json:"rssi,omitempty"`      // signal strength, when the source reports one
+	Direction Direction `json:"direction,omitempty"` // which way the actor was moving, when known
+	Sensed    time.Time `json:"sensed,omitzero"`     // when the actor's device was first heard, if before Epoch
+
+	PresenceOnly bool `json:"presenceOnly,omitempty"` // too weak a sign of the actor to drive a switch
 }
 
 func (e *Event) String() string {
-	return fmt.Sprintf("Event {actor: %+v, action: %+v, epoch: %+v}", e.Actor, e.Action.String(), e.Epoch)
+	return fmt.Sprintf("Event {actor: %+v, action: %+v, epoch: %+v, source: %s}", e.Actor, e.Action.String(), e.Epoch, e.Source)
 }
 
 type Payload struct {
@@ -75,73 +156,379 @@ type BTSentry struct {
 	adapter                    *bluetooth.Adapter
 	advertisementName          string
 	advertisementDelayMs       int
+	advertisementPauseMs       int
+	occupied                   config.Occupied // pause while actors are home
+	advertisementIntervalMs    int
+	continuousAdvertising      bool
 	connectionPoolSize         int
+	reserved                   []string     // actors the last connection pool slot is kept for
+	pending                    atomic.Int32 // events handed to workers, not yet queued
 	serviceUUID                bluetooth.UUID
 	indicateCharacteristicUUID bluetooth.UUID
 	indicateCharacteristic     *bluetooth.Characteristic
 
 	disconnectionLimitDelayMs int
+
+	workers *pool
+
+	nodeID    uint16
+	companyID uint16
+
+	status func() Status
+
+	bluez         *BlueZAdapter
+	alias         string
+	originalAlias string
+
+	txPower *int16
+
+	trend *Trend // signal strength of known actors, when watched
+
+	frames []frame // advertised in turn after the presence advertisement
+}
+
+// ProtocolVersion is broadcast in manufacturer data so companion apps can tell
+// which payload layouts a node understands.
+const ProtocolVersion = 1
+
+// responseTimeout is how long a worker waits for an event to be taken.
+const responseTimeout = time.Second
+
+// discoveryCheck is how often discovery follows actors becoming known or
+// forgotten.
+const discoveryCheck = 30 * time.Second
+
+// DefaultCompanyID is the Bluetooth SIG identifier reserved for testing.
+const DefaultCompanyID = 0xFFFF
+
+// Status is the house state broadcast in service data for passive readers.
+type Status struct {
+	RelayOn   bool
+	Occupancy int
+}
+
+// Encode packs the status as [flags, occupancy]; bit 0 of flags is the relay.
+func (s Status) Encode() []byte {
+	var flags byte
+	if s.RelayOn {
+		flags |= 1
+	}
+	return []byte{flags, byte(min(s.Occupancy, 255))}
+}
+
+// SetStatus registers the source of the status broadcast in service data. It
+// is sampled every time the advertisement is reconfigured.
+func (bts *BTSentry) SetStatus(status func() Status) {
+	bts.status = status
+}
+
+func (bts *BTSentry) advertisementOptions() AdvertisementOptions {
+	options := AdvertisementOptions{
+		AdvertisementOptions: bluetooth.AdvertisementOptions{
+			LocalName:         bts.advertisementName,
+			AdvertisementType: bluetooth.AdvertisingTypeInd,
+			ManufacturerData: []bluetooth.ManufacturerDataElement{{
+				CompanyID: bts.companyID,
+				Data:      []byte{ProtocolVersion, byte(bts.nodeID >> 8), byte(bts.nodeID)},
+			}},
+		},
+		TxPower:     bts.txPower,
+		Connectable: true, // phones connect to register presence
+	}
+	if bts.advertisementIntervalMs > 0 {
+		options.Interval = bluetooth.NewDuration(time.Duration(bts.advertisementIntervalMs) * time.Millisecond)
+	}
+	if bts.serviceUUID != (bluetooth.UUID{}) {
+		options.ServiceUUIDs = []bluetooth.UUID{bts.serviceUUID}
+		if bts.status != nil {
+			options.ServiceData = []bluetooth.ServiceDataElement{{
+				UUID: bts.serviceUUID,
+				Data: bts.status().Encode(),
+			}}
+		}
+	}
+	return options
+}
+
+// Reconcile seeds presence with the known devices BlueZ already has
+// connected, or has heard in a running discovery, when the sentry starts.
+// They connected before Search watched for connections, so they'd otherwise
+// count as absent until they reconnect. Nothing is switched.
+func (bts *BTSentry) Reconcile(presence *PresenceTable) error {
+	devices, err := bts.bluez.Devices()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, d := range devices {
+		actor := Actor{ID: ID(d.Address), Name: FriendlyName(ID(d.Address))}
+		if !actor.Known() || (!d.Connected && d.RSSI == 0) {
+			continue
+		}
+		log.Info("%s is present at startup {connected: %t, rssi: %d}", actor.DisplayName(), d.Connected, d.RSSI)
+		presence.Observe(&Event{Actor: &actor, Action: Entering, Epoch: now, Source: bts.advertisementName, RSSI: d.RSSI})
+	}
+	return nil
 }
 
 func (bts *BTSentry) Search() (chan *Event, error) {
 	response := make(chan *Event, bts.connectionPoolSize)
-	bts.adapter.SetConnectHandler(func(device bluetooth.Device, connected bool) {
-		log.DebugMemoize("new connection {device: %+v, connected: %t}", device, connected)
-		if len(response) == bts.connectionPoolSize {
+	if err := bts.bluez.WatchConnections(func(device Device, connected bool) {
+		log.Bluetooth.DebugMemoize("new connection {device: %+v, connected: %t}", device, connected)
+		path := device.obj.Path()
+		key := device.Address
+		actor := Actor{
+			ID:   ID(key),
+			Name: FriendlyName(ID(key)),
+		}
+		if bts.full(&actor, len(response)+int(bts.pending.Load())) {
 			// NOTE: this is a DDoS guard
+			bts.bluez.Trace.Add(path, "dropped", "event queue full")
 			time.Sleep(time.Duration(100) * time.Millisecond)
 			device.Disconnect()
 			return
 		}
-		actor := Actor{
-			ID:   ID(device.Address.String()),
-			Name: device.Address.String(),
-		}
 		if !actor.Known() {
-			log.DebugMemoize("unknown actor: %v", actor)
-			go func() {
-				time.Sleep(time.Duration(bts.disconnectionLimitDelayMs) * time.Millisecond)
-				device.Disconnect()
-			}()
+			log.Bluetooth.DebugMemoize("unknown actor: %v", actor)
+			bts.bluez.Trace.Add(path, "ignored", "unknown actor "+key)
+			time.AfterFunc(time.Duration(bts.disconnectionLimitDelayMs)*time.Millisecond, func() {
+				if !bts.workers.Submit(key, func() { device.Disconnect() }) {
+					log.Bluetooth.DebugMemoize("worker saturated; disconnecting %s inline", key)
+					device.Disconnect()
+				}
+			})
+			return
+		}
+		now := time.Now()
+		rssi, ok := bts.trend.Latest(actor.ID, now)
+		if !ok && connected {
+			rssi = device.RSSI()
+		}
+		event := &Event{
+			Actor:     &actor,
+			Action:    GetAction(connected),
+			Epoch:     now,
+			Source:    bts.advertisementName,
+			RSSI:      rssi,
+			Direction: bts.trend.Direction(actor.ID, now),
+		}
+		if first, ok := bts.trend.First(actor.ID, now); ok && connected {
+			// NOTE: its advertisements were scanned before it connected
+			event.Sensed = first
+		}
+		bts.pending.Add(1)
+		if !bts.workers.Submit(key, func() { bts.respond(response, event, path); bts.pending.Add(-1) }) {
+			bts.pending.Add(-1)
+			log.Bluetooth.DebugMemoize("worker saturated; dropping %s", event.String())
+			bts.bluez.Trace.Add(path, "dropped", "worker saturated")
 			return
 		}
-		go func() {
-			response <- &Event{
-				Actor:  &actor,
-				Action: GetAction(connected),
-				Epoch:  time.Now(),
+		bts.bluez.Trace.Add(path, "event", event.Action.String())
+	}); err != nil {
+		return nil, err
+	}
+	if bts.trend != nil {
+		if err := bts.bluez.WatchRSSI(func(address string, rssi int16) {
+			actor := Actor{ID: ID(address)}
+			if actor.Known() {
+				bts.trend.Observe(actor.ID, rssi, time.Now())
 			}
-		}()
-	})
-	advertisement := bts.adapter.DefaultAdvertisement()
+		}); err != nil {
+			return nil, err
+		}
+		supervisor.Go("discovery", bts.discover)
+	}
+	adapterEvents, err := bts.bluez.WatchAdapter()
+	if err != nil {
+		return nil, err
+	}
+	advertisement := bts.bluez.NewAdvertisement()
 	go func() {
 		defer func() {
-			log.Debug("closing response channel")
+			log.Bluetooth.Debug("closing response channel")
 			close(response)
 		}()
-		for {
-			if err := advertisement.Configure(bluetooth.AdvertisementOptions{
-				LocalName:         bts.advertisementName,
-				AdvertisementType: bluetooth.AdvertisingTypeInd,
-			}); err != nil {
-				log.Error(err.Error())
-				return
+		supervisor.Run("advertising", func() {
+			if advertisement.started {
+				// NOTE: left registered by a panic in the previous run
+				advertisement.Stop()
 			}
-			log.Debug("configured %s", bts.advertisementName)
-			if err := advertisement.Start(); err != nil {
+			for {
+				err := bts.advertise(advertisement, adapterEvents)
+				if err == nil {
+					continue
+				}
+				if !errors.Is(err, errAdapterRemoved) && bts.bluez.Present() {
+					log.Error(err.Error())
+					return
+				}
+				log.Error("adapter %s is gone; suspending until it returns", bts.bluez.id)
+				advertisement.Reset()
+				for present := range adapterEvents {
+					if present {
+						break
+					}
+				}
+				if err := bts.attach(); err != nil {
+					log.Error(err.Error())
+					return
+				}
+				log.Info("adapter %s is back; resuming", bts.bluez.id)
+			}
+		})
+	}()
+	return response, nil
+}
+
+var errAdapterRemoved = errors.New("adapter removed")
+
+// respond hands an event on, dropping it if nothing takes it within
+// responseTimeout so the worker's other devices aren't held up.
+func (bts *BTSentry) respond(response chan *Event, event *Event, path dbus.ObjectPath) {
+	timeout := time.NewTimer(responseTimeout)
+	defer timeout.Stop()
+	select {
+	case response <- event:
+	case <-timeout.C:
+		log.Bluetooth.DebugMemoize("response blocked; dropping %s", event.String())
+		bts.bluez.Trace.Add(path, "dropped", "response blocked")
+	}
+}
+
+// discover keeps discovery running while there are actors to track, so the
+// adapter doesn't flood the bus with advertisements nobody reads. It is
+// started again every check, in case the adapter came back without it.
+func (bts *BTSentry) discover() {
+	discovering := false
+	for ; ; time.Sleep(discoveryCheck) {
+		if tracking() {
+			if err := bts.bluez.StartDiscovery(true); err != nil {
 				log.Error(err.Error())
-				return
+				continue
 			}
-			log.Debug("advertising %s", bts.advertisementName)
-			time.Sleep(time.Duration(bts.advertisementDelayMs) * time.Millisecond)
-			if err := advertisement.Stop(); err != nil {
+			discovering = true
+		} else if discovering {
+			if err := bts.bluez.StopDiscovery(); err != nil {
 				log.Error(err.Error())
-				return
+				continue
 			}
-			log.Debug("stopped advertising %s", bts.advertisementName)
+			discovering = false
 		}
-	}()
-	return response, nil
+	}
+}
+
+func (bts *BTSentry) advertise(advertisement *Advertisement, adapterEvents chan bool) error {
+	if err := advertisement.Configure(bts.advertisementOptions()); err != nil {
+		return err
+	}
+	log.Bluetooth.Debug("configured %s", bts.advertisementName)
+	if err := advertisement.Start(); err != nil {
+		return err
+	}
+	log.Bluetooth.Debug("advertising %s", bts.advertisementName)
+	var cycle <-chan time.Time
+	if !bts.continuousAdvertising {
+		cycle = time.After(time.Duration(bts.advertisementDelayMs) * time.Millisecond)
+	}
+	if err := hold(cycle, adapterEvents); err != nil {
+		return err
+	}
+	if err := advertisement.Stop(); err != nil {
+		return err
+	}
+	log.Bluetooth.Debug("stopped advertising %s", bts.advertisementName)
+	for _, f := range bts.frames {
+		if err := advertisement.Configure(f.options); err != nil {
+			return err
+		}
+		if err := advertisement.Start(); err != nil {
+			return err
+		}
+		log.Bluetooth.Debug("advertising %s", f.name)
+		if err := hold(time.After(f.duration), adapterEvents); err != nil {
+			return err
+		}
+		if err := advertisement.Stop(); err != nil {
+			return err
+		}
+	}
+	bts.rest()
+	return nil
+}
+
+// hold waits for the end of an advertisement, or the adapter going away.
+func hold(end <-chan time.Time, adapterEvents chan bool) error {
+	for {
+		select {
+		case present := <-adapterEvents:
+			if present {
+				continue
+			}
+			return errAdapterRemoved
+		case <-end:
+			return nil
+		}
+	}
+}
+
+// pause is how long to stay silent between cycles: advertisementPauseMs, or
+// the occupied pause while enough actors are present, where a negative one
+// holds advertising off.
+func (bts *BTSentry) pause() time.Duration {
+	pause := bts.advertisementPauseMs
+	if bts.occupied.MinPresent > 0 && bts.status != nil && bts.status().Occupancy >= bts.occupied.MinPresent {
+		pause = bts.occupied.PauseMs
+	}
+	return power.AdvertisingPause(time.Duration(pause) * time.Millisecond)
+}
+
+// rest stays silent for the pause, checking occupancy every second so a long
+// pause ends as soon as the house empties.
+func (bts *BTSentry) rest() {
+	start := time.Now()
+	for {
+		pause := bts.pause()
+		left := pause - time.Since(start)
+		if pause >= 0 && left <= 0 {
+			return
+		}
+		if pause < 0 || left > time.Second {
+			left = time.Second
+		}
+		time.Sleep(left)
+	}
+}
+
+// full reports whether the connection pool has no room for an actor's event,
+// given how many are queued. Unless the actor is reserved a slot, the last
+// one is kept for those that are, so guests filling the pool can't lock out
+// the homeowner's phone.
+func (bts *BTSentry) full(actor *Actor, queued int) bool {
+	limit := bts.connectionPoolSize
+	if len(bts.reserved) > 0 && limit > 1 && !bts.reserves(actor) {
+		limit--
+	}
+	return queued >= limit
+}
+
+func (bts *BTSentry) reserves(actor *Actor) bool {
+	for _, id := range bts.reserved {
+		if strings.EqualFold(id, string(actor.ID)) || strings.EqualFold(id, actor.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// attach prepares an adapter that (re)appeared for advertising.
+func (bts *BTSentry) attach() error {
+	if err := bts.bluez.SetProperty("Powered", true); err != nil {
+		return err
+	}
+	if bts.alias != "" {
+		return bts.bluez.SetAlias(bts.alias)
+	}
+	return nil
 }
 
 func (bts *BTSentry) Message(payload *Payload) error {
@@ -152,21 +539,100 @@ func (bts *BTSentry) Message(payload *Payload) error {
 	return nil
 }
 
+// Trend is the signal strength of known actors, nil unless watched.
+func (bts *BTSentry) Trend() *Trend {
+	return bts.trend
+}
+
+func (bts *BTSentry) Adapter() *BlueZAdapter {
+	return bts.bluez
+}
+
+// Close restores the adapter to how it was found.
+func (bts *BTSentry) Close() error {
+	if bts.alias == "" {
+		return nil
+	}
+	log.Bluetooth.Debug("restoring adapter alias %q", bts.originalAlias)
+	return bts.bluez.SetAlias(bts.originalAlias)
+}
+
 func NewBTSentry(config config.Bluetooth) (*BTSentry, error) {
-	serviceUUID, _ := bluetooth.ParseUUID(config.ServiceID)
+	var serviceUUID bluetooth.UUID
+	if config.ServiceID != "" {
+		var err error
+		if serviceUUID, err = bluetooth.ParseUUID(config.ServiceID); err != nil {
+			return nil, fmt.Errorf("invalid service id %q: %w", config.ServiceID, err)
+		}
+	}
 	characteristicUUID, _ := bluetooth.ParseUUID(config.IndicateCharacteristicID)
+	companyID := config.CompanyID
+	if companyID == 0 {
+		companyID = DefaultCompanyID
+	}
+	id := config.Adapter
+	if id == "" {
+		id = DefaultAdapterID
+	}
 	adapter := bluetooth.DefaultAdapter
+	if id != DefaultAdapterID {
+		adapter = bluetooth.NewAdapter(id)
+	}
 	if err := adapter.Enable(); err != nil {
 		return nil, err
 	}
+	bluez, err := NewBlueZAdapter(id)
+	if err != nil {
+		return nil, err
+	}
+	if config.Trace.Enabled {
+		bluez.Trace = NewBTTrace(config.Trace.Size)
+	}
+	originalAlias, err := bluez.Alias()
+	if err != nil {
+		return nil, err
+	}
+	if config.AdapterAlias != "" {
+		if err := bluez.SetAlias(config.AdapterAlias); err != nil {
+			return nil, err
+		}
+	}
+	var txPower *int16
+	if config.TxPowerDbm != nil {
+		if txPower, err = bluez.ClampTxPower(int16(*config.TxPowerDbm)); err != nil {
+			log.Error("ignoring tx power: %s", err.Error())
+		}
+	}
+	frames, err := newFrames(config.Frames)
+	if err != nil {
+		return nil, err
+	}
+	var trend *Trend
+	if config.Trend.Enabled {
+		trend = NewTrend(time.Duration(config.Trend.WindowMs)*time.Millisecond, config.Trend.MinSlope)
+	}
 	return &BTSentry{
 		adapter:                    adapter,
 		advertisementName:          config.AdvertisementName,
 		advertisementDelayMs:       config.AdvertisementDelayMs,
+		advertisementPauseMs:       config.AdvertisementPauseMs,
+		occupied:                   config.Occupied,
+		advertisementIntervalMs:    config.AdvertisementIntervalMs,
+		continuousAdvertising:      config.ContinuousAdvertising,
 		connectionPoolSize:         config.ConnectionPoolSize,
+		reserved:                   config.Reserved,
 		serviceUUID:                serviceUUID,
 		indicateCharacteristicUUID: characteristicUUID,
 		indicateCharacteristic:     &bluetooth.Characteristic{},
 		disconnectionLimitDelayMs:  config.DisconnectionDelayMs,
+		workers:                    newPool(config.WorkerPoolSize, config.ConnectionPoolSize),
+		nodeID:                     config.NodeID,
+		companyID:                  companyID,
+		bluez:                      bluez,
+		alias:                      config.AdapterAlias,
+		originalAlias:              originalAlias,
+		txPower:                    txPower,
+		trend:                      trend,
+		frames:                     frames,
 	}, nil
 }
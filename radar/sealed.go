@@ -0,0 +1,231 @@
+package radar
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/robolivable/beaves/log"
+	"tinygo.org/x/bluetooth"
+)
+
+const (
+	DefaultSealedMaxLength = 64 * 1024
+
+	sealedFinal = 0x01 // flag of the last chunk of a sealed message
+)
+
+// SetupCode makes a random code to print for the installer, carrying 80 bits
+// so that sealed messages can't be opened by guessing it.
+func SetupCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to make setup code: %w", err)
+	}
+	s := base32.StdEncoding.EncodeToString(b)
+	return strings.Join([]string{s[0:4], s[4:8], s[8:12], s[12:16]}, "-"), nil
+}
+
+// chunks reassembles the messages phones write in chunks, each phone's on
+// its own so one can't corrupt or stall another's. Each chunk starts with a
+// flags byte; the last one has sealedFinal set. A message left unfinished
+// for chunksIdle is dropped.
+type chunks struct {
+	max     int
+	buffers map[dbus.ObjectPath]*chunkBuffer
+	lock    sync.Mutex
+}
+
+type chunkBuffer struct {
+	data    []byte
+	written time.Time
+}
+
+const chunksIdle = time.Minute
+
+// Write adds a chunk from device, returning its message once the last
+// arrives.
+func (c *chunks) Write(device dbus.ObjectPath, chunk []byte) ([]byte, bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	for d, b := range c.buffers {
+		if now.Sub(b.written) > chunksIdle {
+			delete(c.buffers, d)
+		}
+	}
+	if len(chunk) == 0 {
+		return nil, false, fmt.Errorf("empty chunk")
+	}
+	b, ok := c.buffers[device]
+	if !ok {
+		b = &chunkBuffer{}
+		c.buffers[device] = b
+	}
+	b.data, b.written = append(b.data, chunk[1:]...), now
+	if len(b.data) > c.max {
+		delete(c.buffers, device)
+		return nil, false, fmt.Errorf("message longer than %d bytes", c.max)
+	}
+	if chunk[0]&sealedFinal == 0 {
+		return nil, false, nil
+	}
+	delete(c.buffers, device)
+	return b.data, true, nil
+}
+
+// Sealed opens messages sealed with a key derived from a shared code. A whole
+// message is a 12 byte nonce followed by AES-256-GCM ciphertext, with the
+// label and the server's nonce as additional data.
+type Sealed struct {
+	aead  cipher.AEAD
+	label []byte
+	max   int
+}
+
+func (s *Sealed) String() string {
+	return fmt.Sprintf("Sealed {label: %s}", s.label)
+}
+
+// Open opens a whole message bound to nonce.
+func (s *Sealed) Open(nonce []byte, message []byte) ([]byte, error) {
+	n := s.aead.NonceSize()
+	if len(message) < n {
+		return nil, fmt.Errorf("message too short")
+	}
+	plain, err := s.aead.Open(nil, message[:n], message[n:], append(append([]byte{}, s.label...), nonce...))
+	if err != nil {
+		return nil, fmt.Errorf("%w: message does not match the code", ErrBadProof)
+	}
+	return plain, nil
+}
+
+// CodeKey derives the key of messages sealed with a setup code under label.
+func CodeKey(code string, label []byte) []byte {
+	key := sha256.Sum256(append(append([]byte{}, label...), strings.ToUpper(strings.ReplaceAll(code, "-", ""))...))
+	return key[:]
+}
+
+// NewSealed opens messages sealed with key under label, which leads the
+// additional data of every message.
+func NewSealed(key []byte, label []byte, max int) (*Sealed, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealed{aead: aead, label: label, max: max}, nil
+}
+
+// SealedService is a GATT service taking messages on one characteristic and
+// reporting on another: "ok" once a message is accepted, or why it was
+// refused. Every message starts with the nonce the writing device last read
+// from a third, and is refused unless that nonce is fresh and unused. The
+// nonce is only spent once the message proves itself, so writes that don't
+// can't burn it.
+type SealedService struct {
+	name   string
+	chunks chunks
+	nonces *Nonces
+	open   func(nonce []byte, message []byte) ([]byte, error)
+	accept func(nonce []byte, message []byte, spend func() error) error
+	status *GATTCharacteristic
+}
+
+func (ss *SealedService) String() string {
+	return fmt.Sprintf("SealedService {name: %s}", ss.name)
+}
+
+func (ss *SealedService) report(status string) {
+	if err := ss.status.Notify([]byte(status)); err != nil {
+		log.Bluetooth.Debug("SealedService: %s: failed to report %q: %s", ss.name, status, err.Error())
+	}
+}
+
+// refuse counts and reports a message that was refused.
+func (ss *SealedService) refuse(err error) {
+	reject(ss.name, err)
+	log.Info("%s: refused: %s", ss.name, err.Error())
+	ss.report("error: " + err.Error())
+}
+
+func (ss *SealedService) write(device dbus.ObjectPath, value []byte) {
+	message, complete, err := ss.chunks.Write(device, value)
+	if err != nil {
+		ss.refuse(fmt.Errorf("%w: %w", ErrMalformed, err))
+		return
+	}
+	if !complete {
+		return
+	}
+	if len(message) < NonceSize {
+		ss.refuse(fmt.Errorf("%w: message too short", ErrMalformed))
+		return
+	}
+	nonce, message := message[:NonceSize], message[NonceSize:]
+	if err := ss.nonces.Check(device, nonce); err != nil {
+		ss.refuse(err)
+		return
+	}
+	spend := func() error { return ss.nonces.Spend(device, nonce) }
+	if ss.open != nil {
+		if message, err = ss.open(nonce, message); err != nil {
+			ss.refuse(err)
+			return
+		}
+		if err := spend(); err != nil {
+			ss.refuse(err)
+			return
+		}
+		spend = func() error { return nil }
+	}
+	if err := ss.accept(nonce, message, spend); err != nil {
+		ss.refuse(err)
+		return
+	}
+	ss.report("ok")
+}
+
+// ServeSealed adds a GATT service with the given service, write, status and
+// nonce characteristic UUIDs, handing every message opened by sealed to
+// accept.
+func ServeSealed(adapter *BlueZAdapter, name string, ids [4]string, sealed *Sealed, accept func([]byte) error) (*SealedService, error) {
+	return serve(adapter, name, ids, sealed.max, sealed.Open, func(_ []byte, message []byte, _ func() error) error { return accept(message) })
+}
+
+// serve adds a GATT service handing every message to accept, which must call
+// spend once the message proved itself unless open already did.
+func serve(adapter *BlueZAdapter, name string, ids [4]string, max int, open func([]byte, []byte) ([]byte, error), accept func([]byte, []byte, func() error) error) (*SealedService, error) {
+	uuids := [4]bluetooth.UUID{}
+	for i, id := range ids {
+		uuid, err := bluetooth.ParseUUID(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s uuid %q: %w", name, id, err)
+		}
+		uuids[i] = uuid
+	}
+	ss := &SealedService{name: name, chunks: chunks{max: max, buffers: map[dbus.ObjectPath]*chunkBuffer{}}, open: open, accept: accept}
+	ss.nonces = newNonces(name)
+	ss.status = &GATTCharacteristic{UUID: uuids[2], Flags: []string{"read", "notify"}, Value: []byte("waiting")}
+	ss.nonces.characteristic = &GATTCharacteristic{UUID: uuids[3], Flags: []string{"read"}, OnRead: ss.nonces.Issue}
+	err := adapter.AddService(uuids[0],
+		&GATTCharacteristic{UUID: uuids[1], Flags: []string{"write"}, OnWrite: ss.write},
+		ss.status,
+		ss.nonces.characteristic,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add %s service: %w", name, err)
+	}
+	ss.nonces.Start()
+	return ss, nil
+}
@@ -0,0 +1,87 @@
+package radar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Seen is when an actor's device was last detected.
+type Seen struct {
+	Actor    ID        `json:"actor"`
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// SeenTable is when each actor's device was last detected, by any sentry of
+// any zone. Unlike presence, it only ever moves forward.
+type SeenTable struct {
+	seen map[ID]time.Time
+	lock sync.Mutex
+}
+
+func (s *SeenTable) String() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return fmt.Sprintf("SeenTable {actors: %d}", len(s.seen))
+}
+
+// See records that an actor was detected at a time, unless it was since.
+func (s *SeenTable) See(id ID, at time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if last, ok := s.seen[id]; ok && !at.After(last) {
+		return
+	}
+	s.seen[id] = at
+}
+
+// Get returns when an actor was last seen, however its ID is cased.
+func (s *SeenTable) Get(id ID) (time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for k, at := range s.seen {
+		if strings.EqualFold(string(k), string(id)) {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Snapshot lists every actor ever seen, by ID.
+func (s *SeenTable) Snapshot() []Seen {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	snapshot := make([]Seen, 0, len(s.seen))
+	for id, at := range s.seen {
+		snapshot = append(snapshot, Seen{Actor: id, Name: FriendlyName(id), LastSeen: at})
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Actor < snapshot[j].Actor })
+	return snapshot
+}
+
+// Forget drops when an actor was seen, reporting whether there was one.
+func (s *SeenTable) Forget(id ID) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for k := range s.seen {
+		if strings.EqualFold(string(k), string(id)) {
+			delete(s.seen, k)
+			return true
+		}
+	}
+	return false
+}
+
+// Restore seeds the table from a persisted snapshot, keeping later times.
+func (s *SeenTable) Restore(snapshot []Seen) {
+	for _, seen := range snapshot {
+		s.See(seen.Actor, seen.LastSeen)
+	}
+}
+
+func NewSeenTable() *SeenTable {
+	return &SeenTable{seen: map[ID]time.Time{}}
+}
@@ -0,0 +1,68 @@
+package radar
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Trace replays recorded events at once, without waiting between them, and
+// keeps the time they were recorded at. Like the sentries, it drops events of
+// actors that aren't known. The stream closes after the last one.
+type Trace struct {
+	events []*Event
+}
+
+func (t *Trace) String() string {
+	return fmt.Sprintf("Trace {events: %d}", len(t.events))
+}
+
+func (t *Trace) Search() (chan *Event, error) {
+	response := make(chan *Event, len(t.events))
+	for _, e := range t.events {
+		if !e.Actor.Known() {
+			continue
+		}
+		replayed := *e
+		response <- &replayed
+	}
+	close(response)
+	return response, nil
+}
+
+func (t *Trace) Message(payload *Payload) error {
+	return nil
+}
+
+// ReadTrace loads a trace of events, one JSON object per line, e.g.
+// {"actor": {"id": "11:22:33:AA:BB:CC"}, "action": "Entering", "epoch": "..."}
+func ReadTrace(path string) (*Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace %s: %w", path, err)
+	}
+	defer f.Close()
+	t := &Trace{events: []*Event{}}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("invalid event on line %d of %s: %w", line, path, err)
+		}
+		if e.Actor == nil {
+			return nil, fmt.Errorf("event on line %d of %s has no actor", line, path)
+		}
+		if e.Source == "" {
+			e.Source = "replay"
+		}
+		t.events = append(t.events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trace %s: %w", path, err)
+	}
+	return t, nil
+}
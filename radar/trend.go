@@ -0,0 +1,145 @@
+package radar
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Direction is which way an actor is moving relative to the sentry.
+type Direction string
+
+const (
+	Approaching Direction = "approaching"
+	Departing   Direction = "departing"
+)
+
+const (
+	DefaultTrendWindowMs = 10000
+	DefaultTrendSlope    = 0.5 // dBm per second
+
+	minTrendSamples = 3
+)
+
+type sample struct {
+	rssi int16
+	at   time.Time
+}
+
+// Trend infers the direction of actors from how the signal strength of their
+// devices changed over a recent window: rising as they approach, falling as
+// they walk away. A nil Trend knows nothing.
+type Trend struct {
+	window  time.Duration
+	slope   float64
+	samples map[ID][]sample
+	lock    sync.Mutex
+}
+
+func (t *Trend) String() string {
+	return fmt.Sprintf("Trend {window: %v, slope: %.2f}", t.window, t.slope)
+}
+
+// Observe records a signal strength reading of an actor.
+func (t *Trend) Observe(id ID, rssi int16, at time.Time) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	samples := append(t.samples[id], sample{rssi: rssi, at: at})
+	for len(samples) > 0 && at.Sub(samples[0].at) > t.window {
+		samples = samples[1:]
+	}
+	t.samples[id] = samples
+}
+
+// Latest is the most recent reading of an actor within the window.
+func (t *Trend) Latest(id ID, now time.Time) (int16, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	samples := t.samples[id]
+	if len(samples) == 0 || now.Sub(samples[len(samples)-1].at) > t.window {
+		return 0, false
+	}
+	return samples[len(samples)-1].rssi, true
+}
+
+// First is when the oldest reading of an actor within the window was taken.
+func (t *Trend) First(id ID, now time.Time) (time.Time, bool) {
+	if t == nil {
+		return time.Time{}, false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, s := range t.samples[id] {
+		if now.Sub(s.at) <= t.window {
+			return s.at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Average is the mean reading of an actor over span before now, bounded by
+// the window.
+func (t *Trend) Average(id ID, now time.Time, span time.Duration) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var n, sum float64
+	for _, s := range t.samples[id] {
+		if age := now.Sub(s.at); age <= span && age <= t.window {
+			n, sum = n+1, sum+float64(s.rssi)
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / n, true
+}
+
+// Direction fits a line through the readings of the window before now, and
+// reports the actor approaching or departing if it rises or falls steeply
+// enough. It is empty when there are too few readings or no clear trend.
+func (t *Trend) Direction(id ID, now time.Time) Direction {
+	if t == nil {
+		return ""
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var n, sx, sy, sxx, sxy float64
+	for _, s := range t.samples[id] {
+		if now.Sub(s.at) > t.window {
+			continue
+		}
+		x, y := now.Sub(s.at).Seconds(), float64(s.rssi)
+		n, sx, sy, sxx, sxy = n+1, sx+x, sy+y, sxx+x*x, sxy+x*y
+	}
+	if n < minTrendSamples || n*sxx-sx*sx == 0 {
+		return ""
+	}
+	// x counts back from now, so a rising signal has a negative slope
+	slope := -(n*sxy - sx*sy) / (n*sxx - sx*sx)
+	switch {
+	case slope >= t.slope:
+		return Approaching
+	case slope <= -t.slope:
+		return Departing
+	}
+	return ""
+}
+
+func NewTrend(window time.Duration, slope float64) *Trend {
+	if window <= 0 {
+		window = time.Duration(DefaultTrendWindowMs) * time.Millisecond
+	}
+	if slope <= 0 {
+		slope = DefaultTrendSlope
+	}
+	return &Trend{window: window, slope: slope, samples: map[ID][]sample{}}
+}
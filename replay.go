@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/profile"
+	"github.com/robolivable/beaves/radar"
+)
+
+// ReplayAction is a switch transition observed while replaying a trace.
+type ReplayAction struct {
+	OffsetMs int64  `json:"offsetMs"` // since the replay started; informational
+	Switch   string `json:"switch"`
+	State    string `json:"state"`
+}
+
+func readActions(path string) ([]ReplayAction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expected actions %s: %w", path, err)
+	}
+	defer f.Close()
+	actions := []ReplayAction{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var a ReplayAction
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			return nil, fmt.Errorf("invalid action on line %d of %s: %w", line, path, err)
+		}
+		actions = append(actions, a)
+	}
+	return actions, scanner.Err()
+}
+
+// simulate runs the trace through Manage against mock switches built from the
+// configuration, and returns every transition they made.
+func simulate(trace *radar.Trace) ([]ReplayAction, error) {
+	cfgs := config.RuntimeConfig.Switches
+	if len(cfgs) == 0 {
+		cfgs = []config.Switch{{Name: controller.DefaultSwitch}}
+	}
+	mocks := []config.Switch{}
+	for _, c := range cfgs {
+		c.Type = "mock"
+		c.WallSwitch.Input = ""
+		mocks = append(mocks, c)
+	}
+	var proximity radar.Proximity = trace
+	if config.RuntimeConfig.ArrivalDwellMs > 0 {
+		proximity = radar.NewDwell(trace, time.Duration(config.RuntimeConfig.ArrivalDwellMs)*time.Millisecond)
+	}
+	if config.RuntimeConfig.CoalesceMs > 0 {
+		proximity = radar.NewCoalesce(proximity, time.Duration(config.RuntimeConfig.CoalesceMs)*time.Millisecond)
+	}
+	b := Beaves{
+		Presence:  radar.NewPresenceTable(),
+		Seen:      radar.NewSeenTable(),
+		Events:    bus.New(),
+		Overrides: controller.NewOverrides(),
+	}
+	zones, err := NewZones(b.Presence)
+	if err != nil {
+		return nil, err
+	}
+	// the trace was recorded by the main zone's sentries
+	z := zones[0]
+	b.Zones = []*Zone{z}
+	z.Proximity = proximity
+	if b.Profiles, err = profile.New(config.RuntimeConfig.Profiles, config.RuntimeConfig.Profile); err != nil {
+		return nil, err
+	}
+	if b.Switches, err = controller.NewSwitches(mocks, b.Alert); err != nil {
+		return nil, err
+	}
+	managed := managedSwitch()
+	s, ok := b.Switches[managed]
+	if !ok {
+		return nil, fmt.Errorf("managed switch %q is not configured", managed)
+	}
+	for _, c := range mocks {
+		if c.Name == managed {
+			z.Switch = c
+		}
+	}
+	b.Actuator = controller.NewActuator(managed, s, config.RuntimeConfig.ActuationQueueSize)
+	z.Actuator = b.Actuator
+	if err := b.Arbitrate(mocks); err != nil {
+		return nil, err
+	}
+	if err := b.checkActorActions(z); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if err := b.Manage(z); err != nil {
+		return nil, err
+	}
+	// presses queued by the last events are still running
+	done := make(chan error, 1)
+	if err := b.Actuator.Enqueue(nil, func(err error) { done <- err }); err != nil {
+		return nil, err
+	}
+	<-done
+
+	actions := []ReplayAction{}
+	for _, s := range b.Switches {
+		m, ok := controller.Find[*controller.Mock](s)
+		if !ok {
+			continue
+		}
+		for _, t := range m.Transitions() {
+			actions = append(actions, ReplayAction{OffsetMs: t.Epoch.Sub(start).Milliseconds(), Switch: t.Switch, State: t.State.String()})
+		}
+	}
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].OffsetMs < actions[j].OffsetMs })
+	return actions, nil
+}
+
+// replay feeds a recorded trace through the presence pipeline and prints the
+// resulting switch actions, one JSON object per line. Given a file of expected
+// actions, it fails unless the same switches changed to the same states in the
+// same order.
+func replay(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: beaves replay <trace> [expected]")
+	}
+	trace, err := radar.ReadTrace(args[0])
+	if err != nil {
+		return err
+	}
+	actions, err := simulate(trace)
+	if err != nil {
+		return err
+	}
+	out := json.NewEncoder(os.Stdout)
+	for _, a := range actions {
+		if err := out.Encode(a); err != nil {
+			return err
+		}
+	}
+	if len(args) < 2 {
+		return nil
+	}
+	expected, err := readActions(args[1])
+	if err != nil {
+		return err
+	}
+	for i := 0; i < max(len(actions), len(expected)); i++ {
+		switch {
+		case i >= len(actions):
+			return fmt.Errorf("action %d: expected %s %s, got nothing", i+1, expected[i].Switch, expected[i].State)
+		case i >= len(expected):
+			return fmt.Errorf("action %d: expected nothing, got %s %s", i+1, actions[i].Switch, actions[i].State)
+		case actions[i].Switch != expected[i].Switch || actions[i].State != expected[i].State:
+			return fmt.Errorf("action %d: expected %s %s, got %s %s", i+1, expected[i].Switch, expected[i].State, actions[i].Switch, actions[i].State)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "replay matches %d expected actions\n", len(expected))
+	return nil
+}
@@ -0,0 +1,98 @@
+package report
+
+import (
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/clock"
+)
+
+// DropoutWindow is how soon a return after leaving counts as a missed
+// detection rather than a trip: a fob that drops out and is heard again.
+const DropoutWindow = 10 * time.Minute
+
+type ActorDay struct {
+	Date      string  `json:"date"`
+	HomeHours float64 `json:"homeHours"`
+}
+
+type Actor struct {
+	Days           []ActorDay `json:"days"`
+	Arrivals       int        `json:"arrivals"`
+	AverageArrival string     `json:"averageArrival,omitempty"` // time of day, e.g. "18:05"
+	Departures     int        `json:"departures"`
+	Dropouts       int        `json:"dropouts"`    // departures followed by a return within the dropout window
+	Reliability    float64    `json:"reliability"` // share of departures that were not dropouts
+}
+
+// Actors computes, for each actor with presence events, the time at home on
+// each of the n calendar days starting on the day of from, when they tend to
+// arrive, and how reliably they are detected. Dropouts are not counted as
+// arrivals or departures.
+func Actors(events []bus.Event, from time.Time, n int) map[string]*Actor {
+	p := newPeriod(from, n)
+	in := present(events)
+	actors := map[string]*Actor{}
+	home := map[string][]time.Duration{}
+	since := map[string]time.Time{}        // when each actor present came home
+	left := map[string]time.Time{}         // when each actor last left
+	arrivals := map[string]time.Duration{} // sum of times of day
+	for name, here := range in {
+		actors[name] = &Actor{}
+		home[name] = make([]time.Duration, n)
+		if here {
+			since[name] = p[0]
+		}
+	}
+	stay := func(name string, until time.Time) {
+		p.split(since[name], until, func(i int, d time.Duration) { home[name][i] += d })
+	}
+	for _, e := range events {
+		if e.Kind != bus.Presence || p.day(e.Epoch) < 0 {
+			continue
+		}
+		a := actors[e.Name]
+		switch e.Action {
+		case "Entering":
+			if in[e.Name] {
+				continue
+			}
+			in[e.Name] = true
+			if l, ok := left[e.Name]; ok && e.Epoch.Sub(l) < DropoutWindow {
+				// never really gone: home since before leaving
+				a.Dropouts++
+				a.Departures--
+				since[e.Name] = l
+				continue
+			}
+			a.Arrivals++
+			arrivals[e.Name] += clock.TimeOfDay(clock.Local(e.Epoch))
+			since[e.Name] = e.Epoch
+		case "Exiting":
+			if !in[e.Name] {
+				continue
+			}
+			in[e.Name] = false
+			a.Departures++
+			left[e.Name] = e.Epoch
+			stay(e.Name, e.Epoch)
+		}
+	}
+	for name, a := range actors {
+		if in[name] {
+			stay(name, p.end())
+		}
+		for i, d := range home[name] {
+			a.Days = append(a.Days, ActorDay{Date: p[i].Format(time.DateOnly), HomeHours: d.Hours()})
+		}
+		if a.Arrivals > 0 {
+			avg := arrivals[name] / time.Duration(a.Arrivals)
+			a.AverageArrival = time.Time{}.Add(avg).Format("15:04")
+		}
+		a.Reliability = 1
+		if a.Departures+a.Dropouts > 0 {
+			a.Reliability = float64(a.Departures) / float64(a.Departures+a.Dropouts)
+		}
+	}
+	return actors
+}
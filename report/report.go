@@ -0,0 +1,185 @@
+// Package report summarizes the recorded events of whole days: when the
+// house was first arrived at and last left, how long it was occupied and how
+// often each relay cycled.
+package report
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/clock"
+)
+
+type Day struct {
+	Date          time.Time      // midnight, in the configured timezone
+	FirstArrival  time.Time      // zero without arrivals
+	LastDeparture time.Time      // zero without departures
+	Occupied      time.Duration  // while any actor was present
+	Cycles        map[string]int // by switch: times turned on or pressed
+}
+
+// period is a run of calendar days, by the bounds between them.
+type period []time.Time
+
+func newPeriod(from time.Time, n int) period {
+	from = clock.Local(from)
+	p := make(period, n+1)
+	for i := range p {
+		p[i] = time.Date(from.Year(), from.Month(), from.Day()+i, 0, 0, 0, 0, from.Location())
+	}
+	return p
+}
+
+// day is the index of the day t falls on, or -1 outside the period.
+func (p period) day(t time.Time) int {
+	for i := range len(p) - 1 {
+		if !t.Before(p[i]) && t.Before(p[i+1]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// end is the end of the period, or now while it lasts.
+func (p period) end() time.Time {
+	return earlier(time.Now(), p[len(p)-1])
+}
+
+// split calls fn with the part of a to b on each day of the period.
+func (p period) split(a, b time.Time, fn func(day int, d time.Duration)) {
+	for i := range len(p) - 1 {
+		if start, end := later(a, p[i]), earlier(b, p[i+1]); start.Before(end) {
+			fn(i, end.Sub(start))
+		}
+	}
+}
+
+// present returns who is taken to be present at the start of events: the
+// actors whose first event is leaving.
+func present(events []bus.Event) map[string]bool {
+	in := map[string]bool{}
+	for _, e := range events {
+		if _, seen := in[e.Name]; e.Kind == bus.Presence && !seen {
+			in[e.Name] = e.Action == "Exiting"
+		}
+	}
+	return in
+}
+
+// Days summarizes events over the n calendar days starting on the day of
+// from. Actors whose first event is leaving are taken to have been present
+// since the start.
+func Days(events []bus.Event, from time.Time, n int) []Day {
+	p := newPeriod(from, n)
+	days := make([]Day, n)
+	for i := range days {
+		days[i] = Day{Date: p[i], Cycles: map[string]int{}}
+	}
+	occupy := func(i int, d time.Duration) { days[i].Occupied += d }
+
+	in := present(events)
+	occupants := 0
+	for _, here := range in {
+		if here {
+			occupants++
+		}
+	}
+	at := p[0]
+	for _, e := range events {
+		i := p.day(e.Epoch)
+		if i < 0 {
+			continue
+		}
+		switch e.Kind {
+		case bus.Switch:
+			if e.Action == "On" || e.Action == "Pressed" {
+				days[i].Cycles[e.Name]++
+			}
+		case bus.Presence:
+			if occupants > 0 {
+				p.split(at, e.Epoch, occupy)
+			}
+			at = e.Epoch
+			switch e.Action {
+			case "Entering":
+				if days[i].FirstArrival.IsZero() {
+					days[i].FirstArrival = e.Epoch
+				}
+				if !in[e.Name] {
+					occupants++
+				}
+				in[e.Name] = true
+			case "Exiting":
+				days[i].LastDeparture = e.Epoch
+				if in[e.Name] {
+					occupants--
+				}
+				in[e.Name] = false
+			}
+		}
+	}
+	if occupants > 0 {
+		p.split(at, p.end(), occupy)
+	}
+	return days
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// Format writes days as one line each, followed by their totals when there
+// are several.
+func Format(title string, days []Day) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n", title)
+	total := Day{Cycles: map[string]int{}}
+	for _, d := range days {
+		fmt.Fprintf(&sb, "%s: first arrival %s, last departure %s, occupied %.1fh, %s\n", d.Date.Format("Mon 2006-01-02"),
+			clockTime(d.FirstArrival), clockTime(d.LastDeparture), d.Occupied.Hours(), cycles(d.Cycles))
+		total.Occupied += d.Occupied
+		for name, n := range d.Cycles {
+			total.Cycles[name] += n
+		}
+	}
+	if len(days) > 1 {
+		fmt.Fprintf(&sb, "total: occupied %.1fh, %s\n", total.Occupied.Hours(), cycles(total.Cycles))
+	}
+	return sb.String()
+}
+
+func clockTime(t time.Time) string {
+	if t.IsZero() {
+		return "none"
+	}
+	return clock.Local(t).Format("15:04")
+}
+
+func cycles(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "no relay cycles"
+	}
+	names := []string{}
+	for name := range counts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return "relay cycles: " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/api"
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/radar"
+	"github.com/robolivable/beaves/state"
+)
+
+const retentionInterval = 24 * time.Hour
+
+// Retain removes history events and audit entries older than their retention,
+// once the clock is trusted so a wrong date can't wipe them, and daily after.
+func (b *Beaves) Retain() {
+	<-b.Clock.Ready()
+	for {
+		b.prune(time.Now())
+		time.Sleep(retentionInterval)
+	}
+}
+
+func (b *Beaves) prune(now time.Time) {
+	if days := config.RuntimeConfig.HistoryRetentionDays; days > 0 {
+		cutoff := now.AddDate(0, 0, -days)
+		n, err := b.History.Prune(func(e bus.Event) bool { return !e.Epoch.Before(cutoff) })
+		if err != nil {
+			log.Error(err.Error())
+		} else if n > 0 {
+			log.Info("removed %d history events older than %d days", n, days)
+		}
+	}
+	if days := config.RuntimeConfig.AuditRetentionDays; days > 0 && b.Audit != nil {
+		cutoff := now.AddDate(0, 0, -days)
+		n, err := b.Audit.Prune(func(e audit.Entry) bool { return !e.Epoch.Before(cutoff) },
+			audit.Cause{Kind: "retention"}, fmt.Sprintf("older than %d days", days))
+		if err != nil {
+			log.Error(err.Error())
+			b.Events.Publish(bus.Event{Kind: bus.Alert, Name: "audit", Detail: err.Error()})
+		} else if n > 0 {
+			log.Info("removed %d audit entries older than %d days", n, days)
+		}
+	}
+}
+
+// known resolves an actor given by ID or name to the ID of a known actor.
+func known(actor string) (radar.ID, bool) {
+	a := radar.Actor{ID: radar.ID(actor)}
+	if a.Known() {
+		return a.ID, true
+	}
+	for id, name := range config.RuntimeConfig.Actors.Names {
+		if a = (radar.Actor{ID: radar.ID(id)}); strings.EqualFold(name, actor) && a.Known() {
+			return a.ID, true
+		}
+	}
+	return "", false
+}
+
+// Purge removes everything stored about a known actor, given by ID or name:
+// its presence in every zone, the history events it caused, the audit
+// entries attributed to it, its rolling code counter, its geofence report
+// and the Bluetooth trace of its device. It reports how many records it
+// removed from each store. A tombstone entry naming only a digest of the ID
+// stays in the audit log. The actor stays known until it is removed from the
+// configuration or vault.
+func (b *Beaves) Purge(actor string, cause audit.Cause) (map[string]int, error) {
+	id, ok := known(actor)
+	if !ok {
+		return nil, api.ErrUnknownActor
+	}
+	names := []string{string(id), radar.FriendlyName(id)}
+	about := func(name string) bool {
+		for _, n := range names {
+			if name != "" && strings.EqualFold(name, n) {
+				return true
+			}
+		}
+		return false
+	}
+	removed := map[string]int{"presence": 0, "seen": 0, "history": 0, "audit": 0, "counters": 0, "geofence": 0, "trace": 0}
+	tables := []*radar.PresenceTable{b.Presence}
+	for _, z := range b.Zones {
+		if !slices.Contains(tables, z.Presence) {
+			tables = append(tables, z.Presence)
+		}
+	}
+	for _, t := range tables {
+		for _, p := range t.Snapshot() {
+			if about(string(p.Actor)) || about(p.Name) {
+				t.Forget(p.Actor)
+				removed["presence"]++
+			}
+		}
+	}
+	for _, seen := range b.Seen.Snapshot() {
+		if about(string(seen.Actor)) || about(seen.Name) {
+			b.Seen.Forget(seen.Actor)
+			removed["seen"]++
+		}
+	}
+	if removed["presence"] > 0 || removed["seen"] > 0 {
+		if err := state.Save(stateFile(), b.Snapshot()); err != nil {
+			return removed, err
+		}
+	}
+	if b.Counters != nil {
+		forgot, err := b.Counters.Forget(strings.ToUpper(string(id)))
+		if err != nil {
+			return removed, err
+		}
+		if forgot {
+			removed["counters"]++
+		}
+	}
+	if tracker := b.Geofence.Load(); tracker != nil && tracker.Forget(string(id)) {
+		removed["geofence"]++
+	}
+	device := "dev_" + strings.ReplaceAll(string(id), ":", "_")
+	for _, a := range b.Adapters {
+		removed["trace"] += a.Trace.Forget(func(e radar.BTTraceEntry) bool {
+			return strings.Contains(strings.ToLower(e.Path), strings.ToLower(device)) || strings.Contains(strings.ToLower(e.Detail), strings.ToLower(string(id)))
+		})
+	}
+	var err error
+	if removed["history"], err = b.History.Prune(func(e bus.Event) bool {
+		return !(e.Kind == bus.Presence && about(e.Name)) && !about(e.By)
+	}); err != nil {
+		return removed, err
+	}
+	if b.Audit != nil {
+		// NOTE: the record of the purge names who purged, not whom
+		if removed["audit"], err = b.Audit.Prune(func(e audit.Entry) bool { return !about(e.By) }, cause, "purged an actor"); err != nil {
+			return removed, err
+		}
+		sum := sha256.Sum256([]byte(strings.ToUpper(string(id))))
+		if err := b.Audit.Record(cause, audit.Entry{Action: "Purged", Detail: "actor sha256:" + hex.EncodeToString(sum[:8])}); err != nil {
+			return removed, err
+		}
+	}
+	if config.RuntimeConfig.DumpFile != "" {
+		if err := b.writeDump(); err != nil {
+			log.Error(err.Error())
+		}
+	}
+	log.Info("purged an actor: %d presence, %d last seen, %d history events, %d audit entries, %d counters, %d geofence reports, %d trace entries",
+		removed["presence"], removed["seen"], removed["history"], removed["audit"], removed["counters"], removed["geofence"], removed["trace"])
+	return removed, nil
+}
@@ -0,0 +1,176 @@
+// Package rolling checks rolling codes: HOTP codes (RFC 4226) whose counter
+// only moves forward, kept per actor in a file so a code captured once can't
+// be used again, even after a restart.
+package rolling
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/robolivable/beaves/totp"
+)
+
+const (
+	DefaultFile         = "counters.json"
+	DefaultWindow       = 10
+	DefaultResyncWindow = 100
+)
+
+var (
+	ErrInvalid = errors.New("invalid code")
+	ErrResync  = errors.New("code is too far ahead; send the next one to resynchronize")
+)
+
+// file is how the counters are saved. Earlier versions saved next alone, as
+// the whole file.
+type file struct {
+	Next    map[string]uint64 `json:"next"`
+	Pending map[string]uint64 `json:"pending,omitempty"`
+}
+
+// Counters holds the next counter expected from each actor. A code matching
+// one of the window counters from there is accepted, skipping codes the
+// phone made but never delivered. One further ahead, within the resync
+// window, must be followed by the code right after it, even across a restart.
+type Counters struct {
+	path    string
+	window  uint64
+	resync  uint64
+	next    map[string]uint64
+	pending map[string]uint64 // counter of a code awaiting its successor to resynchronize
+	lock    sync.Mutex
+}
+
+func (c *Counters) String() string {
+	return fmt.Sprintf("Counters {path: %s, actors: %d}", c.path, len(c.next))
+}
+
+// Open reads the counters at path; a missing file starts every actor at 0.
+func Open(path string, window int, resync int) (*Counters, error) {
+	c := &Counters{path: path, window: DefaultWindow, resync: DefaultResyncWindow, next: map[string]uint64{}, pending: map[string]uint64{}}
+	if window > 0 {
+		c.window = uint64(window)
+	}
+	if resync > 0 {
+		c.resync = uint64(resync)
+	}
+	if c.resync < c.window {
+		c.resync = c.window
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read counters %s: %w", path, err)
+	}
+	saved := file{}
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Next == nil {
+		saved = file{}
+		if err := json.Unmarshal(data, &saved.Next); err != nil {
+			return nil, fmt.Errorf("failed to decode counters %s: %w", path, err)
+		}
+	}
+	if saved.Next != nil {
+		c.next = saved.Next
+	}
+	if saved.Pending != nil {
+		c.pending = saved.Pending
+	}
+	return c, nil
+}
+
+// find returns the counter in [from, to) whose code is code.
+func find(secret []byte, code string, from uint64, to uint64) (uint64, bool) {
+	for n := from; n < to; n++ {
+		if subtle.ConstantTimeCompare([]byte(totp.Code(secret, int64(n))), []byte(code)) == 1 {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// Check accepts code from actor if it is one of the next in its sequence,
+// saving the new counter before returning so the code is spent even if
+// beaves stops right after.
+func (c *Counters) Check(actor string, secret []byte, code string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	next := c.next[actor]
+	n, ok := find(secret, code, next, next+c.window)
+	if !ok {
+		if n, ok = find(secret, code, next+c.window, next+c.resync); !ok {
+			return ErrInvalid
+		}
+		if pending, waiting := c.pending[actor]; !waiting || n != pending+1 {
+			// NOTE: saved too, so a restart between the two codes doesn't
+			// make the phone start resynchronizing over
+			c.pending[actor] = n
+			if err := c.save(); err != nil {
+				return err
+			}
+			return ErrResync
+		}
+	}
+	pending, waiting := c.pending[actor]
+	delete(c.pending, actor)
+	c.next[actor] = n + 1
+	if err := c.save(); err != nil {
+		c.next[actor] = next
+		if waiting {
+			c.pending[actor] = pending
+		}
+		return err
+	}
+	return nil
+}
+
+// Forget drops the counter of actor, so its codes start over from 0.
+func (c *Counters) Forget(actor string) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, ok := c.next[actor]
+	if _, waiting := c.pending[actor]; waiting {
+		ok = true
+	}
+	delete(c.next, actor)
+	delete(c.pending, actor)
+	if !ok {
+		return false, nil
+	}
+	return true, c.save()
+}
+
+// save must be called with the lock held. It writes the counters and pending
+// resyncs to a temporary file and renames it over path, like the state file.
+func (c *Counters) save() error {
+	data, err := json.Marshal(file{Next: c.next, Pending: c.pending})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save counters: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save counters: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save counters: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save counters: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to save counters: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/cron"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+// ScheduleSwitches changes switches on their cron schedules, as automation,
+// once the clock is trusted.
+func (b *Beaves) ScheduleSwitches(changes []config.SwitchChange) error {
+	schedules := []*cron.Schedule{}
+	for _, c := range changes {
+		s, err := cron.Parse(c.Cron)
+		if err != nil {
+			return fmt.Errorf("switch schedule: %w", err)
+		}
+		// NOTE: checked against the configuration, as the switches are missing
+		// while the controller is degraded
+		if !slices.ContainsFunc(config.RuntimeConfig.Switches, func(s config.Switch) bool { return s.Name == c.Switch }) {
+			return fmt.Errorf("switch schedule refers to unknown switch %q", c.Switch)
+		}
+		if st := strings.ToLower(c.State); st != "on" && st != "off" {
+			return fmt.Errorf("switch schedule state must be on or off, not %q", c.State)
+		}
+		schedules = append(schedules, s)
+	}
+	for i, s := range schedules {
+		c := changes[i]
+		state := controller.Off
+		if strings.EqualFold(c.State, "on") {
+			state = controller.On
+		}
+		supervisor.Go("schedule "+c.Cron, func() {
+			s.Run(b.Clock.Ready(), func() {
+				if err := b.Automate(c.Switch, state, audit.Cause{Kind: "schedule", By: c.Cron}); err != nil {
+					log.Error(err.Error())
+				}
+			})
+		})
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/clock"
+	"github.com/robolivable/beaves/log"
+)
+
+func numbers(name string, args []any) ([]float64, error) {
+	ns := make([]float64, len(args))
+	for i, a := range args {
+		n, ok := a.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is not a number", name, show(a))
+		}
+		ns[i] = n
+	}
+	return ns, nil
+}
+
+func arithmetic(name string, op func(a, b float64) (float64, error)) Builtin {
+	return func(args []any) (any, error) {
+		ns, err := numbers(name, args)
+		if err != nil {
+			return nil, err
+		}
+		if len(ns) == 0 {
+			return nil, fmt.Errorf("%s takes at least 1 argument", name)
+		}
+		result := ns[0]
+		for _, n := range ns[1:] {
+			if result, err = op(result, n); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+}
+
+func comparison(name string, op func(a, b float64) bool) Builtin {
+	return func(args []any) (any, error) {
+		ns, err := numbers(name, args)
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; i < len(ns); i++ {
+			if !op(ns[i-1], ns[i]) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+}
+
+func equal(a, b any) bool {
+	la, ok := a.([]any)
+	if !ok {
+		if _, ok := b.([]any); ok {
+			return false
+		}
+		switch a.(type) {
+		case map[string]any, *lambda, Builtin:
+			return false
+		}
+		return a == b
+	}
+	lb, ok := b.([]any)
+	if !ok || len(la) != len(lb) {
+		return false
+	}
+	for i := range la {
+		if !equal(la[i], lb[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func text(x any) string {
+	if s, ok := x.(string); ok {
+		return s
+	}
+	return show(x)
+}
+
+func arity(name string, n int, args []any) error {
+	if len(args) != n {
+		return fmt.Errorf("%s takes %d arguments, got %d", name, n, len(args))
+	}
+	return nil
+}
+
+func stringArg(name string, args []any, i int) (string, error) {
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("%s: %s is not a string", name, show(args[i]))
+	}
+	return s, nil
+}
+
+// zoneArg reads the optional zone at i, the last argument, "" when left out.
+func zoneArg(name string, args []any, i int) (string, error) {
+	switch {
+	case len(args) <= i:
+		return "", nil
+	case len(args) > i+1:
+		return "", fmt.Errorf("%s takes at most %d arguments, got %d", name, i+1, len(args))
+	}
+	return stringArg(name, args, i)
+}
+
+// builtins are the functions every script has.
+func builtins() map[Symbol]any {
+	return map[Symbol]any{
+		"+": arithmetic("+", func(a, b float64) (float64, error) { return a + b, nil }),
+		"-": Builtin(func(args []any) (any, error) {
+			if len(args) == 1 {
+				ns, err := numbers("-", args)
+				if err != nil {
+					return nil, err
+				}
+				return -ns[0], nil
+			}
+			return arithmetic("-", func(a, b float64) (float64, error) { return a - b, nil })(args)
+		}),
+		"*": arithmetic("*", func(a, b float64) (float64, error) { return a * b, nil }),
+		"/": arithmetic("/", func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		}),
+		"mod": arithmetic("mod", func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return math.Mod(a, b), nil
+		}),
+		"<":  comparison("<", func(a, b float64) bool { return a < b }),
+		">":  comparison(">", func(a, b float64) bool { return a > b }),
+		"<=": comparison("<=", func(a, b float64) bool { return a <= b }),
+		">=": comparison(">=", func(a, b float64) bool { return a >= b }),
+		"=": Builtin(func(args []any) (any, error) {
+			if err := arity("=", 2, args); err != nil {
+				return nil, err
+			}
+			return equal(args[0], args[1]), nil
+		}),
+		"!=": Builtin(func(args []any) (any, error) {
+			if err := arity("!=", 2, args); err != nil {
+				return nil, err
+			}
+			return !equal(args[0], args[1]), nil
+		}),
+		"not": Builtin(func(args []any) (any, error) {
+			if err := arity("not", 1, args); err != nil {
+				return nil, err
+			}
+			return !truthy(args[0]), nil
+		}),
+		"list": Builtin(func(args []any) (any, error) {
+			return append([]any{}, args...), nil
+		}),
+		"len": Builtin(func(args []any) (any, error) {
+			if err := arity("len", 1, args); err != nil {
+				return nil, err
+			}
+			switch x := args[0].(type) {
+			case string:
+				return float64(len(x)), nil
+			case []any:
+				return float64(len(x)), nil
+			case map[string]any:
+				return float64(len(x)), nil
+			}
+			return nil, fmt.Errorf("len: %s has no length", show(args[0]))
+		}),
+		// (get map key) or (get list index), nil if there is no such element
+		"get": Builtin(func(args []any) (any, error) {
+			if err := arity("get", 2, args); err != nil {
+				return nil, err
+			}
+			switch x := args[0].(type) {
+			case map[string]any:
+				k, err := stringArg("get", args, 1)
+				if err != nil {
+					return nil, err
+				}
+				return x[k], nil
+			case []any:
+				i, ok := args[1].(float64)
+				if !ok || i < 0 || int(i) >= len(x) {
+					return nil, nil
+				}
+				return x[int(i)], nil
+			}
+			return nil, fmt.Errorf("get: %s is not a map or list", show(args[0]))
+		}),
+		// (contains string substring) or (contains list element)
+		"contains": Builtin(func(args []any) (any, error) {
+			if err := arity("contains", 2, args); err != nil {
+				return nil, err
+			}
+			switch x := args[0].(type) {
+			case string:
+				sub, err := stringArg("contains", args, 1)
+				if err != nil {
+					return nil, err
+				}
+				return strings.Contains(x, sub), nil
+			case []any:
+				for _, v := range x {
+					if equal(v, args[1]) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+			return nil, fmt.Errorf("contains: %s is not a string or list", show(args[0]))
+		}),
+		"str": Builtin(func(args []any) (any, error) {
+			var b strings.Builder
+			for _, a := range args {
+				b.WriteString(text(a))
+			}
+			return b.String(), nil
+		}),
+		"lower": Builtin(func(args []any) (any, error) {
+			if err := arity("lower", 1, args); err != nil {
+				return nil, err
+			}
+			s, err := stringArg("lower", args, 0)
+			return strings.ToLower(s), err
+		}),
+		"print": Builtin(func(args []any) (any, error) {
+			parts := make([]string, len(args))
+			for i, a := range args {
+				parts[i] = text(a)
+			}
+			log.Info("script: %s", strings.Join(parts, " "))
+			return nil, nil
+		}),
+		// wall clock of the configured timezone
+		"hour": Builtin(func(args []any) (any, error) {
+			return float64(clock.Local(time.Now()).Hour()), nil
+		}),
+		"minute": Builtin(func(args []any) (any, error) {
+			return float64(clock.Local(time.Now()).Minute()), nil
+		}),
+		"weekday": Builtin(func(args []any) (any, error) {
+			return strings.ToLower(clock.Local(time.Now()).Weekday().String()), nil
+		}),
+	}
+}
@@ -0,0 +1,340 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const maxDepth = 200
+
+var ErrBudget = errors.New("script: exceeded its budget")
+
+// Builtin is a function provided by Go.
+type Builtin func(args []any) (any, error)
+
+type lambda struct {
+	name   string
+	params []Symbol
+	body   []any
+	env    *env
+}
+
+type env struct {
+	vars  map[Symbol]any
+	outer *env
+}
+
+func newEnv(outer *env) *env {
+	return &env{vars: map[Symbol]any{}, outer: outer}
+}
+
+func (e *env) find(s Symbol) (*env, bool) {
+	for ; e != nil; e = e.outer {
+		if _, ok := e.vars[s]; ok {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// interp evaluates within a budget of steps, allocation and time, so a
+// runaway script can't stall the sentry or exhaust its memory.
+type interp struct {
+	steps    int
+	alloc    int // string bytes and list elements builtins may still make
+	deadline time.Time
+	depth    int
+}
+
+func truthy(x any) bool {
+	return x != nil && x != false
+}
+
+func (in *interp) step() error {
+	in.steps--
+	if in.steps < 0 || in.steps%1000 == 0 && time.Now().After(in.deadline) {
+		return ErrBudget
+	}
+	return nil
+}
+
+// allocate charges what a builtin made against the budget.
+func (in *interp) allocate(x any) error {
+	switch x := x.(type) {
+	case string:
+		in.alloc -= len(x)
+	case []any:
+		in.alloc -= len(x)
+	}
+	if in.alloc < 0 {
+		return ErrBudget
+	}
+	return nil
+}
+
+func (in *interp) eval(x any, e *env) (any, error) {
+	if err := in.step(); err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case Symbol:
+		if found, ok := e.find(x); ok {
+			return found.vars[x], nil
+		}
+		return nil, fmt.Errorf("undefined %s", x)
+	case []any:
+		if len(x) == 0 {
+			return nil, fmt.Errorf("empty call")
+		}
+		if s, ok := x[0].(Symbol); ok {
+			if form, ok := specialForms[s]; ok {
+				return form(in, x[1:], e)
+			}
+		}
+		f, err := in.eval(x[0], e)
+		if err != nil {
+			return nil, err
+		}
+		args := make([]any, len(x)-1)
+		for i, a := range x[1:] {
+			if args[i], err = in.eval(a, e); err != nil {
+				return nil, err
+			}
+		}
+		return in.apply(f, args)
+	}
+	return x, nil
+}
+
+func (in *interp) body(exprs []any, e *env) (any, error) {
+	var result any
+	var err error
+	for _, x := range exprs {
+		if result, err = in.eval(x, e); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (in *interp) apply(f any, args []any) (any, error) {
+	switch f := f.(type) {
+	case Builtin:
+		result, err := f(args)
+		if err != nil {
+			return nil, err
+		}
+		return result, in.allocate(result)
+	case *lambda:
+		if len(args) != len(f.params) {
+			return nil, fmt.Errorf("%s takes %d arguments, got %d", f.name, len(f.params), len(args))
+		}
+		if in.depth++; in.depth > maxDepth {
+			return nil, fmt.Errorf("%s: calls nested too deep", f.name)
+		}
+		defer func() { in.depth-- }()
+		e := newEnv(f.env)
+		for i, p := range f.params {
+			e.vars[p] = args[i]
+		}
+		return in.body(f.body, e)
+	}
+	return nil, fmt.Errorf("%s is not a function", show(f))
+}
+
+func params(x any) ([]Symbol, error) {
+	list, ok := x.([]any)
+	if !ok {
+		return nil, fmt.Errorf("parameters must be a list")
+	}
+	ps := []Symbol{}
+	for _, p := range list {
+		s, ok := p.(Symbol)
+		if !ok {
+			return nil, fmt.Errorf("parameter %s is not a name", show(p))
+		}
+		ps = append(ps, s)
+	}
+	return ps, nil
+}
+
+type specialForm func(in *interp, args []any, e *env) (any, error)
+
+var specialForms map[Symbol]specialForm
+
+func init() {
+	specialForms = map[Symbol]specialForm{
+		"quote": func(in *interp, args []any, e *env) (any, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("quote takes 1 argument")
+			}
+			return args[0], nil
+		},
+		"if": func(in *interp, args []any, e *env) (any, error) {
+			if len(args) < 2 || len(args) > 3 {
+				return nil, fmt.Errorf("if takes a condition, a consequence and an optional alternative")
+			}
+			cond, err := in.eval(args[0], e)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(cond) {
+				return in.eval(args[1], e)
+			}
+			if len(args) == 3 {
+				return in.eval(args[2], e)
+			}
+			return nil, nil
+		},
+		"cond": func(in *interp, args []any, e *env) (any, error) {
+			for _, c := range args {
+				clause, ok := c.([]any)
+				if !ok || len(clause) == 0 {
+					return nil, fmt.Errorf("cond clauses must be lists")
+				}
+				if s, ok := clause[0].(Symbol); !ok || s != "else" {
+					cond, err := in.eval(clause[0], e)
+					if err != nil {
+						return nil, err
+					}
+					if !truthy(cond) {
+						continue
+					}
+				}
+				return in.body(clause[1:], e)
+			}
+			return nil, nil
+		},
+		"do": func(in *interp, args []any, e *env) (any, error) {
+			return in.body(args, e)
+		},
+		"and": func(in *interp, args []any, e *env) (any, error) {
+			var result any = true
+			var err error
+			for _, a := range args {
+				if result, err = in.eval(a, e); err != nil || !truthy(result) {
+					return result, err
+				}
+			}
+			return result, nil
+		},
+		"or": func(in *interp, args []any, e *env) (any, error) {
+			for _, a := range args {
+				if result, err := in.eval(a, e); err != nil || truthy(result) {
+					return result, err
+				}
+			}
+			return false, nil
+		},
+		"fn": func(in *interp, args []any, e *env) (any, error) {
+			if len(args) < 1 {
+				return nil, fmt.Errorf("fn takes parameters and a body")
+			}
+			ps, err := params(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return &lambda{name: "fn", params: ps, body: args[1:], env: e}, nil
+		},
+		// (define name value) or (define (name params...) body...)
+		"define": func(in *interp, args []any, e *env) (any, error) {
+			if len(args) < 1 {
+				return nil, fmt.Errorf("define takes a name")
+			}
+			if sig, ok := args[0].([]any); ok {
+				if len(sig) == 0 {
+					return nil, fmt.Errorf("define takes a name")
+				}
+				name, ok := sig[0].(Symbol)
+				if !ok {
+					return nil, fmt.Errorf("define: %s is not a name", show(sig[0]))
+				}
+				ps, err := params(sig[1:])
+				if err != nil {
+					return nil, err
+				}
+				e.vars[name] = &lambda{name: string(name), params: ps, body: args[1:], env: e}
+				return nil, nil
+			}
+			name, ok := args[0].(Symbol)
+			if !ok || len(args) != 2 {
+				return nil, fmt.Errorf("define takes a name and a value")
+			}
+			v, err := in.eval(args[1], e)
+			if err != nil {
+				return nil, err
+			}
+			e.vars[name] = v
+			return nil, nil
+		},
+		"set!": func(in *interp, args []any, e *env) (any, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("set! takes a name and a value")
+			}
+			name, ok := args[0].(Symbol)
+			if !ok {
+				return nil, fmt.Errorf("set! takes a name and a value")
+			}
+			found, ok := e.find(name)
+			if !ok {
+				return nil, fmt.Errorf("set!: undefined %s", name)
+			}
+			v, err := in.eval(args[1], e)
+			if err != nil {
+				return nil, err
+			}
+			found.vars[name] = v
+			return nil, nil
+		},
+		// (let ((name value) ...) body...)
+		"let": func(in *interp, args []any, e *env) (any, error) {
+			if len(args) < 1 {
+				return nil, fmt.Errorf("let takes bindings and a body")
+			}
+			bindings, ok := args[0].([]any)
+			if !ok {
+				return nil, fmt.Errorf("let bindings must be a list")
+			}
+			inner := newEnv(e)
+			for _, b := range bindings {
+				pair, ok := b.([]any)
+				if !ok || len(pair) != 2 {
+					return nil, fmt.Errorf("let bindings must be (name value) pairs")
+				}
+				name, ok := pair[0].(Symbol)
+				if !ok {
+					return nil, fmt.Errorf("let: %s is not a name", show(pair[0]))
+				}
+				v, err := in.eval(pair[1], e)
+				if err != nil {
+					return nil, err
+				}
+				inner.vars[name] = v
+			}
+			return in.body(args[1:], inner)
+		},
+	}
+}
+
+// show formats a value as it would be written in a script.
+func show(x any) string {
+	switch x := x.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return fmt.Sprintf("%q", x)
+	case []any:
+		parts := make([]string, len(x))
+		for i, v := range x {
+			parts[i] = show(v)
+		}
+		return "(" + strings.Join(parts, " ") + ")"
+	case *lambda:
+		return "<fn " + x.name + ">"
+	case Builtin:
+		return "<builtin>"
+	}
+	return fmt.Sprint(x)
+}
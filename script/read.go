@@ -0,0 +1,149 @@
+package script
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Symbol is a name, evaluated by looking it up.
+type Symbol string
+
+type reader struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (r *reader) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", r.line, fmt.Sprintf(format, args...))
+}
+
+// skip moves past whitespace and comments, which run from ';' to the end of
+// the line.
+func (r *reader) skip() {
+	for r.pos < len(r.src) {
+		switch c := r.src[r.pos]; {
+		case c == '\n':
+			r.line++
+			r.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			r.pos++
+		case c == ';':
+			for r.pos < len(r.src) && r.src[r.pos] != '\n' {
+				r.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func delimiter(c byte) bool {
+	return strings.IndexByte(" \t\r\n();\"'", c) >= 0
+}
+
+// read returns the next expression, and false at the end of the source.
+func (r *reader) read() (any, bool, error) {
+	r.skip()
+	if r.pos >= len(r.src) {
+		return nil, false, nil
+	}
+	switch c := r.src[r.pos]; c {
+	case '(':
+		r.pos++
+		list := []any{}
+		for {
+			r.skip()
+			if r.pos >= len(r.src) {
+				return nil, false, r.errorf("unclosed (")
+			}
+			if r.src[r.pos] == ')' {
+				r.pos++
+				return list, true, nil
+			}
+			x, _, err := r.read()
+			if err != nil {
+				return nil, false, err
+			}
+			list = append(list, x)
+		}
+	case ')':
+		return nil, false, r.errorf("unexpected )")
+	case '\'':
+		r.pos++
+		x, ok, err := r.read()
+		if err == nil && !ok {
+			err = r.errorf("nothing to quote")
+		}
+		return []any{Symbol("quote"), x}, true, err
+	case '"':
+		return r.string()
+	}
+	start := r.pos
+	for r.pos < len(r.src) && !delimiter(r.src[r.pos]) {
+		r.pos++
+	}
+	return atom(r.src[start:r.pos]), true, nil
+}
+
+func (r *reader) string() (any, bool, error) {
+	var b strings.Builder
+	for r.pos++; r.pos < len(r.src); r.pos++ {
+		c := r.src[r.pos]
+		switch c {
+		case '"':
+			r.pos++
+			return b.String(), true, nil
+		case '\\':
+			r.pos++
+			if r.pos >= len(r.src) {
+				break
+			}
+			switch e := r.src[r.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(e)
+			}
+			continue
+		case '\n':
+			r.line++
+		}
+		b.WriteByte(c)
+	}
+	return nil, false, r.errorf("unterminated string")
+}
+
+func atom(token string) any {
+	switch token {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "nil":
+		return nil
+	}
+	if n, err := strconv.ParseFloat(token, 64); err == nil {
+		return n
+	}
+	return Symbol(token)
+}
+
+// Read parses every expression of a source.
+func Read(src string) ([]any, error) {
+	r := &reader{src: src, line: 1}
+	exprs := []any{}
+	for {
+		x, ok, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return exprs, nil
+		}
+		exprs = append(exprs, x)
+	}
+}
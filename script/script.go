@@ -0,0 +1,205 @@
+// Package script runs a user's rules written in a small Lisp, for household
+// logic beyond what the configuration can express. A script defines
+// (on-event e), which is called with every event published on the bus and
+// can drive switches through the controller functions.
+package script
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultMaxSteps  = 100000
+	DefaultMaxAlloc  = 1 << 20
+	DefaultTimeoutMs = 1000
+
+	handler Symbol = "on-event"
+)
+
+// Controller is what scripts may see and do.
+type Controller interface {
+	State(name string) (string, error)
+	Command(name string, command string) error
+	Group(name string) error
+	Pattern(name string) error
+	Occupancy(zone string) (int, error)       // of the main zone when ""
+	Present(actor, zone string) (bool, error) // in the main zone when ""
+	Profile() string
+	SetProfile(name string) error
+	Alert(msg string)
+}
+
+type Script struct {
+	file    string
+	global  *env
+	steps   int
+	alloc   int
+	timeout time.Duration
+	lock    sync.Mutex // a script handles one event at a time
+}
+
+func (s *Script) String() string {
+	return fmt.Sprintf("Script {file: %s, steps: %d, timeout: %v}", s.file, s.steps, s.timeout)
+}
+
+// controller wraps the controller as script functions.
+func controller(c Controller) map[Symbol]any {
+	one := func(name string, fn func(s string) (any, error)) Builtin {
+		return func(args []any) (any, error) {
+			if err := arity(name, 1, args); err != nil {
+				return nil, err
+			}
+			s, err := stringArg(name, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return fn(s)
+		}
+	}
+	return map[Symbol]any{
+		"state": one("state", func(name string) (any, error) { return c.State(name) }),
+		// (command switch "on"|"off"|"toggle"|"press")
+		"command": Builtin(func(args []any) (any, error) {
+			if err := arity("command", 2, args); err != nil {
+				return nil, err
+			}
+			name, err := stringArg("command", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			command, err := stringArg("command", args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return nil, c.Command(name, command)
+		}),
+		// (group name), which keeps running after the call returns
+		"group": one("group", func(name string) (any, error) { return nil, c.Group(name) }),
+		// (pattern name), which keeps playing after the call returns
+		"pattern": one("pattern", func(name string) (any, error) { return nil, c.Pattern(name) }),
+		// (occupancy [zone])
+		"occupancy": Builtin(func(args []any) (any, error) {
+			zone, err := zoneArg("occupancy", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			n, err := c.Occupancy(zone)
+			return float64(n), err
+		}),
+		// (present actor [zone])
+		"present": Builtin(func(args []any) (any, error) {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("present takes at least 1 argument")
+			}
+			actor, err := stringArg("present", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			zone, err := zoneArg("present", args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return c.Present(actor, zone)
+		}),
+		"profile": Builtin(func(args []any) (any, error) {
+			return c.Profile(), nil
+		}),
+		"set-profile": one("set-profile", func(name string) (any, error) { return nil, c.SetProfile(name) }),
+		"alert":       one("alert", func(msg string) (any, error) { c.Alert(msg); return nil, nil }),
+	}
+}
+
+func (s *Script) interp() *interp {
+	return &interp{steps: s.steps, alloc: s.alloc, deadline: time.Now().Add(s.timeout)}
+}
+
+// value converts an event to the map scripts receive.
+func value(e bus.Event) map[string]any {
+	return map[string]any{
+		"kind":      string(e.Kind),
+		"name":      e.Name,
+		"action":    e.Action,
+		"detail":    e.Detail,
+		"direction": e.Direction,
+		"value":     e.Value,
+		"epoch":     float64(e.Epoch.Unix()),
+	}
+}
+
+// Handle calls the script's on-event with e. A panic, e.g. of a controller
+// function, fails the event rather than the script.
+func (s *Script) Handle(e bus.Event) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("script %s: %s: panicked: %v", s.file, e.String(), r)
+		}
+	}()
+	in := s.interp()
+	f := s.global.vars[handler]
+	if _, err := in.apply(f, []any{value(e)}); err != nil {
+		return fmt.Errorf("script %s: %s: %w", s.file, e.String(), err)
+	}
+	return nil
+}
+
+// Run hands events published on b to the script until the bus subscription
+// is cancelled, which it is when Run stops.
+func (s *Script) Run(b *bus.Bus) {
+	events, cancel := b.Subscribe(64)
+	defer cancel()
+	for e := range events {
+		if err := s.Handle(e); err != nil {
+			log.Error(err.Error())
+		}
+	}
+}
+
+// Load reads and runs a script file, whose top level may define helpers and
+// state kept between events, and must define on-event.
+func Load(c config.Script, ctl Controller) (*Script, error) {
+	src, err := os.ReadFile(c.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+	exprs, err := Read(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", c.File, err)
+	}
+	s := &Script{
+		file:    c.File,
+		global:  newEnv(nil),
+		steps:   c.MaxSteps,
+		alloc:   c.MaxAlloc,
+		timeout: time.Duration(c.TimeoutMs) * time.Millisecond,
+	}
+	if s.steps <= 0 {
+		s.steps = DefaultMaxSteps
+	}
+	if s.alloc <= 0 {
+		s.alloc = DefaultMaxAlloc
+	}
+	if s.timeout <= 0 {
+		s.timeout = time.Duration(DefaultTimeoutMs) * time.Millisecond
+	}
+	for _, vars := range []map[Symbol]any{builtins(), controller(ctl)} {
+		for k, v := range vars {
+			s.global.vars[k] = v
+		}
+	}
+	if _, err := s.interp().body(exprs, s.global); err != nil {
+		return nil, fmt.Errorf("script %s: %w", c.File, err)
+	}
+	if _, ok := s.global.vars[handler].(*lambda); !ok {
+		return nil, fmt.Errorf("script %s does not define (%s e)", c.File, handler)
+	}
+	return s, nil
+}
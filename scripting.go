@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/radar"
+)
+
+// scripted is the controller a rules script sees. Its switch commands are
+// automation, so pinned switches and those changed by hand are left alone.
+type scripted struct {
+	b    *Beaves
+	file string
+}
+
+func (s scripted) State(name string) (string, error) {
+	sw, ok := s.b.Switches[name]
+	if !ok {
+		return "", fmt.Errorf("unknown switch %q", name)
+	}
+	return strings.ToLower(sw.State().String()), nil
+}
+
+func (s scripted) Command(name string, command string) error {
+	cause := audit.Cause{Kind: "script", By: s.file}
+	if _, ok := s.b.Switches[name]; ok && !s.b.automatic(name, cause) {
+		return nil
+	}
+	return s.b.Command(name, command, cause)
+}
+
+// Group starts a group as automation; scripts see how it went through its
+// events.
+func (s scripted) Group(name string) error {
+	if _, ok := group(name); !ok {
+		return fmt.Errorf("unknown group %q", name)
+	}
+	go func() {
+		if err := s.b.AutomateGroup(name, audit.Cause{Kind: "script", By: s.file}); err != nil {
+			log.Error(err.Error())
+		}
+	}()
+	return nil
+}
+
+// Pattern starts playing a pattern as automation.
+func (s scripted) Pattern(name string) error {
+	if _, ok := s.b.Patterns[name]; !ok {
+		return fmt.Errorf("unknown pattern %q", name)
+	}
+	go func() {
+		if err := s.b.AutomatePlay(name, audit.Cause{Kind: "script", By: s.file}); err != nil {
+			log.Error(err.Error())
+		}
+	}()
+	return nil
+}
+
+func (s scripted) Occupancy(zone string) (int, error) {
+	presence, err := s.b.presence(zone)
+	if err != nil {
+		return 0, err
+	}
+	return presence.Occupancy(), nil
+}
+
+// Present reports whether an actor, by ID or name, is in a zone.
+func (s scripted) Present(actor, zone string) (bool, error) {
+	presence, err := s.b.presence(zone)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range presence.Snapshot() {
+		if strings.EqualFold(string(p.Actor), actor) || strings.EqualFold(p.Name, actor) {
+			return p.State == radar.Present, nil
+		}
+	}
+	return false, nil
+}
+
+func (s scripted) Profile() string {
+	return s.b.Profiles.Active().Name
+}
+
+func (s scripted) SetProfile(name string) error {
+	return s.b.Profiles.Set(name, "script")
+}
+
+func (s scripted) Alert(msg string) {
+	log.Error("alert from script %s: %s", s.file, msg)
+	s.b.Events.Publish(bus.Event{Kind: bus.Alert, Name: "script", Detail: msg})
+}
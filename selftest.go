@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/radar"
+	"tinygo.org/x/bluetooth"
+)
+
+const (
+	selfTestClick         = 500 * time.Millisecond
+	selfTestAdvertisement = 3 * time.Second
+)
+
+// selfTest exercises the hardware of a fresh install: every configured
+// switch, the buzzer and advertising. It claims the pins itself, so the
+// sentry must not be running.
+func selfTest(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: beaves self-test")
+	}
+	r := &readiness{}
+	in := bufio.NewReader(os.Stdin)
+
+	fmt.Println("switches")
+	switches, err := controller.NewSwitches(config.RuntimeConfig.Switches, func(name string, msg string) {
+		fmt.Printf("  alert %s: %s\n", name, msg)
+	})
+	if err != nil {
+		r.fail("%v (is beaves running?)", err)
+	}
+	names := []string{}
+	for name := range switches {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Printf("  click %s briefly? [y/N] ", name)
+		answer, _ := in.ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			r.warn("%s skipped", name)
+			continue
+		}
+		if err := click(switches[name]); err != nil {
+			r.fail("%s: %v", name, err)
+			continue
+		}
+		r.ok("%s clicked and restored to %s", name, switches[name].State())
+	}
+
+	fmt.Println("buzzer")
+	if !config.RuntimeConfig.Buzzer.Enabled {
+		r.warn("not enabled")
+	} else if buzzer, err := controller.NewBuzzer(config.RuntimeConfig.Buzzer); err != nil {
+		r.fail("%v (is beaves running?)", err)
+	} else {
+		for _, c := range []controller.Chirp{controller.EnteringChirp, controller.ExitingChirp, controller.EnrollmentChirp, controller.ErrorChirp} {
+			if err := buzzer.Play(c); err != nil {
+				r.fail("%v", err)
+				continue
+			}
+			r.ok("played %s", c)
+			time.Sleep(selfTestClick)
+		}
+	}
+
+	fmt.Println("advertising")
+	for _, s := range sentryConfigs() {
+		if err := advertise(s.Adapter, s.Bluetooth); err != nil {
+			r.fail("%s: %v", s.Adapter, err)
+		} else {
+			r.ok("%s advertised as %q for %v", s.Adapter, s.AdvertisementName, selfTestAdvertisement)
+		}
+	}
+
+	if r.failed > 0 {
+		return fmt.Errorf("self-test failed: %d checks failed", r.failed)
+	}
+	fmt.Println("self-test passed")
+	return nil
+}
+
+// click flips a switch and, after a moment, puts it back as it was.
+func click(s controller.Switch) error {
+	if err := s.Toggle(); err != nil {
+		return err
+	}
+	time.Sleep(selfTestClick)
+	return s.Toggle()
+}
+
+// advertise registers a test advertisement with BlueZ on an adapter and
+// withdraws it, leaving the adapter as discoverable as it found it.
+func advertise(id string, c config.Bluetooth) (err error) {
+	adapter, err := radar.NewBlueZAdapter(id)
+	if err != nil {
+		return err
+	}
+	if !adapter.Present() {
+		return fmt.Errorf("adapter %s is not known to BlueZ", id)
+	}
+	v, err := adapter.Property("Discoverable")
+	if err != nil {
+		return err
+	}
+	discoverable, _ := v.Value().(bool)
+	defer func() {
+		// NOTE: starting the advertisement makes the adapter discoverable,
+		// and stopping it only puts that back when it succeeds
+		if restoreErr := adapter.SetProperty("Discoverable", discoverable); restoreErr != nil && err == nil {
+			err = restoreErr
+		}
+	}()
+	ad := adapter.NewAdvertisement()
+	err = ad.Configure(radar.AdvertisementOptions{
+		AdvertisementOptions: bluetooth.AdvertisementOptions{
+			LocalName:         c.AdvertisementName,
+			AdvertisementType: bluetooth.AdvertisingTypeInd,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := ad.Start(); err != nil {
+		return err
+	}
+	time.Sleep(selfTestAdvertisement)
+	return ad.Stop()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/robolivable/beaves/log"
+)
+
+var (
+	cleanups     []func() error
+	cleanupsLock sync.Mutex
+	shutdownOnce sync.Once
+)
+
+// ShutdownOn registers cleanups to run, most recent first, before the process
+// exits on SIGINT or SIGTERM.
+func ShutdownOn(c ...func() error) {
+	cleanupsLock.Lock()
+	cleanups = append(cleanups, c...)
+	cleanupsLock.Unlock()
+	shutdownOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			log.Info("received %s; shutting down", sig)
+			cleanup()
+			os.Exit(0)
+		}()
+	})
+}
+
+func cleanup() {
+	cleanupsLock.Lock()
+	defer cleanupsLock.Unlock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		if err := cleanups[i](); err != nil {
+			log.Error("cleanup failed: %s", err.Error())
+		}
+	}
+	cleanups = nil
+}
+
+// Restart runs the cleanups and starts beaves over, e.g. to load a changed
+// config.
+func Restart() error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to restart: %w", err)
+	}
+	log.Info("restarting")
+	cleanup()
+	return syscall.Exec(self, os.Args, os.Environ())
+}
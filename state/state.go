@@ -0,0 +1,83 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/radar"
+)
+
+const (
+	DefaultFile      = "state.json"
+	DefaultPersistMs = 60000
+)
+
+type Timer struct {
+	Switch   string    `json:"switch"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// Snapshot is the runtime state that must survive a crash or reboot.
+type Snapshot struct {
+	Epoch    time.Time                   `json:"epoch"`
+	Presence []radar.Presence            `json:"presence,omitempty"` // main zone, from before zones were kept
+	Zones    map[string][]radar.Presence `json:"zones"`              // presence by zone name
+	Timers   []Timer                     `json:"timers"`             // pending auto-off cutoffs
+	Cycles   map[string]uint64           `json:"cycles"`             // relay wear by switch
+	Energy   float64                     `json:"energyKWh"`          // pulse meter reading
+	Pulses   uint64                      `json:"pulses"`             // counted towards the reading
+	Profile  string                      `json:"profile"`
+	Pins     []controller.Pin            `json:"pins"` // manual overrides
+	Seen     []radar.Seen                `json:"seen"` // when each actor was last detected
+}
+
+// Load reads a snapshot from path. A missing file is not an error and yields
+// an empty snapshot.
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state %s: %w", path, err)
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode state %s: %w", path, err)
+	}
+	return snapshot, nil
+}
+
+// Save writes the snapshot to a temporary file, syncs it, and renames it over
+// path so a crash never leaves a truncated state file behind.
+func Save(path string, snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to persist state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to persist state: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to persist state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to persist state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to persist state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/clock"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/cron"
+	"github.com/robolivable/beaves/history"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/report"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+// reportDays is how many whole days each report period covers.
+var reportDays = map[string]int{"daily": 1, "weekly": 7}
+
+// summarize reports on the whole days of a period before the day of now.
+func summarize(store *history.Store, period string, now time.Time) (string, error) {
+	n, ok := reportDays[period]
+	if !ok {
+		return "", fmt.Errorf("unknown report period %q", period)
+	}
+	today := clock.Local(now)
+	from := time.Date(today.Year(), today.Month(), today.Day()-n, 0, 0, 0, 0, today.Location())
+	events, err := store.Read(from)
+	if err != nil {
+		return "", err
+	}
+	return report.Format(fmt.Sprintf("beaves %s report", period), report.Days(events, from, n)), nil
+}
+
+// Report publishes the summary of a period, for triggers to deliver, and
+// appends it to the report file when one is configured.
+func (b *Beaves) Report(period string) error {
+	summary, err := summarize(b.History, period, time.Now())
+	if err != nil {
+		return err
+	}
+	b.Events.Publish(bus.Event{Kind: bus.Report, Name: period, Detail: summary})
+	file := config.RuntimeConfig.Report.File
+	if file == "" {
+		return nil
+	}
+	path := config.StatePath(file, "")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open report file %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s\n", summary); err != nil {
+		return fmt.Errorf("failed to write report file %s: %w", path, err)
+	}
+	return nil
+}
+
+// ScheduleReports runs the configured reports on their cron schedules, once
+// the clock is trusted.
+func (b *Beaves) ScheduleReports(c config.Report) error {
+	for period, expr := range map[string]string{"daily": c.Daily, "weekly": c.Weekly} {
+		if expr == "" {
+			continue
+		}
+		s, err := cron.Parse(expr)
+		if err != nil {
+			return fmt.Errorf("%s report: %w", period, err)
+		}
+		supervisor.Go(period+" report", func() {
+			s.Run(b.Clock.Ready(), func() {
+				if err := b.Report(period); err != nil {
+					log.Error(err.Error())
+				}
+			})
+		})
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Package supervisor keeps long running components going: a panic is logged
+// with its stack trace and the component is started again after a backoff,
+// instead of taking the whole process down.
+package supervisor
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	MinBackoff = time.Second
+	MaxBackoff = time.Minute
+)
+
+// Recover logs a panic of the calling goroutine with its stack trace and
+// swallows it, e.g. for one-off tasks. It must be deferred.
+func Recover(name string) {
+	if r := recover(); r != nil {
+		log.Error("%s panicked: %v\n%s", name, r, debug.Stack())
+	}
+}
+
+// once runs fn, turning a panic into an error.
+func once(name string, fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("%s panicked: %v\n%s", name, r, debug.Stack())
+			err = fmt.Errorf("%s panicked: %v", name, r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+// Run runs fn until it returns normally, starting it again whenever it
+// panics. The backoff doubles with every panic up to MaxBackoff, and starts
+// over once fn has run for longer than that.
+func Run(name string, fn func()) {
+	backoff := MinBackoff
+	for {
+		started := time.Now()
+		if err := once(name, fn); err == nil {
+			return
+		}
+		if time.Since(started) > MaxBackoff {
+			backoff = MinBackoff
+		}
+		log.Info("restarting %s in %v", name, backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, MaxBackoff)
+	}
+}
+
+// Go runs fn under supervision in its own goroutine.
+func Go(name string, fn func()) {
+	go Run(name, fn)
+}
@@ -0,0 +1,241 @@
+package supervisor
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/log"
+)
+
+// Policy decides whether a component is started again once it stops.
+type Policy string
+
+const (
+	Permanent Policy = "permanent" // whenever it stops
+	Transient Policy = "transient" // only after a panic
+	Temporary Policy = "temporary" // never
+)
+
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case Permanent, Transient, Temporary:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown restart policy %q, expected %q, %q or %q", s, Permanent, Transient, Temporary)
+}
+
+type State string
+
+const (
+	Pending    State = "pending"
+	Running    State = "running"
+	Restarting State = "restarting"
+	Stopped    State = "stopped"
+	Failed     State = "failed"
+	Degraded   State = "degraded" // not started, beaves carries on without it
+)
+
+// Component is a part of beaves started by a Tree. Init prepares it, after
+// the components it needs; Run, if set, is its long running part.
+type Component struct {
+	Name     string
+	Needs    []string // started first; it is degraded without them
+	After    []string // started first if present, but not needed
+	Policy   Policy   // defaults to Transient
+	Optional bool     // failing to initialize degrades it instead of startup
+	Init     func() error
+	Run      func()
+}
+
+// Status is how a component is doing.
+type Status struct {
+	Name     string    `json:"name"`
+	State    State     `json:"state"`
+	Policy   Policy    `json:"policy"`
+	Restarts int       `json:"restarts"`
+	Error    string    `json:"error,omitempty"` // why it last failed or panicked
+	Since    time.Time `json:"since"`           // when State last changed
+}
+
+func (s Status) String() string {
+	return fmt.Sprintf("Status {name: %s, state: %s, restarts: %d}", s.Name, s.State, s.Restarts)
+}
+
+// Tree starts components in dependency order and supervises each according
+// to its restart policy, so one failing integration doesn't take down the
+// others.
+type Tree struct {
+	components []Component
+	status     map[string]*Status
+	policies   map[string]Policy // configured, overriding the components'
+	lock       sync.Mutex
+}
+
+func (t *Tree) String() string {
+	return fmt.Sprintf("Tree {components: %d}", len(t.components))
+}
+
+func (t *Tree) Add(c Component) {
+	if c.Policy == "" {
+		c.Policy = Transient
+	}
+	if p, ok := t.policies[c.Name]; ok {
+		c.Policy = p
+	}
+	t.components = append(t.components, c)
+	t.status[c.Name] = &Status{Name: c.Name, State: Pending, Policy: c.Policy, Since: time.Now()}
+}
+
+func (t *Tree) set(name string, state State, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s := t.status[name]
+	if state == Restarting {
+		s.Restarts++
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if s.State != state {
+		s.State, s.Since = state, time.Now()
+	}
+}
+
+// order sorts the components so every one comes after those it needs.
+func (t *Tree) order() ([]Component, error) {
+	byName := map[string]Component{}
+	for _, c := range t.components {
+		byName[c.Name] = c
+	}
+	ordered := []Component{}
+	visiting := map[string]bool{}
+	done := map[string]bool{}
+	var visit func(c Component) error
+	visit = func(c Component) error {
+		if done[c.Name] {
+			return nil
+		}
+		if visiting[c.Name] {
+			return fmt.Errorf("component %q depends on itself", c.Name)
+		}
+		visiting[c.Name] = true
+		for _, n := range c.Needs {
+			if _, ok := byName[n]; !ok {
+				return fmt.Errorf("component %q needs unknown component %q", c.Name, n)
+			}
+		}
+		for _, n := range append(slices.Clone(c.Needs), c.After...) {
+			need, ok := byName[n]
+			if !ok {
+				continue
+			}
+			if err := visit(need); err != nil {
+				return err
+			}
+		}
+		done[c.Name] = true
+		ordered = append(ordered, c)
+		return nil
+	}
+	for _, c := range t.components {
+		if err := visit(c); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// supervise runs a component's long running part according to its policy.
+func (t *Tree) supervise(c Component) {
+	backoff := MinBackoff
+	for {
+		t.set(c.Name, Running, nil)
+		started := time.Now()
+		err := once(c.Name, c.Run)
+		if err == nil && c.Policy != Permanent || c.Policy == Temporary {
+			t.set(c.Name, Stopped, err)
+			log.Info("%s stopped", c.Name)
+			return
+		}
+		if time.Since(started) > MaxBackoff {
+			backoff = MinBackoff
+		}
+		t.set(c.Name, Restarting, err)
+		log.Info("restarting %s in %v", c.Name, backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, MaxBackoff)
+	}
+}
+
+// Start initializes every component in dependency order, then starts their
+// long running parts. It stops at the first component failing to initialize,
+// unless it is optional: then it and the components needing it are degraded.
+func (t *Tree) Start() error {
+	for name := range t.policies {
+		if !slices.ContainsFunc(t.components, func(c Component) bool { return c.Name == name }) {
+			return fmt.Errorf("restart policy for unknown component %q", name)
+		}
+	}
+	ordered, err := t.order()
+	if err != nil {
+		return err
+	}
+	degraded := map[string]bool{}
+	for _, c := range ordered {
+		if i := slices.IndexFunc(c.Needs, func(n string) bool { return degraded[n] }); i >= 0 {
+			degraded[c.Name] = true
+			t.set(c.Name, Degraded, fmt.Errorf("needs %s", c.Needs[i]))
+			log.Error("%s degraded: needs %s", c.Name, c.Needs[i])
+			continue
+		}
+		if c.Init != nil {
+			if err := c.Init(); err != nil && c.Optional {
+				degraded[c.Name] = true
+				t.set(c.Name, Degraded, err)
+				log.Error("%s degraded: %s", c.Name, err.Error())
+				continue
+			} else if err != nil {
+				t.set(c.Name, Failed, err)
+				return fmt.Errorf("failed to start %s: %w", c.Name, err)
+			}
+		}
+		if c.Run == nil {
+			t.set(c.Name, Running, nil)
+			continue
+		}
+		go t.supervise(c)
+	}
+	return nil
+}
+
+// Degraded returns the status of the components beaves runs without.
+func (t *Tree) Degraded() []Status {
+	return slices.DeleteFunc(t.Status(), func(s Status) bool { return s.State != Degraded })
+}
+
+// Status returns the status of every component, in the order they were added.
+func (t *Tree) Status() []Status {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	statuses := []Status{}
+	for _, c := range t.components {
+		statuses = append(statuses, *t.status[c.Name])
+	}
+	return statuses
+}
+
+// NewTree makes a tree whose components follow the configured restart
+// policies, by component name, over their own.
+func NewTree(policies map[string]string) (*Tree, error) {
+	t := &Tree{status: map[string]*Status{}, policies: map[string]Policy{}}
+	for name, s := range policies {
+		p, err := ParsePolicy(s)
+		if err != nil {
+			return nil, fmt.Errorf("component %q: %w", name, err)
+		}
+		t.policies[name] = p
+	}
+	return t, nil
+}
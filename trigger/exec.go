@@ -0,0 +1,102 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+)
+
+// maxOutput is how much of a failed command's output is reported.
+const maxOutput = 512
+
+// command is a hook run for matching events, its arguments templates over the
+// event. It runs without a shell, in its own process group, with only PATH and
+// the event in its environment, and optionally as another user.
+type command struct {
+	args       []*template.Template
+	dir        string
+	credential *syscall.Credential
+	timeout    time.Duration
+}
+
+func newCommand(args []string, dir, username string, timeout time.Duration) (*command, error) {
+	c := &command{dir: dir, timeout: timeout}
+	for i, a := range args {
+		t, err := parse(fmt.Sprintf("exec argument %d", i), a)
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, t)
+	}
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			return nil, fmt.Errorf("trigger exec user: %w", err)
+		}
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		c.credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	}
+	return c, nil
+}
+
+// environment passes the event to the command as BEAVES_* variables.
+func environment(e bus.Event) []string {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"BEAVES_KIND=" + string(e.Kind),
+		"BEAVES_NAME=" + e.Name,
+		"BEAVES_ACTION=" + e.Action,
+		"BEAVES_DETAIL=" + e.Detail,
+		"BEAVES_EPOCH=" + e.Epoch.Format(time.RFC3339),
+	}
+	if e.Direction != "" {
+		env = append(env, "BEAVES_DIRECTION="+e.Direction)
+	}
+	return env
+}
+
+func (c *command) run(e bus.Event) error {
+	args := make([]string, len(c.args))
+	for i, t := range c.args {
+		var b bytes.Buffer
+		if err := t.Execute(&b, e); err != nil {
+			return fmt.Errorf("failed to render trigger exec argument: %w", err)
+		}
+		args[i] = b.String()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = c.dir
+	cmd.Env = environment(e)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: c.credential}
+	// take down anything the command started along with it
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	cmd.WaitDelay = time.Second
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %v", args[0], c.timeout)
+	}
+	if err != nil {
+		output := strings.TrimSpace(out.String())
+		if len(output) > maxOutput {
+			output = output[:maxOutput] + "..."
+		}
+		return fmt.Errorf("%s failed: %w: %s", args[0], err, output)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package trigger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/clock"
+)
+
+// funcs are available to templates besides the event's fields, e.g.
+// {{.Epoch | local "15:04"}} or {"text": {{printf "%s arrived" .Name | json}}}.
+var funcs = template.FuncMap{
+	"local": func(layout string, t time.Time) string { return clock.Local(t).Format(layout) },
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parse reads a template over events, trying it on an empty event so that
+// misspelled fields are reported at startup rather than when it first fires.
+func parse(name string, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trigger %s: %w", name, err)
+	}
+	if err := t.Execute(io.Discard, bus.Event{}); err != nil {
+		return nil, fmt.Errorf("invalid trigger %s: %w", name, err)
+	}
+	return t, nil
+}
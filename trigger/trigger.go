@@ -0,0 +1,201 @@
+// Package trigger fires outbound HTTP requests, such as IFTTT Webhooks, or
+// runs commands when matching events are published on the bus.
+package trigger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/filter"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultTimeoutMs = 10000
+
+	iftttURL = "https://maker.ifttt.com/trigger/%s/with/key/%s"
+)
+
+type Trigger struct {
+	kind      bus.Kind
+	action    string
+	direction string
+	filter    *filter.Filter
+	target    string   // for logging; never includes the IFTTT key
+	exec      *command // run instead of sending a request
+	method    string
+	url       *template.Template
+	body      *template.Template
+	values    []*template.Template // IFTTT value1 to value3, sent as the body
+	headers   map[string]string
+	interval  time.Duration
+	client    *http.Client
+
+	last map[string]time.Time // by event name
+}
+
+func (t *Trigger) String() string {
+	return fmt.Sprintf("Trigger {kind: %s, action: %s, target: %s}", t.kind, t.action, t.target)
+}
+
+func (t *Trigger) Matches(e bus.Event) bool {
+	return e.Kind == t.kind && (t.action == "" || strings.EqualFold(t.action, e.Action)) &&
+		(t.direction == "" || strings.EqualFold(t.direction, e.Direction)) && t.filter.Match(e)
+}
+
+// Fire sends the request for e, or runs the command, unless the trigger fired for the same name
+// within its minimum interval. It reports whether the request was sent.
+func (t *Trigger) Fire(e bus.Event) (bool, error) {
+	if last, ok := t.last[e.Name]; ok && time.Since(last) < t.interval {
+		return false, nil
+	}
+	if t.exec != nil {
+		t.last[e.Name] = time.Now()
+		if err := t.exec.run(e); err != nil {
+			return false, fmt.Errorf("failed to fire trigger: %w", err)
+		}
+		return true, nil
+	}
+	var url, body bytes.Buffer
+	if err := t.url.Execute(&url, e); err != nil {
+		return false, fmt.Errorf("failed to render trigger url: %w", err)
+	}
+	if err := t.render(&body, e); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(t.method, url.String(), &body)
+	if err != nil {
+		return false, err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.last[e.Name] = time.Now()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to fire trigger: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return false, fmt.Errorf("failed to fire trigger: %s", resp.Status)
+	}
+	return true, nil
+}
+
+// render writes the body of the request for e.
+func (t *Trigger) render(w io.Writer, e bus.Event) error {
+	if t.values == nil {
+		if err := t.body.Execute(w, e); err != nil {
+			return fmt.Errorf("failed to render trigger body: %w", err)
+		}
+		return nil
+	}
+	values := map[string]string{}
+	for i, v := range t.values {
+		var b bytes.Buffer
+		if err := v.Execute(&b, e); err != nil {
+			return fmt.Errorf("failed to render ifttt value%d: %w", i+1, err)
+		}
+		values[fmt.Sprintf("value%d", i+1)] = b.String()
+	}
+	return json.NewEncoder(w).Encode(values)
+}
+
+// Run fires triggers for events published on b until the bus subscription is
+// cancelled.
+func Run(b *bus.Bus, triggers []*Trigger) {
+	events, _ := b.Subscribe(64)
+	for e := range events {
+		for _, t := range triggers {
+			if !t.Matches(e) {
+				continue
+			}
+			fired, err := t.Fire(e)
+			if err != nil {
+				log.Error("%s: %s", t.String(), err.Error())
+				continue
+			}
+			if fired {
+				log.Rules.Debug("fired %s for %s", t.String(), e.String())
+			}
+		}
+	}
+}
+
+func New(c config.Trigger) (*Trigger, error) {
+	kind, action, _ := strings.Cut(c.Event, ":")
+	action, direction, _ := strings.Cut(action, ":")
+	t := &Trigger{
+		kind:      bus.Kind(kind),
+		action:    action,
+		direction: direction,
+		method:    strings.ToUpper(c.Method),
+		headers:   c.Headers,
+		interval:  time.Duration(c.MinIntervalMs) * time.Millisecond,
+		last:      map[string]time.Time{},
+	}
+	var err error
+	if t.filter, err = filter.Parse(c.Filter); err != nil {
+		return nil, fmt.Errorf("trigger for %q: %w", c.Event, err)
+	}
+	timeout := c.TimeoutMs
+	if timeout == 0 {
+		timeout = DefaultTimeoutMs
+	}
+	if len(c.Exec) > 0 {
+		t.target = "exec/" + c.Exec[0]
+		if t.exec, err = newCommand(c.Exec, c.Dir, c.User, time.Duration(timeout)*time.Millisecond); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	url, body := c.URL, c.Body
+	t.target = url
+	if c.IFTTT.Key != "" {
+		t.target = "ifttt/" + c.IFTTT.Event
+		url = fmt.Sprintf(iftttURL, c.IFTTT.Event, c.IFTTT.Key)
+		// IFTTT passes up to three values on to the applet
+		values := []string{"{{.Name}}", "{{.Action}}", "{{.Detail}}"}
+		if len(c.IFTTT.Values) > 3 {
+			return nil, fmt.Errorf("trigger for %q has more than 3 ifttt values", c.Event)
+		}
+		if len(c.IFTTT.Values) > 0 {
+			values = c.IFTTT.Values
+		}
+		for i, v := range values {
+			value, err := parse(fmt.Sprintf("ifttt value%d", i+1), v)
+			if err != nil {
+				return nil, err
+			}
+			t.values = append(t.values, value)
+		}
+		t.method = http.MethodPost
+		if t.headers == nil {
+			t.headers = map[string]string{}
+		}
+		t.headers["Content-Type"] = "application/json"
+	}
+	if url == "" {
+		return nil, fmt.Errorf("trigger for %q requires a url, ifttt key or exec", c.Event)
+	}
+	if t.method == "" {
+		t.method = http.MethodPost
+	}
+	if t.url, err = parse("url", url); err != nil {
+		return nil, err
+	}
+	if t.body, err = parse("body", body); err != nil {
+		return nil, err
+	}
+	t.client = &http.Client{Timeout: time.Duration(timeout) * time.Millisecond}
+	return t, nil
+}
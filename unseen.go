@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/radar"
+)
+
+const unseenInterval = time.Hour
+
+// WatchUnseen raises an unseen alert for every watched actor that hasn't been
+// detected for the configured days, once the clock is trusted and hourly
+// after. An actor never seen counts from startup. Each actor is alerted on
+// once until it is seen again.
+func (b *Beaves) WatchUnseen() {
+	<-b.Clock.Ready()
+	started := time.Now()
+	alerted := map[radar.ID]time.Time{} // when the actor was last seen, as of its alert
+	for {
+		b.unseen(config.RuntimeConfig.Unseen, started, alerted, time.Now())
+		time.Sleep(unseenInterval)
+	}
+}
+
+func (b *Beaves) unseen(c config.Unseen, started time.Time, alerted map[radar.ID]time.Time, now time.Time) {
+	actors := c.Actors
+	if len(actors) == 0 {
+		actors = config.RuntimeConfig.Actors.Known
+	}
+	for _, actor := range actors {
+		id := radar.ID(actorID(actor))
+		last, seen := b.Seen.Get(id)
+		since := last
+		if !seen {
+			since = started
+		}
+		if now.Before(since.AddDate(0, 0, c.Days)) {
+			continue
+		}
+		if at, ok := alerted[id]; ok && at.Equal(last) {
+			continue
+		}
+		alerted[id] = last
+		detail := fmt.Sprintf("%s not seen for %d days", radar.FriendlyName(id), int(now.Sub(since).Hours()/24))
+		if !seen {
+			detail = fmt.Sprintf("%s not seen since startup %d days ago", radar.FriendlyName(id), int(now.Sub(since).Hours()/24))
+		}
+		log.Error("unseen: %s", detail)
+		b.Events.Publish(bus.Event{Kind: bus.Alert, Name: "unseen", Detail: detail, By: radar.FriendlyName(id)})
+	}
+}
@@ -0,0 +1,355 @@
+// Package update replaces the running binary with signed releases published
+// at a URL, and rolls back when a new binary doesn't prove healthy.
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultCheckMs     = 86400000
+	DefaultProbationMs = 300000
+
+	fetchTimeout = 5 * time.Minute
+	maxBinary    = 256 << 20
+)
+
+// Release describes the latest build, as published at the configured URL.
+type Release struct {
+	Version   string `json:"version"`
+	URL       string `json:"url"`       // of the binary
+	SHA256    string `json:"sha256"`    // hex digest of the binary
+	Signature string `json:"signature"` // base64 ed25519 signature of the manifest
+}
+
+// Manifest is what a release's signature covers: its version and the digest
+// of its binary, so neither can be swapped for an older, also signed, one.
+func (r Release) Manifest() []byte {
+	return []byte(r.Version + "\n" + strings.ToLower(r.SHA256))
+}
+
+// newer reports whether release is a later version than running, comparing
+// dotted numbers. Any release is newer than a dev build.
+func newer(release, running string) bool {
+	parse := func(v string) ([]int, bool) {
+		v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-")
+		var parts []int
+		for _, p := range strings.Split(v, ".") {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, false
+			}
+			parts = append(parts, n)
+		}
+		return parts, true
+	}
+	r, ok := parse(release)
+	if !ok {
+		return false
+	}
+	current, ok := parse(running)
+	if !ok {
+		return true
+	}
+	for i := 0; i < max(len(r), len(current)); i++ {
+		a, b := 0, 0
+		if i < len(r) {
+			a = r[i]
+		}
+		if i < len(current) {
+			b = current[i]
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+type Updater struct {
+	url       string
+	key       ed25519.PublicKey
+	interval  time.Duration
+	probation time.Duration
+	binary    string
+	running   string // version
+	dir       string // where the files below are kept
+
+	Healthy func() error // asked once a new binary has been up for the probation
+	Restart func() error // starts the binary over
+}
+
+func (u *Updater) String() string {
+	return fmt.Sprintf("Updater {url: %s, binary: %s}", u.url, u.binary)
+}
+
+// previous is a copy of the binary kept for rolling back; pending, while it
+// exists, counts the starts of a new binary that isn't confirmed yet; failed
+// lists the digests of binaries rolled back, which aren't installed again.
+// They are kept in the state directory; only the binary being swapped in is
+// staged next to the running one, so the swap is a rename.
+func (u *Updater) previous() string { return filepath.Join(u.dir, filepath.Base(u.binary)+".prev") }
+func (u *Updater) pending() string  { return filepath.Join(u.dir, filepath.Base(u.binary)+".pending") }
+func (u *Updater) failed() string   { return filepath.Join(u.dir, filepath.Base(u.binary)+".failed") }
+func (u *Updater) staged() string   { return u.binary + ".new" }
+
+// Files are those kept in the state directory, for moving them there from
+// next to the binary where they were kept before.
+func (u *Updater) Files() []string {
+	return []string{u.previous(), u.pending(), u.failed()}
+}
+
+// install swaps data in as the binary.
+func (u *Updater) install(data []byte) error {
+	if err := os.WriteFile(u.staged(), data, 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(u.staged(), u.binary); err != nil {
+		os.Remove(u.staged())
+		return err
+	}
+	return nil
+}
+
+// restore puts the previous binary back.
+func (u *Updater) restore() error {
+	data, err := os.ReadFile(u.previous())
+	if err != nil {
+		return err
+	}
+	if err := u.install(data); err != nil {
+		return err
+	}
+	return os.Remove(u.previous())
+}
+
+func (u *Updater) rolledBack(sum string) bool {
+	data, err := os.ReadFile(u.failed())
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.EqualFold(strings.TrimSpace(line), sum) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *Updater) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("update: failed to fetch %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("update: failed to fetch %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+func digest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Check installs the published release if it is newer than the running
+// binary and wasn't rolled back before, and restarts into it.
+func (u *Updater) Check() error {
+	if _, err := os.Stat(u.pending()); err == nil {
+		return nil // still on probation
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	resp, err := u.get(ctx, u.url)
+	if err != nil {
+		return err
+	}
+	release := Release{}
+	err = json.NewDecoder(resp.Body).Decode(&release)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("update: invalid release: %w", err)
+	}
+	current, err := digest(u.binary)
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	if strings.EqualFold(current, release.SHA256) {
+		return nil
+	}
+	signature, err := base64.StdEncoding.DecodeString(release.Signature)
+	if err != nil {
+		return fmt.Errorf("update: invalid signature of %s: %w", release.Version, err)
+	}
+	if !ed25519.Verify(u.key, release.Manifest(), signature) {
+		return fmt.Errorf("update: %s is not signed by the configured key", release.Version)
+	}
+	if !newer(release.Version, u.running) {
+		return nil
+	}
+	if u.rolledBack(release.SHA256) {
+		return fmt.Errorf("update: %s was rolled back before; skipping it", release.Version)
+	}
+	if resp, err = u.get(ctx, release.URL); err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBinary))
+	if err != nil {
+		return fmt.Errorf("update: failed to download %s: %w", release.Version, err)
+	}
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), release.SHA256) {
+		return fmt.Errorf("update: %s does not match its digest", release.Version)
+	}
+	running, err := os.ReadFile(u.binary)
+	if err != nil {
+		return fmt.Errorf("update: failed to keep the previous binary: %w", err)
+	}
+	if err := os.WriteFile(u.previous(), running, 0o755); err != nil {
+		return fmt.Errorf("update: failed to keep the previous binary: %w", err)
+	}
+	if err := u.install(data); err != nil {
+		os.Remove(u.previous())
+		return fmt.Errorf("update: failed to install %s: %w", release.Version, err)
+	}
+	if err := os.WriteFile(u.pending(), []byte("0"), 0o644); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	log.Info("update: installed %s; restarting into it", release.Version)
+	if err := u.Restart(); err != nil {
+		// NOTE: still running the previous binary, so put it back rather than
+		// leave a probation nothing will end
+		os.Remove(u.pending())
+		if err := u.restore(); err != nil {
+			log.Error("update: failed to put the previous binary back: %s", err.Error())
+		}
+		return fmt.Errorf("update: failed to restart into %s: %w", release.Version, err)
+	}
+	return nil
+}
+
+func (u *Updater) rollback(reason string) error {
+	log.Error("update: rolling back: %s", reason)
+	if sum, err := digest(u.binary); err == nil {
+		f, err := os.OpenFile(u.failed(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err == nil {
+			fmt.Fprintln(f, sum)
+			f.Close()
+		}
+	}
+	if err := u.restore(); err != nil {
+		return fmt.Errorf("update: failed to roll back: %w", err)
+	}
+	os.Remove(u.pending())
+	return u.Restart()
+}
+
+// Start counts the start of a binary installed by Check, as early as
+// possible: one that already started without finishing its probation is
+// rolled back.
+func (u *Updater) Start() error {
+	data, err := os.ReadFile(u.pending())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	starts, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	if starts > 0 {
+		return u.rollback("the new binary stopped before its probation ended")
+	}
+	if err := os.WriteFile(u.pending(), []byte(strconv.Itoa(starts+1)), 0o644); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	return nil
+}
+
+// confirm keeps a new binary once it has stayed up and healthy through the
+// probation, or rolls it back.
+func (u *Updater) confirm() error {
+	if _, err := os.Stat(u.pending()); err != nil {
+		return nil
+	}
+	time.Sleep(u.probation)
+	if u.Healthy != nil {
+		if err := u.Healthy(); err != nil {
+			return u.rollback(err.Error())
+		}
+	}
+	os.Remove(u.pending())
+	os.Remove(u.previous())
+	log.Info("update: the new binary is healthy")
+	return nil
+}
+
+// Run confirms a new binary, then checks for releases periodically.
+func (u *Updater) Run() {
+	if err := u.confirm(); err != nil {
+		log.Error(err.Error())
+	}
+	for {
+		if err := u.Check(); err != nil {
+			log.Error(err.Error())
+		}
+		time.Sleep(u.interval)
+	}
+}
+
+func New(c config.Update, binary string, running string, dir string) (*Updater, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("update url is required")
+	}
+	key, err := hex.DecodeString(c.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("update public key must be %d hex encoded bytes", ed25519.PublicKeySize)
+	}
+	interval := c.CheckMs
+	if interval <= 0 {
+		interval = DefaultCheckMs
+	}
+	probation := c.ProbationMs
+	if probation <= 0 {
+		probation = DefaultProbationMs
+	}
+	return &Updater{
+		url:       c.URL,
+		key:       ed25519.PublicKey(key),
+		interval:  time.Duration(interval) * time.Millisecond,
+		probation: time.Duration(probation) * time.Millisecond,
+		binary:    binary,
+		running:   running,
+		dir:       dir,
+	}, nil
+}
@@ -0,0 +1,188 @@
+// Package vacation makes the house look occupied by replaying a randomly
+// chosen day of recorded switching on the configured lights.
+package vacation
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/bus"
+	"github.com/robolivable/beaves/clock"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/history"
+	"github.com/robolivable/beaves/log"
+)
+
+const (
+	DefaultLookbackDays = 14
+	DefaultJitterMs     = 900000
+
+	// Detail marks switch events caused by the simulation, so they are never
+	// replayed themselves.
+	Detail = "vacation"
+)
+
+type Change struct {
+	Offset time.Duration // time of day, by the wall clock
+	Switch string
+	State  controller.State
+}
+
+// Days groups the recorded On/Off changes of switches by calendar day, leaving
+// out changes made by a previous simulation.
+func Days(events []bus.Event, switches []string) [][]Change {
+	wanted := map[string]bool{}
+	for _, name := range switches {
+		wanted[name] = true
+	}
+	byDay := map[string][]Change{}
+	for _, e := range events {
+		if e.Kind != bus.Switch || !wanted[e.Name] || e.Detail == Detail {
+			continue
+		}
+		state := controller.Unknown
+		switch e.Action {
+		case controller.On.String():
+			state = controller.On
+		case controller.Off.String():
+			state = controller.Off
+		default:
+			continue
+		}
+		epoch := clock.Local(e.Epoch)
+		day := epoch.Format(time.DateOnly)
+		byDay[day] = append(byDay[day], Change{Offset: clock.TimeOfDay(epoch), Switch: e.Name, State: state})
+	}
+	days := [][]Change{}
+	for _, changes := range byDay {
+		days = append(days, changes)
+	}
+	return days
+}
+
+type Simulator struct {
+	store    *history.Store
+	switches []string
+	lookback time.Duration
+	jitter   time.Duration
+	set      func(name string, state controller.State, cause audit.Cause) error
+
+	Clock *clock.Clock // days are planned once it is trusted
+
+	stop chan struct{}
+	lock sync.Mutex
+}
+
+func (s *Simulator) String() string {
+	return fmt.Sprintf("Vacation {switches: %v, running: %v}", s.switches, s.Running())
+}
+
+func (s *Simulator) Running() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stop != nil
+}
+
+// Start begins simulating presence until Stop is called. It does nothing if
+// the simulation is already running.
+func (s *Simulator) Start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	log.Info("simulating presence on %v", s.switches)
+	go s.run(s.stop)
+}
+
+func (s *Simulator) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	s.stop = nil
+	log.Info("stopped simulating presence")
+}
+
+// plan picks a recorded day at random and shifts each of its changes by up to
+// the jitter either way, keeping them within the day.
+func (s *Simulator) plan(now time.Time) []Change {
+	events, err := s.store.Read(now.Add(-s.lookback))
+	if err != nil {
+		log.Error(err.Error())
+		return nil
+	}
+	days := Days(events, s.switches)
+	if len(days) == 0 {
+		log.Rules.DebugMemoize("vacation: no switching recorded in the last %v", s.lookback)
+		return nil
+	}
+	day := days[rand.Intn(len(days))]
+	changes := make([]Change, len(day))
+	for i, c := range day {
+		if s.jitter > 0 {
+			c.Offset += time.Duration(rand.Int63n(int64(2*s.jitter))) - s.jitter
+		}
+		c.Offset = min(max(c.Offset, 0), 24*time.Hour-time.Second)
+		changes[i] = c
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Offset < changes[j].Offset })
+	return changes
+}
+
+func (s *Simulator) run(stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-s.Clock.Ready():
+		}
+		now := clock.Local(time.Now())
+		for _, c := range s.plan(now) {
+			at := clock.On(now, c.Offset)
+			if at.Before(now) {
+				continue
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Until(at)):
+			}
+			log.Rules.Debug("vacation: switching %s %s", c.Switch, c.State)
+			if err := s.set(c.Switch, c.State, audit.Cause{Kind: Detail}); err != nil {
+				log.Error(err.Error())
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Until(clock.On(now.AddDate(0, 0, 1), 0))):
+		}
+	}
+}
+
+func New(c config.Vacation, store *history.Store, set func(name string, state controller.State, cause audit.Cause) error) *Simulator {
+	lookback := c.LookbackDays
+	if lookback <= 0 {
+		lookback = DefaultLookbackDays
+	}
+	jitter := c.JitterMs
+	if jitter <= 0 {
+		jitter = DefaultJitterMs
+	}
+	return &Simulator{
+		store:    store,
+		switches: c.Switches,
+		lookback: time.Duration(lookback) * 24 * time.Hour,
+		jitter:   time.Duration(jitter) * time.Millisecond,
+		set:      set,
+	}
+}
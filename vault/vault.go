@@ -0,0 +1,147 @@
+// Package vault keeps the known actors and their secrets encrypted at rest
+// (AES-256-GCM), so a copy of the SD card doesn't reveal the allow-list.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const KeySize = 32
+
+var header = []byte("beaves-vault-1\n")
+
+type Contents struct {
+	Known   []string                     `json:"known"`
+	Secrets map[string]map[string]string `json:"secrets"` // by actor, then name
+}
+
+type Vault struct {
+	path string
+	aead cipher.AEAD
+
+	Contents
+}
+
+func (v *Vault) String() string {
+	return fmt.Sprintf("Vault {path: %s, known: %d}", v.path, len(v.Known))
+}
+
+// ReadKey loads a hex encoded key, e.g. one made with `openssl rand -hex 32`.
+func ReadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault key %s: %w", path, err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid vault key %s: want %d bytes, got %d", path, KeySize, len(key))
+	}
+	return key, nil
+}
+
+func (v *Vault) Secret(actor string, name string) (string, bool) {
+	secret, ok := v.Secrets[actor][name]
+	return secret, ok
+}
+
+func (v *Vault) Add(actor string) {
+	if !slices.Contains(v.Known, actor) {
+		v.Known = append(v.Known, actor)
+	}
+}
+
+// Remove forgets an actor along with its secrets.
+func (v *Vault) Remove(actor string) bool {
+	i := slices.Index(v.Known, actor)
+	if i < 0 {
+		return false
+	}
+	v.Known = slices.Delete(v.Known, i, i+1)
+	delete(v.Secrets, actor)
+	return true
+}
+
+func (v *Vault) SetSecret(actor string, name string, secret string) {
+	if v.Secrets[actor] == nil {
+		v.Secrets[actor] = map[string]string{}
+	}
+	v.Secrets[actor][name] = secret
+}
+
+// Save encrypts the contents to a temporary file and renames it over the
+// vault, so a crash never leaves it truncated.
+func (v *Vault) Save() error {
+	plain, err := json.Marshal(v.Contents)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data := append(append(append([]byte{}, header...), nonce...), v.aead.Seal(nil, nonce, plain, header)...)
+	tmp, err := os.CreateTemp(filepath.Dir(v.path), filepath.Base(v.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save vault: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save vault: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save vault: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), v.path); err != nil {
+		return fmt.Errorf("failed to save vault: %w", err)
+	}
+	return nil
+}
+
+// Open decrypts the vault at path. A missing file yields an empty vault.
+func Open(path string, key []byte) (*Vault, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vault{path: path, aead: aead, Contents: Contents{Known: []string{}, Secrets: map[string]map[string]string{}}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault %s: %w", path, err)
+	}
+	if len(data) < len(header)+aead.NonceSize() || string(data[:len(header)]) != string(header) {
+		return nil, fmt.Errorf("vault %s is not a beaves vault", path)
+	}
+	data = data[len(header):]
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt vault %s: wrong key or tampered file", path)
+	}
+	if err := json.Unmarshal(plain, &v.Contents); err != nil {
+		return nil, fmt.Errorf("failed to decode vault %s: %w", path, err)
+	}
+	if v.Secrets == nil {
+		v.Secrets = map[string]map[string]string{}
+	}
+	return v, nil
+}
@@ -0,0 +1,54 @@
+// Package version identifies the running build. Release builds set it with
+// -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/robolivable/beaves/version.Version=1.4.0
+//	  -X github.com/robolivable/beaves/version.Commit=$(git rev-parse --short HEAD)
+//	  -X github.com/robolivable/beaves/version.Date=$(date -u +%FT%TZ)"
+//
+// Otherwise the commit and date recorded by the go tool are used, if any.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	Date    string `json:"date,omitempty"`
+	Go      string `json:"go"`
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit: %s, built: %s, %s)", i.Version, or(i.Commit, "unknown"), or(i.Date, "unknown"), i.Go)
+}
+
+func or(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, Go: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range build.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value[:min(len(s.Value), 12)]
+			case s.Key == "vcs.time" && info.Date == "":
+				info.Date = s.Value
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/robolivable/beaves/audit"
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/log"
+	"github.com/robolivable/beaves/supervisor"
+)
+
+// Arbitrate sets up the arbitration policy of every switch and watches the
+// wall switches wired to them.
+func (b *Beaves) Arbitrate(switches []config.Switch) error {
+	b.Arbiters = map[string]*controller.Arbiter{}
+	for name := range b.Switches {
+		b.Arbiters[name], _ = controller.NewArbiter(config.WallSwitch{})
+	}
+	for _, c := range switches {
+		a, err := controller.NewArbiter(c.WallSwitch)
+		if err != nil {
+			return fmt.Errorf("switch %q: %w", c.Name, err)
+		}
+		b.Arbiters[c.Name] = a
+		if c.WallSwitch.Input == "" {
+			continue
+		}
+		newInput := controller.NewButton
+		if c.WallSwitch.Rocker {
+			newInput = controller.NewRocker
+		}
+		input, err := newInput(c.WallSwitch.Input, c.WallSwitch.DebounceMs)
+		if err != nil {
+			return fmt.Errorf("switch %q: %w", c.Name, err)
+		}
+		supervisor.Go("wall switch "+c.Name, func() { input.Run(b.wall(c.Name)) })
+	}
+	return nil
+}
+
+// wall toggles a switch from its wall switch, if the policy allows it.
+func (b *Beaves) wall(name string) func() {
+	return func() {
+		if !b.Arbiters[name].Manual() {
+			log.Info("ignoring wall switch of %s: automation only", name)
+			return
+		}
+		s, ok := b.Switches[name]
+		if !ok {
+			return
+		}
+		state := controller.On
+		if s.State() == controller.On {
+			state = controller.Off
+		}
+		if err := b.Set(name, state, audit.Cause{Kind: "wall switch"}); err != nil {
+			log.Error(err.Error())
+			b.Chirp(controller.ErrorChirp)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// Package wire is the compact binary encoding of presence messages shared
+// between nodes and published over MQTT. Each message is a CBOR (RFC 8949) map
+// keyed by small integers, so fields can be added without breaking older
+// readers, which skip keys they don't know.
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robolivable/beaves/radar"
+)
+
+// Version is bumped only for changes older readers cannot skip over; they
+// refuse messages with a newer version.
+const Version = 1
+
+type Type uint
+
+const (
+	EventMessage    Type = 1 // a radar event
+	PresenceMessage Type = 2 // an actor's presence after an event
+)
+
+func (t Type) String() string {
+	switch t {
+	case EventMessage:
+		return "event"
+	case PresenceMessage:
+		return "presence"
+	}
+	return fmt.Sprintf("type %d", uint(t))
+}
+
+// map keys
+const (
+	keyVersion = 0
+	keyType    = 1
+	keyNode    = 2
+	keyActor   = 3
+	keyName    = 4
+	keyAction  = 5 // events: the radar action
+	keyState   = 5 // presence: the presence state
+	keyEpoch   = 6 // unix milliseconds; last seen for presence
+	keySource  = 7
+	keyRSSI    = 8
+	keyHeading = 9 // direction of travel, when known
+)
+
+type Message struct {
+	Version  uint
+	Type     Type
+	Node     uint16
+	Event    *radar.Event    // set for event messages
+	Presence *radar.Presence // set for presence messages
+}
+
+func (m Message) String() string {
+	return fmt.Sprintf("Message {version: %d, type: %s, node: %d}", m.Version, m.Type, m.Node)
+}
+
+// CBOR major types
+const (
+	cborUint   = 0
+	cborNegint = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+)
+
+func appendHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= 0xFF:
+		return append(b, major|24, byte(n))
+	case n <= 0xFFFF:
+		return append(b, major|25, byte(n>>8), byte(n))
+	case n <= 0xFFFFFFFF:
+		return append(b, major|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, major|27, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendInt(b []byte, n int64) []byte {
+	if n < 0 {
+		return appendHead(b, cborNegint, uint64(-1-n))
+	}
+	return appendHead(b, cborUint, uint64(n))
+}
+
+func appendText(b []byte, s string) []byte {
+	return append(appendHead(b, cborText, uint64(len(s))), s...)
+}
+
+// fields builds a map of the common keys followed by the given ones, leaving
+// out empty strings and zero signal strengths.
+type fields struct {
+	b []byte
+	n int
+}
+
+func (f *fields) int(key uint64, n int64) {
+	f.b = appendInt(appendHead(f.b, cborUint, key), n)
+	f.n++
+}
+
+func (f *fields) text(key uint64, s string) {
+	if s == "" {
+		return
+	}
+	f.b = appendText(appendHead(f.b, cborUint, key), s)
+	f.n++
+}
+
+func (f *fields) encode() []byte {
+	return append(appendHead(nil, cborMap, uint64(f.n)), f.b...)
+}
+
+func header(t Type, node uint16) *fields {
+	f := &fields{}
+	f.int(keyVersion, Version)
+	f.int(keyType, int64(t))
+	f.int(keyNode, int64(node))
+	return f
+}
+
+func EncodeEvent(node uint16, e *radar.Event) []byte {
+	f := header(EventMessage, node)
+	f.text(keyActor, string(e.Actor.ID))
+	f.text(keyName, e.Actor.Name)
+	f.int(keyAction, int64(e.Action))
+	f.int(keyEpoch, e.Epoch.UnixMilli())
+	f.text(keySource, e.Source)
+	if e.RSSI != 0 {
+		f.int(keyRSSI, int64(e.RSSI))
+	}
+	f.text(keyHeading, string(e.Direction))
+	return f.encode()
+}
+
+func EncodePresence(node uint16, p radar.Presence) []byte {
+	f := header(PresenceMessage, node)
+	f.text(keyActor, string(p.Actor))
+	f.text(keyName, p.Name)
+	f.text(keyState, string(p.State))
+	f.int(keyEpoch, p.LastSeen.UnixMilli())
+	f.text(keySource, p.Source)
+	if p.RSSI != 0 {
+		f.int(keyRSSI, int64(p.RSSI))
+	}
+	f.text(keyHeading, string(p.Direction))
+	return f.encode()
+}
+
+var errTruncated = errors.New("wire: truncated message")
+
+type decoder struct {
+	b []byte
+}
+
+func (d *decoder) head() (byte, uint64, error) {
+	if len(d.b) == 0 {
+		return 0, 0, errTruncated
+	}
+	major, info := d.b[0]>>5, d.b[0]&0x1F
+	d.b = d.b[1:]
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, fmt.Errorf("wire: unsupported additional info %d", info)
+	}
+	size := 1 << (info - 24)
+	if len(d.b) < size {
+		return 0, 0, errTruncated
+	}
+	var n uint64
+	for _, c := range d.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	d.b = d.b[size:]
+	return major, n, nil
+}
+
+// value reads an integer or a string; anything else is skipped and returned
+// as nil.
+func (d *decoder) value() (any, error) {
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		return int64(n), nil
+	case cborNegint:
+		return -1 - int64(n), nil
+	case cborBytes, cborText:
+		if uint64(len(d.b)) < n {
+			return nil, errTruncated
+		}
+		s := string(d.b[:n])
+		d.b = d.b[n:]
+		if major == cborBytes {
+			return nil, nil
+		}
+		return s, nil
+	case cborArray, cborMap:
+		if major == cborMap {
+			n *= 2
+		}
+		for range n {
+			if _, err := d.value(); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("wire: unsupported major type %d", major)
+}
+
+// Decode reads a message, ignoring keys it doesn't know.
+func Decode(data []byte) (Message, error) {
+	d := &decoder{b: data}
+	major, n, err := d.head()
+	if err != nil {
+		return Message{}, err
+	}
+	if major != cborMap {
+		return Message{}, errors.New("wire: message is not a map")
+	}
+	values := map[int64]any{}
+	for range n {
+		key, err := d.value()
+		if err != nil {
+			return Message{}, err
+		}
+		value, err := d.value()
+		if err != nil {
+			return Message{}, err
+		}
+		if k, ok := key.(int64); ok {
+			values[k] = value
+		}
+	}
+	integer := func(key int64) int64 { n, _ := values[key].(int64); return n }
+	text := func(key int64) string { s, _ := values[key].(string); return s }
+
+	m := Message{Version: uint(integer(keyVersion)), Type: Type(integer(keyType)), Node: uint16(integer(keyNode))}
+	if m.Version == 0 || m.Version > Version {
+		return m, fmt.Errorf("wire: unsupported version %d", m.Version)
+	}
+	epoch := time.UnixMilli(integer(keyEpoch))
+	switch m.Type {
+	case EventMessage:
+		m.Event = &radar.Event{
+			Actor:  &radar.Actor{ID: radar.ID(text(keyActor)), Name: text(keyName)},
+			Action: radar.Action(integer(keyAction)),
+			Epoch:  epoch,
+			Source: text(keySource),
+			RSSI:   int16(integer(keyRSSI)),
+
+			Direction: radar.Direction(text(keyHeading)),
+		}
+	case PresenceMessage:
+		m.Presence = &radar.Presence{
+			Actor:    radar.ID(text(keyActor)),
+			Name:     text(keyName),
+			State:    radar.PresenceState(text(keyState)),
+			LastSeen: epoch,
+			Source:   text(keySource),
+			RSSI:     int16(integer(keyRSSI)),
+
+			Direction: radar.Direction(text(keyHeading)),
+		}
+	default:
+		return m, fmt.Errorf("wire: unknown message %s", m.Type)
+	}
+	return m, nil
+}
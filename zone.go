@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robolivable/beaves/config"
+	"github.com/robolivable/beaves/controller"
+	"github.com/robolivable/beaves/radar"
+)
+
+// MainZone names the zone configured at the top level.
+const MainZone = "main"
+
+// Zone is a presence pipeline of its own: the sentries watching a door, the
+// switch they drive and the rules deciding when.
+type Zone struct {
+	Name      string
+	Proximity radar.Proximity // nil without a radar
+	Presence  *radar.PresenceTable
+	Actuator  *controller.Actuator // of the managed switch; nil without a controller
+	Trend     *radar.Trend         // signal strength at its sentry; nil unless watched
+	Switch    config.Switch        // managed switch configuration
+	Actions   map[string]config.ActorActions
+	Conflict  radar.Conflict // which event of a batch is acted on
+	Delay     time.Duration  // minimum time to wait between operations
+	NodeID    uint16         // of its sentry, for passage
+
+	lock sync.Mutex // guards last
+	last time.Time
+}
+
+// Last is when the zone's switch was last operated.
+func (z *Zone) Last() time.Time {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	return z.last
+}
+
+func (z *Zone) String() string {
+	return fmt.Sprintf("Zone {name: %s}", z.Name)
+}
+
+// status is what the zone's sentry advertises.
+func (z *Zone) status() radar.Status {
+	return radar.Status{RelayOn: z.Actuator != nil && z.Actuator.State() == controller.On, Occupancy: z.Presence.Occupancy()}
+}
+
+// NewZones makes the main zone, sharing presence, and one for each configured
+// zone. Their sentries and actuators are set up by the radar and controller.
+func NewZones(presence *radar.PresenceTable) ([]*Zone, error) {
+	conflict, err := radar.ParseConflict(config.RuntimeConfig.Actors.Conflict)
+	if err != nil {
+		return nil, err
+	}
+	zones := []*Zone{{
+		Name:     MainZone,
+		Presence: presence,
+		Actions:  config.RuntimeConfig.Actors.Actions,
+		Conflict: conflict,
+		Delay:    time.Duration(config.RuntimeConfig.OperationDelayMs) * time.Millisecond,
+		NodeID:   config.RuntimeConfig.Bluetooth.NodeID,
+	}}
+	names := map[string]bool{MainZone: true}
+	for _, c := range config.RuntimeConfig.Zones {
+		if c.Name == "" || names[c.Name] {
+			return nil, fmt.Errorf("zone %q must have a name of its own", c.Name)
+		}
+		names[c.Name] = true
+		if c.ManagedSwitch == "" {
+			return nil, fmt.Errorf("zone %q has no managed switch", c.Name)
+		}
+		conflict, err := radar.ParseConflict(c.Conflict)
+		if err != nil {
+			return nil, fmt.Errorf("zone %q: %w", c.Name, err)
+		}
+		zones = append(zones, &Zone{
+			Name:     c.Name,
+			Presence: radar.NewPresenceTable(),
+			Actions:  c.Actions,
+			Conflict: conflict,
+			Delay:    time.Duration(c.OperationDelayMs) * time.Millisecond,
+			NodeID:   c.Bluetooth.NodeID,
+		})
+	}
+	return zones, nil
+}
+
+const DefaultDistanceBoundWindowMs = 3000
+
+// atDoor refuses a press for actor unless its signal at the zone's sentry,
+// averaged over the distance bound's window, is strong enough right now.
+// Presses not made for an actor aren't bound.
+func (z *Zone) atDoor(actor radar.ID) error {
+	bound := z.Switch.DistanceBound
+	if bound.MinRSSI == 0 || actor == "" {
+		return nil
+	}
+	window := time.Duration(DefaultDistanceBoundWindowMs) * time.Millisecond
+	if bound.WindowMs > 0 {
+		window = time.Duration(bound.WindowMs) * time.Millisecond
+	}
+	name := radar.FriendlyName(actor)
+	rssi, ok := z.Trend.Average(actor, time.Now(), window)
+	if !ok {
+		return fmt.Errorf("no recent signal of %s to bound its distance", name)
+	}
+	if rssi < float64(bound.MinRSSI) {
+		return fmt.Errorf("%s is not at the door (%.0f dBm, needs %d)", name, rssi, bound.MinRSSI)
+	}
+	return nil
+}
+
+// sentryConfig is the Bluetooth configuration of a zone's sentry, with the
+// adapter it runs on.
+type sentryConfig struct {
+	Zone    string
+	Adapter string
+	config.Bluetooth
+}
+
+// sentryConfigs lists the sentry of every zone, the main one first, each
+// adapter once.
+func sentryConfigs() []sentryConfig {
+	sentries := []sentryConfig{{Zone: MainZone, Bluetooth: config.RuntimeConfig.Bluetooth}}
+	for _, c := range config.RuntimeConfig.Zones {
+		sentries = append(sentries, sentryConfig{Zone: c.Name, Bluetooth: c.Bluetooth})
+	}
+	seen := map[string]bool{}
+	adapters := []sentryConfig{}
+	for _, s := range sentries {
+		s.Adapter = s.Bluetooth.Adapter
+		if s.Adapter == "" {
+			s.Adapter = radar.DefaultAdapterID
+		}
+		if !seen[s.Adapter] {
+			seen[s.Adapter] = true
+			adapters = append(adapters, s)
+		}
+	}
+	return adapters
+}
+
+// zoneConfig returns the configuration of a zone other than the main one.
+func zoneConfig(name string) config.Zone {
+	for _, c := range config.RuntimeConfig.Zones {
+		if c.Name == name {
+			return c
+		}
+	}
+	return config.Zone{}
+}
+
+// presence returns the presence of a zone by name, of the main zone for "".
+func (b *Beaves) presence(zone string) (*radar.PresenceTable, error) {
+	if zone == "" || zone == MainZone {
+		return b.Presence, nil
+	}
+	for _, z := range b.Zones {
+		if z.Name == zone {
+			return z.Presence, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown zone %q", zone)
+}
+
+// zonePresence maps every zone's name to its presence.
+func (b *Beaves) zonePresence() map[string]*radar.PresenceTable {
+	tables := map[string]*radar.PresenceTable{MainZone: b.Presence}
+	for _, z := range b.Zones {
+		tables[z.Name] = z.Presence
+	}
+	return tables
+}
+
+// managing returns the zone whose managed switch is name.
+func (b *Beaves) managing(name string) (*Zone, bool) {
+	for _, z := range b.Zones {
+		if z.Actuator != nil && z.Actuator.Name() == name {
+			return z, true
+		}
+	}
+	return nil, false
+}